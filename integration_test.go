@@ -3,13 +3,19 @@ package main
 import (
 	"bufio"
 	"context"
+	"crypto/tls"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"io"
+	"net"
 	"net/http"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"regexp"
+	"runtime"
+	"strconv"
 	"strings"
 	"testing"
 	"time"
@@ -98,7 +104,7 @@ func buildBinary(t *testing.T) string {
 	return binPath
 }
 
-var listenRe = regexp.MustCompile(`Listening on http://(\S+)`)
+var listenRe = regexp.MustCompile(`Listening on (https?://\S+)`)
 
 // startBinary starts the ghdiff binary and waits for it to be ready.
 // Returns the base URL and a cancel function. The process is killed when cancel is called.
@@ -130,7 +136,7 @@ func startBinary(t *testing.T, binPath, dir string, args ...string) (string, con
 		for scanner.Scan() {
 			line := scanner.Text()
 			if m := listenRe.FindStringSubmatch(line); m != nil {
-				urlCh <- "http://" + m[1]
+				urlCh <- m[1]
 				return
 			}
 		}
@@ -158,7 +164,9 @@ func startBinaryStdin(t *testing.T, binPath, diffData string, extraArgs ...strin
 
 	ctx, cancel := context.WithCancel(context.Background())
 
-	args := append([]string{"--no-open", "--port", "0", "-"}, extraArgs...)
+	// Flags must come before "-", where flag parsing stops.
+	args := append([]string{"--no-open", "--port", "0"}, extraArgs...)
+	args = append(args, "-")
 	cmd := exec.CommandContext(ctx, binPath, args...)
 
 	stdin, err := cmd.StdinPipe()
@@ -191,7 +199,7 @@ func startBinaryStdin(t *testing.T, binPath, diffData string, extraArgs ...strin
 		for scanner.Scan() {
 			line := scanner.Text()
 			if m := listenRe.FindStringSubmatch(line); m != nil {
-				urlCh <- "http://" + m[1]
+				urlCh <- m[1]
 				return
 			}
 		}
@@ -321,8 +329,9 @@ func TestIntegrationGitMode(t *testing.T) {
 		if err := json.NewDecoder(resp.Body).Decode(&commits); err != nil {
 			t.Fatalf("decode: %v", err)
 		}
-		if len(commits) != 2 {
-			t.Fatalf("expected 2 commits, got %d", len(commits))
+		// Only the commits in HEAD~1..HEAD, the range being compared.
+		if len(commits) != 1 {
+			t.Fatalf("expected 1 commit, got %d", len(commits))
 		}
 		if commits[0].Message != "add goodbye" {
 			t.Errorf("expected first commit 'add goodbye', got %q", commits[0].Message)
@@ -427,6 +436,109 @@ index 1234567..abcdef0 100644
 	})
 }
 
+func TestIntegrationStripCR(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping integration test in short mode")
+	}
+
+	binPath := buildBinary(t)
+
+	diffData := "diff --git a/x.txt b/x.txt\r\n--- a/x.txt\r\n+++ b/x.txt\r\n@@ -1 +1 @@\r\n-a\r\n+b\r\n"
+
+	for _, tt := range []struct {
+		args []string
+		want string
+	}{
+		{nil, "b"},
+		{[]string{"--strip-cr=false"}, "b\r"},
+	} {
+		baseURL, cleanup := startBinaryStdin(t, binPath, diffData, tt.args...)
+		token := extractToken(t, baseURL)
+
+		resp, err := authGet(baseURL+"/api/diff", token)
+		if err != nil {
+			cleanup()
+			t.Fatalf("GET /api/diff: %v", err)
+		}
+		var result diff.Result
+		err = json.NewDecoder(resp.Body).Decode(&result)
+		resp.Body.Close()
+		cleanup()
+		if err != nil {
+			t.Fatalf("decode: %v", err)
+		}
+
+		if len(result.Files) != 1 || len(result.Files[0].Hunks) != 1 || len(result.Files[0].Hunks[0].Lines) != 2 {
+			t.Fatalf("%v: expected one file with one two-line hunk, got %+v", tt.args, result.Files)
+		}
+		if got := result.Files[0].Hunks[0].Lines[1].Content; got != tt.want {
+			t.Errorf("%v: expected added line %q, got %q", tt.args, tt.want, got)
+		}
+	}
+
+	// In an LF diff, a carriage return is content: with the default flags,
+	// a change of line ending alone is still flagged as one.
+	eolData := "diff --git a/x.txt b/x.txt\n--- a/x.txt\n+++ b/x.txt\n@@ -1 +1 @@\n-a\r\n+a\n"
+	baseURL, cleanup := startBinaryStdin(t, binPath, eolData)
+	defer cleanup()
+	resp, err := authGet(baseURL+"/api/diff", extractToken(t, baseURL))
+	if err != nil {
+		t.Fatalf("GET /api/diff: %v", err)
+	}
+	defer resp.Body.Close()
+	var result diff.Result
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if len(result.Files) != 1 || !result.Files[0].EOLOnly {
+		t.Errorf("expected one file flagged as a line ending change, got %+v", result.Files)
+	}
+}
+
+func TestIntegrationSessionRefs(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping integration test in short mode")
+	}
+
+	binPath := buildBinary(t)
+	dir := initTestRepo(t)
+	commitFile(t, dir, "a.txt", "one\n", "first commit")
+	commitFile(t, dir, "a.txt", "two\n", "second commit")
+	commitFile(t, dir, "a.txt", "three\n", "third commit")
+
+	session := filepath.Join(t.TempDir(), "session.json")
+	if err := os.WriteFile(session, []byte(`{"base":"HEAD~2","target":"HEAD~1"}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tt := range []struct {
+		args []string
+		want string
+	}{
+		// Refs on the command line win over the saved ones...
+		{[]string{"HEAD~1", "HEAD"}, "HEAD~1..HEAD"},
+		// ...which are resumed when none are given.
+		{nil, "HEAD~2..HEAD~1"},
+	} {
+		baseURL, cleanup := startBinary(t, binPath, dir, append([]string{"--session", session}, tt.args...)...)
+		resp, err := authGet(baseURL+"/api/range", extractToken(t, baseURL))
+		if err != nil {
+			cleanup()
+			t.Fatalf("GET /api/range: %v", err)
+		}
+		var rng struct{ Base, Target string }
+		err = json.NewDecoder(resp.Body).Decode(&rng)
+		resp.Body.Close()
+		cleanup()
+		if err != nil {
+			t.Fatalf("decode: %v", err)
+		}
+		if got := rng.Base + ".." + rng.Target; got != tt.want {
+			t.Errorf("%v: expected range %s, got %s", tt.args, tt.want, got)
+		}
+	}
+}
+
 func TestIntegrationDiffWithBaseQuery(t *testing.T) {
 	if testing.Short() {
 		t.Skip("skipping integration test in short mode")
@@ -690,3 +802,577 @@ func TestIntegration404(t *testing.T) {
 		t.Errorf("expected status 404 for nonexistent path, got %d", resp.StatusCode)
 	}
 }
+
+func TestIntegrationReadyOnListen(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping integration test in short mode")
+	}
+
+	binPath := buildBinary(t)
+	dir := initTestRepo(t)
+	commitFile(t, dir, "a.txt", "alpha\n", "initial")
+	commitFile(t, dir, "a.txt", "alpha\nbeta\n", "add beta")
+
+	// Startup races are intermittent, so try a few times.
+	for i := range 3 {
+		baseURL, cleanup := startBinary(t, binPath, dir, "HEAD~1", "HEAD")
+
+		token := extractToken(t, baseURL)
+		resp, err := authGet(baseURL+"/api/diff", token)
+		if err != nil {
+			cleanup()
+			t.Fatalf("run %d: GET /api/diff: %v", i, err)
+		}
+		resp.Body.Close()
+		cleanup()
+
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("run %d: expected 200 from first /api/diff, got %d", i, resp.StatusCode)
+		}
+	}
+}
+
+func TestIntegrationQuiet(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping integration test in short mode")
+	}
+	if runtime.GOOS == "windows" {
+		t.Skip("interrupting a process is not supported on Windows")
+	}
+
+	binPath := buildBinary(t)
+	dir := initTestRepo(t)
+	commitFile(t, dir, "a.txt", "alpha\n", "initial")
+	commitFile(t, dir, "a.txt", "alpha\nbeta\n", "add beta")
+
+	cmd := exec.Command(binPath, "--no-open", "--quiet", "--port", "0", "HEAD~1", "HEAD")
+	cmd.Dir = dir
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		t.Fatalf("stdout pipe: %v", err)
+	}
+	if err := cmd.Start(); err != nil {
+		t.Fatalf("start binary: %v", err)
+	}
+
+	// Read the URL line, then stop the server and collect the rest.
+	reader := bufio.NewReader(stdout)
+	first, err := reader.ReadString('\n')
+	if err != nil {
+		_ = cmd.Process.Kill()
+		t.Fatalf("reading first line: %v", err)
+	}
+	if err := cmd.Process.Signal(os.Interrupt); err != nil {
+		t.Fatalf("interrupt: %v", err)
+	}
+	rest, _ := io.ReadAll(reader)
+	_ = cmd.Wait()
+
+	if !listenRe.MatchString(first) {
+		t.Errorf("expected first line to be the URL, got %q", first)
+	}
+	if len(rest) != 0 {
+		t.Errorf("expected no further output with --quiet, got %q", rest)
+	}
+}
+
+func TestIntegrationPrintURL(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping integration test in short mode")
+	}
+	if runtime.GOOS == "windows" {
+		t.Skip("interrupting a process is not supported on Windows")
+	}
+
+	binPath := buildBinary(t)
+	dir := initTestRepo(t)
+	commitFile(t, dir, "a.txt", "alpha\n", "initial")
+	commitFile(t, dir, "a.txt", "alpha\nbeta\n", "add beta")
+
+	cmd := exec.Command(binPath, "--print-url", "--port", "0", "HEAD~1", "HEAD")
+	cmd.Dir = dir
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		t.Fatalf("stdout pipe: %v", err)
+	}
+	if err := cmd.Start(); err != nil {
+		t.Fatalf("start binary: %v", err)
+	}
+
+	reader := bufio.NewReader(stdout)
+	first, err := reader.ReadString('\n')
+	if err != nil {
+		_ = cmd.Process.Kill()
+		t.Fatalf("reading first line: %v", err)
+	}
+	baseURL := strings.TrimSuffix(first, "\n")
+	if !regexp.MustCompile(`^http://localhost:\d+$`).MatchString(baseURL) {
+		t.Errorf("expected the first line to be only the URL, got %q", first)
+	}
+
+	// The server keeps serving after printing the URL.
+	token := extractToken(t, baseURL)
+	resp, err := authGet(baseURL+"/api/diff", token)
+	if err != nil {
+		t.Errorf("GET /api/diff: %v", err)
+	} else {
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Errorf("expected status 200 from /api/diff, got %d", resp.StatusCode)
+		}
+	}
+
+	if err := cmd.Process.Signal(os.Interrupt); err != nil {
+		t.Fatalf("interrupt: %v", err)
+	}
+	rest, _ := io.ReadAll(reader)
+	_ = cmd.Wait()
+	if len(rest) != 0 {
+		t.Errorf("expected no further output with --print-url, got %q", rest)
+	}
+}
+
+func TestIntegrationGracefulShutdown(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping integration test in short mode")
+	}
+	if runtime.GOOS == "windows" {
+		t.Skip("interrupting a process is not supported on Windows")
+	}
+
+	binPath := buildBinary(t)
+	dir := initTestRepo(t)
+	commitFile(t, dir, "a.txt", "alpha\n", "initial")
+	commitFile(t, dir, "a.txt", "alpha\nbeta\n", "add beta")
+
+	// A git whose diffs take a while keeps /api/diff in flight.
+	realGit, err := exec.LookPath("git")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fakeDir := t.TempDir()
+	script := "#!/bin/sh\nif [ \"$1\" = diff ]; then sleep 2; fi\nexec " + realGit + " \"$@\"\n"
+	if err := os.WriteFile(filepath.Join(fakeDir, "git"), []byte(script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", fakeDir+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	cmd := exec.Command(binPath, "--no-open", "--port", "0", "HEAD~1", "HEAD")
+	cmd.Dir = dir
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		t.Fatalf("stdout pipe: %v", err)
+	}
+	if err := cmd.Start(); err != nil {
+		t.Fatalf("start binary: %v", err)
+	}
+	defer func() { _ = cmd.Process.Kill() }()
+	first, err := bufio.NewReader(stdout).ReadString('\n')
+	m := listenRe.FindStringSubmatch(first)
+	if err != nil || m == nil {
+		t.Fatalf("expected the URL line, got %q (%v)", first, err)
+	}
+	token := extractToken(t, m[1])
+
+	type response struct {
+		status int
+		result diff.Result
+		err    error
+	}
+	done := make(chan response, 1)
+	go func() {
+		resp, err := authGet(m[1]+"/api/diff", token)
+		if err != nil {
+			done <- response{err: err}
+			return
+		}
+		defer resp.Body.Close()
+		r := response{status: resp.StatusCode}
+		r.err = json.NewDecoder(resp.Body).Decode(&r.result)
+		done <- r
+	}()
+
+	// Interrupt while git is still diffing.
+	time.Sleep(500 * time.Millisecond)
+	if err := cmd.Process.Signal(os.Interrupt); err != nil {
+		t.Fatalf("interrupt: %v", err)
+	}
+
+	r := <-done
+	if r.err != nil {
+		t.Fatalf("expected the in-flight /api/diff to complete, got %v", r.err)
+	}
+	if r.status != http.StatusOK || len(r.result.Files) != 1 {
+		t.Errorf("expected status 200 with a.txt, got %d with %+v", r.status, r.result.Files)
+	}
+	if err := cmd.Wait(); err != nil {
+		t.Errorf("expected a clean exit after shutdown, got %v", err)
+	}
+}
+
+func TestIntegrationExitCodes(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping integration test in short mode")
+	}
+
+	binPath := buildBinary(t)
+
+	// A repo without main or master can't resolve the default merge-base.
+	noMain := initTestRepo(t)
+	commitFile(t, noMain, "a.txt", "alpha\n", "initial")
+	cmd := exec.Command("git", "branch", "-M", "develop")
+	cmd.Dir = noMain
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("git branch -M: %v\n%s", err, out)
+	}
+
+	outside := t.TempDir()
+
+	tests := []struct {
+		name string
+		dir  string
+		args []string
+		code int
+	}{
+		{"invalid flag", outside, []string{"--no-such-flag"}, 2},
+		{"too many args", outside, []string{"a", "b", "c"}, 2},
+		{"outside a repo", outside, nil, 3},
+		{"git failure", noMain, nil, 4},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cmd := exec.Command(binPath, append([]string{"--no-open"}, tt.args...)...)
+			cmd.Dir = tt.dir
+			cmd.Env = append(os.Environ(), "GIT_CEILING_DIRECTORIES="+filepath.Dir(outside))
+			err := cmd.Run()
+			var exitErr *exec.ExitError
+			if !errors.As(err, &exitErr) {
+				t.Fatalf("expected exit error, got %v", err)
+			}
+			if got := exitErr.ExitCode(); got != tt.code {
+				t.Errorf("expected exit code %d, got %d", tt.code, got)
+			}
+		})
+	}
+}
+
+func TestIntegrationPortInUse(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping integration test in short mode")
+	}
+
+	binPath := buildBinary(t)
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	defer ln.Close()
+	port := ln.Addr().(*net.TCPAddr).Port
+
+	cmd := exec.Command(binPath, "--no-open", "--host", "127.0.0.1", "--port", strconv.Itoa(port), "--bind-timeout", "0", "-")
+	cmd.Stdin = strings.NewReader("")
+	out, err := cmd.CombinedOutput()
+	var exitErr *exec.ExitError
+	if !errors.As(err, &exitErr) {
+		t.Fatalf("expected exit error, got %v\n%s", err, out)
+	}
+	want := fmt.Sprintf("port %d is already in use on 127.0.0.1; use --port 0 to pick a free port", port)
+	if !strings.Contains(string(out), want) {
+		t.Errorf("expected error containing %q, got:\n%s", want, out)
+	}
+}
+
+func TestIntegrationRebaseMode(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping integration test in short mode")
+	}
+
+	binPath := buildBinary(t)
+	dir := initTestRepo(t)
+	commitFile(t, dir, "a.txt", "alpha\n", "initial")
+
+	// Simulate git am stopping on a mailbox patch.
+	patch := `From 1234567890abcdef Mon Sep 17 00:00:00 2001
+From: Test User <test@example.com>
+Subject: [PATCH] change alpha
+
+---
+ a.txt | 2 +-
+ 1 file changed, 1 insertion(+), 1 deletion(-)
+
+diff --git a/a.txt b/a.txt
+index 1234567..abcdef0 100644
+--- a/a.txt
++++ b/a.txt
+@@ -1 +1 @@
+-alpha
++gamma
+`
+	applyDir := filepath.Join(dir, ".git", "rebase-apply")
+	if err := os.MkdirAll(applyDir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(applyDir, "patch"), []byte(patch), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	baseURL, cleanup := startBinary(t, binPath, dir, "--rebase")
+	defer cleanup()
+
+	token := extractToken(t, baseURL)
+	resp, err := authGet(baseURL+"/api/diff", token)
+	if err != nil {
+		t.Fatalf("GET /api/diff: %v", err)
+	}
+	defer resp.Body.Close()
+
+	var result diff.Result
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if len(result.Files) != 1 || result.Files[0].NewName != "a.txt" {
+		t.Fatalf("expected the patch's a.txt change, got %+v", result.Files)
+	}
+	if result.Files[0].Additions != 1 || result.Files[0].Deletions != 1 {
+		t.Errorf("expected +1 -1, got +%d -%d", result.Files[0].Additions, result.Files[0].Deletions)
+	}
+}
+
+func TestIntegrationCommitsFile(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping integration test in short mode")
+	}
+
+	binPath := buildBinary(t)
+	dir := initTestRepo(t)
+	first := commitFile(t, dir, "a.txt", "alpha\n", "initial")
+	second := commitFile(t, dir, "b.txt", "beta\n", "add b")
+	commitFile(t, dir, "c.txt", "gamma\n", "add c")
+
+	listPath := filepath.Join(t.TempDir(), "commits.txt")
+	list := first + " " + second + "\n" + second + " HEAD\n"
+	if err := os.WriteFile(listPath, []byte(list), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	baseURL, cleanup := startBinary(t, binPath, dir, "--commits-file", listPath)
+	defer cleanup()
+	token := extractToken(t, baseURL)
+
+	for id, want := range []string{"b.txt", "c.txt"} {
+		resp, err := authGet(baseURL+"/api/diff?id="+strconv.Itoa(id), token)
+		if err != nil {
+			t.Fatalf("GET /api/diff?id=%d: %v", id, err)
+		}
+		var result diff.Result
+		err = json.NewDecoder(resp.Body).Decode(&result)
+		resp.Body.Close()
+		if err != nil {
+			t.Fatalf("decode: %v", err)
+		}
+		if len(result.Files) != 1 || result.Files[0].NewName != want {
+			t.Errorf("id %d: expected only %s, got %+v", id, want, result.Files)
+		}
+	}
+
+	resp, err := authGet(baseURL+"/api/diff?id=2", token)
+	if err != nil {
+		t.Fatalf("GET /api/diff?id=2: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("expected 400 for unknown id, got %d", resp.StatusCode)
+	}
+}
+
+func TestIntegrationDirs(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping integration test in short mode")
+	}
+
+	binPath := buildBinary(t)
+	dir := t.TempDir()
+	files := map[string]string{
+		"a/same.txt":    "unchanged\n",
+		"b/same.txt":    "unchanged\n",
+		"a/sub/cfg.txt": "alpha\n",
+		"b/sub/cfg.txt": "beta\n",
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	baseURL, cleanup := startBinary(t, binPath, dir, "--dirs", "./a", "./b")
+	defer cleanup()
+
+	token := extractToken(t, baseURL)
+	resp, err := authGet(baseURL+"/api/diff", token)
+	if err != nil {
+		t.Fatalf("GET /api/diff: %v", err)
+	}
+	defer resp.Body.Close()
+
+	var result diff.Result
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if len(result.Files) != 1 {
+		t.Fatalf("expected 1 changed file, got %+v", result.Files)
+	}
+	f := result.Files[0]
+	if f.OldName != "sub/cfg.txt" || f.NewName != "sub/cfg.txt" || f.Status != "modified" {
+		t.Errorf("expected modified sub/cfg.txt relative to both dirs, got %q -> %q (%s)", f.OldName, f.NewName, f.Status)
+	}
+}
+
+func TestIntegrationMbox(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping integration test in short mode")
+	}
+
+	binPath := buildBinary(t)
+	dir := initTestRepo(t)
+	commitFile(t, dir, "a.txt", "one\n", "initial commit")
+	commitFile(t, dir, "a.txt", "two\n", "change a")
+	commitFile(t, dir, "b.txt", "hello\n", "add b")
+	series := filepath.Join(t.TempDir(), "series")
+	cmd := exec.Command("git", "format-patch", "-q", "-o", series, "HEAD~2")
+	cmd.Dir = dir
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("git format-patch: %v\n%s", err, out)
+	}
+
+	// The patches are read without a repository.
+	baseURL, cleanup := startBinary(t, binPath, t.TempDir(), "--mbox", series)
+	defer cleanup()
+
+	token := extractToken(t, baseURL)
+	resp, err := authGet(baseURL+"/api/history", token)
+	if err != nil {
+		t.Fatalf("GET /api/history: %v", err)
+	}
+	defer resp.Body.Close()
+
+	var log diff.Log
+	if err := json.NewDecoder(resp.Body).Decode(&log); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if len(log.Commits) != 2 || log.Commits[0].Subject != "change a" || log.Commits[1].Subject != "add b" {
+		t.Fatalf("expected the two patches in order, got %+v", log.Commits)
+	}
+	if files := log.Commits[1].Files; len(files) != 1 || files[0].NewName != "b.txt" || files[0].Status != "added" {
+		t.Errorf("expected b.txt added by the second patch, got %+v", files)
+	}
+}
+
+func TestIntegrationTLS(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping integration test in short mode")
+	}
+
+	binPath := buildBinary(t)
+	dir := initTestRepo(t)
+	commitFile(t, dir, "hello.txt", "hello\n", "initial commit")
+	commitFile(t, dir, "hello.txt", "hello\nworld\n", "add world")
+
+	baseURL, cleanup := startBinary(t, binPath, dir, "--tls", "HEAD~1", "HEAD")
+	defer cleanup()
+
+	if !strings.HasPrefix(baseURL, "https://") {
+		t.Fatalf("expected an https:// URL, got %s", baseURL)
+	}
+
+	// The certificate is self-signed.
+	client := &http.Client{Transport: &http.Transport{
+		TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+	}}
+
+	resp, err := client.Get(baseURL + "/")
+	if err != nil {
+		t.Fatalf("GET /: %v", err)
+	}
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		t.Fatalf("read body: %v", err)
+	}
+	if resp.TLS == nil {
+		t.Fatal("expected a TLS connection")
+	}
+	m := tokenRe.FindSubmatch(body)
+	if m == nil {
+		t.Fatalf("could not extract token from index.html:\n%s", body)
+	}
+
+	req, err := http.NewRequest("GET", baseURL+"/api/diff", http.NoBody)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("X-Auth-Token", string(m[1]))
+	resp, err = client.Do(req)
+	if err != nil {
+		t.Fatalf("GET /api/diff: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected 200, got %d", resp.StatusCode)
+	}
+	var result diff.Result
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if len(result.Files) != 1 || result.Files[0].NewName != "hello.txt" {
+		t.Errorf("expected the hello.txt change, got %+v", result.Files)
+	}
+}
+
+func TestIntegrationStash(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping integration test in short mode")
+	}
+
+	binPath := buildBinary(t)
+	dir := initTestRepo(t)
+	commitFile(t, dir, "tracked.txt", "before\n", "initial commit")
+	if err := os.WriteFile(filepath.Join(dir, "tracked.txt"), []byte("after\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "new.txt"), []byte("untracked\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	cmd := exec.Command("git", "stash", "push", "--include-untracked")
+	cmd.Dir = dir
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("git stash: %v\n%s", err, out)
+	}
+
+	baseURL, cleanup := startBinary(t, binPath, dir, "--stash")
+	defer cleanup()
+
+	token := extractToken(t, baseURL)
+	resp, err := authGet(baseURL+"/api/diff", token)
+	if err != nil {
+		t.Fatalf("GET /api/diff: %v", err)
+	}
+	defer resp.Body.Close()
+
+	var result diff.Result
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	origins := make(map[string]string)
+	for _, f := range result.Files {
+		origins[f.Path()] = f.Origin
+	}
+	if len(origins) != 2 || origins["tracked.txt"] != "tracked" || origins["new.txt"] != "untracked" {
+		t.Errorf("expected tracked.txt tracked and new.txt untracked, got %v", origins)
+	}
+}
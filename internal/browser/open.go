@@ -3,12 +3,22 @@ package browser
 
 import (
 	"fmt"
+	"os"
 	"os/exec"
 	"runtime"
+	"strings"
 )
 
-// Open opens the given URL in the default browser.
+// Open opens the given URL in the browser. The commands listed in the
+// BROWSER environment variable are tried first, then the platform's
+// default browser.
 func Open(url string) error {
+	for _, args := range browserCommands(os.Getenv("BROWSER"), url) {
+		if start(exec.Command(args[0], args[1:]...)) == nil {
+			return nil
+		}
+	}
+
 	var cmd *exec.Cmd
 	switch runtime.GOOS {
 	case "linux":
@@ -20,9 +30,71 @@ func Open(url string) error {
 	default:
 		return fmt.Errorf("unsupported platform: %s", runtime.GOOS)
 	}
+	return start(cmd)
+}
+
+// start starts cmd without waiting for it to exit.
+func start(cmd *exec.Cmd) error {
 	if err := cmd.Start(); err != nil {
 		return err
 	}
 	go func() { _ = cmd.Wait() }() // reap zombie process
 	return nil
 }
+
+// browserCommands parses the value of BROWSER, a list of commands separated
+// by colons as read by Python's webbrowser module, into the arguments to run
+// for url. A %s in a command is replaced by the URL, and %% by a percent
+// sign; commands without %s get the URL as their last argument.
+func browserCommands(env, url string) [][]string {
+	var cmds [][]string
+	for _, command := range strings.Split(env, string(os.PathListSeparator)) {
+		args := strings.Fields(command)
+		if len(args) == 0 {
+			continue
+		}
+		substituted := false
+		for i, arg := range args {
+			if strings.Contains(arg, "%s") {
+				substituted = true
+			}
+			args[i] = strings.NewReplacer("%s", url, "%%", "%").Replace(arg)
+		}
+		if !substituted {
+			args = append(args, url)
+		}
+		cmds = append(cmds, args)
+	}
+	return cmds
+}
+
+// Available reports whether Open can be expected to work: the launcher is
+// on PATH and, on Linux, there is a display to open a browser on. It is
+// false on headless machines, such as servers reached over SSH, unless
+// BROWSER names a browser to use.
+func Available() bool {
+	return available(runtime.GOOS, exec.LookPath, os.Getenv)
+}
+
+// available implements Available with the platform, PATH lookup and
+// environment passed in, for testing.
+func available(goos string, lookPath func(string) (string, error), getenv func(string) string) bool {
+	if getenv("BROWSER") != "" {
+		return true
+	}
+	switch goos {
+	case "linux":
+		if getenv("DISPLAY") == "" && getenv("WAYLAND_DISPLAY") == "" {
+			return false
+		}
+		_, err := lookPath("xdg-open")
+		return err == nil
+	case "darwin":
+		_, err := lookPath("open")
+		return err == nil
+	case "windows":
+		return true
+	default:
+		return false
+	}
+}
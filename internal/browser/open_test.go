@@ -0,0 +1,97 @@
+package browser
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+)
+
+func TestAvailable(t *testing.T) {
+	tests := []struct {
+		name   string
+		goos   string
+		onPath []string
+		env    map[string]string
+		want   bool
+	}{
+		{"linux with X11", "linux", []string{"xdg-open"}, map[string]string{"DISPLAY": ":0"}, true},
+		{"linux with Wayland", "linux", []string{"xdg-open"}, map[string]string{"WAYLAND_DISPLAY": "wayland-0"}, true},
+		{"linux headless", "linux", []string{"xdg-open"}, nil, false},
+		{"linux without xdg-open", "linux", nil, map[string]string{"DISPLAY": ":0"}, false},
+		{"linux headless with BROWSER", "linux", nil, map[string]string{"BROWSER": "w3m"}, true},
+		{"darwin", "darwin", []string{"open"}, nil, true},
+		{"darwin without open", "darwin", nil, nil, false},
+		{"windows", "windows", nil, nil, true},
+		{"unsupported platform", "plan9", []string{"xdg-open"}, map[string]string{"DISPLAY": ":0"}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lookPath := func(file string) (string, error) {
+				for _, p := range tt.onPath {
+					if p == file {
+						return "/usr/bin/" + file, nil
+					}
+				}
+				return "", errors.New("not found")
+			}
+			getenv := func(key string) string { return tt.env[key] }
+			if got := available(tt.goos, lookPath, getenv); got != tt.want {
+				t.Errorf("available() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBrowserCommands(t *testing.T) {
+	url := "http://localhost:8080/"
+	got := browserCommands("::firefox --new-tab:chrome --app=%s:echo 100%%", url)
+	want := [][]string{
+		{"firefox", "--new-tab", url},
+		{"chrome", "--app=" + url},
+		{"echo", "100%", url},
+	}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("browserCommands() = %q, want %q", got, want)
+	}
+	if got := browserCommands("", url); len(got) != 0 {
+		t.Errorf("browserCommands(\"\") = %q, want none", got)
+	}
+}
+
+func TestOpen_Browser(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("fake browser is a shell script")
+	}
+	dir := t.TempDir()
+	out := filepath.Join(dir, "opened")
+	fake := filepath.Join(dir, "fake-browser")
+	script := "#!/bin/sh\necho \"$@\" > " + out + ".tmp && mv " + out + ".tmp " + out + "\n"
+	if err := os.WriteFile(fake, []byte(script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	// The missing browser is skipped.
+	t.Setenv("BROWSER", filepath.Join(dir, "missing")+":"+fake+" --flag")
+
+	url := "http://localhost:8080/?token=abc"
+	if err := Open(url); err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		data, err := os.ReadFile(out)
+		if err == nil {
+			if got, want := string(data), "--flag "+url+"\n"; got != want {
+				t.Errorf("fake browser got arguments %q, want %q", got, want)
+			}
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("fake browser was not started")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -6,6 +6,16 @@ import (
 	"flag"
 	"fmt"
 	"io"
+	"os"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lundberg/ghdiff/internal/fetch"
+	"github.com/lundberg/ghdiff/internal/git"
+	"github.com/lundberg/ghdiff/web"
 )
 
 // ErrHelp is returned when --help is requested.
@@ -16,13 +26,72 @@ var ErrVersion = errors.New("version requested")
 
 // Config holds the parsed CLI configuration.
 type Config struct {
-	Mode     string // "merge-base", "commit", "compare", "working", "stdin"
-	Base     string // base ref for diff
-	Target   string // target ref (or empty for working tree)
-	Port     int
-	Host     string
-	NoOpen   bool
-	ViewMode string // "split" or "unified"
+	Mode        string // "merge-base", "commit", "compare", "working", "stdin", "range-diff", "history", "rebase", "batch", "dirs", "conflict", "stash", "mbox", "pr"
+	Base        string // base ref for diff (old range in range-diff mode, old directory in dirs mode, the entry in stash mode)
+	Target      string // target ref, or empty for working tree (new range in range-diff mode, new directory in dirs mode)
+	Port        int
+	PortRange   int // number of ports to try starting at Port, 0 or 1 for just Port
+	Host        string
+	NoOpen      bool
+	TLS         bool          // serve over HTTPS
+	TLSCert     string        // certificate file for TLS, empty for a self-signed one
+	TLSKey      string        // private key file for TLSCert
+	Quiet       bool          // print only the "Listening on" line to stdout
+	PrintURL    bool          // print only the bare URL to stdout, implies NoOpen and Quiet
+	OpenDelay   time.Duration // extra wait before opening the browser
+	ViewMode    string        // "split" or "unified"
+	ViewModeSet bool          // whether --mode was given rather than defaulted
+	Editor      string        // URL scheme of "open in editor" links: "vscode", "idea", or "none"
+
+	SyntaxTheme string // syntax highlighting theme, a stylesheet in web/css/themes
+
+	BindTimeout time.Duration // how long to retry binding a port that is in use
+
+	WatchInterval time.Duration // how often the UI's change watcher polls git
+
+	DiffSoftTimeout time.Duration // how long /api/diff lets git diff run, 0 = no limit
+
+	Abbrev int // hex digits of abbreviated commit hashes, 0 for git's default
+
+	FindRenames string // rename similarity threshold percent, empty for git's default
+	FindCopies  string // copy similarity threshold percent, empty to disable
+	WordDiff    bool   // diff by words (git --word-diff=porcelain)
+	Text        bool   // treat binary files as text (git --text)
+	StripCR     bool   // convert CRLF to LF in a diff read from stdin
+
+	IgnoreMatching string   // regex for changed lines to leave out (git diff -I)
+	GitConfig      []string // "key=value" settings passed to git with -c, from git.SafeConfigKeys
+
+	MaxLineLength    int      // truncate lines longer than this many bytes, 0 = unlimited
+	TabWidth         int      // columns per tab unless .editorconfig or .gitattributes sets one
+	SortBy           string   // file order: "" (git's order), "path", "status", "size"
+	ChangesOnly      bool     // drop context lines from hunks
+	ChangesOnlyFiles bool     // drop files whose content didn't change, e.g. renamed-only
+	HideMoves        bool     // drop files whose changes were all moved
+	Renumber         int      // renumber each file's lines from this number, 0 = keep git's
+	Only             []string // keep only files with these extensions, e.g. "go"
+	Status           []string // keep only files with these statuses, e.g. "added"
+
+	Merges string // merge commits in the commit list: "all", "none", or "first-parent"
+
+	ThreeDot     bool   // in compare mode, diff Target against its merge-base with Base
+	Upstream     bool   // in merge-base mode, diff against the upstream tracking branch
+	BaseBranch   string // in merge-base mode, the branch Base is the merge-base with (set by main)
+	SinceTag     bool   // in compare mode, Target is a tag and Base is the tag before it
+	SinceRelease bool   // in commit mode, Base is the latest tag reachable from HEAD
+	Path         string // file whose history is shown in history mode
+	Mbox         string // mbox file or directory of .patch files shown in mbox mode
+	PR           string // URL of the pull request shown in pr mode
+	Session      string // file the review state is saved to and resumed from
+
+	Batch []BatchEntry // diffs to review in turn in batch mode, from --commits-file
+}
+
+// BatchEntry is one diff listed in a --commits-file.
+type BatchEntry struct {
+	Label  string `json:"label"` // the line as written in the file
+	Base   string `json:"base"`
+	Target string `json:"target"`
 }
 
 const usageHeader = `Usage: ghdiff [flags] [ref1 [ref2]]
@@ -35,25 +104,184 @@ Arguments:
   <ref1> <ref2>  diff between two refs
   -              read unified diff from stdin
 
+  With --range-diff, the two arguments are commit ranges to compare,
+  e.g. main..feature@{1} main..feature after a rebase.
+
+  With --dirs, the two arguments are directories to compare, e.g. the
+  outputs of two builds.
+
+  With --since-tag <tag>, no arguments are given: the tag is diffed
+  against the tag before it, e.g. --since-tag v1.2.0 for release notes.
+
+  With --path <file>, the two arguments bound the commits whose changes
+  to that file are shown one by one, e.g. --path main.go HEAD~10 HEAD.
+
 Flags:
 `
 
+// DefaultMaxLineLength is the default for --max-line-length. Lines longer
+// than this are almost always minified or generated content.
+const DefaultMaxLineLength = 10000
+
+// DefaultBindTimeout is the default for --bind-timeout, long enough for a
+// previous ghdiff on the same port to have released it.
+const DefaultBindTimeout = 500 * time.Millisecond
+
+// DefaultWatchInterval is the default for --watch-interval.
+const DefaultWatchInterval = time.Second
+
+// DefaultSyntaxTheme is the default for --syntax-theme, matching the
+// page's dark colors.
+const DefaultSyntaxTheme = "github-dark"
+
+// DefaultTabWidth is the default for --tab-width, git's own default.
+const DefaultTabWidth = 8
+
 // flags holds pointers to flag values, used to share between
 // newFlagSet and ParseArgs without duplicating definitions.
 type flags struct {
-	port     int
-	host     string
-	noOpen   bool
-	viewMode string
-	version  bool
+	port        int
+	portRange   int
+	bindTimeout time.Duration
+	host        string
+	noOpen      bool
+	quiet       bool
+	printURL    bool
+	openDelay   time.Duration
+	viewMode    string
+	editor      string
+	syntaxTheme string
+	version     bool
+	findRenames thresholdFlag
+	findCopies  thresholdFlag
+	wordDiff    bool
+	text        bool
+	stripCR     bool
+	ignoreMatch string
+	maxLineLen  int
+	tabWidth    int
+	sortBy      string
+	changesOnly bool
+	onlyChanged bool
+	hideMoves   bool
+	renumber    int
+	only        string
+	status      string
+	rangeDiff   bool
+	upstream    bool
+	sinceTag    string
+	sinceRel    bool
+	path        string
+	rebase      bool
+	commitsFile string
+	dirs        bool
+	merges      string
+	threeDot    bool
+	tls         bool
+	tlsCert     string
+	tlsKey      string
+	conflict    bool
+	watchEvery  time.Duration
+	diffTimeout time.Duration
+	abbrev      int
+	stash       bool
+	mbox        string
+	pr          string
+	session     string
+	gitConfig   configFlag
+}
+
+// defaultThreshold is git's default similarity threshold for -M and -C.
+const defaultThreshold = "50"
+
+// thresholdFlag is a flag with an optional value: "--find-renames" uses
+// git's default similarity threshold, "--find-renames=N" sets N percent.
+type thresholdFlag struct {
+	value string
+}
+
+func (t *thresholdFlag) String() string { return t.value }
+
+func (t *thresholdFlag) Set(s string) error {
+	if s == "true" {
+		t.value = defaultThreshold
+		return nil
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil || n < 0 || n > 100 {
+		return fmt.Errorf("invalid threshold %q: must be 0-100", s)
+	}
+	t.value = strconv.Itoa(n)
+	return nil
+}
+
+// IsBoolFlag lets the flag be given without a value.
+func (t *thresholdFlag) IsBoolFlag() bool { return true }
+
+// configFlag collects the settings of a repeated --git-config flag,
+// rejecting keys that aren't safe to override.
+type configFlag []string
+
+func (c *configFlag) String() string { return strings.Join(*c, " ") }
+
+func (c *configFlag) Set(s string) error {
+	if err := git.ValidateConfig(s); err != nil {
+		return err
+	}
+	*c = append(*c, s)
+	return nil
 }
 
 func newFlagSet(f *flags) *flag.FlagSet {
 	fs := flag.NewFlagSet("ghdiff", flag.ContinueOnError)
 	fs.IntVar(&f.port, "port", 0, "HTTP server port (0 = auto)")
+	fs.IntVar(&f.portRange, "port-range", 0, "if --port is in use, try the ports after it, up to `N` ports in all")
+	fs.DurationVar(&f.bindTimeout, "bind-timeout", DefaultBindTimeout, "how long to keep retrying a --port that is in use (e.g. 2s)")
 	fs.StringVar(&f.host, "host", "localhost", "HTTP server host")
+	fs.BoolVar(&f.tls, "tls", false, "serve over HTTPS with a self-signed certificate generated at startup")
+	fs.StringVar(&f.tlsCert, "tls-cert", "", "serve over HTTPS with the certificate in `file` (PEM, needs --tls-key)")
+	fs.StringVar(&f.tlsKey, "tls-key", "", "private key `file` (PEM) for --tls-cert")
 	fs.BoolVar(&f.noOpen, "no-open", false, "don't open browser automatically")
+	fs.BoolVar(&f.quiet, "quiet", false, "print only the \"Listening on\" line to stdout")
+	fs.BoolVar(&f.printURL, "print-url", false, "print only the URL to stdout and don't open a browser, for launchers")
+	fs.DurationVar(&f.openDelay, "open-delay", 0, "extra delay before opening the browser (e.g. 500ms)")
+	fs.DurationVar(&f.diffTimeout, "diff-soft-timeout", 0, "give up on diffs that take git longer than this (e.g. 10s), suggesting a narrower range (0 = no limit)")
+	fs.DurationVar(&f.watchEvery, "watch-interval", DefaultWatchInterval, "how often to check for changes to the diff being viewed (e.g. 5s for large repos)")
+	fs.IntVar(&f.abbrev, "abbrev", 0, "show commit hashes abbreviated to `N` hex digits (4-40), 0 for git's core.abbrev")
 	fs.StringVar(&f.viewMode, "mode", "split", "view mode: split or unified")
+	fs.StringVar(&f.editor, "editor", "none", "link files to open in an editor, when serving on localhost: vscode, idea, or none")
+	fs.StringVar(&f.syntaxTheme, "syntax-theme", DefaultSyntaxTheme, "syntax highlighting theme: "+strings.Join(web.SyntaxThemes(), ", "))
+	fs.Var(&f.findRenames, "find-renames", "detect renames, optionally with similarity `N` percent (0-100)")
+	fs.Var(&f.gitConfig, "git-config", "pass `key=value` to git as -c key=value, for keys such as diff.algorithm (repeatable)")
+	fs.Var(&f.findCopies, "find-copies", "detect copies, optionally with similarity `N` percent (0-100)")
+	fs.BoolVar(&f.wordDiff, "word-diff", false, "highlight changed words (for stdin, expects --word-diff=porcelain input)")
+	fs.BoolVar(&f.text, "text", false, "treat all files as text, showing diffs of files git considers binary")
+	fs.StringVar(&f.ignoreMatch, "ignore-matching", "", "leave out changes whose lines all match `regex`, e.g. generated timestamps (git 2.30+)")
+	fs.BoolVar(&f.stripCR, "strip-cr", true, "convert CRLF line endings to LF in a diff read from stdin (--strip-cr=false keeps carriage returns)")
+	fs.IntVar(&f.tabWidth, "tab-width", DefaultTabWidth, "columns per tab for files without a width in .editorconfig or .gitattributes")
+	fs.IntVar(&f.maxLineLen, "max-line-length", DefaultMaxLineLength, "truncate diff lines longer than this many bytes (0 = unlimited)")
+	fs.StringVar(&f.sortBy, "sort", "", "file order: path, status, or size (default: git's order)")
+	fs.BoolVar(&f.changesOnly, "changes-only", false, "show only added and deleted lines, without context")
+	fs.BoolVar(&f.onlyChanged, "changes-only-files", false, "hide files whose content didn't change, such as renamed-only and mode-only files")
+	fs.BoolVar(&f.hideMoves, "hide-moves", false, "hide files whose changes only move lines, e.g. within or between files in a refactor")
+	fs.IntVar(&f.renumber, "renumber", 0, "number each file's lines from `N`, e.g. 1 for a snippet pasted from mid-file (0 = keep real line numbers)")
+	fs.StringVar(&f.only, "only", "", "show only files with these comma-separated `extensions` (e.g. go,proto)")
+	fs.StringVar(&f.status, "status", "", "show only files with these comma-separated `statuses`: added, deleted, modified, renamed")
+	fs.StringVar(&f.merges, "merges", "all", "merge commits in the commit list: all, none, or first-parent")
+	fs.BoolVar(&f.rangeDiff, "range-diff", false, "compare two versions of a branch: --range-diff <base1>..<tip1> <base2>..<tip2>")
+	fs.BoolVar(&f.threeDot, "three-dot", false, "with two refs, diff ref2 against its merge-base with ref1, like a pull request (ref1...ref2)")
+	fs.BoolVar(&f.upstream, "upstream", false, "with no arguments, diff against the merge-base with the upstream branch (@{u}) instead of main/master")
+	fs.BoolVar(&f.sinceRel, "since-release", false, "diff the working tree against the latest tag reachable from HEAD")
+	fs.StringVar(&f.sinceTag, "since-tag", "", "diff `tag` against the tag before it in version order, e.g. for release notes")
+	fs.StringVar(&f.commitsFile, "commits-file", "", "review the commits or \"base target\" ranges listed one per line in `file`")
+	fs.BoolVar(&f.dirs, "dirs", false, "diff two directory trees, which need not be in a repository: --dirs <dir1> <dir2>")
+	fs.StringVar(&f.session, "session", "", "save the compared refs and viewed file to `file`, and resume from it when started with it again")
+	fs.StringVar(&f.pr, "pr", "", "review a GitHub pull request or GitLab merge request by its `url`")
+	fs.StringVar(&f.mbox, "mbox", "", "review a patch series, as from git format-patch, in an mbox `file` or a directory of .patch files")
+	fs.BoolVar(&f.stash, "stash", false, "show a stash entry (default stash@{0}), with stashed untracked files marked")
+	fs.BoolVar(&f.conflict, "conflict", false, "during a merge conflict, show what ours and theirs each changed from the common ancestor")
+	fs.BoolVar(&f.rebase, "rebase", false, "show the patch an in-progress rebase or git am stopped on")
+	fs.StringVar(&f.path, "path", "", "show the history of one `file` across <ref1>..<ref2>, commit by commit")
 	fs.BoolVar(&f.version, "version", false, "print version and exit")
 	return fs
 }
@@ -81,20 +309,273 @@ func ParseArgs(args []string) (*Config, error) {
 	if f.viewMode != "split" && f.viewMode != "unified" {
 		return nil, fmt.Errorf("invalid mode %q: must be split or unified", f.viewMode)
 	}
+	viewModeSet := false
+	fs.Visit(func(fl *flag.Flag) {
+		if fl.Name == "mode" {
+			viewModeSet = true
+		}
+	})
+
+	// Validate editor
+	switch f.editor {
+	case "vscode", "idea", "none":
+	default:
+		return nil, fmt.Errorf("invalid editor %q: must be vscode, idea, or none", f.editor)
+	}
+
+	// Validate syntax theme
+	if !slices.Contains(web.SyntaxThemes(), f.syntaxTheme) {
+		return nil, fmt.Errorf("invalid syntax theme %q: must be one of %s", f.syntaxTheme, strings.Join(web.SyntaxThemes(), ", "))
+	}
+
+	// Validate sort key
+	switch f.sortBy {
+	case "", "path", "status", "size":
+	default:
+		return nil, fmt.Errorf("invalid sort %q: must be path, status, or size", f.sortBy)
+	}
+
+	// Validate statuses
+	for _, status := range splitList(f.status) {
+		switch status {
+		case "added", "deleted", "modified", "renamed":
+		default:
+			return nil, fmt.Errorf("invalid status %q: must be added, deleted, modified, or renamed", status)
+		}
+	}
+
+	// Validate ignore-matching regex. Go's syntax differs from git's POSIX
+	// extended regexes in details, but catches typos before git runs.
+	if f.ignoreMatch != "" {
+		if _, err := regexp.Compile(f.ignoreMatch); err != nil {
+			return nil, fmt.Errorf("invalid ignore-matching regex: %w", err)
+		}
+	}
+
+	// Validate merges
+	switch f.merges {
+	case "all", "none", "first-parent":
+	default:
+		return nil, fmt.Errorf("invalid merges %q: must be all, none, or first-parent", f.merges)
+	}
+
+	// Validate open delay
+	if f.openDelay < 0 {
+		return nil, fmt.Errorf("invalid open-delay %s: must not be negative", f.openDelay)
+	}
+
+	// Validate watch interval
+	if f.watchEvery <= 0 {
+		return nil, fmt.Errorf("invalid watch-interval %s: must be positive", f.watchEvery)
+	}
+	if f.diffTimeout < 0 {
+		return nil, fmt.Errorf("invalid diff-soft-timeout %s: must not be negative", f.diffTimeout)
+	}
+
+	// Validate abbrev; git allows no fewer than 4 digits
+	if f.abbrev != 0 && (f.abbrev < 4 || f.abbrev > 40) {
+		return nil, fmt.Errorf("invalid abbrev %d: must be between 4 and 40, or 0 for git's default", f.abbrev)
+	}
+
+	// Validate max line length
+	if f.maxLineLen < 0 {
+		return nil, fmt.Errorf("invalid max-line-length: %d (must not be negative)", f.maxLineLen)
+	}
+
+	// Validate renumber start
+	if f.renumber < 0 {
+		return nil, fmt.Errorf("invalid renumber: %d (must not be negative)", f.renumber)
+	}
+
+	// Validate tab width
+	if f.tabWidth < 1 {
+		return nil, fmt.Errorf("invalid tab-width: %d (must be at least 1)", f.tabWidth)
+	}
+
+	// Validate TLS files
+	if (f.tlsCert == "") != (f.tlsKey == "") {
+		return nil, fmt.Errorf("--tls-cert and --tls-key must be given together")
+	}
 
 	// Validate port range
 	if f.port < 0 || f.port > 65535 {
 		return nil, fmt.Errorf("invalid port: %d (must be 0-65535)", f.port)
 	}
+	if f.portRange < 0 {
+		return nil, fmt.Errorf("invalid port-range: %d (must not be negative)", f.portRange)
+	}
+	if f.portRange > 1 {
+		if f.port == 0 {
+			return nil, fmt.Errorf("--port-range needs a --port to start from")
+		}
+		if f.port+f.portRange-1 > 65535 {
+			return nil, fmt.Errorf("invalid port-range: %d ports from %d go past 65535", f.portRange, f.port)
+		}
+	}
+
+	// Validate bind timeout
+	if f.bindTimeout < 0 {
+		return nil, fmt.Errorf("invalid bind-timeout %s: must not be negative", f.bindTimeout)
+	}
 
 	cfg := &Config{
-		Port:     f.port,
-		Host:     f.host,
-		NoOpen:   f.noOpen,
-		ViewMode: f.viewMode,
+		Port:        f.port,
+		PortRange:   f.portRange,
+		Host:        f.host,
+		NoOpen:      f.noOpen || f.printURL,
+		TLS:         f.tls || f.tlsCert != "",
+		TLSCert:     f.tlsCert,
+		TLSKey:      f.tlsKey,
+		Quiet:       f.quiet || f.printURL,
+		PrintURL:    f.printURL,
+		OpenDelay:   f.openDelay,
+		ViewMode:    f.viewMode,
+		ViewModeSet: viewModeSet,
+		Editor:      f.editor,
+
+		SyntaxTheme: f.syntaxTheme,
+
+		BindTimeout: f.bindTimeout,
+
+		WatchInterval: f.watchEvery,
+
+		DiffSoftTimeout: f.diffTimeout,
+
+		Abbrev: f.abbrev,
+
+		FindRenames: f.findRenames.value,
+		FindCopies:  f.findCopies.value,
+		WordDiff:    f.wordDiff,
+		Text:        f.text,
+		StripCR:     f.stripCR,
+
+		IgnoreMatching: f.ignoreMatch,
+		GitConfig:      f.gitConfig,
+
+		MaxLineLength:    f.maxLineLen,
+		TabWidth:         f.tabWidth,
+		SortBy:           f.sortBy,
+		ChangesOnly:      f.changesOnly,
+		ChangesOnlyFiles: f.onlyChanged,
+		HideMoves:        f.hideMoves,
+		Renumber:         f.renumber,
+		Only:             splitList(f.only),
+		Status:           splitList(f.status),
+
+		Merges: f.merges,
+
+		Upstream: f.upstream,
+		Session:  f.session,
 	}
 
 	positional := fs.Args()
+	if f.rangeDiff {
+		if len(positional) != 2 {
+			return nil, fmt.Errorf("--range-diff expects 2 ranges, got %d arguments", len(positional))
+		}
+		cfg.Mode = "range-diff"
+		cfg.Base = positional[0]
+		cfg.Target = positional[1]
+		return cfg, nil
+	}
+	if f.sinceTag != "" {
+		if len(positional) != 0 {
+			return nil, fmt.Errorf("--since-tag takes no arguments, got %d", len(positional))
+		}
+		// main resolves Base to the previous tag.
+		cfg.Mode = "compare"
+		cfg.Target = f.sinceTag
+		cfg.SinceTag = true
+		return cfg, nil
+	}
+	if f.sinceRel {
+		if len(positional) != 0 {
+			return nil, fmt.Errorf("--since-release takes no arguments, got %d", len(positional))
+		}
+		// main resolves Base to the latest tag.
+		cfg.Mode = "commit"
+		cfg.SinceRelease = true
+		return cfg, nil
+	}
+	if f.commitsFile != "" {
+		if len(positional) != 0 {
+			return nil, fmt.Errorf("--commits-file takes no arguments, got %d", len(positional))
+		}
+		entries, err := readCommitsFile(f.commitsFile)
+		if err != nil {
+			return nil, err
+		}
+		cfg.Mode = "batch"
+		cfg.Batch = entries
+		cfg.Base = entries[0].Base
+		cfg.Target = entries[0].Target
+		return cfg, nil
+	}
+	if f.dirs {
+		if len(positional) != 2 {
+			return nil, fmt.Errorf("--dirs expects 2 directories, got %d arguments", len(positional))
+		}
+		cfg.Mode = "dirs"
+		cfg.Base = positional[0]
+		cfg.Target = positional[1]
+		return cfg, nil
+	}
+	if f.mbox != "" {
+		if len(positional) != 0 {
+			return nil, fmt.Errorf("--mbox takes no arguments, got %d", len(positional))
+		}
+		cfg.Mode = "mbox"
+		cfg.Mbox = f.mbox
+		return cfg, nil
+	}
+	if f.pr != "" {
+		if len(positional) != 0 {
+			return nil, fmt.Errorf("--pr takes no arguments, got %d", len(positional))
+		}
+		if _, err := fetch.ParsePullRequest(f.pr); err != nil {
+			return nil, err
+		}
+		cfg.Mode = "pr"
+		cfg.PR = f.pr
+		return cfg, nil
+	}
+	if f.stash {
+		switch len(positional) {
+		case 0:
+			cfg.Base = "stash@{0}"
+		case 1:
+			cfg.Base = positional[0]
+		default:
+			return nil, fmt.Errorf("--stash expects at most 1 stash entry, got %d arguments", len(positional))
+		}
+		cfg.Mode = "stash"
+		return cfg, nil
+	}
+	if f.conflict {
+		if len(positional) != 0 {
+			return nil, fmt.Errorf("--conflict takes no arguments, got %d", len(positional))
+		}
+		cfg.Mode = "conflict"
+		return cfg, nil
+	}
+	if f.rebase {
+		if len(positional) != 0 {
+			return nil, fmt.Errorf("--rebase takes no arguments, got %d", len(positional))
+		}
+		cfg.Mode = "rebase"
+		return cfg, nil
+	}
+	if f.path != "" {
+		if len(positional) != 2 {
+			return nil, fmt.Errorf("--path expects 2 refs, got %d arguments", len(positional))
+		}
+		cfg.Mode = "history"
+		cfg.Base = positional[0]
+		cfg.Target = positional[1]
+		cfg.Path = f.path
+		return cfg, nil
+	}
+
 	switch len(positional) {
 	case 0:
 		cfg.Mode = "merge-base"
@@ -116,9 +597,63 @@ func ParseArgs(args []string) (*Config, error) {
 		return nil, fmt.Errorf("too many arguments: expected at most 2, got %d", len(positional))
 	}
 
+	if f.upstream && cfg.Mode != "merge-base" {
+		return nil, fmt.Errorf("--upstream cannot be combined with ref arguments")
+	}
+	if f.threeDot && cfg.Mode != "compare" {
+		return nil, fmt.Errorf("--three-dot expects 2 refs")
+	}
+	cfg.ThreeDot = f.threeDot
+
 	return cfg, nil
 }
 
+// readCommitsFile reads a --commits-file. Each line is a commit, shown
+// against its first parent, or a "base target" pair. Blank lines and lines
+// starting with # are skipped.
+func readCommitsFile(path string) ([]BatchEntry, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading commits file: %w", err)
+	}
+	var entries []BatchEntry
+	for i, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		for _, ref := range fields {
+			if strings.HasPrefix(ref, "-") {
+				return nil, fmt.Errorf("%s:%d: ref must not start with '-': %q", path, i+1, ref)
+			}
+		}
+		switch len(fields) {
+		case 1:
+			entries = append(entries, BatchEntry{Label: line, Base: fields[0] + "^", Target: fields[0]})
+		case 2:
+			entries = append(entries, BatchEntry{Label: line, Base: fields[0], Target: fields[1]})
+		default:
+			return nil, fmt.Errorf("%s:%d: expected a ref or a \"base target\" pair, got %q", path, i+1, line)
+		}
+	}
+	if len(entries) == 0 {
+		return nil, fmt.Errorf("%s: no commits listed", path)
+	}
+	return entries, nil
+}
+
+// splitList splits a comma-separated flag value, dropping empty items.
+func splitList(s string) []string {
+	var items []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
 // PrintUsage writes usage information to w.
 func PrintUsage(w io.Writer) {
 	_, _ = fmt.Fprint(w, usageHeader)
@@ -1,7 +1,11 @@
 package cli
 
 import (
+	"os"
+	"path/filepath"
+	"slices"
 	"testing"
+	"time"
 )
 
 func TestParseArgs_DefaultConfig(t *testing.T) {
@@ -101,8 +105,16 @@ func TestParseArgs_ModeFlag(t *testing.T) {
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
-	if cfg.ViewMode != "unified" {
-		t.Errorf("expected ViewMode=unified, got %q", cfg.ViewMode)
+	if cfg.ViewMode != "unified" || !cfg.ViewModeSet {
+		t.Errorf("expected ViewMode=unified, set on the command line, got %q (set %v)", cfg.ViewMode, cfg.ViewModeSet)
+	}
+
+	cfg, err = ParseArgs([]string{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.ViewMode != "split" || cfg.ViewModeSet {
+		t.Errorf("expected the default ViewMode=split, not set, got %q (set %v)", cfg.ViewMode, cfg.ViewModeSet)
 	}
 }
 
@@ -116,6 +128,52 @@ func TestParseArgs_ModeFlagSplit(t *testing.T) {
 	}
 }
 
+func TestParseArgs_Editor(t *testing.T) {
+	cfg, err := ParseArgs([]string{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.Editor != "none" {
+		t.Errorf("expected Editor=none by default, got %q", cfg.Editor)
+	}
+
+	cfg, err = ParseArgs([]string{"--editor", "vscode"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.Editor != "vscode" {
+		t.Errorf("expected Editor=vscode, got %q", cfg.Editor)
+	}
+
+	if _, err := ParseArgs([]string{"--editor", "emacs"}); err == nil {
+		t.Error("expected error for unknown editor, got nil")
+	}
+}
+
+func TestParseArgs_SyntaxTheme(t *testing.T) {
+	cfg, err := ParseArgs([]string{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.SyntaxTheme != DefaultSyntaxTheme {
+		t.Errorf("expected SyntaxTheme=%s by default, got %q", DefaultSyntaxTheme, cfg.SyntaxTheme)
+	}
+
+	cfg, err = ParseArgs([]string{"--syntax-theme", "github-dark-dimmed"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.SyntaxTheme != "github-dark-dimmed" {
+		t.Errorf("expected SyntaxTheme=github-dark-dimmed, got %q", cfg.SyntaxTheme)
+	}
+
+	for _, bad := range []string{"solarized", "../style", ""} {
+		if _, err := ParseArgs([]string{"--syntax-theme", bad}); err == nil {
+			t.Errorf("expected error for syntax theme %q, got nil", bad)
+		}
+	}
+}
+
 func TestParseArgs_InvalidModeFlag(t *testing.T) {
 	_, err := ParseArgs([]string{"--mode", "invalid"})
 	if err == nil {
@@ -205,9 +263,634 @@ func TestParseArgs_InvalidPortTooHigh(t *testing.T) {
 	}
 }
 
+func TestParseArgs_PortRange(t *testing.T) {
+	cfg, err := ParseArgs([]string{"--port", "8080", "--port-range", "10", "--bind-timeout", "2s"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.PortRange != 10 || cfg.BindTimeout != 2*time.Second {
+		t.Errorf("expected PortRange=10 and BindTimeout=2s, got %d and %s", cfg.PortRange, cfg.BindTimeout)
+	}
+
+	for _, args := range [][]string{
+		{"--port-range", "10"},
+		{"--port", "65530", "--port-range", "10"},
+		{"--port", "8080", "--port-range", "-1"},
+		{"--bind-timeout", "-1s"},
+	} {
+		if _, err := ParseArgs(args); err == nil {
+			t.Errorf("ParseArgs(%q): expected error, got nil", args)
+		}
+	}
+}
+
 func TestParseArgs_HelpFlag(t *testing.T) {
 	_, err := ParseArgs([]string{"--help"})
 	if err != ErrHelp {
 		t.Errorf("expected ErrHelp, got %v", err)
 	}
 }
+
+func TestParseArgs_FindRenames(t *testing.T) {
+	tests := []struct {
+		name    string
+		args    []string
+		renames string
+		copies  string
+	}{
+		{"unset", []string{}, "", ""},
+		{"bare uses git default", []string{"--find-renames"}, "50", ""},
+		{"explicit threshold", []string{"--find-renames=30"}, "30", ""},
+		{"copies", []string{"--find-copies=75", "HEAD"}, "", "75"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := ParseArgs(tt.args)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if cfg.FindRenames != tt.renames {
+				t.Errorf("expected FindRenames=%q, got %q", tt.renames, cfg.FindRenames)
+			}
+			if cfg.FindCopies != tt.copies {
+				t.Errorf("expected FindCopies=%q, got %q", tt.copies, cfg.FindCopies)
+			}
+		})
+	}
+}
+
+func TestParseArgs_InvalidFindRenames(t *testing.T) {
+	for _, arg := range []string{"--find-renames=101", "--find-renames=-1", "--find-copies=abc"} {
+		if _, err := ParseArgs([]string{arg}); err == nil {
+			t.Errorf("expected error for %s, got nil", arg)
+		}
+	}
+}
+
+func TestParseArgs_OpenDelay(t *testing.T) {
+	cfg, err := ParseArgs([]string{"--open-delay", "250ms"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.OpenDelay != 250*time.Millisecond {
+		t.Errorf("expected OpenDelay=250ms, got %s", cfg.OpenDelay)
+	}
+
+	if _, err := ParseArgs([]string{"--open-delay", "-1s"}); err == nil {
+		t.Error("expected error for negative open-delay, got nil")
+	}
+}
+
+func TestParseArgs_MaxLineLength(t *testing.T) {
+	cfg, err := ParseArgs([]string{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.MaxLineLength != DefaultMaxLineLength {
+		t.Errorf("expected default MaxLineLength=%d, got %d", DefaultMaxLineLength, cfg.MaxLineLength)
+	}
+
+	cfg, err = ParseArgs([]string{"--max-line-length", "0"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.MaxLineLength != 0 {
+		t.Errorf("expected MaxLineLength=0, got %d", cfg.MaxLineLength)
+	}
+
+	if _, err := ParseArgs([]string{"--max-line-length", "-5"}); err == nil {
+		t.Error("expected error for negative max-line-length, got nil")
+	}
+}
+
+func TestParseArgs_Sort(t *testing.T) {
+	for _, key := range []string{"path", "status", "size"} {
+		cfg, err := ParseArgs([]string{"--sort", key})
+		if err != nil {
+			t.Fatalf("--sort %s: unexpected error: %v", key, err)
+		}
+		if cfg.SortBy != key {
+			t.Errorf("expected SortBy=%s, got %q", key, cfg.SortBy)
+		}
+	}
+
+	if _, err := ParseArgs([]string{"--sort", "random"}); err == nil {
+		t.Error("expected error for invalid sort key, got nil")
+	}
+}
+
+func TestParseArgs_ChangesOnly(t *testing.T) {
+	cfg, err := ParseArgs([]string{"--changes-only"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !cfg.ChangesOnly {
+		t.Error("expected ChangesOnly=true")
+	}
+}
+
+func TestParseArgs_ChangesOnlyFiles(t *testing.T) {
+	cfg, err := ParseArgs([]string{"--changes-only-files"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !cfg.ChangesOnlyFiles {
+		t.Error("expected ChangesOnlyFiles=true")
+	}
+}
+
+func TestParseArgs_HideMoves(t *testing.T) {
+	cfg, err := ParseArgs([]string{"--hide-moves"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !cfg.HideMoves {
+		t.Error("expected HideMoves=true")
+	}
+}
+
+func TestParseArgs_Status(t *testing.T) {
+	cfg, err := ParseArgs([]string{"--status", "added, deleted"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if want := []string{"added", "deleted"}; !slices.Equal(cfg.Status, want) {
+		t.Errorf("expected Status=%v, got %v", want, cfg.Status)
+	}
+
+	if _, err := ParseArgs([]string{"--status", "copied"}); err == nil {
+		t.Error("expected error for unknown status, got nil")
+	}
+}
+
+func TestParseArgs_Renumber(t *testing.T) {
+	cfg, err := ParseArgs([]string{"--renumber", "1", "-"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.Renumber != 1 {
+		t.Errorf("expected Renumber=1, got %d", cfg.Renumber)
+	}
+
+	if _, err := ParseArgs([]string{"--renumber", "-1"}); err == nil {
+		t.Error("expected error for negative renumber, got nil")
+	}
+}
+
+func TestParseArgs_RangeDiff(t *testing.T) {
+	cfg, err := ParseArgs([]string{"--range-diff", "main..v1", "main..v2"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.Mode != "range-diff" {
+		t.Errorf("expected Mode=range-diff, got %q", cfg.Mode)
+	}
+	if cfg.Base != "main..v1" || cfg.Target != "main..v2" {
+		t.Errorf("expected ranges main..v1 and main..v2, got %q and %q", cfg.Base, cfg.Target)
+	}
+
+	if _, err := ParseArgs([]string{"--range-diff", "main..v1"}); err == nil {
+		t.Error("expected error for --range-diff with one range, got nil")
+	}
+}
+
+func TestParseArgs_Upstream(t *testing.T) {
+	cfg, err := ParseArgs([]string{"--upstream"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !cfg.Upstream || cfg.Mode != "merge-base" {
+		t.Errorf("expected Upstream=true in merge-base mode, got Upstream=%v Mode=%q", cfg.Upstream, cfg.Mode)
+	}
+
+	if _, err := ParseArgs([]string{"--upstream", "abc123"}); err == nil {
+		t.Error("expected error for --upstream with a ref argument, got nil")
+	}
+}
+
+func TestParseArgs_Path(t *testing.T) {
+	cfg, err := ParseArgs([]string{"--path", "src/foo.go", "HEAD~10", "HEAD"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.Mode != "history" {
+		t.Errorf("expected Mode=history, got %q", cfg.Mode)
+	}
+	if cfg.Path != "src/foo.go" || cfg.Base != "HEAD~10" || cfg.Target != "HEAD" {
+		t.Errorf("expected src/foo.go over HEAD~10..HEAD, got %q over %q..%q", cfg.Path, cfg.Base, cfg.Target)
+	}
+
+	if _, err := ParseArgs([]string{"--path", "src/foo.go", "HEAD"}); err == nil {
+		t.Error("expected error for --path with one ref, got nil")
+	}
+}
+
+func TestParseArgs_Quiet(t *testing.T) {
+	cfg, err := ParseArgs([]string{"--quiet"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !cfg.Quiet {
+		t.Error("expected Quiet=true")
+	}
+}
+
+func TestParseArgs_PrintURL(t *testing.T) {
+	cfg, err := ParseArgs([]string{"--print-url"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !cfg.PrintURL || !cfg.NoOpen || !cfg.Quiet {
+		t.Errorf("expected PrintURL to imply NoOpen and Quiet, got %+v", cfg)
+	}
+}
+
+func TestParseArgs_Text(t *testing.T) {
+	cfg, err := ParseArgs([]string{"--text"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !cfg.Text {
+		t.Error("expected Text=true")
+	}
+}
+
+func TestParseArgs_Only(t *testing.T) {
+	cfg, err := ParseArgs([]string{"--only", "go, proto,,"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(cfg.Only) != 2 || cfg.Only[0] != "go" || cfg.Only[1] != "proto" {
+		t.Errorf("expected Only=[go proto], got %q", cfg.Only)
+	}
+
+	cfg, err = ParseArgs(nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.Only != nil {
+		t.Errorf("expected no Only filter by default, got %q", cfg.Only)
+	}
+}
+
+func TestParseArgs_Stash(t *testing.T) {
+	tests := []struct {
+		args []string
+		want string
+	}{
+		{[]string{"--stash"}, "stash@{0}"},
+		{[]string{"--stash", "stash@{2}"}, "stash@{2}"},
+	}
+	for _, tt := range tests {
+		cfg, err := ParseArgs(tt.args)
+		if err != nil {
+			t.Fatalf("ParseArgs(%q): unexpected error: %v", tt.args, err)
+		}
+		if cfg.Mode != "stash" || cfg.Base != tt.want {
+			t.Errorf("ParseArgs(%q): expected stash mode with %q, got %q %q", tt.args, tt.want, cfg.Mode, cfg.Base)
+		}
+	}
+
+	if _, err := ParseArgs([]string{"--stash", "a", "b"}); err == nil {
+		t.Error("expected error for --stash with two arguments, got nil")
+	}
+}
+
+func TestParseArgs_Conflict(t *testing.T) {
+	cfg, err := ParseArgs([]string{"--conflict"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.Mode != "conflict" {
+		t.Errorf("expected Mode=conflict, got %q", cfg.Mode)
+	}
+
+	if _, err := ParseArgs([]string{"--conflict", "HEAD"}); err == nil {
+		t.Error("expected error for --conflict with a ref, got nil")
+	}
+}
+
+func TestParseArgs_Rebase(t *testing.T) {
+	cfg, err := ParseArgs([]string{"--rebase"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.Mode != "rebase" {
+		t.Errorf("expected Mode=rebase, got %q", cfg.Mode)
+	}
+
+	if _, err := ParseArgs([]string{"--rebase", "HEAD"}); err == nil {
+		t.Error("expected error for --rebase with a ref, got nil")
+	}
+}
+
+func TestParseArgs_WatchInterval(t *testing.T) {
+	cfg, err := ParseArgs(nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.WatchInterval != DefaultWatchInterval {
+		t.Errorf("expected default WatchInterval=%s, got %s", DefaultWatchInterval, cfg.WatchInterval)
+	}
+
+	cfg, err = ParseArgs([]string{"--watch-interval", "5s"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.WatchInterval != 5*time.Second {
+		t.Errorf("expected WatchInterval=5s, got %s", cfg.WatchInterval)
+	}
+
+	if _, err := ParseArgs([]string{"--watch-interval", "0s"}); err == nil {
+		t.Error("expected error for --watch-interval 0s, got nil")
+	}
+}
+
+func TestParseArgs_Abbrev(t *testing.T) {
+	cfg, err := ParseArgs([]string{"--abbrev", "12"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.Abbrev != 12 {
+		t.Errorf("expected Abbrev=12, got %d", cfg.Abbrev)
+	}
+
+	for _, n := range []string{"3", "41", "-1"} {
+		if _, err := ParseArgs([]string{"--abbrev", n}); err == nil {
+			t.Errorf("expected error for --abbrev %s, got nil", n)
+		}
+	}
+}
+
+func TestParseArgs_GitConfig(t *testing.T) {
+	cfg, err := ParseArgs([]string{"--git-config", "diff.algorithm=patience", "--git-config", "diff.indentHeuristic=false"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if want := []string{"diff.algorithm=patience", "diff.indentHeuristic=false"}; !slices.Equal(cfg.GitConfig, want) {
+		t.Errorf("expected GitConfig=%q, got %q", want, cfg.GitConfig)
+	}
+
+	for _, setting := range []string{"core.fsmonitor=/tmp/run.sh", "diff.external=evil", "diff.algorithm"} {
+		if _, err := ParseArgs([]string{"--git-config", setting}); err == nil {
+			t.Errorf("expected error for --git-config %s, got nil", setting)
+		}
+	}
+}
+
+func TestParseArgs_TLS(t *testing.T) {
+	tests := []struct {
+		name    string
+		args    []string
+		wantTLS bool
+		wantErr bool
+	}{
+		{"default", nil, false, false},
+		{"self-signed", []string{"--tls"}, true, false},
+		{"cert and key", []string{"--tls-cert", "cert.pem", "--tls-key", "key.pem"}, true, false},
+		{"cert without key", []string{"--tls-cert", "cert.pem"}, false, true},
+		{"key without cert", []string{"--tls", "--tls-key", "key.pem"}, false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := ParseArgs(tt.args)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("expected error, got nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if cfg.TLS != tt.wantTLS {
+				t.Errorf("expected TLS=%v, got %v", tt.wantTLS, cfg.TLS)
+			}
+		})
+	}
+}
+
+func TestParseArgs_ThreeDot(t *testing.T) {
+	cfg, err := ParseArgs([]string{"--three-dot", "main", "feature"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.Mode != "compare" || !cfg.ThreeDot {
+		t.Errorf("expected compare mode with ThreeDot, got Mode=%q ThreeDot=%v", cfg.Mode, cfg.ThreeDot)
+	}
+
+	if _, err := ParseArgs([]string{"--three-dot", "feature"}); err == nil {
+		t.Error("expected error for --three-dot with one ref, got nil")
+	}
+}
+
+func TestParseArgs_TabWidth(t *testing.T) {
+	cfg, err := ParseArgs(nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.TabWidth != DefaultTabWidth {
+		t.Errorf("expected default TabWidth=%d, got %d", DefaultTabWidth, cfg.TabWidth)
+	}
+
+	cfg, err = ParseArgs([]string{"--tab-width", "4"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.TabWidth != 4 {
+		t.Errorf("expected TabWidth=4, got %d", cfg.TabWidth)
+	}
+
+	if _, err := ParseArgs([]string{"--tab-width", "0"}); err == nil {
+		t.Error("expected error for --tab-width 0, got nil")
+	}
+}
+
+func TestParseArgs_Merges(t *testing.T) {
+	cfg, err := ParseArgs(nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.Merges != "all" {
+		t.Errorf("expected default Merges=all, got %q", cfg.Merges)
+	}
+
+	cfg, err = ParseArgs([]string{"--merges", "first-parent"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.Merges != "first-parent" {
+		t.Errorf("expected Merges=first-parent, got %q", cfg.Merges)
+	}
+
+	if _, err := ParseArgs([]string{"--merges", "some"}); err == nil {
+		t.Error("expected error for invalid --merges, got nil")
+	}
+}
+
+func TestParseArgs_Mbox(t *testing.T) {
+	cfg, err := ParseArgs([]string{"--mbox", "series.mbox"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.Mode != "mbox" || cfg.Mbox != "series.mbox" {
+		t.Errorf("expected mbox mode with series.mbox, got %q %q", cfg.Mode, cfg.Mbox)
+	}
+
+	if _, err := ParseArgs([]string{"--mbox", "series.mbox", "HEAD"}); err == nil {
+		t.Error("expected error for --mbox with an argument, got nil")
+	}
+}
+
+func TestParseArgs_PR(t *testing.T) {
+	url := "https://github.com/org/repo/pull/123"
+	cfg, err := ParseArgs([]string{"--pr", url})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.Mode != "pr" || cfg.PR != url {
+		t.Errorf("expected pr mode with %s, got %q %q", url, cfg.Mode, cfg.PR)
+	}
+
+	if _, err := ParseArgs([]string{"--pr", "https://github.com/org/repo"}); err == nil {
+		t.Error("expected error for a URL that isn't a pull request, got nil")
+	}
+	if _, err := ParseArgs([]string{"--pr", url, "HEAD"}); err == nil {
+		t.Error("expected error for --pr with an argument, got nil")
+	}
+}
+
+func TestParseArgs_DiffSoftTimeout(t *testing.T) {
+	cfg, err := ParseArgs([]string{"--diff-soft-timeout", "5s"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.DiffSoftTimeout != 5*time.Second {
+		t.Errorf("expected DiffSoftTimeout=5s, got %s", cfg.DiffSoftTimeout)
+	}
+
+	if _, err := ParseArgs([]string{"--diff-soft-timeout", "-1s"}); err == nil {
+		t.Error("expected error for negative diff-soft-timeout, got nil")
+	}
+}
+
+func TestParseArgs_Session(t *testing.T) {
+	cfg, err := ParseArgs([]string{"--session", "review.json", "main", "feature"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.Session != "review.json" || cfg.Mode != "compare" {
+		t.Errorf("expected compare mode with session review.json, got %q %q", cfg.Mode, cfg.Session)
+	}
+}
+
+func TestParseArgs_IgnoreMatching(t *testing.T) {
+	cfg, err := ParseArgs([]string{"--ignore-matching", "^// Generated"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.IgnoreMatching != "^// Generated" {
+		t.Errorf("expected IgnoreMatching=^// Generated, got %q", cfg.IgnoreMatching)
+	}
+
+	if _, err := ParseArgs([]string{"--ignore-matching", "(unclosed"}); err == nil {
+		t.Error("expected error for invalid regex, got nil")
+	}
+}
+
+func TestParseArgs_SinceTag(t *testing.T) {
+	cfg, err := ParseArgs([]string{"--since-tag", "v1.2.0"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.Mode != "compare" || !cfg.SinceTag || cfg.Target != "v1.2.0" || cfg.Base != "" {
+		t.Errorf("expected compare mode to v1.2.0 with base unresolved, got %q %v %q %q", cfg.Mode, cfg.SinceTag, cfg.Base, cfg.Target)
+	}
+
+	if _, err := ParseArgs([]string{"--since-tag", "v1.2.0", "main"}); err == nil {
+		t.Error("expected error for --since-tag with an argument, got nil")
+	}
+}
+
+func TestParseArgs_SinceRelease(t *testing.T) {
+	cfg, err := ParseArgs([]string{"--since-release"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.Mode != "commit" || !cfg.SinceRelease || cfg.Base != "" {
+		t.Errorf("expected commit mode with base unresolved, got %q %v %q", cfg.Mode, cfg.SinceRelease, cfg.Base)
+	}
+
+	if _, err := ParseArgs([]string{"--since-release", "main"}); err == nil {
+		t.Error("expected error for --since-release with an argument, got nil")
+	}
+}
+
+func TestParseArgs_Dirs(t *testing.T) {
+	cfg, err := ParseArgs([]string{"--dirs", "./a", "./b"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.Mode != "dirs" || cfg.Base != "./a" || cfg.Target != "./b" {
+		t.Errorf("expected dirs mode with ./a and ./b, got %q %q %q", cfg.Mode, cfg.Base, cfg.Target)
+	}
+
+	if _, err := ParseArgs([]string{"--dirs", "./a"}); err == nil {
+		t.Error("expected error for --dirs with one directory, got nil")
+	}
+}
+
+func TestParseArgs_CommitsFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "commits.txt")
+	content := "# review queue\nabc123\n\nmain feature\n"
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := ParseArgs([]string{"--commits-file", path})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.Mode != "batch" {
+		t.Errorf("expected Mode=batch, got %q", cfg.Mode)
+	}
+	want := []BatchEntry{
+		{Label: "abc123", Base: "abc123^", Target: "abc123"},
+		{Label: "main feature", Base: "main", Target: "feature"},
+	}
+	if len(cfg.Batch) != len(want) {
+		t.Fatalf("expected %d entries, got %+v", len(want), cfg.Batch)
+	}
+	for i := range want {
+		if cfg.Batch[i] != want[i] {
+			t.Errorf("entry %d: got %+v, want %+v", i, cfg.Batch[i], want[i])
+		}
+	}
+	if cfg.Base != "abc123^" || cfg.Target != "abc123" {
+		t.Errorf("expected the first entry as default range, got %q..%q", cfg.Base, cfg.Target)
+	}
+}
+
+func TestParseArgs_CommitsFileInvalid(t *testing.T) {
+	dir := t.TempDir()
+	tests := map[string]string{
+		"empty":         "# nothing\n",
+		"too many refs": "a b c\n",
+		"flag":          "--output=/tmp/x\n",
+	}
+	for name, content := range tests {
+		t.Run(name, func(t *testing.T) {
+			path := filepath.Join(dir, name)
+			if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := ParseArgs([]string{"--commits-file", path}); err == nil {
+				t.Error("expected error, got nil")
+			}
+		})
+	}
+
+	if _, err := ParseArgs([]string{"--commits-file", filepath.Join(dir, "missing")}); err == nil {
+		t.Error("expected error for missing file, got nil")
+	}
+}
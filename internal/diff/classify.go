@@ -0,0 +1,294 @@
+package diff
+
+import (
+	"crypto/sha256"
+	"strings"
+	"unicode/utf8"
+)
+
+// ClassifyEOLOnly sets EOLOnly on files whose changes consist solely of
+// line-ending conversions (CRLF <-> LF): every deleted line is paired with
+// an added line that differs from it only by a trailing carriage return.
+func ClassifyEOLOnly(result *Result) {
+	for i := range result.Files {
+		result.Files[i].EOLOnly = isEOLOnly(&result.Files[i])
+	}
+}
+
+func isEOLOnly(file *FileDiff) bool {
+	trimCR := func(s string) string { return strings.TrimSuffix(s, "\r") }
+	changed := false
+	for _, hunk := range file.Hunks {
+		only, hunkChanged := changesOnlyIn(hunk.Lines, trimCR)
+		if !only {
+			return false
+		}
+		changed = changed || hunkChanged
+	}
+	return changed
+}
+
+// ClassifyWhitespaceOnly sets WhitespaceOnly on hunks whose changes differ
+// only in leading or trailing whitespace, such as reindented blocks: every
+// deleted line is paired with an added line that is the same once both are
+// trimmed.
+func ClassifyWhitespaceOnly(result *Result) {
+	for i := range result.Files {
+		for j := range result.Files[i].Hunks {
+			hunk := &result.Files[i].Hunks[j]
+			only, changed := changesOnlyIn(hunk.Lines, strings.TrimSpace)
+			hunk.WhitespaceOnly = only && changed
+		}
+	}
+}
+
+// changesOnlyIn reports whether every run of deleted lines in lines is
+// followed by as many added lines, each differing from its deleted line
+// but equal to it after normalize, and whether lines have any changes.
+func changesOnlyIn(lines []Line, normalize func(string) string) (only, changed bool) {
+	i := 0
+	for i < len(lines) {
+		if lines[i].Type == "context" {
+			i++
+			continue
+		}
+		// Collect a run of deletes followed by a run of adds
+		var deletes, adds []Line
+		for i < len(lines) && lines[i].Type == "delete" {
+			deletes = append(deletes, lines[i])
+			i++
+		}
+		for i < len(lines) && lines[i].Type == "add" {
+			adds = append(adds, lines[i])
+			i++
+		}
+		if len(deletes) != len(adds) {
+			return false, true
+		}
+		for j := range deletes {
+			if deletes[j].Content == adds[j].Content {
+				return false, true
+			}
+			if normalize(deletes[j].Content) != normalize(adds[j].Content) {
+				return false, true
+			}
+		}
+		changed = true
+	}
+	return true, changed
+}
+
+// DetectMoves sets Moved on deleted lines whose content is added elsewhere
+// in result, in the same file or another, and on the added lines they pair
+// with. Each added line pairs with at most one deleted line, so a line
+// deleted twice and added once is moved once.
+func DetectMoves(result *Result) {
+	deleted := make(map[string]int)
+	added := make(map[string]int)
+	eachChange(result, func(line *Line) {
+		if line.Type == "delete" {
+			deleted[line.Content]++
+		} else {
+			added[line.Content]++
+		}
+	})
+	// Each side has min(deleted, added) moved lines of each content.
+	movedDeletes := make(map[string]int)
+	movedAdds := make(map[string]int)
+	for content, n := range deleted {
+		movedDeletes[content] = min(n, added[content])
+		movedAdds[content] = movedDeletes[content]
+	}
+	eachChange(result, func(line *Line) {
+		left := movedAdds
+		if line.Type == "delete" {
+			left = movedDeletes
+		}
+		if left[line.Content] > 0 {
+			line.Moved = true
+			left[line.Content]--
+		}
+	})
+}
+
+// eachChange calls fn for every added and deleted line of result.
+func eachChange(result *Result, fn func(line *Line)) {
+	for i := range result.Files {
+		for j := range result.Files[i].Hunks {
+			lines := result.Files[i].Hunks[j].Lines
+			for k := range lines {
+				if lines[k].Type == "add" || lines[k].Type == "delete" {
+					fn(&lines[k])
+				}
+			}
+		}
+	}
+}
+
+// HideMoves drops files whose changes are all Moved, as set by
+// DetectMoves, such as a file a function was only moved around in.
+func HideMoves(result *Result) {
+	kept := result.Files[:0]
+	for _, f := range result.Files {
+		if !movedOnly(&f) {
+			kept = append(kept, f)
+		}
+	}
+	result.Files = kept
+}
+
+// HideUnchangedFiles drops files whose content didn't change, such as
+// files that were only renamed or had only their mode changed, counting
+// them in HiddenFiles. Added, deleted and binary files are kept.
+func HideUnchangedFiles(result *Result) {
+	kept := result.Files[:0]
+	for _, f := range result.Files {
+		if unchanged(&f) {
+			result.HiddenFiles++
+			continue
+		}
+		kept = append(kept, f)
+	}
+	result.Files = kept
+}
+
+// unchanged reports whether file is modified or renamed without any
+// change to its content.
+func unchanged(file *FileDiff) bool {
+	if file.Status != StatusModified && file.Status != StatusRenamed {
+		return false
+	}
+	return !file.IsBinary && len(file.Hunks) == 0 && file.Additions == 0 && file.Deletions == 0
+}
+
+// movedOnly reports whether file has changes and all of them are moved.
+func movedOnly(file *FileDiff) bool {
+	changed := false
+	for _, hunk := range file.Hunks {
+		for _, line := range hunk.Lines {
+			if line.Type == "context" {
+				continue
+			}
+			if !line.Moved {
+				return false
+			}
+			changed = true
+		}
+	}
+	return changed
+}
+
+// RelateCopies sets RelatedTo on added files with the same content as a
+// deleted or renamed file in result, and on that file, so that reviewers
+// can tell a copy or a split from new code. Added and deleted files carry
+// their content in their hunks; renamed files are looked up by their new
+// name with content, and skipped if content is nil or doesn't know them.
+// A file is related to at most one other, the first one found.
+func RelateCopies(result *Result, content func(path string) ([]byte, bool)) {
+	added := make(map[[sha256.Size]byte]*FileDiff)
+	for i := range result.Files {
+		f := &result.Files[i]
+		if f.Status != StatusAdded || f.IsBinary || len(f.Hunks) == 0 {
+			continue
+		}
+		sum := linesHash(sideLines(f, "add"))
+		if _, ok := added[sum]; !ok {
+			added[sum] = f
+		}
+	}
+	if len(added) == 0 {
+		return
+	}
+
+	for i := range result.Files {
+		f := &result.Files[i]
+		if f.IsBinary || f.RelatedTo != "" {
+			continue
+		}
+		var lines []string
+		switch f.Status {
+		case StatusDeleted:
+			if len(f.Hunks) == 0 {
+				continue
+			}
+			lines = sideLines(f, "delete")
+		case StatusRenamed:
+			if content == nil {
+				continue
+			}
+			data, ok := content(f.NewName)
+			if !ok || len(data) == 0 {
+				continue
+			}
+			lines = strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+		default:
+			continue
+		}
+		dup, ok := added[linesHash(lines)]
+		if !ok || dup.RelatedTo != "" {
+			continue
+		}
+		dup.RelatedTo = f.Path()
+		f.RelatedTo = dup.NewName
+	}
+}
+
+// sideLines returns the content of the lines of file's hunks of type typ,
+// which for an added or deleted file is the whole file.
+func sideLines(file *FileDiff, typ string) []string {
+	var lines []string
+	for _, hunk := range file.Hunks {
+		for _, line := range hunk.Lines {
+			if line.Type != typ {
+				continue
+			}
+			content := line.Content
+			if line.Encoding == "base64" {
+				content = line.Raw
+			}
+			lines = append(lines, content)
+		}
+	}
+	return lines
+}
+
+// linesHash returns the SHA-256 of lines, each terminated by a newline.
+func linesHash(lines []string) [sha256.Size]byte {
+	h := sha256.New()
+	for _, line := range lines {
+		h.Write([]byte(line))
+		h.Write([]byte{'\n'})
+	}
+	var sum [sha256.Size]byte
+	h.Sum(sum[:0])
+	return sum
+}
+
+// TruncateLines shortens lines longer than maxLen bytes and marks them
+// Truncated, so that huge single-line files (e.g. minified JS) don't
+// overwhelm the browser. Truncated lines lose their word segments and raw
+// bytes. A maxLen of 0 disables truncation.
+func TruncateLines(result *Result, maxLen int) {
+	if maxLen <= 0 {
+		return
+	}
+	for i := range result.Files {
+		for j := range result.Files[i].Hunks {
+			lines := result.Files[i].Hunks[j].Lines
+			for k := range lines {
+				if len(lines[k].Content) <= maxLen {
+					continue
+				}
+				cut := maxLen
+				for cut > 0 && !utf8.RuneStart(lines[k].Content[cut]) {
+					cut--
+				}
+				lines[k].Content = lines[k].Content[:cut]
+				lines[k].Truncated = true
+				lines[k].Segments = nil
+				lines[k].Encoding = ""
+				lines[k].Raw = ""
+			}
+		}
+	}
+}
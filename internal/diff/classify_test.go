@@ -0,0 +1,308 @@
+package diff
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestClassifyEOLOnly(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  bool
+	}{
+		{
+			name: "CRLF to LF conversion",
+			input: "diff --git a/win.txt b/win.txt\n" +
+				"--- a/win.txt\n" +
+				"+++ b/win.txt\n" +
+				"@@ -1,3 +1,3 @@\n" +
+				"-first\r\n" +
+				"-second\r\n" +
+				"-third\r\n" +
+				"+first\n" +
+				"+second\n" +
+				"+third\n",
+			want: true,
+		},
+		{
+			name: "LF to CRLF with context",
+			input: "diff --git a/unix.txt b/unix.txt\n" +
+				"--- a/unix.txt\n" +
+				"+++ b/unix.txt\n" +
+				"@@ -1,3 +1,3 @@\n" +
+				" keep\n" +
+				"-change\n" +
+				"+change\r\n" +
+				" keep\n",
+			want: true,
+		},
+		{
+			name: "content change",
+			input: "diff --git a/a.txt b/a.txt\n" +
+				"--- a/a.txt\n" +
+				"+++ b/a.txt\n" +
+				"@@ -1 +1 @@\n" +
+				"-hello\r\n" +
+				"+goodbye\n",
+			want: false,
+		},
+		{
+			name: "EOL change plus added line",
+			input: "diff --git a/a.txt b/a.txt\n" +
+				"--- a/a.txt\n" +
+				"+++ b/a.txt\n" +
+				"@@ -1 +1,2 @@\n" +
+				"-hello\r\n" +
+				"+hello\n" +
+				"+extra\n",
+			want: false,
+		},
+		{
+			name: "pure addition",
+			input: "diff --git a/a.txt b/a.txt\n" +
+				"--- /dev/null\n" +
+				"+++ b/a.txt\n" +
+				"@@ -0,0 +1 @@\n" +
+				"+hello\n",
+			want: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := Parse(tt.input)
+			if err != nil {
+				t.Fatalf("Parse() returned error: %v", err)
+			}
+			ClassifyEOLOnly(result)
+			if len(result.Files) != 1 {
+				t.Fatalf("got %d files, want 1", len(result.Files))
+			}
+			if got := result.Files[0].EOLOnly; got != tt.want {
+				t.Errorf("EOLOnly = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestClassifyWhitespaceOnly(t *testing.T) {
+	input := "diff --git a/main.go b/main.go\n" +
+		"--- a/main.go\n" +
+		"+++ b/main.go\n" +
+		"@@ -1,4 +1,4 @@\n" +
+		" func main() {\n" +
+		"-fmt.Println(\"a\")\n" +
+		"-fmt.Println(\"b\")  \n" +
+		"+\tfmt.Println(\"a\")\n" +
+		"+\tfmt.Println(\"b\")\n" +
+		" }\n" +
+		"@@ -10,3 +10,3 @@ func helper() {\n" +
+		" \tx := 1\n" +
+		"-\ty := 2\n" +
+		"+\ty := 3\n" +
+		" \treturn x + y\n"
+	result, err := Parse(input)
+	if err != nil {
+		t.Fatalf("Parse() returned error: %v", err)
+	}
+	ClassifyWhitespaceOnly(result)
+
+	hunks := result.Files[0].Hunks
+	if !hunks[0].WhitespaceOnly {
+		t.Error("reindentation hunk: WhitespaceOnly = false, want true")
+	}
+	if hunks[1].WhitespaceOnly {
+		t.Error("content change hunk: WhitespaceOnly = true, want false")
+	}
+}
+
+func TestDetectMovesAndHideMoves(t *testing.T) {
+	input := "diff --git a/reordered.go b/reordered.go\n" +
+		"--- a/reordered.go\n" +
+		"+++ b/reordered.go\n" +
+		"@@ -1,6 +1,6 @@\n" +
+		"-func b() {}\n" +
+		"-\n" +
+		" func a() {}\n" +
+		"+\n" +
+		"+func b() {}\n" +
+		" \n" +
+		" func c() {}\n" +
+		"diff --git a/old.go b/old.go\n" +
+		"--- a/old.go\n" +
+		"+++ b/old.go\n" +
+		"@@ -1,3 +1,2 @@\n" +
+		" package old\n" +
+		"-func moved() {}\n" +
+		" // end\n" +
+		"diff --git a/new.go b/new.go\n" +
+		"--- a/new.go\n" +
+		"+++ b/new.go\n" +
+		"@@ -1,2 +1,4 @@\n" +
+		" package new\n" +
+		"+func moved() {}\n" +
+		"+func added() {}\n" +
+		" // end\n"
+	result, err := Parse(input)
+	if err != nil {
+		t.Fatalf("Parse() returned error: %v", err)
+	}
+	DetectMoves(result)
+
+	// The moved function keeps its flag on both ends, the new one doesn't.
+	lines := result.Files[2].Hunks[0].Lines
+	if !lines[1].Moved || lines[2].Moved {
+		t.Errorf("new.go: Moved = %v, %v, want true, false", lines[1].Moved, lines[2].Moved)
+	}
+	if !result.Files[1].Hunks[0].Lines[1].Moved {
+		t.Error("old.go: deleted line not Moved")
+	}
+
+	HideMoves(result)
+	var got []string
+	for _, f := range result.Files {
+		got = append(got, f.Path())
+	}
+	if want := []string{"new.go"}; strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("files after HideMoves = %q, want %q", got, want)
+	}
+}
+
+func TestHideUnchangedFiles(t *testing.T) {
+	input := "diff --git a/run.sh b/run.sh\n" +
+		"old mode 100644\n" +
+		"new mode 100755\n" +
+		"diff --git a/old.go b/new.go\n" +
+		"similarity index 100%\n" +
+		"rename from old.go\n" +
+		"rename to new.go\n" +
+		"diff --git a/empty.txt b/empty.txt\n" +
+		"new file mode 100644\n" +
+		"index 0000000..e69de29\n" +
+		"diff --git a/main.go b/main.go\n" +
+		"old mode 100644\n" +
+		"new mode 100755\n" +
+		"--- a/main.go\n" +
+		"+++ b/main.go\n" +
+		"@@ -1 +1 @@\n" +
+		"-package old\n" +
+		"+package main\n"
+	result, err := Parse(input)
+	if err != nil {
+		t.Fatalf("Parse() returned error: %v", err)
+	}
+
+	HideUnchangedFiles(result)
+	var got []string
+	for _, f := range result.Files {
+		got = append(got, f.Path())
+	}
+	if want := []string{"empty.txt", "main.go"}; strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("files after HideUnchangedFiles = %q, want %q", got, want)
+	}
+	if result.HiddenFiles != 2 {
+		t.Errorf("HiddenFiles = %d, want 2", result.HiddenFiles)
+	}
+}
+
+func TestRelateCopies(t *testing.T) {
+	input := "diff --git a/old.txt b/gone.txt\n" +
+		"similarity index 100%\n" +
+		"rename from old.txt\n" +
+		"rename to gone.txt\n" +
+		"diff --git a/copy.txt b/copy.txt\n" +
+		"new file mode 100644\n" +
+		"--- /dev/null\n" +
+		"+++ b/copy.txt\n" +
+		"@@ -0,0 +1,2 @@\n" +
+		"+one\n" +
+		"+two\n" +
+		"diff --git a/split.txt b/split.txt\n" +
+		"deleted file mode 100644\n" +
+		"--- a/split.txt\n" +
+		"+++ /dev/null\n" +
+		"@@ -1 +0,0 @@\n" +
+		"-three\n" +
+		"diff --git a/part.txt b/part.txt\n" +
+		"new file mode 100644\n" +
+		"--- /dev/null\n" +
+		"+++ b/part.txt\n" +
+		"@@ -0,0 +1 @@\n" +
+		"+three\n" +
+		"diff --git a/new.txt b/new.txt\n" +
+		"new file mode 100644\n" +
+		"--- /dev/null\n" +
+		"+++ b/new.txt\n" +
+		"@@ -0,0 +1 @@\n" +
+		"+four\n"
+	result, err := Parse(input)
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	RelateCopies(result, func(path string) ([]byte, bool) {
+		if path == "gone.txt" {
+			return []byte("one\ntwo\n"), true
+		}
+		return nil, false
+	})
+
+	want := map[string]string{
+		"gone.txt":  "copy.txt",
+		"copy.txt":  "gone.txt",
+		"split.txt": "part.txt",
+		"part.txt":  "split.txt",
+		"new.txt":   "",
+	}
+	for _, f := range result.Files {
+		if f.RelatedTo != want[f.Path()] {
+			t.Errorf("%s: expected RelatedTo %q, got %q", f.Path(), want[f.Path()], f.RelatedTo)
+		}
+	}
+
+	// Without content, renames can't be compared.
+	result, _ = Parse(input)
+	RelateCopies(result, nil)
+	if got := result.Files[1].RelatedTo; got != "" {
+		t.Errorf("copy.txt: expected no relation without content, got %q", got)
+	}
+}
+
+func TestTruncateLines(t *testing.T) {
+	long := strings.Repeat("x", 99) + "é" + strings.Repeat("y", 100)
+	result := &Result{Files: []FileDiff{{
+		NewName: "app.min.js",
+		Hunks: []Hunk{{Lines: []Line{
+			{Type: "delete", Content: "short", OldNum: 1},
+			{Type: "add", Content: long, NewNum: 1, Segments: []Segment{{Type: "add", Text: long}}},
+		}}},
+	}}}
+
+	TruncateLines(result, 100)
+
+	lines := result.Files[0].Hunks[0].Lines
+	if lines[0].Truncated || lines[0].Content != "short" {
+		t.Errorf("short line should be untouched, got %+v", lines[0])
+	}
+	if !lines[1].Truncated {
+		t.Error("expected long line to be flagged truncated")
+	}
+	// The cut must not split the two-byte "é".
+	if want := strings.Repeat("x", 99); lines[1].Content != want {
+		t.Errorf("Content = %q, want %q", lines[1].Content, want)
+	}
+	if lines[1].Segments != nil {
+		t.Error("expected segments to be dropped from truncated line")
+	}
+}
+
+func TestTruncateLines_Disabled(t *testing.T) {
+	long := strings.Repeat("x", 1000)
+	result := &Result{Files: []FileDiff{{Hunks: []Hunk{{Lines: []Line{{Type: "add", Content: long}}}}}}}
+
+	TruncateLines(result, 0)
+
+	if line := result.Files[0].Hunks[0].Lines[0]; line.Truncated || line.Content != long {
+		t.Error("expected no truncation with maxLen 0")
+	}
+}
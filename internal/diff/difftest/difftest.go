@@ -0,0 +1,154 @@
+// Package difftest builds unified diffs and parsed results for tests.
+//
+// GenerateDiff turns before/after file contents into the text git diff
+// would print for them, so tests can describe a change instead of
+// hand-writing hunk headers and line counts.
+package difftest
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/lundberg/ghdiff/internal/diff"
+)
+
+// context is the number of unchanged lines shown around a change, as in
+// git diff's default -U3.
+const context = 3
+
+// FileSpec describes one file of a generated diff by its contents before
+// and after the change.
+type FileSpec struct {
+	Name    string // path after the change
+	OldName string // path before the change, if the file was renamed
+	Status  string // "added", "deleted", or empty for a modified or renamed file
+	Old     string // contents before the change; ignored for added files
+	New     string // contents after the change; ignored for deleted files
+}
+
+// GenerateDiff returns a "git diff" style unified diff of files. Each
+// file gets at most one hunk, spanning from its first to its last changed
+// line. Contents without a trailing newline get a "\ No newline at end
+// of file" marker.
+func GenerateDiff(files ...FileSpec) string {
+	var b strings.Builder
+	for _, f := range files {
+		writeFile(&b, f)
+	}
+	return b.String()
+}
+
+// Result parses GenerateDiff(files...). It panics if the generated diff
+// does not parse, which would be a bug in this package.
+func Result(files ...FileSpec) *diff.Result {
+	result, err := diff.Parse(GenerateDiff(files...))
+	if err != nil {
+		panic("difftest: generated diff does not parse: " + err.Error())
+	}
+	return result
+}
+
+// SampleFiles is a small change touching one file of each status.
+var SampleFiles = []FileSpec{
+	{
+		Name: "main.go",
+		Old:  "package main\n\nimport \"fmt\"\n\nfunc main() {\n\tfmt.Println(\"hello\")\n}\n",
+		New:  "package main\n\nimport \"fmt\"\n\nfunc main() {\n\tfmt.Println(\"hello, world\")\n}\n",
+	},
+	{Name: "docs/NOTES.md", Status: "added", New: "# Notes\n\nFirst draft.\n"},
+	{Name: "old.txt", Status: "deleted", Old: "obsolete\n"},
+	{Name: "internal/util.go", OldName: "util.go", Old: "package util\n", New: "package util\n\n// Helper does nothing.\nfunc Helper() {}\n"},
+}
+
+// Sample returns SampleFiles parsed. Each call returns a new result that
+// the caller may modify.
+func Sample() *diff.Result {
+	return Result(SampleFiles...)
+}
+
+func writeFile(b *strings.Builder, f FileSpec) {
+	oldName, newName := f.OldName, f.Name
+	if oldName == "" {
+		oldName = newName
+	}
+	oldPath, newPath := "a/"+oldName, "b/"+newName
+	before, after := splitLines(f.Old), splitLines(f.New)
+
+	fmt.Fprintf(b, "diff --git a/%s b/%s\n", oldName, newName)
+	switch f.Status {
+	case "added":
+		b.WriteString("new file mode 100644\n")
+		before, oldPath = nil, "/dev/null"
+	case "deleted":
+		b.WriteString("deleted file mode 100644\n")
+		after, newPath = nil, "/dev/null"
+	default:
+		if oldName != newName {
+			fmt.Fprintf(b, "rename from %s\nrename to %s\n", oldName, newName)
+		}
+	}
+	if slices.Equal(before, after) && f.Status == "" {
+		return // pure rename or no change: no hunk
+	}
+	fmt.Fprintf(b, "--- %s\n+++ %s\n", oldPath, newPath)
+	writeHunk(b, before, after)
+}
+
+// writeHunk writes a single hunk covering every difference between the
+// before and after lines, with up to context unchanged lines on either
+// side.
+func writeHunk(b *strings.Builder, before, after []string) {
+	prefix := 0
+	for prefix < len(before) && prefix < len(after) && before[prefix] == after[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(before)-prefix && suffix < len(after)-prefix &&
+		before[len(before)-1-suffix] == after[len(after)-1-suffix] {
+		suffix++
+	}
+	start := max(prefix-context, 0)
+	trailing := min(suffix, context)
+	oldEnd, newEnd := len(before)-suffix, len(after)-suffix
+
+	fmt.Fprintf(b, "@@ -%s +%s @@\n",
+		hunkRange(start, oldEnd+trailing-start), hunkRange(start, newEnd+trailing-start))
+	writeLines(b, " ", before[start:prefix])
+	writeLines(b, "-", before[prefix:oldEnd])
+	writeLines(b, "+", after[prefix:newEnd])
+	writeLines(b, " ", before[oldEnd:oldEnd+trailing])
+}
+
+// hunkRange formats one side of a hunk header for count lines after the
+// first start lines, the way git does: an empty range names the line
+// before it, and a count of 1 is left out.
+func hunkRange(start, count int) string {
+	switch count {
+	case 0:
+		return fmt.Sprintf("%d,0", start)
+	case 1:
+		return fmt.Sprintf("%d", start+1)
+	}
+	return fmt.Sprintf("%d,%d", start+1, count)
+}
+
+func writeLines(b *strings.Builder, marker string, lines []string) {
+	for _, line := range lines {
+		b.WriteString(marker)
+		b.WriteString(line)
+		if !strings.HasSuffix(line, "\n") {
+			b.WriteString("\n\\ No newline at end of file\n")
+		}
+	}
+}
+
+// splitLines splits s into lines that keep their trailing newline, so a
+// last line without one differs from the same text with one.
+func splitLines(s string) []string {
+	lines := strings.SplitAfter(s, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
@@ -0,0 +1,138 @@
+package difftest
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/lundberg/ghdiff/internal/diff"
+)
+
+func TestGenerateDiff(t *testing.T) {
+	got := GenerateDiff(FileSpec{
+		Name: "a.txt",
+		Old:  "1\n2\n3\n4\n5\n6\n7\n8\n9\n",
+		New:  "1\n2\n3\n4\nfive\n6\n7\n8\n9\n",
+	})
+	want := `diff --git a/a.txt b/a.txt
+--- a/a.txt
++++ b/a.txt
+@@ -2,7 +2,7 @@
+ 2
+ 3
+ 4
+-5
++five
+ 6
+ 7
+ 8
+`
+	if got != want {
+		t.Errorf("GenerateDiff:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestGenerateDiffRoundTrip(t *testing.T) {
+	tests := []struct {
+		name string
+		spec FileSpec
+		// want is the parsed file, without hunks.
+		want                 diff.FileDiff
+		additions, deletions int
+	}{
+		{
+			name:      "modified",
+			spec:      FileSpec{Name: "main.go", Old: "a\nb\nc\n", New: "a\nB\nc\n"},
+			want:      diff.FileDiff{OldName: "main.go", NewName: "main.go", Status: "modified"},
+			additions: 1, deletions: 1,
+		},
+		{
+			name:      "added",
+			spec:      FileSpec{Name: "new.txt", Status: "added", New: "x\ny\n"},
+			want:      diff.FileDiff{OldName: "/dev/null", NewName: "new.txt", Status: "added"},
+			additions: 2,
+		},
+		{
+			name:      "deleted",
+			spec:      FileSpec{Name: "old.txt", Status: "deleted", Old: "x\n"},
+			want:      diff.FileDiff{OldName: "old.txt", NewName: "/dev/null", Status: "deleted"},
+			deletions: 1,
+		},
+		{
+			name: "pure rename",
+			spec: FileSpec{Name: "b.txt", OldName: "a.txt", Old: "same\n", New: "same\n"},
+			want: diff.FileDiff{OldName: "a.txt", NewName: "b.txt", Status: "renamed"},
+		},
+		{
+			name:      "missing trailing newline",
+			spec:      FileSpec{Name: "f.txt", Old: "a\nb", New: "a\nb\n"},
+			want:      diff.FileDiff{OldName: "f.txt", NewName: "f.txt", Status: "modified"},
+			additions: 1, deletions: 1,
+		},
+		{
+			name:      "append at end",
+			spec:      FileSpec{Name: "f.txt", Old: "1\n2\n3\n4\n5\n", New: "1\n2\n3\n4\n5\n6\n"},
+			want:      diff.FileDiff{OldName: "f.txt", NewName: "f.txt", Status: "modified"},
+			additions: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			text := GenerateDiff(tt.spec)
+			result, err := diff.Parse(text)
+			if err != nil {
+				t.Fatalf("Parse: %v\n%s", err, text)
+			}
+			if len(result.Files) != 1 {
+				t.Fatalf("expected 1 file, got %d:\n%s", len(result.Files), text)
+			}
+			f := result.Files[0]
+			if f.OldName != tt.want.OldName || f.NewName != tt.want.NewName || f.Status != tt.want.Status {
+				t.Errorf("got %q -> %q (%s), want %q -> %q (%s)", f.OldName, f.NewName, f.Status,
+					tt.want.OldName, tt.want.NewName, tt.want.Status)
+			}
+			if f.Additions != tt.additions || f.Deletions != tt.deletions {
+				t.Errorf("got +%d -%d, want +%d -%d\n%s", f.Additions, f.Deletions, tt.additions, tt.deletions, text)
+			}
+			checkLineNumbers(t, f)
+		})
+	}
+}
+
+// checkLineNumbers verifies that each hunk's lines agree with its header.
+func checkLineNumbers(t *testing.T, f diff.FileDiff) {
+	t.Helper()
+	for _, h := range f.Hunks {
+		var oldLines, newLines int
+		for _, line := range h.Lines {
+			switch line.Type {
+			case "context":
+				oldLines++
+				newLines++
+			case "delete":
+				oldLines++
+			case "add":
+				newLines++
+			}
+		}
+		if oldLines != h.OldLines || newLines != h.NewLines {
+			t.Errorf("hunk %q has %d old and %d new lines", h.Header, oldLines, newLines)
+		}
+	}
+}
+
+func TestSample(t *testing.T) {
+	result := Sample()
+	var statuses []string
+	for _, f := range result.Files {
+		statuses = append(statuses, string(f.Status))
+	}
+	if got := strings.Join(statuses, ","); got != "modified,added,deleted,renamed" {
+		t.Errorf("unexpected statuses %s", got)
+	}
+
+	// Callers get their own copy.
+	result.Files = nil
+	if len(Sample().Files) != len(SampleFiles) {
+		t.Error("Sample returned a shared result")
+	}
+}
@@ -0,0 +1,160 @@
+package diff
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// EditorConfig holds the tab widths set by an .editorconfig file.
+// Only the file at the repository root is read; nested .editorconfig
+// files are not merged in.
+type EditorConfig struct {
+	sections []editorConfigSection
+}
+
+type editorConfigSection struct {
+	pattern  *regexp.Regexp
+	tabWidth int // 0 if the section doesn't set one
+}
+
+// ParseEditorConfig parses the sections of an .editorconfig file that set
+// tab_width or a numeric indent_size, which tab_width defaults to.
+// Sections with patterns it can't parse are skipped.
+func ParseEditorConfig(data string) *EditorConfig {
+	var c EditorConfig
+	var cur *editorConfigSection
+	var tabWidth, indentSize int
+	flush := func() {
+		if cur == nil {
+			return
+		}
+		cur.tabWidth = tabWidth
+		if cur.tabWidth == 0 {
+			cur.tabWidth = indentSize
+		}
+		if cur.tabWidth > 0 {
+			c.sections = append(c.sections, *cur)
+		}
+	}
+	for _, line := range strings.Split(data, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || line[0] == '#' || line[0] == ';' {
+			continue
+		}
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			flush()
+			cur, tabWidth, indentSize = nil, 0, 0
+			if re, err := regexp.Compile(editorConfigGlob(line[1 : len(line)-1])); err == nil {
+				cur = &editorConfigSection{pattern: re}
+			}
+			continue
+		}
+		key, value, ok := strings.Cut(line, "=")
+		if !ok {
+			continue
+		}
+		n, err := strconv.Atoi(strings.TrimSpace(value))
+		if err != nil || n <= 0 {
+			continue
+		}
+		switch strings.ToLower(strings.TrimSpace(key)) {
+		case "tab_width":
+			tabWidth = n
+		case "indent_size":
+			indentSize = n
+		}
+	}
+	flush()
+	return &c
+}
+
+// TabWidth returns the tab width for a path relative to the repository
+// root, or 0 if no section sets one. Later sections take precedence.
+func (c *EditorConfig) TabWidth(path string) int {
+	width := 0
+	for _, s := range c.sections {
+		if s.pattern.MatchString(path) {
+			width = s.tabWidth
+		}
+	}
+	return width
+}
+
+// editorConfigGlob translates an EditorConfig section glob to an anchored
+// regular expression. A glob without a slash matches the file name in any
+// directory, as in .gitignore.
+func editorConfigGlob(glob string) string {
+	var b strings.Builder
+	b.WriteString("^")
+	if !strings.Contains(glob, "/") {
+		b.WriteString("(?:.*/)?")
+	}
+	glob = strings.TrimPrefix(glob, "/")
+	depth := 0 // nesting of {a,b} groups
+	for i := 0; i < len(glob); i++ {
+		switch c := glob[i]; c {
+		case '*':
+			if i+1 < len(glob) && glob[i+1] == '*' {
+				b.WriteString(".*")
+				i++
+			} else {
+				b.WriteString("[^/]*")
+			}
+		case '?':
+			b.WriteString("[^/]")
+		case '{':
+			b.WriteString("(?:")
+			depth++
+		case '}':
+			if depth > 0 {
+				b.WriteString(")")
+				depth--
+			} else {
+				b.WriteString(`\}`)
+			}
+		case ',':
+			if depth > 0 {
+				b.WriteString("|")
+			} else {
+				b.WriteString(",")
+			}
+		case '[':
+			end := strings.IndexByte(glob[i:], ']')
+			if end < 0 {
+				b.WriteString(`\[`)
+				continue
+			}
+			class := glob[i+1 : i+end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			b.WriteString("[" + class + "]")
+			i += end
+		case '\\':
+			if i+1 < len(glob) {
+				i++
+				b.WriteString(regexp.QuoteMeta(glob[i : i+1]))
+			}
+		default:
+			b.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	b.WriteString("$")
+	return b.String()
+}
+
+// SetTabWidths sets each file's TabWidth to the first non-zero width that
+// sources return for its path, or to def if none does.
+func SetTabWidths(result *Result, def int, sources ...func(path string) int) {
+	for i := range result.Files {
+		f := &result.Files[i]
+		f.TabWidth = def
+		for _, width := range sources {
+			if w := width(f.Path()); w > 0 {
+				f.TabWidth = w
+				break
+			}
+		}
+	}
+}
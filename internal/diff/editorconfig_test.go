@@ -0,0 +1,70 @@
+package diff
+
+import "testing"
+
+func TestEditorConfigTabWidth(t *testing.T) {
+	cfg := ParseEditorConfig(`root = true
+
+[*]
+indent_style = space
+indent_size = 2
+
+[*.go]
+indent_style = tab
+tab_width = 4
+
+[{Makefile,*.mk}]
+indent_size = tab
+tab_width = 8
+
+[docs/**.md]
+indent_size = 3
+
+[vendor/*]
+indent_size = unset
+`)
+
+	tests := []struct {
+		path string
+		want int
+	}{
+		{"main.go", 4},
+		{"internal/diff/parser.go", 4},
+		{"web/js/app.js", 2},
+		{"Makefile", 8},
+		{"build/rules.mk", 8},
+		{"docs/guide/intro.md", 3},
+		{"README.md", 2},
+		{"vendor/lib.c", 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			if got := cfg.TabWidth(tt.path); got != tt.want {
+				t.Errorf("TabWidth(%q) = %d, want %d", tt.path, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSetTabWidths(t *testing.T) {
+	result := &Result{Files: []FileDiff{
+		{NewName: "a.go"},
+		{NewName: "b.py"},
+		{OldName: "c.txt", NewName: "/dev/null", Status: "deleted"},
+	}}
+	editorConfig := ParseEditorConfig("[*.go]\ntab_width = 4\n").TabWidth
+	attributes := func(path string) int {
+		if path == "a.go" || path == "c.txt" {
+			return 2
+		}
+		return 0
+	}
+	SetTabWidths(result, 8, editorConfig, attributes)
+
+	want := []int{4, 8, 2}
+	for i, w := range want {
+		if got := result.Files[i].TabWidth; got != w {
+			t.Errorf("file %d: TabWidth = %d, want %d", i, got, w)
+		}
+	}
+}
@@ -0,0 +1,43 @@
+package diff
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+// languages maps file extensions to language names.
+var languages = map[string]string{
+	".c":     "c",
+	".h":     "c",
+	".cc":    "cpp",
+	".cpp":   "cpp",
+	".hpp":   "cpp",
+	".cs":    "csharp",
+	".css":   "css",
+	".go":    "go",
+	".html":  "html",
+	".java":  "java",
+	".js":    "javascript",
+	".mjs":   "javascript",
+	".json":  "json",
+	".kt":    "kotlin",
+	".md":    "markdown",
+	".php":   "php",
+	".py":    "python",
+	".rb":    "ruby",
+	".rs":    "rust",
+	".sh":    "shell",
+	".sql":   "sql",
+	".swift": "swift",
+	".toml":  "toml",
+	".ts":    "typescript",
+	".tsx":   "typescript",
+	".yaml":  "yaml",
+	".yml":   "yaml",
+}
+
+// LanguageForPath returns the language of path based on its extension, or
+// "" if it is not recognized.
+func LanguageForPath(path string) string {
+	return languages[strings.ToLower(filepath.Ext(path))]
+}
@@ -0,0 +1,43 @@
+package diff
+
+import (
+	"fmt"
+	"strings"
+)
+
+// LogFormat is the "git log --format" value ParseLog expects: each commit
+// starts with a record separator, followed by NUL-separated hash, author,
+// date and subject.
+const LogFormat = "%x1e%H%x00%an%x00%ai%x00%s"
+
+// ParseLog parses the output of "git log -p --format=" + LogFormat into
+// one CommitDiff per commit, newest first as git prints them.
+func ParseLog(input string) (*Log, error) {
+	log := &Log{}
+	for _, record := range strings.Split(input, "\x1e") {
+		if strings.TrimSpace(record) == "" {
+			continue
+		}
+		header, body, _ := strings.Cut(record, "\n")
+		fields := strings.SplitN(header, "\x00", 4)
+		if len(fields) != 4 {
+			return nil, fmt.Errorf("invalid log header %q", header)
+		}
+		result, err := Parse(body)
+		if err != nil {
+			return nil, fmt.Errorf("commit %s: %w", fields[0], err)
+		}
+		files := result.Files
+		if files == nil {
+			files = []FileDiff{}
+		}
+		log.Commits = append(log.Commits, CommitDiff{
+			Hash:    fields[0],
+			Author:  fields[1],
+			Date:    fields[2],
+			Subject: fields[3],
+			Files:   files,
+		})
+	}
+	return log, nil
+}
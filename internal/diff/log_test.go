@@ -0,0 +1,58 @@
+package diff
+
+import "testing"
+
+func TestParseLog(t *testing.T) {
+	input := "\x1eaaa111\x00Alice\x002024-01-02 10:00:00 +0000\x00update foo\n" +
+		"\n" +
+		"diff --git a/foo.go b/foo.go\n" +
+		"index 1234567..abcdef0 100644\n" +
+		"--- a/foo.go\n" +
+		"+++ b/foo.go\n" +
+		"@@ -1 +1 @@\n" +
+		"-old\n" +
+		"+new\n" +
+		"\x1ebbb222\x00Bob\x002024-01-01 10:00:00 +0000\x00add foo\n" +
+		"\n" +
+		"diff --git a/foo.go b/foo.go\n" +
+		"new file mode 100644\n" +
+		"index 0000000..1234567\n" +
+		"--- /dev/null\n" +
+		"+++ b/foo.go\n" +
+		"@@ -0,0 +1 @@\n" +
+		"+old\n"
+
+	log, err := ParseLog(input)
+	if err != nil {
+		t.Fatalf("ParseLog: %v", err)
+	}
+	if len(log.Commits) != 2 {
+		t.Fatalf("expected 2 commits, got %d", len(log.Commits))
+	}
+
+	first := log.Commits[0]
+	if first.Hash != "aaa111" || first.Author != "Alice" || first.Subject != "update foo" {
+		t.Errorf("unexpected first commit: %+v", first)
+	}
+	if len(first.Files) != 1 || first.Files[0].Status != "modified" || first.Files[0].Additions != 1 {
+		t.Errorf("unexpected files in first commit: %+v", first.Files)
+	}
+
+	second := log.Commits[1]
+	if second.Hash != "bbb222" || second.Date != "2024-01-01 10:00:00 +0000" {
+		t.Errorf("unexpected second commit: %+v", second)
+	}
+	if len(second.Files) != 1 || second.Files[0].Status != "added" {
+		t.Errorf("unexpected files in second commit: %+v", second.Files)
+	}
+}
+
+func TestParseLog_Empty(t *testing.T) {
+	log, err := ParseLog("")
+	if err != nil {
+		t.Fatalf("ParseLog: %v", err)
+	}
+	if len(log.Commits) != 0 {
+		t.Errorf("expected no commits, got %+v", log.Commits)
+	}
+}
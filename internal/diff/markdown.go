@@ -0,0 +1,66 @@
+package diff
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Markdown formats result as GitHub-flavored markdown for pasting into
+// issues and pull requests: each file's path in bold, followed by its hunks
+// in a fenced diff code block. Files without hunks, such as binary files
+// or pure renames, get only the path and a note.
+func Markdown(result *Result) string {
+	var b strings.Builder
+	for i := range result.Files {
+		f := &result.Files[i]
+		if i > 0 {
+			b.WriteString("\n")
+		}
+		if f.Status == StatusRenamed {
+			fmt.Fprintf(&b, "**`%s` → `%s`**", f.OldName, f.NewName)
+		} else {
+			fmt.Fprintf(&b, "**`%s`**", f.Path())
+		}
+		if len(f.Hunks) == 0 {
+			note := string(f.Status)
+			if f.IsBinary {
+				note = "binary, " + note
+			}
+			fmt.Fprintf(&b, " (%s)\n", note)
+			continue
+		}
+		b.WriteString("\n\n")
+
+		fence := markdownFence(f.Hunks)
+		b.WriteString(fence + "diff\n")
+		for _, hunk := range f.Hunks {
+			b.WriteString(hunk.Header + "\n")
+			for _, line := range hunk.Lines {
+				b.WriteString(lineMarkers[line.Type] + line.Content + "\n")
+			}
+		}
+		b.WriteString(fence + "\n")
+	}
+	return b.String()
+}
+
+// markdownFence returns a backtick fence longer than any run of backticks
+// in hunks, so that content such as a markdown file's own code blocks
+// can't close the block early.
+func markdownFence(hunks []Hunk) string {
+	longest := 0
+	for _, hunk := range hunks {
+		for _, line := range hunk.Lines {
+			run := 0
+			for _, r := range line.Content {
+				if r != '`' {
+					run = 0
+					continue
+				}
+				run++
+				longest = max(longest, run)
+			}
+		}
+	}
+	return strings.Repeat("`", max(3, longest+1))
+}
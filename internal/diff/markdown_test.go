@@ -0,0 +1,42 @@
+package diff
+
+import "testing"
+
+func TestMarkdown(t *testing.T) {
+	input := "diff --git a/README.md b/README.md\n" +
+		"index 1234567..abcdef0 100644\n" +
+		"--- a/README.md\n" +
+		"+++ b/README.md\n" +
+		"@@ -1,3 +1,3 @@ Intro\n" +
+		" ```go\n" +
+		"-x := 1\n" +
+		"+x := 2\n" +
+		" ```\n" +
+		"diff --git a/old.png b/new.png\n" +
+		"similarity index 100%\n" +
+		"rename from old.png\n" +
+		"rename to new.png\n" +
+		"diff --git a/logo.bin b/logo.bin\n" +
+		"index 1234567..abcdef0 100644\n" +
+		"Binary files a/logo.bin and b/logo.bin differ\n"
+	result, err := Parse(input)
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+
+	// The README's own fences are context lines indented by one space,
+	// which would close a three-backtick block.
+	want := "**`README.md`**\n\n" +
+		"````diff\n" +
+		"@@ -1,3 +1,3 @@ Intro\n" +
+		" ```go\n" +
+		"-x := 1\n" +
+		"+x := 2\n" +
+		" ```\n" +
+		"````\n" +
+		"\n**`old.png` → `new.png`** (renamed)\n" +
+		"\n**`logo.bin`** (binary, modified)\n"
+	if got := Markdown(result); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
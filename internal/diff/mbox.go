@@ -0,0 +1,116 @@
+package diff
+
+import (
+	"fmt"
+	"io"
+	"mime"
+	"net/mail"
+	"regexp"
+	"strings"
+)
+
+var (
+	// mboxFromRe matches the "From <hash> <date>" line that starts each
+	// message of an mbox, as written by git format-patch.
+	mboxFromRe = regexp.MustCompile(`^From (\S+) +\w{3} \w{3} +\d+ \d\d:\d\d:\d\d \d{4}$`)
+	// patchPrefixRe matches the "[PATCH n/m]" prefix of a patch subject.
+	patchPrefixRe = regexp.MustCompile(`^\[[^\]]*PATCH[^\]]*\]\s*`)
+	// hashRe matches a full commit hash.
+	hashRe = regexp.MustCompile(`^[0-9a-f]{40}([0-9a-f]{24})?$`)
+)
+
+// ParseMbox parses a patch series in mbox format, as produced by
+// "git format-patch", into one CommitDiff per patch in the order given.
+// The mail headers provide the author, date and subject; the commit
+// message, diffstat and signature around the diff are dropped. Hash is
+// empty for messages whose "From " line doesn't carry a commit hash.
+func ParseMbox(input string) (*Log, error) {
+	log := &Log{}
+	var hash string
+	var msg []string
+	flush := func() error {
+		if msg == nil {
+			return nil
+		}
+		commit, err := parsePatchMail(strings.Join(msg, "\n"))
+		if err != nil {
+			return fmt.Errorf("patch %d: %w", len(log.Commits)+1, err)
+		}
+		commit.Hash = hash
+		log.Commits = append(log.Commits, commit)
+		return nil
+	}
+	for _, line := range strings.Split(input, "\n") {
+		if m := mboxFromRe.FindStringSubmatch(line); m != nil {
+			if err := flush(); err != nil {
+				return nil, err
+			}
+			hash, msg = "", []string{}
+			if hashRe.MatchString(m[1]) {
+				hash = m[1]
+			}
+			continue
+		}
+		if msg != nil {
+			msg = append(msg, line)
+		}
+	}
+	if err := flush(); err != nil {
+		return nil, err
+	}
+	return log, nil
+}
+
+// parsePatchMail parses one mail of a patch series, without its "From "
+// line.
+func parsePatchMail(text string) (CommitDiff, error) {
+	m, err := mail.ReadMessage(strings.NewReader(text))
+	if err != nil {
+		return CommitDiff{}, fmt.Errorf("reading mail headers: %w", err)
+	}
+	var dec mime.WordDecoder
+	commit := CommitDiff{Files: []FileDiff{}}
+
+	subject, err := dec.DecodeHeader(m.Header.Get("Subject"))
+	if err != nil {
+		subject = m.Header.Get("Subject")
+	}
+	commit.Subject = patchPrefixRe.ReplaceAllString(subject, "")
+
+	commit.Author = m.Header.Get("From")
+	if addr, err := mail.ParseAddress(commit.Author); err == nil {
+		commit.Author = addr.Name
+		if commit.Author == "" {
+			commit.Author = addr.Address
+		}
+	}
+
+	commit.Date = m.Header.Get("Date")
+	if date, err := m.Header.Date(); err == nil {
+		// The format of "git log --format=%ai", as in ParseLog.
+		commit.Date = date.Format("2006-01-02 15:04:05 -0700")
+	}
+
+	body, err := io.ReadAll(m.Body)
+	if err != nil {
+		return CommitDiff{}, fmt.Errorf("reading mail body: %w", err)
+	}
+	patch := "\n" + string(body)
+	start := strings.Index(patch, "\ndiff --git ")
+	if start < 0 {
+		return commit, nil
+	}
+	patch = patch[start+1:]
+	// The "-- " signature line would otherwise parse as a deleted line.
+	if end := strings.LastIndex(patch, "\n-- \n"); end >= 0 {
+		patch = patch[:end+1]
+	}
+	result, err := Parse(patch)
+	if err != nil {
+		return CommitDiff{}, err
+	}
+	if result.Files != nil {
+		commit.Files = result.Files
+	}
+	return commit, nil
+}
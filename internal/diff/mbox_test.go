@@ -0,0 +1,79 @@
+package diff
+
+import "testing"
+
+func TestParseMbox(t *testing.T) {
+	input := `From c41dd74c05872c2b2a172167a236cb53bfb9ee71 Mon Sep 17 00:00:00 2001
+From: Ada Lovelace <ada@example.com>
+Date: Wed, 2 Oct 2024 11:30:00 +0200
+Subject: [PATCH 1/2] Change two to a digit
+
+Body line.
+---
+ a.txt | 2 +-
+ 1 file changed, 1 insertion(+), 1 deletion(-)
+
+diff --git a/a.txt b/a.txt
+index 814f4a4..99b356d 100644
+--- a/a.txt
++++ b/a.txt
+@@ -1,2 +1,2 @@
+ one
+-two
++2
+-- 
+2.39.5
+
+
+From ffd4bb87236ad61c775ef90ab8df4f7c110879f4 Mon Sep 17 00:00:00 2001
+From: =?UTF-8?q?J=C3=B6rg=20M=C3=BCller?= <jorg@example.com>
+Date: Thu, 3 Oct 2024 09:15:00 +0200
+Subject: [PATCH 2/2] Add b.txt with a subject long enough
+ to be folded
+
+---
+ b.txt | 1 +
+ 1 file changed, 1 insertion(+)
+ create mode 100644 b.txt
+
+diff --git a/b.txt b/b.txt
+new file mode 100644
+index 0000000..ce01362
+--- /dev/null
++++ b/b.txt
+@@ -0,0 +1 @@
++hello
+-- 
+2.39.5
+
+`
+	log, err := ParseMbox(input)
+	if err != nil {
+		t.Fatalf("ParseMbox: %v", err)
+	}
+	if len(log.Commits) != 2 {
+		t.Fatalf("expected 2 commits, got %d", len(log.Commits))
+	}
+
+	first, second := log.Commits[0], log.Commits[1]
+	if first.Hash != "c41dd74c05872c2b2a172167a236cb53bfb9ee71" || first.Subject != "Change two to a digit" ||
+		first.Author != "Ada Lovelace" || first.Date != "2024-10-02 11:30:00 +0200" {
+		t.Errorf("unexpected first commit: %+v", first)
+	}
+	if second.Hash != "ffd4bb87236ad61c775ef90ab8df4f7c110879f4" || second.Subject != "Add b.txt with a subject long enough to be folded" ||
+		second.Author != "Jörg Müller" {
+		t.Errorf("unexpected second commit: %+v", second)
+	}
+
+	if len(first.Files) != 1 || first.Files[0].NewName != "a.txt" || first.Files[0].Status != "modified" {
+		t.Fatalf("unexpected first commit files: %+v", first.Files)
+	}
+	// The signature after the diff is not part of the last hunk.
+	lines := first.Files[0].Hunks[0].Lines
+	if len(lines) != 3 || lines[1].Content != "two" || lines[2].Content != "2" {
+		t.Errorf("unexpected first commit lines: %+v", lines)
+	}
+	if len(second.Files) != 1 || second.Files[0].NewName != "b.txt" || second.Files[0].Status != "added" || second.Files[0].Additions != 1 {
+		t.Errorf("unexpected second commit files: %+v", second.Files)
+	}
+}
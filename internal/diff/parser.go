@@ -2,22 +2,58 @@
 package diff
 
 import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
 	"fmt"
+	"io"
+	"path/filepath"
 	"regexp"
 	"strconv"
 	"strings"
+	"unicode/utf8"
 )
 
 var (
 	diffHeaderRe = regexp.MustCompile(`^diff --git a/(.+) b/(.+)$`)
+	// noPrefixRe matches headers from "git diff --no-prefix" (or with
+	// diff.noprefix set), where the names lack the a/ and b/ prefixes.
+	noPrefixRe   = regexp.MustCompile(`^diff --git (.+)$`)
 	hunkHeaderRe = regexp.MustCompile(`^@@ -(\d+)(?:,(\d+))? \+(\d+)(?:,(\d+))? @@(.*)$`)
 	renameFromRe = regexp.MustCompile(`^rename from (.+)$`)
 	renameToRe   = regexp.MustCompile(`^rename to (.+)$`)
 	binaryRe     = regexp.MustCompile(`^Binary files (.+) and (.+) differ$`)
+	// modeRe matches the extended header lines that carry a file mode.
+	modeRe = regexp.MustCompile(`^(?:(?:new file|deleted file|old|new) mode|index [0-9a-f]+\.\.[0-9a-f]+) ([0-7]{6})$`)
 )
 
+// ErrUnrecognizedFormat is returned by Parse and ParseWordDiff for input
+// without any diff headers, such as the output of a custom diff driver
+// that doesn't write unified diffs, which would otherwise parse as no
+// changes at all.
+var ErrUnrecognizedFormat = errors.New("input doesn't look like a unified diff")
+
+// symlinkMode is the git file mode of symbolic links.
+const symlinkMode = "120000"
+
+// hunkParser parses the hunk whose header match is hm, advancing i past
+// all lines belonging to it.
+type hunkParser func(hm, lines []string, i *int) (Hunk, error)
+
 // Parse parses a unified diff string into structured data.
 func Parse(input string) (*Result, error) {
+	return parse(input, parseHunk)
+}
+
+// ParseWordDiff parses the output of "git diff --word-diff=porcelain".
+// Each changed line is returned as a delete/add pair whose Segments mark
+// the words git reported as removed or added.
+func ParseWordDiff(input string) (*Result, error) {
+	return parse(input, parseWordDiffHunk)
+}
+
+func parse(input string, hunkFn hunkParser) (*Result, error) {
 	if input == "" {
 		return &Result{}, nil
 	}
@@ -28,16 +64,17 @@ func Parse(input string) (*Result, error) {
 
 	for i < len(lines) {
 		// Look for diff header
-		m := diffHeaderRe.FindStringSubmatch(lines[i])
-		if m == nil {
+		var file FileDiff
+		prefixed := true
+		if m := diffHeaderRe.FindStringSubmatch(lines[i]); m != nil {
+			file.OldName, file.NewName = m[1], m[2]
+		} else if m := noPrefixRe.FindStringSubmatch(lines[i]); m != nil {
+			file.OldName, file.NewName = splitNoPrefixNames(m[1])
+			prefixed = false
+		} else {
 			i++
 			continue
 		}
-
-		file := FileDiff{
-			OldName: m[1],
-			NewName: m[2],
-		}
 		i++
 
 		// Parse extended header lines until we hit --- or another diff header or a hunk or binary
@@ -50,46 +87,68 @@ func Parse(input string) (*Result, error) {
 
 			if rm := renameFromRe.FindStringSubmatch(line); rm != nil {
 				file.OldName = rm[1]
-				file.Status = "renamed"
+				file.Status = StatusRenamed
 				i++
 				continue
 			}
 			if rm := renameToRe.FindStringSubmatch(line); rm != nil {
 				file.NewName = rm[1]
-				file.Status = "renamed"
+				file.Status = StatusRenamed
+				i++
+				continue
+			}
+
+			if mm := modeRe.FindStringSubmatch(line); mm != nil {
+				if mm[1] == symlinkMode {
+					file.IsSymlink = true
+				}
+				// Empty added and deleted files have no ---/+++ lines
+				// to tell their status by.
+				switch {
+				case strings.HasPrefix(line, "new file mode "):
+					file.Status = StatusAdded
+				case strings.HasPrefix(line, "deleted file mode "):
+					file.Status = StatusDeleted
+				}
 				i++
 				continue
 			}
 
 			if bm := binaryRe.FindStringSubmatch(line); bm != nil {
 				file.IsBinary = true
+				// The rename lines already gave the exact names, which
+				// "Binary files ... and ... differ" may not split right.
+				if file.Status == StatusRenamed {
+					i++
+					break
+				}
 				// Extract names from "Binary files a/foo and b/bar differ"
 				oldSide := bm[1]
 				newSide := bm[2]
 				if oldSide == "/dev/null" {
 					file.OldName = "/dev/null"
-					file.Status = "added"
+					file.Status = StatusAdded
 				} else {
-					file.OldName = strings.TrimPrefix(oldSide, "a/")
+					file.OldName = parseFileName(oldSide, prefixed)
 				}
 				if newSide == "/dev/null" {
 					file.NewName = "/dev/null"
-					file.Status = "deleted"
+					file.Status = StatusDeleted
 				} else {
-					file.NewName = strings.TrimPrefix(newSide, "b/")
+					file.NewName = parseFileName(newSide, prefixed)
 				}
 				if file.Status == "" {
-					file.Status = "modified"
+					file.Status = StatusModified
 				}
 				i++
 				break
 			}
 
 			if strings.HasPrefix(line, "--- ") {
-				file.OldName = parseFileName(line[4:])
+				file.OldName = parseFileName(line[4:], prefixed)
 				i++
 				if i < len(lines) && strings.HasPrefix(lines[i], "+++ ") {
-					file.NewName = parseFileName(lines[i][4:])
+					file.NewName = parseFileName(lines[i][4:], prefixed)
 					i++
 				}
 
@@ -97,11 +156,11 @@ func Parse(input string) (*Result, error) {
 				if file.Status == "" {
 					switch {
 					case file.OldName == "/dev/null":
-						file.Status = "added"
+						file.Status = StatusAdded
 					case file.NewName == "/dev/null":
-						file.Status = "deleted"
+						file.Status = StatusDeleted
 					default:
-						file.Status = "modified"
+						file.Status = StatusModified
 					}
 				}
 				break
@@ -127,41 +186,148 @@ func Parse(input string) (*Result, error) {
 				continue
 			}
 
-			hunk, err := parseHunk(hm, lines, &i)
+			hunk, err := hunkFn(hm, lines, &i)
 			if err != nil {
 				return nil, err
 			}
 			file.Hunks = append(file.Hunks, hunk)
+			for _, l := range hunk.Lines {
+				if l.Encoding != "" {
+					file.InvalidUTF8 = true
+				}
+				switch l.Type {
+				case "add":
+					file.Additions++
+				case "delete":
+					file.Deletions++
+				}
+			}
 		}
 
 		// Default status if not set
 		if file.Status == "" {
-			file.Status = "modified"
+			file.Status = StatusModified
 		}
+		setPrecedingLines(file.Hunks)
+		file.IsImage = IsImagePath(file.Path())
+		file.Language = LanguageForPath(file.Path())
+		file.ContentHash = contentHash(file.Hunks)
 
 		result.Files = append(result.Files, file)
 	}
 
+	if result.Files == nil && !hasDiffHeaders(lines) {
+		return nil, ErrUnrecognizedFormat
+	}
 	return result, nil
 }
 
+// hasDiffHeaders reports whether lines are blank or have a "---" file
+// header, as diffs that parse to no files still do.
+func hasDiffHeaders(lines []string) bool {
+	blank := true
+	for _, line := range lines {
+		if strings.HasPrefix(line, "--- ") {
+			return true
+		}
+		blank = blank && strings.TrimSpace(line) == ""
+	}
+	return blank
+}
+
+// setPrecedingLines sets each hunk's PrecedingLines from the old-side
+// positions of the hunks: the lines before the first hunk, and the lines
+// between each hunk and the one before it.
+func setPrecedingLines(hunks []Hunk) {
+	next := 1 // first old line not yet covered by a hunk
+	for i := range hunks {
+		h := &hunks[i]
+		start := h.OldStart
+		if h.OldLines == 0 {
+			// "-N,0" names the line after which lines were added.
+			start++
+		}
+		h.PrecedingLines = max(start-next, 0)
+		next = start + h.OldLines
+	}
+}
+
+// lineMarkers maps line types back to their unified diff prefix.
+var lineMarkers = map[string]string{
+	"add":     "+",
+	"delete":  "-",
+	"context": " ",
+}
+
+// contentHash returns the hex SHA-256 of hunks in unified diff form, or ""
+// if there are none. Lines that aren't valid UTF-8 are hashed by their
+// original bytes.
+func contentHash(hunks []Hunk) string {
+	if len(hunks) == 0 {
+		return ""
+	}
+	h := sha256.New()
+	for _, hunk := range hunks {
+		_, _ = io.WriteString(h, hunk.Header+"\n")
+		for _, line := range hunk.Lines {
+			content := line.Content
+			if line.Encoding == "base64" {
+				content = line.Raw
+			}
+			_, _ = io.WriteString(h, lineMarkers[line.Type]+content+"\n")
+		}
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// imageExts lists file extensions the frontend can preview as images.
+var imageExts = map[string]bool{
+	".png":  true,
+	".jpg":  true,
+	".jpeg": true,
+	".gif":  true,
+	".webp": true,
+	".bmp":  true,
+	".ico":  true,
+	".svg":  true,
+	".avif": true,
+}
+
+// IsImagePath reports whether path has an image file extension.
+func IsImagePath(path string) bool {
+	return imageExts[strings.ToLower(filepath.Ext(path))]
+}
+
 // parseFileName extracts the file name from a --- or +++ line value.
-// Handles "a/path", "b/path", and "/dev/null".
-func parseFileName(s string) string {
+// Handles "a/path", "b/path", and "/dev/null". The a/ or b/ prefix is only
+// stripped when the diff was generated with prefixes, so that in
+// --no-prefix output a directory named "a" or "b" is kept.
+func parseFileName(s string, prefixed bool) string {
 	s = strings.TrimSpace(s)
 	if s == "/dev/null" {
 		return "/dev/null"
 	}
 	// Strip the a/ or b/ prefix
-	if strings.HasPrefix(s, "a/") || strings.HasPrefix(s, "b/") {
+	if prefixed && (strings.HasPrefix(s, "a/") || strings.HasPrefix(s, "b/")) {
 		return s[2:]
 	}
 	return s
 }
 
-// parseHunk parses a single hunk starting at the @@ header line.
-// It advances i past all lines belonging to this hunk.
-func parseHunk(hm, lines []string, i *int) (Hunk, error) {
+// splitNoPrefixNames splits the names of a --no-prefix diff header. When
+// the file was not renamed both names are equal, which splits names with
+// spaces correctly; otherwise it splits at the first space, and the
+// ---/+++ or rename lines that follow supply the exact names.
+func splitNoPrefixNames(s string) (string, string) {
+	if n := len(s) / 2; len(s)%2 == 1 && s[n] == ' ' && s[:n] == s[n+1:] {
+		return s[:n], s[n+1:]
+	}
+	oldName, newName, _ := strings.Cut(s, " ")
+	return oldName, newName
+}
+
+// newHunk builds a Hunk from a matched @@ header line.
+func newHunk(hm []string) (Hunk, error) {
 	oldStart, err := strconv.Atoi(hm[1])
 	if err != nil {
 		return Hunk{}, fmt.Errorf("invalid old start: %w", err)
@@ -199,16 +365,35 @@ func parseHunk(hm, lines []string, i *int) (Hunk, error) {
 		header += " " + funcCtx
 	}
 
-	hunk := Hunk{
+	return Hunk{
 		OldStart: oldStart,
 		OldLines: oldLines,
 		NewStart: newStart,
 		NewLines: newLines,
 		Header:   header,
+	}, nil
+}
+
+// isNoNewlineMarker reports whether line is git's "\ No newline at end of
+// file" marker, which follows the last line of a file without a trailing
+// newline. It belongs to the hunk but is not a line of it. The text after
+// the backslash is translated in localized git output, and other tools
+// write just the backslash, so only that is checked. Wherever it appears,
+// even with no line before it, the marker is skipped.
+func isNoNewlineMarker(line string) bool {
+	return strings.HasPrefix(line, `\`)
+}
+
+// parseHunk parses a single hunk starting at the @@ header line.
+// It advances i past all lines belonging to this hunk.
+func parseHunk(hm, lines []string, i *int) (Hunk, error) {
+	hunk, err := newHunk(hm)
+	if err != nil {
+		return Hunk{}, err
 	}
 
-	oldNum := oldStart
-	newNum := newStart
+	oldNum := hunk.OldStart
+	newNum := hunk.NewStart
 	*i++ // advance past @@ line
 
 loop:
@@ -220,8 +405,7 @@ loop:
 			break
 		}
 
-		// Skip "no newline" marker
-		if strings.HasPrefix(line, `\ No newline at end of file`) {
+		if isNoNewlineMarker(line) {
 			*i++
 			continue
 		}
@@ -265,8 +449,142 @@ loop:
 			break loop
 		}
 
+		// encoding/json would silently replace invalid bytes, so keep the
+		// original bytes around for the client.
+		if !utf8.ValidString(content) {
+			last := &hunk.Lines[len(hunk.Lines)-1]
+			last.Content = strings.ToValidUTF8(content, "\uFFFD")
+			last.Encoding = "base64"
+			last.Raw = base64.StdEncoding.EncodeToString([]byte(content))
+		}
+
 		*i++
 	}
 
 	return hunk, nil
 }
+
+// parseWordDiffHunk parses a single hunk of porcelain word-diff output.
+// Each input line is one segment: ' ' context, '-' removed, '+' added, and
+// '~' ends the current line. It advances i past all lines of the hunk.
+func parseWordDiffHunk(hm, lines []string, i *int) (Hunk, error) {
+	hunk, err := newHunk(hm)
+	if err != nil {
+		return Hunk{}, err
+	}
+
+	oldNum := hunk.OldStart
+	newNum := hunk.NewStart
+	var segments []Segment
+	*i++ // advance past @@ line
+
+	// flush turns the segments collected since the last '~' into lines.
+	flush := func() {
+		var oldText, newText strings.Builder
+		var oldSegs, newSegs []Segment
+		hasAdd, hasDelete, hasContext := false, false, false
+		for _, seg := range segments {
+			switch seg.Type {
+			case "context":
+				hasContext = true
+				oldText.WriteString(seg.Text)
+				newText.WriteString(seg.Text)
+				oldSegs = append(oldSegs, seg)
+				newSegs = append(newSegs, seg)
+			case "delete":
+				hasDelete = true
+				oldText.WriteString(seg.Text)
+				oldSegs = append(oldSegs, seg)
+			case "add":
+				hasAdd = true
+				newText.WriteString(seg.Text)
+				newSegs = append(newSegs, seg)
+			}
+		}
+		segments = nil
+
+		switch {
+		case !hasAdd && !hasDelete:
+			hunk.Lines = append(hunk.Lines, Line{
+				Type:    "context",
+				Content: oldText.String(),
+				OldNum:  oldNum,
+				NewNum:  newNum,
+			})
+			oldNum++
+			newNum++
+		case hasDelete && !hasAdd && !hasContext:
+			hunk.Lines = append(hunk.Lines, Line{
+				Type:    "delete",
+				Content: oldText.String(),
+				OldNum:  oldNum,
+			})
+			oldNum++
+		case hasAdd && !hasDelete && !hasContext:
+			hunk.Lines = append(hunk.Lines, Line{
+				Type:    "add",
+				Content: newText.String(),
+				NewNum:  newNum,
+			})
+			newNum++
+		default:
+			hunk.Lines = append(hunk.Lines,
+				Line{
+					Type:     "delete",
+					Content:  oldText.String(),
+					OldNum:   oldNum,
+					Segments: oldSegs,
+				},
+				Line{
+					Type:     "add",
+					Content:  newText.String(),
+					NewNum:   newNum,
+					Segments: newSegs,
+				},
+			)
+			oldNum++
+			newNum++
+		}
+	}
+
+loop:
+	for *i < len(lines) {
+		line := lines[*i]
+
+		// Stop at next hunk or next diff
+		if strings.HasPrefix(line, "@@ ") || strings.HasPrefix(line, "diff --git ") {
+			break
+		}
+
+		if isNoNewlineMarker(line) {
+			*i++
+			continue
+		}
+
+		if line == "" {
+			*i++
+			break
+		}
+
+		switch line[0] {
+		case ' ':
+			segments = append(segments, Segment{Type: "context", Text: line[1:]})
+		case '-':
+			segments = append(segments, Segment{Type: "delete", Text: line[1:]})
+		case '+':
+			segments = append(segments, Segment{Type: "add", Text: line[1:]})
+		case '~':
+			flush()
+		default:
+			// Unknown prefix, likely end of hunk
+			break loop
+		}
+
+		*i++
+	}
+	if len(segments) > 0 {
+		flush()
+	}
+
+	return hunk, nil
+}
@@ -1,6 +1,10 @@
 package diff
 
 import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"strings"
 	"testing"
 )
@@ -188,6 +192,206 @@ index 1234567..abcdef0 100644
 				},
 			},
 		},
+		{
+			name: "renamed file with changes in several hunks",
+			input: `diff --git a/old.txt b/new.txt
+similarity index 59%
+rename from old.txt
+rename to new.txt
+index 0ff3bbb..53eba72 100644
+--- a/old.txt
++++ b/new.txt
+@@ -1,6 +1,6 @@
+ 1
+ 2
+-3
++three
+ 4
+ 5
+ 6
+@@ -8,13 +8,14 @@
+ 8
+ 9
+ 10
++ten-and-a-half
+ 11
+ 12
+ 13
+ 14
+ 15
+ 16
+-17
++seventeen
+ 18
+ 19
+ 20
+`,
+			expected: &Result{
+				Files: []FileDiff{
+					{
+						OldName: "old.txt",
+						NewName: "new.txt",
+						Status:  "renamed",
+						Hunks: []Hunk{
+							{
+								OldStart: 1,
+								OldLines: 6,
+								NewStart: 1,
+								NewLines: 6,
+								Header:   "@@ -1,6 +1,6 @@",
+								Lines: []Line{
+									{Type: "context", Content: "1", OldNum: 1, NewNum: 1},
+									{Type: "context", Content: "2", OldNum: 2, NewNum: 2},
+									{Type: "delete", Content: "3", OldNum: 3},
+									{Type: "add", Content: "three", NewNum: 3},
+									{Type: "context", Content: "4", OldNum: 4, NewNum: 4},
+									{Type: "context", Content: "5", OldNum: 5, NewNum: 5},
+									{Type: "context", Content: "6", OldNum: 6, NewNum: 6},
+								},
+							},
+							{
+								OldStart: 8,
+								OldLines: 13,
+								NewStart: 8,
+								NewLines: 14,
+								Header:   "@@ -8,13 +8,14 @@",
+								Lines: []Line{
+									{Type: "context", Content: "8", OldNum: 8, NewNum: 8},
+									{Type: "context", Content: "9", OldNum: 9, NewNum: 9},
+									{Type: "context", Content: "10", OldNum: 10, NewNum: 10},
+									{Type: "add", Content: "ten-and-a-half", NewNum: 11},
+									{Type: "context", Content: "11", OldNum: 11, NewNum: 12},
+									{Type: "context", Content: "12", OldNum: 12, NewNum: 13},
+									{Type: "context", Content: "13", OldNum: 13, NewNum: 14},
+									{Type: "context", Content: "14", OldNum: 14, NewNum: 15},
+									{Type: "context", Content: "15", OldNum: 15, NewNum: 16},
+									{Type: "context", Content: "16", OldNum: 16, NewNum: 17},
+									{Type: "delete", Content: "17", OldNum: 17},
+									{Type: "add", Content: "seventeen", NewNum: 18},
+									{Type: "context", Content: "18", OldNum: 18, NewNum: 19},
+									{Type: "context", Content: "19", OldNum: 19, NewNum: 20},
+									{Type: "context", Content: "20", OldNum: 20, NewNum: 21},
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+		{
+			name: "renamed file with hunks starting at different lines",
+			input: `diff --git a/old.txt b/moved.txt
+similarity index 84%
+rename from old.txt
+rename to moved.txt
+index 0ff3bbb..7710be5 100644
+--- a/old.txt
++++ b/moved.txt
+@@ -1,5 +1,3 @@
+-1
+-2
+ 3
+ 4
+ 5
+@@ -12,7 +10,7 @@
+ 12
+ 13
+ 14
+-15
++fifteen
+ 16
+ 17
+ 18
+`,
+			expected: &Result{
+				Files: []FileDiff{
+					{
+						OldName: "old.txt",
+						NewName: "moved.txt",
+						Status:  "renamed",
+						Hunks: []Hunk{
+							{
+								OldStart: 1,
+								OldLines: 5,
+								NewStart: 1,
+								NewLines: 3,
+								Header:   "@@ -1,5 +1,3 @@",
+								Lines: []Line{
+									{Type: "delete", Content: "1", OldNum: 1},
+									{Type: "delete", Content: "2", OldNum: 2},
+									{Type: "context", Content: "3", OldNum: 3, NewNum: 1},
+									{Type: "context", Content: "4", OldNum: 4, NewNum: 2},
+									{Type: "context", Content: "5", OldNum: 5, NewNum: 3},
+								},
+							},
+							{
+								OldStart: 12,
+								OldLines: 7,
+								NewStart: 10,
+								NewLines: 7,
+								Header:   "@@ -12,7 +10,7 @@",
+								Lines: []Line{
+									{Type: "context", Content: "12", OldNum: 12, NewNum: 10},
+									{Type: "context", Content: "13", OldNum: 13, NewNum: 11},
+									{Type: "context", Content: "14", OldNum: 14, NewNum: 12},
+									{Type: "delete", Content: "15", OldNum: 15},
+									{Type: "add", Content: "fifteen", NewNum: 13},
+									{Type: "context", Content: "16", OldNum: 16, NewNum: 14},
+									{Type: "context", Content: "17", OldNum: 17, NewNum: 15},
+									{Type: "context", Content: "18", OldNum: 18, NewNum: 16},
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+		{
+			// Copies are reported as modified, as git --name-status is
+			// mapped in ParseSummary.
+			name: "copied file with changes",
+			input: `diff --git a/old.txt b/copy.txt
+similarity index 84%
+copy from old.txt
+copy to copy.txt
+index 0ff3bbb..ac71085 100644
+--- a/old.txt
++++ b/copy.txt
+@@ -16,5 +16,5 @@
+ 16
+ 17
+ 18
+-19
++nineteen
+ 20
+`,
+			expected: &Result{
+				Files: []FileDiff{
+					{
+						OldName: "old.txt",
+						NewName: "copy.txt",
+						Status:  "modified",
+						Hunks: []Hunk{
+							{
+								OldStart: 16,
+								OldLines: 5,
+								NewStart: 16,
+								NewLines: 5,
+								Header:   "@@ -16,5 +16,5 @@",
+								Lines: []Line{
+									{Type: "context", Content: "16", OldNum: 16, NewNum: 16},
+									{Type: "context", Content: "17", OldNum: 17, NewNum: 17},
+									{Type: "context", Content: "18", OldNum: 18, NewNum: 18},
+									{Type: "delete", Content: "19", OldNum: 19},
+									{Type: "add", Content: "nineteen", NewNum: 19},
+									{Type: "context", Content: "20", OldNum: 20, NewNum: 20},
+								},
+							},
+						},
+					},
+				},
+			},
+		},
 		{
 			name: "multiple files",
 			input: `diff --git a/a.txt b/a.txt
@@ -282,6 +486,26 @@ Binary files a/image.png and b/image.png differ
 				},
 			},
 		},
+		{
+			name: "renamed and changed binary file",
+			input: `diff --git a/logos and icons/old.png b/logos and icons/new.png
+similarity index 80%
+rename from logos and icons/old.png
+rename to logos and icons/new.png
+index 1234567..abcdef0 100644
+Binary files a/logos and icons/old.png and b/logos and icons/new.png differ
+`,
+			expected: &Result{
+				Files: []FileDiff{
+					{
+						OldName:  "logos and icons/old.png",
+						NewName:  "logos and icons/new.png",
+						Status:   "renamed",
+						IsBinary: true,
+					},
+				},
+			},
+		},
 		{
 			name: "hunk header with function context",
 			input: `diff --git a/main.go b/main.go
@@ -655,6 +879,106 @@ index 0000000..1234567
 				},
 			},
 		},
+		{
+			name: "no-prefix file modification",
+			input: `diff --git hello.go hello.go
+index 1234567..abcdef0 100644
+--- hello.go
++++ hello.go
+@@ -1 +1 @@
+-old
++new
+`,
+			expected: &Result{
+				Files: []FileDiff{
+					{
+						OldName: "hello.go",
+						NewName: "hello.go",
+						Status:  "modified",
+						Hunks: []Hunk{
+							{
+								OldStart: 1,
+								OldLines: 1,
+								NewStart: 1,
+								NewLines: 1,
+								Header:   "@@ -1 +1 @@",
+								Lines: []Line{
+									{Type: "delete", Content: "old", OldNum: 1},
+									{Type: "add", Content: "new", NewNum: 1},
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+		{
+			name: "no-prefix file in directory named a",
+			input: `diff --git a/b/x.go a/b/x.go
+index 1234567..abcdef0 100644
+--- a/b/x.go
++++ a/b/x.go
+@@ -1 +1 @@
+-old
++new
+`,
+			expected: &Result{
+				Files: []FileDiff{
+					{
+						OldName: "a/b/x.go",
+						NewName: "a/b/x.go",
+						Status:  "modified",
+						Hunks: []Hunk{
+							{
+								OldStart: 1,
+								OldLines: 1,
+								NewStart: 1,
+								NewLines: 1,
+								Header:   "@@ -1 +1 @@",
+								Lines: []Line{
+									{Type: "delete", Content: "old", OldNum: 1},
+									{Type: "add", Content: "new", NewNum: 1},
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+		{
+			name: "no-prefix binary file with spaces in name",
+			input: `diff --git img/my logo.png img/my logo.png
+index 1234567..abcdef0 100644
+Binary files img/my logo.png and img/my logo.png differ
+`,
+			expected: &Result{
+				Files: []FileDiff{
+					{
+						OldName:  "img/my logo.png",
+						NewName:  "img/my logo.png",
+						Status:   "modified",
+						IsBinary: true,
+					},
+				},
+			},
+		},
+		{
+			name: "no-prefix rename",
+			input: `diff --git old name.txt new name.txt
+similarity index 100%
+rename from old name.txt
+rename to new name.txt
+`,
+			expected: &Result{
+				Files: []FileDiff{
+					{
+						OldName: "old name.txt",
+						NewName: "new name.txt",
+						Status:  "renamed",
+					},
+				},
+			},
+		},
 	}
 
 	for _, tt := range tests {
@@ -732,3 +1056,554 @@ index 0000000..1234567
 		})
 	}
 }
+
+func TestParse_InvalidUTF8(t *testing.T) {
+	// "caf\xe9" is "café" in Latin-1.
+	input := "diff --git a/menu.txt b/menu.txt\n" +
+		"--- a/menu.txt\n" +
+		"+++ b/menu.txt\n" +
+		"@@ -1 +1 @@\n" +
+		"-cafe\n" +
+		"+caf\xe9\n"
+
+	result, err := Parse(input)
+	if err != nil {
+		t.Fatalf("Parse() returned error: %v", err)
+	}
+	if len(result.Files) != 1 {
+		t.Fatalf("got %d files, want 1", len(result.Files))
+	}
+	file := result.Files[0]
+	if !file.InvalidUTF8 {
+		t.Error("expected InvalidUTF8 to be set on file")
+	}
+
+	lines := file.Hunks[0].Lines
+	if lines[0].Encoding != "" || lines[0].Raw != "" {
+		t.Errorf("valid line should not be encoded, got %+v", lines[0])
+	}
+	if lines[1].Content != "caf\uFFFD" {
+		t.Errorf("Content = %q, want %q", lines[1].Content, "caf\uFFFD")
+	}
+	if lines[1].Encoding != "base64" {
+		t.Errorf("Encoding = %q, want base64", lines[1].Encoding)
+	}
+	raw, err := base64.StdEncoding.DecodeString(lines[1].Raw)
+	if err != nil {
+		t.Fatalf("decode Raw: %v", err)
+	}
+	if string(raw) != "caf\xe9" {
+		t.Errorf("Raw decodes to %q, want %q", raw, "caf\xe9")
+	}
+}
+
+func TestParseWordDiff(t *testing.T) {
+	input := `diff --git a/README.md b/README.md
+index b1472e3..be639da 100644
+--- a/README.md
++++ b/README.md
+@@ -1,4 +1,4 @@
+ The quick 
+-brown
++red
+  fox
+~
+ jumps over
+~
+-removed line
+~
++new line
+~
+`
+	result, err := ParseWordDiff(input)
+	if err != nil {
+		t.Fatalf("ParseWordDiff() returned error: %v", err)
+	}
+	if len(result.Files) != 1 {
+		t.Fatalf("got %d files, want 1", len(result.Files))
+	}
+	file := result.Files[0]
+	if file.NewName != "README.md" || file.Status != "modified" {
+		t.Errorf("got file %q status %q, want README.md modified", file.NewName, file.Status)
+	}
+	if len(file.Hunks) != 1 {
+		t.Fatalf("got %d hunks, want 1", len(file.Hunks))
+	}
+
+	want := []Line{
+		{Type: "delete", Content: "The quick brown fox", OldNum: 1, Segments: []Segment{
+			{Type: "context", Text: "The quick "},
+			{Type: "delete", Text: "brown"},
+			{Type: "context", Text: " fox"},
+		}},
+		{Type: "add", Content: "The quick red fox", NewNum: 1, Segments: []Segment{
+			{Type: "context", Text: "The quick "},
+			{Type: "add", Text: "red"},
+			{Type: "context", Text: " fox"},
+		}},
+		{Type: "context", Content: "jumps over", OldNum: 2, NewNum: 2},
+		{Type: "delete", Content: "removed line", OldNum: 3},
+		{Type: "add", Content: "new line", NewNum: 3},
+	}
+	got := file.Hunks[0].Lines
+	if len(got) != len(want) {
+		t.Fatalf("got %d lines, want %d: %+v", len(got), len(want), got)
+	}
+	for k := range want {
+		if got[k].Type != want[k].Type || got[k].Content != want[k].Content ||
+			got[k].OldNum != want[k].OldNum || got[k].NewNum != want[k].NewNum {
+			t.Errorf("line[%d] = %+v, want %+v", k, got[k], want[k])
+		}
+		if len(got[k].Segments) != len(want[k].Segments) {
+			t.Errorf("line[%d] got %d segments, want %d", k, len(got[k].Segments), len(want[k].Segments))
+			continue
+		}
+		for n := range want[k].Segments {
+			if got[k].Segments[n] != want[k].Segments[n] {
+				t.Errorf("line[%d].segment[%d] = %+v, want %+v", k, n, got[k].Segments[n], want[k].Segments[n])
+			}
+		}
+	}
+}
+
+func TestParse_IsImage(t *testing.T) {
+	input := `diff --git a/logo.PNG b/logo.PNG
+index 1234567..abcdef0 100644
+Binary files a/logo.PNG and b/logo.PNG differ
+diff --git a/old.gif b/old.gif
+deleted file mode 100644
+index 1234567..0000000
+Binary files a/old.gif and /dev/null differ
+diff --git a/main.go b/main.go
+index 1234567..abcdef0 100644
+--- a/main.go
++++ b/main.go
+@@ -1 +1 @@
+-a
++b
+`
+	result, err := Parse(input)
+	if err != nil {
+		t.Fatalf("Parse() returned error: %v", err)
+	}
+	want := map[string]bool{"logo.PNG": true, "old.gif": true, "main.go": false}
+	if len(result.Files) != len(want) {
+		t.Fatalf("got %d files, want %d", len(result.Files), len(want))
+	}
+	for _, f := range result.Files {
+		if f.IsImage != want[f.Path()] {
+			t.Errorf("%s: IsImage = %v, want %v", f.Path(), f.IsImage, want[f.Path()])
+		}
+	}
+}
+
+func TestParse_CountsAndLanguage(t *testing.T) {
+	input := `diff --git a/main.go b/main.go
+index 1234567..abcdef0 100644
+--- a/main.go
++++ b/main.go
+@@ -1,3 +1,4 @@
+ package main
+-var a = 1
++var a = 2
++var b = 3
+ func main() {}
+`
+	result, err := Parse(input)
+	if err != nil {
+		t.Fatalf("Parse() returned error: %v", err)
+	}
+	f := result.Files[0]
+	if f.Additions != 2 || f.Deletions != 1 {
+		t.Errorf("expected +2 -1, got +%d -%d", f.Additions, f.Deletions)
+	}
+	if f.Language != "go" {
+		t.Errorf("expected language go, got %q", f.Language)
+	}
+}
+
+func TestParse_ContentHash(t *testing.T) {
+	diffOf := func(name, added string) string {
+		return "diff --git a/" + name + " b/" + name + "\n" +
+			"index 1234567..abcdef0 100644\n" +
+			"--- a/" + name + "\n" +
+			"+++ b/" + name + "\n" +
+			"@@ -1,2 +1,2 @@\n" +
+			" keep\n" +
+			"-old\n" +
+			"+" + added + "\n"
+	}
+	hash := func(input string) string {
+		t.Helper()
+		result, err := Parse(input)
+		if err != nil {
+			t.Fatalf("Parse() returned error: %v", err)
+		}
+		if len(result.Files) != 1 {
+			t.Fatalf("expected 1 file, got %d", len(result.Files))
+		}
+		return result.Files[0].ContentHash
+	}
+
+	first := hash(diffOf("a.txt", "new"))
+	if len(first) != 64 {
+		t.Fatalf("expected a hex SHA-256, got %q", first)
+	}
+	if again := hash(diffOf("a.txt", "new")); again != first {
+		t.Errorf("expected identical input to hash the same, got %s and %s", first, again)
+	}
+	if changed := hash(diffOf("a.txt", "newer")); changed == first {
+		t.Error("expected changed content to hash differently")
+	}
+
+	// A deleted line that becomes a context line must change the hash.
+	moved := strings.Replace(diffOf("a.txt", "new"), "-old", " old", 1)
+	if hash(moved) == first {
+		t.Error("expected a change in line type to hash differently")
+	}
+
+	binary := "diff --git a/x.bin b/x.bin\nindex 1234567..abcdef0 100644\nBinary files a/x.bin and b/x.bin differ\n"
+	if got := hash(binary); got != "" {
+		t.Errorf("expected no hash for a binary file, got %q", got)
+	}
+}
+
+func TestParse_Symlink(t *testing.T) {
+	input := `diff --git a/link b/link
+new file mode 120000
+index 0000000..1234567
+--- /dev/null
++++ b/link
+@@ -0,0 +1 @@
++target/one
+\ No newline at end of file
+diff --git a/other b/other
+index 1234567..abcdef0 120000
+--- a/other
++++ b/other
+@@ -1 +1 @@
+-old/target
+\ No newline at end of file
++new/target
+\ No newline at end of file
+diff --git a/main.go b/main.go
+index 1234567..abcdef0 100644
+--- a/main.go
++++ b/main.go
+@@ -1 +1 @@
+-a
++b
+`
+	result, err := Parse(input)
+	if err != nil {
+		t.Fatalf("Parse() returned error: %v", err)
+	}
+	if len(result.Files) != 3 {
+		t.Fatalf("expected 3 files, got %d", len(result.Files))
+	}
+
+	created := result.Files[0]
+	if !created.IsSymlink || created.Status != "added" {
+		t.Errorf("expected added symlink, got %+v", created)
+	}
+	if got := created.Hunks[0].Lines[0].Content; got != "target/one" {
+		t.Errorf("expected target 'target/one', got %q", got)
+	}
+
+	retargeted := result.Files[1]
+	if !retargeted.IsSymlink || retargeted.Status != "modified" {
+		t.Errorf("expected modified symlink, got %+v", retargeted)
+	}
+	if retargeted.Additions != 1 || retargeted.Deletions != 1 {
+		t.Errorf("expected the target to change, got +%d -%d", retargeted.Additions, retargeted.Deletions)
+	}
+
+	if result.Files[2].IsSymlink {
+		t.Error("expected regular file not to be a symlink")
+	}
+}
+
+func TestParse_NoTrailingNewline(t *testing.T) {
+	header := "diff --git a/a.txt b/a.txt\n" +
+		"--- a/a.txt\n" +
+		"+++ b/a.txt\n"
+	tests := []struct {
+		name  string
+		input string
+		want  []string
+		adds  int
+		dels  int
+	}{
+		{"add", header + "@@ -1 +1,2 @@\n one\n+final", []string{"context one", "add final"}, 1, 0},
+		{"delete", header + "@@ -1,2 +1 @@\n one\n-final", []string{"context one", "delete final"}, 0, 1},
+		{"context", header + "@@ -1,2 +1,2 @@\n-one\n+uno\n final", []string{"delete one", "add uno", "context final"}, 1, 1},
+		// As pasted from a file with Windows line endings.
+		{"CRLF", StripCR(strings.ReplaceAll(header, "\n", "\r\n") + "@@ -1 +1,2 @@\r\n one\r\n+final\r"), []string{"context one", "add final"}, 1, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := Parse(tt.input)
+			if err != nil {
+				t.Fatalf("Parse: %v", err)
+			}
+			if len(result.Files) != 1 || len(result.Files[0].Hunks) != 1 {
+				t.Fatalf("expected 1 file with 1 hunk, got %+v", result.Files)
+			}
+			var got []string
+			for _, l := range result.Files[0].Hunks[0].Lines {
+				got = append(got, l.Type+" "+l.Content)
+			}
+			if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("expected lines %q, got %q", tt.want, got)
+			}
+			if f := result.Files[0]; f.Additions != tt.adds || f.Deletions != tt.dels {
+				t.Errorf("expected +%d -%d, got +%d -%d", tt.adds, tt.dels, f.Additions, f.Deletions)
+			}
+		})
+	}
+}
+
+func TestParse_NoNewlineMarker(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  [][]string // per file, type and content of each line
+	}{
+		{
+			name: "followed by EOF",
+			input: "diff --git a/a.txt b/a.txt\n" +
+				"--- a/a.txt\n" +
+				"+++ b/a.txt\n" +
+				"@@ -1 +1,2 @@\n" +
+				" one\n" +
+				"+two\n" +
+				`\ No newline at end of file`,
+			want: [][]string{{"context one", "add two"}},
+		},
+		{
+			name: "followed by another file",
+			input: "diff --git a/a.txt b/a.txt\n" +
+				"--- a/a.txt\n" +
+				"+++ b/a.txt\n" +
+				"@@ -1 +1 @@\n" +
+				"-one\n" +
+				"+uno\n" +
+				`\ No newline at end of file` + "\n" +
+				"diff --git a/b.txt b/b.txt\n" +
+				"--- a/b.txt\n" +
+				"+++ b/b.txt\n" +
+				"@@ -1 +1 @@\n" +
+				"-two\n" +
+				"+dos\n",
+			want: [][]string{{"delete one", "add uno"}, {"delete two", "add dos"}},
+		},
+		{
+			name: "on both sides",
+			input: "diff --git a/a.txt b/a.txt\n" +
+				"--- a/a.txt\n" +
+				"+++ b/a.txt\n" +
+				"@@ -1,2 +1,3 @@\n" +
+				" one\n" +
+				"-two\n" +
+				`\ No newline at end of file` + "\n" +
+				"+two\n" +
+				"+three\n" +
+				`\ No newline at end of file` + "\n",
+			want: [][]string{{"context one", "delete two", "add two", "add three"}},
+		},
+		{
+			name: "localized",
+			input: "diff --git a/a.txt b/a.txt\n" +
+				"--- a/a.txt\n" +
+				"+++ b/a.txt\n" +
+				"@@ -1 +1 @@\n" +
+				"-one\n" +
+				`\ Kein Zeilenumbruch am Dateiende.` + "\n" +
+				"+one\n",
+			want: [][]string{{"delete one", "add one"}},
+		},
+		{
+			name: "first in the hunk",
+			input: "diff --git a/a.txt b/a.txt\n" +
+				"--- a/a.txt\n" +
+				"+++ b/a.txt\n" +
+				"@@ -1 +1 @@\n" +
+				`\ No newline at end of file` + "\n" +
+				"-one\n" +
+				"+uno\n",
+			want: [][]string{{"delete one", "add uno"}},
+		},
+		{
+			name: "alone in a hunk",
+			input: "diff --git a/a.txt b/a.txt\n" +
+				"--- a/a.txt\n" +
+				"+++ b/a.txt\n" +
+				"@@ -1 +1 @@\n" +
+				`\ No newline at end of file` + "\n" +
+				"@@ -5 +5 @@\n" +
+				"-five\n" +
+				"+cinco\n",
+			want: [][]string{{"delete five", "add cinco"}},
+		},
+		{
+			name: "bare backslash",
+			input: "diff --git a/a.txt b/a.txt\n" +
+				"--- a/a.txt\n" +
+				"+++ b/a.txt\n" +
+				"@@ -1,2 +1,2 @@\n" +
+				"-one\n" +
+				"\\\n" +
+				"+uno\n" +
+				" two\n",
+			want: [][]string{{"delete one", "add uno", "context two"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := Parse(tt.input)
+			if err != nil {
+				t.Fatalf("Parse: %v", err)
+			}
+			var got [][]string
+			for _, f := range result.Files {
+				var lines []string
+				for _, h := range f.Hunks {
+					for _, l := range h.Lines {
+						lines = append(lines, l.Type+" "+l.Content)
+					}
+				}
+				got = append(got, lines)
+			}
+			if fmt.Sprint(got) != fmt.Sprint(tt.want) {
+				t.Errorf("expected lines %q, got %q", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestParse_UnrecognizedFormat(t *testing.T) {
+	for _, input := range []string{
+		"Files a.txt and b.txt are different\n",
+		"1c1\n< old\n---\n> new\n",
+		"lorem ipsum dolor sit amet\nconsectetur adipiscing elit\n",
+	} {
+		if _, err := Parse(input); !errors.Is(err, ErrUnrecognizedFormat) {
+			t.Errorf("Parse(%q): expected ErrUnrecognizedFormat, got %v", input, err)
+		}
+		if _, err := ParseWordDiff(input); !errors.Is(err, ErrUnrecognizedFormat) {
+			t.Errorf("ParseWordDiff(%q): expected ErrUnrecognizedFormat, got %v", input, err)
+		}
+	}
+
+	// No changes is not an error.
+	for _, input := range []string{"", "\n", "--- a.txt\n+++ b.txt\n"} {
+		if _, err := Parse(input); err != nil {
+			t.Errorf("Parse(%q): unexpected error %v", input, err)
+		}
+	}
+}
+
+func TestParse_StatusValid(t *testing.T) {
+	// Headers without ---/+++ lines take other paths through the parser.
+	input := `diff --git a/mode.sh b/mode.sh
+old mode 100644
+new mode 100755
+diff --git a/empty.txt b/empty.txt
+new file mode 100644
+index 0000000..e69de29
+diff --git a/gone.txt b/gone.txt
+deleted file mode 100644
+index e69de29..0000000
+diff --git a/logo.png b/logo.png
+new file mode 100644
+index 0000000..1234567
+Binary files /dev/null and b/logo.png differ
+diff --git a/old.bin b/old.bin
+deleted file mode 100644
+index 1234567..0000000
+Binary files a/old.bin and /dev/null differ
+diff --git a/a.txt b/b.txt
+similarity index 100%
+rename from a.txt
+rename to b.txt
+diff --git a/src.go b/copy.go
+similarity index 100%
+copy from src.go
+copy to copy.go
+diff --git a/hello.go b/hello.go
+index 1234567..abcdef0 100644
+--- a/hello.go
++++ b/hello.go
+@@ -1 +1 @@
+-old
++new
+`
+	result, err := Parse(input)
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	if len(result.Files) != 8 {
+		t.Fatalf("expected 8 files, got %d", len(result.Files))
+	}
+	for _, f := range result.Files {
+		if !f.Status.Valid() {
+			t.Errorf("%s: invalid status %q", f.Path(), f.Status)
+		}
+	}
+	if got := result.Files[1].Status; got != StatusAdded {
+		t.Errorf("empty.txt: expected status added, got %q", got)
+	}
+	if got := result.Files[2].Status; got != StatusDeleted {
+		t.Errorf("gone.txt: expected status deleted, got %q", got)
+	}
+
+	// The JSON encoding is unchanged from when Status was a string.
+	data, err := json.Marshal(FileDiff{Status: StatusRenamed})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), `"status":"renamed"`) {
+		t.Errorf("expected status to marshal as a lowercase string, got %s", data)
+	}
+
+	if Status("copied").Valid() || Status("").Valid() {
+		t.Error("expected undefined statuses to be invalid")
+	}
+}
+
+func TestParse_PrecedingLines(t *testing.T) {
+	input := `diff --git a/f.txt b/f.txt
+--- a/f.txt
++++ b/f.txt
+@@ -5,3 +5,3 @@
+ line 5
+-line 6
++LINE 6
+ line 7
+@@ -20,2 +20,3 @@
+ line 20
++inserted
+ line 21
+@@ -30,0 +32,1 @@
++appended after line 30
+`
+	result, err := Parse(input)
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	hunks := result.Files[0].Hunks
+	if len(hunks) != 3 {
+		t.Fatalf("expected 3 hunks, got %d", len(hunks))
+	}
+	if got, want := hunks[0].PrecedingLines, hunks[0].OldStart-1; got != want {
+		t.Errorf("first hunk: PrecedingLines = %d, want OldStart-1 = %d", got, want)
+	}
+	// Lines 8-19 lie between the first and second hunks.
+	if hunks[1].PrecedingLines != 12 {
+		t.Errorf("second hunk: PrecedingLines = %d, want 12", hunks[1].PrecedingLines)
+	}
+	// An insertion after line 30 follows lines 22-30.
+	if hunks[2].PrecedingLines != 9 {
+		t.Errorf("third hunk: PrecedingLines = %d, want 9", hunks[2].PrecedingLines)
+	}
+}
@@ -0,0 +1,109 @@
+package diff
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// pairRe matches a commit-pair line of git range-diff, e.g.
+// "2:  a4f4118 ! 2:  9426386 add b" or "-:  ------- > 3:  cd20418 add e".
+var pairRe = regexp.MustCompile(`^\s*(\d+|-+):\s+([0-9a-f]+|-+) ([=!<>]) \s*(\d+|-+):\s+([0-9a-f]+|-+) (.*)$`)
+
+// rangeDiffStatus maps range-diff pair markers to CommitPair statuses.
+var rangeDiffStatus = map[string]string{
+	"=": "unchanged",
+	"!": "modified",
+	"<": "dropped",
+	">": "added",
+}
+
+// rangeDiffIndent is the indentation git puts before the nested diff of a
+// modified commit pair.
+const rangeDiffIndent = "    "
+
+// ParseRangeDiff parses the output of "git range-diff --no-color".
+//
+// Each commit pair's nested diff (a diff between the two versions of the
+// patch) is returned as hunks whose lines are typed by the outer marker:
+// a line "-+foo" is a "delete" line with content "+foo".
+func ParseRangeDiff(input string) (*RangeDiff, error) {
+	result := &RangeDiff{}
+	var pair *CommitPair
+	var hunk *Hunk
+
+	for _, line := range strings.Split(input, "\n") {
+		if m := pairRe.FindStringSubmatch(line); m != nil {
+			oldIndex, err := rangeDiffIndex(m[1])
+			if err != nil {
+				return nil, err
+			}
+			newIndex, err := rangeDiffIndex(m[4])
+			if err != nil {
+				return nil, err
+			}
+			result.Pairs = append(result.Pairs, CommitPair{
+				OldIndex: oldIndex,
+				OldHash:  rangeDiffHash(m[2]),
+				NewIndex: newIndex,
+				NewHash:  rangeDiffHash(m[5]),
+				Status:   rangeDiffStatus[m[3]],
+				Subject:  m[6],
+			})
+			pair = &result.Pairs[len(result.Pairs)-1]
+			hunk = nil
+			continue
+		}
+
+		if pair == nil || !strings.HasPrefix(line, rangeDiffIndent) {
+			continue
+		}
+		body := strings.TrimPrefix(line, rangeDiffIndent)
+
+		if strings.HasPrefix(body, "@@") {
+			pair.Hunks = append(pair.Hunks, Hunk{Header: body})
+			hunk = &pair.Hunks[len(pair.Hunks)-1]
+			continue
+		}
+		if hunk == nil {
+			pair.Hunks = append(pair.Hunks, Hunk{})
+			hunk = &pair.Hunks[len(pair.Hunks)-1]
+		}
+		if body == "" {
+			hunk.Lines = append(hunk.Lines, Line{Type: "context"})
+			continue
+		}
+
+		lineType := "context"
+		switch body[0] {
+		case '+':
+			lineType = "add"
+		case '-':
+			lineType = "delete"
+		}
+		hunk.Lines = append(hunk.Lines, Line{Type: lineType, Content: body[1:]})
+	}
+
+	return result, nil
+}
+
+// rangeDiffIndex parses a 1-based commit position; dashes mean absent (0).
+func rangeDiffIndex(s string) (int, error) {
+	if strings.Trim(s, "-") == "" {
+		return 0, nil
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid range-diff commit index %q: %w", s, err)
+	}
+	return n, nil
+}
+
+// rangeDiffHash returns the abbreviated hash, or "" for a dash placeholder.
+func rangeDiffHash(s string) string {
+	if strings.Trim(s, "-") == "" {
+		return ""
+	}
+	return s
+}
@@ -0,0 +1,76 @@
+package diff
+
+import "testing"
+
+func TestParseRangeDiff(t *testing.T) {
+	input := `1:  3bb4f11 = 1:  a57f2a1 add a
+2:  a4f4118 ! 2:  9426386 add b
+    @@ b (new)
+     +8
+     +9
+    -+10
+    ++ten
+3:  5c260d7 < -:  ------- add d
+-:  ------- > 3:  cd20418 add e
+`
+	result, err := ParseRangeDiff(input)
+	if err != nil {
+		t.Fatalf("ParseRangeDiff() returned error: %v", err)
+	}
+
+	want := []CommitPair{
+		{OldIndex: 1, OldHash: "3bb4f11", NewIndex: 1, NewHash: "a57f2a1", Status: "unchanged", Subject: "add a"},
+		{OldIndex: 2, OldHash: "a4f4118", NewIndex: 2, NewHash: "9426386", Status: "modified", Subject: "add b"},
+		{OldIndex: 3, OldHash: "5c260d7", Status: "dropped", Subject: "add d"},
+		{NewIndex: 3, NewHash: "cd20418", Status: "added", Subject: "add e"},
+	}
+	if len(result.Pairs) != len(want) {
+		t.Fatalf("got %d pairs, want %d", len(result.Pairs), len(want))
+	}
+	for i, w := range want {
+		got := result.Pairs[i]
+		if got.OldIndex != w.OldIndex || got.OldHash != w.OldHash ||
+			got.NewIndex != w.NewIndex || got.NewHash != w.NewHash ||
+			got.Status != w.Status || got.Subject != w.Subject {
+			t.Errorf("pair[%d] = %+v, want %+v", i, got, w)
+		}
+	}
+
+	for _, i := range []int{0, 2, 3} {
+		if len(result.Pairs[i].Hunks) != 0 {
+			t.Errorf("pair[%d]: expected no nested diff, got %d hunks", i, len(result.Pairs[i].Hunks))
+		}
+	}
+
+	hunks := result.Pairs[1].Hunks
+	if len(hunks) != 1 {
+		t.Fatalf("pair[1]: got %d hunks, want 1", len(hunks))
+	}
+	if hunks[0].Header != "@@ b (new)" {
+		t.Errorf("hunk header = %q, want %q", hunks[0].Header, "@@ b (new)")
+	}
+	wantLines := []Line{
+		{Type: "context", Content: "+8"},
+		{Type: "context", Content: "+9"},
+		{Type: "delete", Content: "+10"},
+		{Type: "add", Content: "+ten"},
+	}
+	if len(hunks[0].Lines) != len(wantLines) {
+		t.Fatalf("got %d lines, want %d", len(hunks[0].Lines), len(wantLines))
+	}
+	for k, w := range wantLines {
+		if got := hunks[0].Lines[k]; got.Type != w.Type || got.Content != w.Content {
+			t.Errorf("line[%d] = %+v, want %+v", k, got, w)
+		}
+	}
+}
+
+func TestParseRangeDiff_Empty(t *testing.T) {
+	result, err := ParseRangeDiff("")
+	if err != nil {
+		t.Fatalf("ParseRangeDiff() returned error: %v", err)
+	}
+	if len(result.Pairs) != 0 {
+		t.Errorf("expected no pairs, got %d", len(result.Pairs))
+	}
+}
@@ -0,0 +1,51 @@
+package diff
+
+import (
+	"cmp"
+	"slices"
+	"strings"
+)
+
+// Sort keys accepted by SortFiles.
+const (
+	SortPath   = "path"
+	SortStatus = "status"
+	SortSize   = "size"
+)
+
+// statusOrder ranks file statuses for SortStatus.
+var statusOrder = map[Status]int{
+	StatusAdded:    0,
+	StatusModified: 1,
+	StatusRenamed:  2,
+	StatusDeleted:  3,
+}
+
+// SortFiles stably reorders result.Files by path, status, or size (number
+// of added and deleted lines, largest first). Any other key, including "",
+// keeps git's order.
+func SortFiles(result *Result, by string) {
+	var fn func(a, b FileDiff) int
+	switch by {
+	case SortPath:
+		fn = func(a, b FileDiff) int {
+			return strings.Compare(a.Path(), b.Path())
+		}
+	case SortStatus:
+		fn = func(a, b FileDiff) int {
+			return cmp.Compare(statusOrder[a.Status], statusOrder[b.Status])
+		}
+	case SortSize:
+		fn = func(a, b FileDiff) int {
+			return cmp.Compare(b.churn(), a.churn())
+		}
+	default:
+		return
+	}
+	slices.SortStableFunc(result.Files, fn)
+}
+
+// churn returns the number of added and deleted lines in the file.
+func (f *FileDiff) churn() int {
+	return f.Additions + f.Deletions
+}
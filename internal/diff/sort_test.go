@@ -0,0 +1,69 @@
+package diff
+
+import (
+	"slices"
+	"testing"
+)
+
+const multiFileDiff = `diff --git a/src/b.go b/src/b.go
+index 1234567..abcdef0 100644
+--- a/src/b.go
++++ b/src/b.go
+@@ -1 +1 @@
+-old
++new
+diff --git a/gone.txt b/gone.txt
+deleted file mode 100644
+index 1234567..0000000
+--- a/gone.txt
++++ /dev/null
+@@ -1,3 +0,0 @@
+-one
+-two
+-three
+diff --git a/a.txt b/a.txt
+new file mode 100644
+index 0000000..1234567
+--- /dev/null
++++ b/a.txt
+@@ -0,0 +1 @@
++hello
+diff --git a/src/c.go b/src/c.go
+index 1234567..abcdef0 100644
+--- a/src/c.go
++++ b/src/c.go
+@@ -1,2 +1,2 @@
+ keep
+-x
++y
+`
+
+func TestSortFiles(t *testing.T) {
+	tests := []struct {
+		by   string
+		want []string
+	}{
+		{"", []string{"src/b.go", "gone.txt", "a.txt", "src/c.go"}},
+		{SortPath, []string{"a.txt", "gone.txt", "src/b.go", "src/c.go"}},
+		{SortStatus, []string{"a.txt", "src/b.go", "src/c.go", "gone.txt"}},
+		{SortSize, []string{"gone.txt", "src/b.go", "src/c.go", "a.txt"}},
+	}
+
+	for _, tt := range tests {
+		t.Run("by "+tt.by, func(t *testing.T) {
+			result, err := Parse(multiFileDiff)
+			if err != nil {
+				t.Fatalf("Parse() returned error: %v", err)
+			}
+			SortFiles(result, tt.by)
+
+			got := make([]string, len(result.Files))
+			for i := range result.Files {
+				got[i] = result.Files[i].Path()
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("order = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
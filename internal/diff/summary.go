@@ -0,0 +1,107 @@
+package diff
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ParseSummary builds a Result without hunks from the output of
+// "git diff --numstat -z" and "git diff --name-status -z" for the same
+// range. Names and statuses come from name-status; line counts come from
+// numstat. Binary files have no line counts.
+func ParseSummary(numstat, nameStatus string) (*Result, error) {
+	type counts struct {
+		add, del int
+		binary   bool
+	}
+	byPath := make(map[string]counts)
+
+	fields := strings.Split(strings.TrimSuffix(numstat, "\x00"), "\x00")
+	for i := 0; i < len(fields); i++ {
+		if fields[i] == "" {
+			continue
+		}
+		// "added\tdeleted\tpath", or "added\tdeleted\t" followed by the
+		// old and new path as separate fields for renames and copies.
+		parts := strings.SplitN(fields[i], "\t", 3)
+		if len(parts) != 3 {
+			return nil, fmt.Errorf("invalid numstat entry %q", fields[i])
+		}
+		path := parts[2]
+		if path == "" {
+			if i+2 >= len(fields) {
+				return nil, fmt.Errorf("truncated numstat rename entry %q", fields[i])
+			}
+			path = fields[i+2]
+			i += 2
+		}
+		var c counts
+		if parts[0] == "-" && parts[1] == "-" {
+			c.binary = true
+		} else {
+			var err error
+			if c.add, err = strconv.Atoi(parts[0]); err != nil {
+				return nil, fmt.Errorf("invalid numstat count %q: %w", parts[0], err)
+			}
+			if c.del, err = strconv.Atoi(parts[1]); err != nil {
+				return nil, fmt.Errorf("invalid numstat count %q: %w", parts[1], err)
+			}
+		}
+		byPath[path] = c
+	}
+
+	result := &Result{}
+	fields = strings.Split(strings.TrimSuffix(nameStatus, "\x00"), "\x00")
+	for i := 0; i < len(fields); i++ {
+		code := fields[i]
+		if code == "" {
+			continue
+		}
+		if i+1 >= len(fields) {
+			return nil, fmt.Errorf("truncated name-status entry %q", code)
+		}
+		file := FileDiff{OldName: fields[i+1], NewName: fields[i+1]}
+		i++
+
+		// Mirror what Parse reports for the same diff.
+		switch code[0] {
+		case 'A':
+			file.Status = StatusAdded
+			file.OldName = "/dev/null"
+		case 'D':
+			file.Status = StatusDeleted
+			file.NewName = "/dev/null"
+		case 'R', 'C':
+			if i+1 >= len(fields) {
+				return nil, fmt.Errorf("truncated name-status entry %q", code)
+			}
+			file.NewName = fields[i+1]
+			i++
+			file.Status = StatusModified
+			if code[0] == 'R' {
+				file.Status = StatusRenamed
+			}
+		default:
+			file.Status = StatusModified
+		}
+
+		c := byPath[file.Path()]
+		file.Additions = c.add
+		file.Deletions = c.del
+		file.IsBinary = c.binary
+		file.IsImage = IsImagePath(file.Path())
+		file.Language = LanguageForPath(file.Path())
+		result.Files = append(result.Files, file)
+	}
+
+	return result, nil
+}
+
+// Summarize drops the hunks of every file in result, keeping names,
+// statuses and line counts.
+func Summarize(result *Result) {
+	for i := range result.Files {
+		result.Files[i].Hunks = nil
+	}
+}
@@ -0,0 +1,65 @@
+package diff
+
+import "testing"
+
+func TestParseSummary(t *testing.T) {
+	numstat := "3\t1\tmain.go\x00" +
+		"10\t0\tnew.txt\x00" +
+		"0\t4\told.txt\x00" +
+		"1\t1\t\x00a.txt\x00b.txt\x00" +
+		"-\t-\tlogo.png\x00"
+	nameStatus := "M\x00main.go\x00" +
+		"A\x00new.txt\x00" +
+		"D\x00old.txt\x00" +
+		"R090\x00a.txt\x00b.txt\x00" +
+		"M\x00logo.png\x00"
+
+	result, err := ParseSummary(numstat, nameStatus)
+	if err != nil {
+		t.Fatalf("ParseSummary: %v", err)
+	}
+
+	tests := []struct {
+		oldName, newName     string
+		status               Status
+		additions, deletions int
+		binary               bool
+	}{
+		{"main.go", "main.go", "modified", 3, 1, false},
+		{"/dev/null", "new.txt", "added", 10, 0, false},
+		{"old.txt", "/dev/null", "deleted", 0, 4, false},
+		{"a.txt", "b.txt", "renamed", 1, 1, false},
+		{"logo.png", "logo.png", "modified", 0, 0, true},
+	}
+	if len(result.Files) != len(tests) {
+		t.Fatalf("expected %d files, got %d: %+v", len(tests), len(result.Files), result.Files)
+	}
+	for i, tt := range tests {
+		f := result.Files[i]
+		if f.OldName != tt.oldName || f.NewName != tt.newName || f.Status != tt.status {
+			t.Errorf("file %d: got %s -> %s (%s), want %s -> %s (%s)", i, f.OldName, f.NewName, f.Status, tt.oldName, tt.newName, tt.status)
+		}
+		if f.Additions != tt.additions || f.Deletions != tt.deletions || f.IsBinary != tt.binary {
+			t.Errorf("file %d: got +%d -%d binary=%v, want +%d -%d binary=%v", i, f.Additions, f.Deletions, f.IsBinary, tt.additions, tt.deletions, tt.binary)
+		}
+		if f.Hunks != nil {
+			t.Errorf("file %d: expected no hunks", i)
+		}
+	}
+	if result.Files[0].Language != "go" {
+		t.Errorf("expected language go for main.go, got %q", result.Files[0].Language)
+	}
+	if !result.Files[4].IsImage {
+		t.Error("expected logo.png to be flagged as an image")
+	}
+}
+
+func TestParseSummary_Empty(t *testing.T) {
+	result, err := ParseSummary("", "")
+	if err != nil {
+		t.Fatalf("ParseSummary: %v", err)
+	}
+	if len(result.Files) != 0 {
+		t.Errorf("expected no files, got %+v", result.Files)
+	}
+}
@@ -0,0 +1,304 @@
+package diff
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// StripContext removes context lines from every hunk, leaving only added
+// and deleted lines. Hunks and their headers are kept, so the boundaries
+// between changes remain visible.
+func StripContext(result *Result) {
+	for i := range result.Files {
+		for j := range result.Files[i].Hunks {
+			hunk := &result.Files[i].Hunks[j]
+			kept := hunk.Lines[:0]
+			for _, line := range hunk.Lines {
+				if line.Type != "context" {
+					kept = append(kept, line)
+				}
+			}
+			hunk.Lines = kept
+		}
+	}
+}
+
+// StripCR converts CRLF line endings in a diff to LF, e.g. for a patch
+// saved on Windows, whose carriage returns would otherwise end up in file
+// names, hunk headers and line contents. Only a diff whose own header
+// lines end in CRLF is converted, and only one carriage return is removed
+// per line, so carriage returns of the files' contents are kept. A
+// copy-pasted diff may lack the final line ending, leaving a lone
+// carriage return at the end.
+func StripCR(input string) string {
+	if !crlfFramed(input) {
+		return input
+	}
+	return strings.TrimSuffix(strings.ReplaceAll(input, "\r\n", "\n"), "\r")
+}
+
+// crlfFramed reports whether the first "diff" or "@@" header line of a
+// diff ends in CRLF. Unlike content lines, headers never carry a file's
+// own carriage returns.
+func crlfFramed(input string) bool {
+	for line := range strings.Lines(input) {
+		if strings.HasPrefix(line, "diff ") || strings.HasPrefix(line, "@@ ") {
+			return strings.HasSuffix(strings.TrimSuffix(line, "\n"), "\r")
+		}
+	}
+	return false
+}
+
+// FilterByExtensions keeps only the files whose path has one of the given
+// extensions, compared case-insensitively. Extensions may be given with or
+// without the leading dot. An empty list keeps every file.
+func FilterByExtensions(result *Result, exts []string) {
+	if len(exts) == 0 {
+		return
+	}
+	want := make(map[string]bool, len(exts))
+	for _, ext := range exts {
+		want["."+strings.ToLower(strings.TrimPrefix(ext, "."))] = true
+	}
+	kept := result.Files[:0]
+	for _, f := range result.Files {
+		if want[strings.ToLower(filepath.Ext(f.Path()))] {
+			kept = append(kept, f)
+		}
+	}
+	result.Files = kept
+}
+
+// FilterByStatus keeps only the files with one of the given statuses, e.g.
+// "added". An empty list keeps every file.
+func FilterByStatus(result *Result, statuses []string) {
+	if len(statuses) == 0 {
+		return
+	}
+	kept := result.Files[:0]
+	for _, f := range result.Files {
+		if slices.Contains(statuses, string(f.Status)) {
+			kept = append(kept, f)
+		}
+	}
+	result.Files = kept
+}
+
+// LimitHunks keeps at most maxHunks hunks per file, recording how many
+// were dropped in TruncatedHunks. Additions and Deletions still count the
+// whole file. A truncated file's TrailingLines, counted after a hunk that
+// was dropped, are cleared. A maxHunks of 0 keeps every hunk.
+func LimitHunks(result *Result, maxHunks int) {
+	if maxHunks <= 0 {
+		return
+	}
+	for i := range result.Files {
+		f := &result.Files[i]
+		if len(f.Hunks) > maxHunks {
+			f.TruncatedHunks = len(f.Hunks) - maxHunks
+			f.Hunks = f.Hunks[:maxHunks]
+			f.TrailingLines = nil
+		}
+	}
+}
+
+// PageFiles keeps limit files starting at offset, or all files from offset
+// if limit is 0, and records the number of files before paging in
+// TotalFiles. An offset past the end keeps no files.
+func PageFiles(result *Result, offset, limit int) {
+	total := len(result.Files)
+	start := min(offset, total)
+	end := total
+	if limit > 0 {
+		end = min(start+limit, total)
+	}
+	result.Files = result.Files[start:end]
+	result.TotalFiles = total
+}
+
+// Clone returns a deep copy of result, whose files, hunks and lines can be
+// modified without affecting result.
+func Clone(result *Result) *Result {
+	c := *result
+	c.Files = slices.Clone(result.Files)
+	for i := range c.Files {
+		f := &c.Files[i]
+		if f.TrailingLines != nil {
+			n := *f.TrailingLines
+			f.TrailingLines = &n
+		}
+		f.Hunks = slices.Clone(f.Hunks)
+		for j := range f.Hunks {
+			h := &f.Hunks[j]
+			h.Lines = slices.Clone(h.Lines)
+			for k := range h.Lines {
+				h.Lines[k].Segments = slices.Clone(h.Lines[k].Segments)
+			}
+		}
+	}
+	if result.Debug != nil {
+		d := *result.Debug
+		c.Debug = &d
+	}
+	return &c
+}
+
+// SetHunkIDs sets the ID of every hunk from its file's path and the
+// hunk's content, so that a hunk can be addressed on its own, and keeps
+// its ID for as long as neither changes.
+func SetHunkIDs(result *Result) {
+	for i := range result.Files {
+		f := &result.Files[i]
+		for j := range f.Hunks {
+			h := sha256.Sum256([]byte(f.Path() + "\x00" + contentHash(f.Hunks[j:j+1])))
+			f.Hunks[j].ID = hex.EncodeToString(h[:8])
+		}
+	}
+}
+
+// MarkStaged sets Staged on the hunks of result, a diff against the
+// working tree, that staged, the diff of the index against the same base,
+// has too: what "git add -p" would no longer offer to stage. A hunk that is
+// only partly staged differs from the staged one and is left unmarked.
+func MarkStaged(result, staged *Result) {
+	inIndex := make(map[string]bool)
+	for i := range staged.Files {
+		f := &staged.Files[i]
+		for j := range f.Hunks {
+			inIndex[stagedKey(f, &f.Hunks[j])] = true
+		}
+	}
+	for i := range result.Files {
+		f := &result.Files[i]
+		for j := range f.Hunks {
+			f.Hunks[j].Staged = inIndex[stagedKey(f, &f.Hunks[j])]
+		}
+	}
+}
+
+// stagedKey identifies hunk of file by its position in the base and its
+// lines. Its position in the new version is left out, as other hunks
+// staged or not shift it.
+func stagedKey(file *FileDiff, hunk *Hunk) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s\x00%d,%d,%d\x00", file.Path(), hunk.OldStart, hunk.OldLines, hunk.NewLines)
+	for _, line := range hunk.Lines {
+		b.WriteString(lineMarkers[line.Type] + line.Content + "\n")
+	}
+	return b.String()
+}
+
+// SetTrailingLines sets each file's TrailingLines from the number of lines
+// in its new version, as reported by lineCount. Deleted files, files
+// without hunks, and files whose length lineCount doesn't know are left
+// unset.
+func SetTrailingLines(result *Result, lineCount func(path string) (int, bool)) {
+	for i := range result.Files {
+		f := &result.Files[i]
+		if f.Status == StatusDeleted || len(f.Hunks) == 0 {
+			continue
+		}
+		n, ok := lineCount(f.NewName)
+		if !ok {
+			continue
+		}
+		last := f.Hunks[len(f.Hunks)-1]
+		end := last.NewStart + last.NewLines - 1
+		if last.NewLines == 0 {
+			// "+N,0" names the line after which lines were deleted.
+			end = last.NewStart
+		}
+		trailing := max(n-end, 0)
+		f.TrailingLines = &trailing
+	}
+}
+
+// TrimDirs makes file names relative to the directories they were diffed
+// from, as git diff --no-index names files by their full path, e.g.
+// "./a/x.go" for x.go in ./a. Each name loses the first of dirs that
+// prefixes it.
+func TrimDirs(result *Result, dirs ...string) {
+	prefixes := make([]string, 0, len(dirs))
+	for _, dir := range dirs {
+		// git drops a leading slash and any trailing one from the path.
+		dir = strings.Trim(filepath.ToSlash(dir), "/")
+		if dir != "" {
+			prefixes = append(prefixes, dir+"/")
+		}
+	}
+	trim := func(name string) string {
+		for _, prefix := range prefixes {
+			if rest, ok := strings.CutPrefix(name, prefix); ok {
+				return rest
+			}
+		}
+		return name
+	}
+	for i := range result.Files {
+		f := &result.Files[i]
+		f.OldName = trim(f.OldName)
+		f.NewName = trim(f.NewName)
+	}
+}
+
+// RenumberFrom shifts line numbers so that each file's first hunk starts
+// at line start on both sides, e.g. for a snippet pasted from the middle
+// of a file. Every number in a file moves by the same amount, so gaps
+// between hunks and the pairing of old and new lines are kept. The
+// missing side of an added or deleted file stays at 0.
+func RenumberFrom(result *Result, start int) {
+	for i := range result.Files {
+		f := &result.Files[i]
+		if len(f.Hunks) == 0 {
+			continue
+		}
+		first := f.Hunks[0]
+		oldShift := start - firstLine(first.OldStart, first.OldLines)
+		newShift := start - firstLine(first.NewStart, first.NewLines)
+		if f.Status == StatusAdded {
+			oldShift = 0
+		}
+		if f.Status == StatusDeleted {
+			newShift = 0
+		}
+		for j := range f.Hunks {
+			h := &f.Hunks[j]
+			h.OldStart += oldShift
+			h.NewStart += newShift
+			h.Header = renumberHeader(h)
+			for k := range h.Lines {
+				line := &h.Lines[k]
+				if line.OldNum > 0 {
+					line.OldNum += oldShift
+				}
+				if line.NewNum > 0 {
+					line.NewNum += newShift
+				}
+			}
+		}
+	}
+}
+
+// firstLine returns the line a hunk side starts at. A side with no lines
+// names the line it follows, as in "@@ -50,0 +51,2 @@" for lines inserted
+// after line 50.
+func firstLine(start, lines int) int {
+	if lines == 0 {
+		return start + 1
+	}
+	return start
+}
+
+// renumberHeader rebuilds a hunk's "@@ -a,b +c,d @@" header from its
+// current starts and counts, keeping the function context after it.
+func renumberHeader(h *Hunk) string {
+	header := fmt.Sprintf("@@ -%d,%d +%d,%d @@", h.OldStart, h.OldLines, h.NewStart, h.NewLines)
+	if _, rest, ok := strings.Cut(strings.TrimPrefix(h.Header, "@@"), "@@"); ok && rest != "" {
+		header += rest
+	}
+	return header
+}
@@ -0,0 +1,322 @@
+package diff
+
+import (
+	"strings"
+	"testing"
+)
+
+// countLines returns the number of lines of each type in result.
+func countLines(t *testing.T, result *Result) map[string]int {
+	t.Helper()
+	counts := map[string]int{}
+	for _, f := range result.Files {
+		for _, h := range f.Hunks {
+			for _, l := range h.Lines {
+				counts[l.Type]++
+			}
+		}
+	}
+	return counts
+}
+
+func TestStripCR(t *testing.T) {
+	tests := []struct {
+		name, input, want string
+	}{
+		{
+			"CRLF diff",
+			"diff --git a/x b/x\r\n@@ -1 +1 @@\r\n-a\r\n+b\r\n",
+			"diff --git a/x b/x\n@@ -1 +1 @@\n-a\n+b\n",
+		},
+		{
+			"CRLF diff of CRLF content",
+			"diff --git a/x b/x\r\n@@ -1 +1 @@\r\n-a\r\r\n+b\r\r\n",
+			"diff --git a/x b/x\n@@ -1 +1 @@\n-a\r\n+b\r\n",
+		},
+		{
+			"CRLF diff without final newline",
+			"@@ -1 +1 @@\r\n-a\r\n+b\r",
+			"@@ -1 +1 @@\n-a\n+b",
+		},
+		{
+			"LF diff of a line ending change",
+			"diff --git a/x b/x\n@@ -1 +1 @@\n-a\r\n+a\n",
+			"diff --git a/x b/x\n@@ -1 +1 @@\n-a\r\n+a\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := StripCR(tt.input); got != tt.want {
+				t.Errorf("StripCR(%q) = %q, want %q", tt.input, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestStripContext(t *testing.T) {
+	input := `diff --git a/main.go b/main.go
+index 1234567..abcdef0 100644
+--- a/main.go
++++ b/main.go
+@@ -1,5 +1,5 @@
+ package main
+ 
+-var x = 1
++var x = 2
+ 
+ func main() {}
+@@ -20,3 +20,4 @@ func helper() {
+ 	a()
++	b()
+ 	c()
+`
+	result, err := Parse(input)
+	if err != nil {
+		t.Fatalf("Parse() returned error: %v", err)
+	}
+	before := countLines(t, result)
+
+	StripContext(result)
+
+	after := countLines(t, result)
+	if after["context"] != 0 {
+		t.Errorf("expected no context lines, got %d", after["context"])
+	}
+	if after["add"] != before["add"] || after["delete"] != before["delete"] {
+		t.Errorf("add/delete counts changed: before %v, after %v", before, after)
+	}
+	if n := len(result.Files[0].Hunks); n != 2 {
+		t.Errorf("expected hunk boundaries to be kept, got %d hunks", n)
+	}
+}
+
+func TestFilterByExtensions(t *testing.T) {
+	input := `diff --git a/main.go b/main.go
+index 1234567..abcdef0 100644
+--- a/main.go
++++ b/main.go
+@@ -1 +1 @@
+-a
++b
+diff --git a/README.md b/README.md
+index 1234567..abcdef0 100644
+--- a/README.md
++++ b/README.md
+@@ -1 +1 @@
+-a
++b
+diff --git a/api/old.proto b/api/old.proto
+deleted file mode 100644
+index 1234567..0000000
+--- a/api/old.proto
++++ /dev/null
+@@ -1 +0,0 @@
+-a
+diff --git a/util/Helper.GO b/util/Helper.GO
+index 1234567..abcdef0 100644
+--- a/util/Helper.GO
++++ b/util/Helper.GO
+@@ -1 +1 @@
+-a
++b
+`
+	tests := []struct {
+		name string
+		exts []string
+		want []string
+	}{
+		{"single extension", []string{"go"}, []string{"main.go", "util/Helper.GO"}},
+		{"with dot", []string{".md"}, []string{"README.md"}},
+		{"deleted file", []string{"go", "proto"}, []string{"main.go", "api/old.proto", "util/Helper.GO"}},
+		{"no match", []string{"rs"}, nil},
+		{"empty keeps all", nil, []string{"main.go", "README.md", "api/old.proto", "util/Helper.GO"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := Parse(input)
+			if err != nil {
+				t.Fatalf("Parse() returned error: %v", err)
+			}
+			FilterByExtensions(result, tt.exts)
+			var got []string
+			for _, f := range result.Files {
+				got = append(got, f.Path())
+			}
+			if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("got files %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTrimDirs(t *testing.T) {
+	input := `diff --git a/./a/only.txt b/./a/only.txt
+deleted file mode 100644
+index 587be6b..0000000
+--- a/./a/only.txt
++++ /dev/null
+@@ -1 +0,0 @@
+-x
+diff --git a/./a/sub/f.txt b/./b/sub/f.txt
+index d00491f..0cfbf08 100644
+--- a/./a/sub/f.txt
++++ b/./b/sub/f.txt
+@@ -1 +1 @@
+-1
++2
+`
+	result, err := Parse(input)
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	TrimDirs(result, "./a/", "./b")
+
+	want := [][2]string{{"only.txt", "/dev/null"}, {"sub/f.txt", "sub/f.txt"}}
+	if len(result.Files) != len(want) {
+		t.Fatalf("expected %d files, got %d", len(want), len(result.Files))
+	}
+	for i, w := range want {
+		f := result.Files[i]
+		if f.OldName != w[0] || f.NewName != w[1] {
+			t.Errorf("file %d: got %q -> %q, want %q -> %q", i, f.OldName, f.NewName, w[0], w[1])
+		}
+	}
+}
+
+func TestRenumberFrom(t *testing.T) {
+	input := `diff --git a/a.go b/a.go
+index 1234567..abcdef0 100644
+--- a/a.go
++++ b/a.go
+@@ -10,3 +12,4 @@ func main() {
+ a
+-b
++B
++C
+ c
+@@ -40,2 +43,2 @@
+-x
++X
+ y
+@@ -50,0 +54,1 @@
++z
+diff --git a/new.txt b/new.txt
+new file mode 100644
+index 0000000..abcdef0
+--- /dev/null
++++ b/new.txt
+@@ -0,0 +1,2 @@
++one
++two
+`
+	result, err := Parse(input)
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	RenumberFrom(result, 1)
+
+	hunks := result.Files[0].Hunks
+	if got := hunks[0].Header; got != "@@ -1,3 +1,4 @@ func main() {" {
+		t.Errorf("first header: got %q", got)
+	}
+	// The second hunk keeps its distance from the first on each side.
+	if got := hunks[1].Header; got != "@@ -31,2 +32,2 @@" {
+		t.Errorf("second header: got %q", got)
+	}
+
+	type nums struct{ old, new int }
+	var got []nums
+	for _, h := range hunks {
+		for _, l := range h.Lines {
+			got = append(got, nums{l.OldNum, l.NewNum})
+		}
+	}
+	// A pure insertion moves like the hunks with lines on both sides.
+	if got := hunks[2].Header; got != "@@ -41,0 +43,1 @@" {
+		t.Errorf("third header: got %q", got)
+	}
+	want := []nums{{1, 1}, {2, 0}, {0, 2}, {0, 3}, {3, 4}, {31, 0}, {0, 32}, {32, 33}, {0, 43}}
+	if len(got) != len(want) {
+		t.Fatalf("expected %d lines, got %d", len(want), len(got))
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("line %d: got old %d new %d, want old %d new %d", i, got[i].old, got[i].new, want[i].old, want[i].new)
+		}
+	}
+
+	added := result.Files[1].Hunks[0]
+	if added.OldStart != 0 || added.NewStart != 1 || added.Header != "@@ -0,0 +1,2 @@" {
+		t.Errorf("added file: got %+v", added)
+	}
+}
+
+func TestSetTrailingLines(t *testing.T) {
+	input := `diff --git a/a.txt b/a.txt
+--- a/a.txt
++++ b/a.txt
+@@ -1,2 +1,3 @@
+ one
++two
+ three
+diff --git a/unknown.txt b/unknown.txt
+--- a/unknown.txt
++++ b/unknown.txt
+@@ -1 +1 @@
+-x
++y
+diff --git a/gone.txt b/gone.txt
+deleted file mode 100644
+--- a/gone.txt
++++ /dev/null
+@@ -1 +0,0 @@
+-bye
+`
+	result, err := Parse(input)
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	SetTrailingLines(result, func(path string) (int, bool) {
+		if path == "a.txt" {
+			return 10, true
+		}
+		return 0, false
+	})
+
+	// Lines 4-10 follow the hunk ending at line 3.
+	if got := result.Files[0].TrailingLines; got == nil || *got != 7 {
+		t.Errorf("a.txt: expected 7 trailing lines, got %v", got)
+	}
+	if got := result.Files[1].TrailingLines; got != nil {
+		t.Errorf("unknown.txt: expected unknown trailing lines, got %d", *got)
+	}
+	if got := result.Files[2].TrailingLines; got != nil {
+		t.Errorf("gone.txt: expected no trailing lines for a deleted file, got %d", *got)
+	}
+}
+
+func TestClone(t *testing.T) {
+	input := `diff --git a/a.txt b/a.txt
+--- a/a.txt
++++ b/a.txt
+@@ -1 +1 @@
+-one
++two
+`
+	result, err := Parse(input)
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	trailing := 3
+	result.Files[0].TrailingLines = &trailing
+
+	c := Clone(result)
+	c.Files[0].NewName = "b.txt"
+	c.Files[0].Hunks[0].Lines[0].Content = "changed"
+	*c.Files[0].TrailingLines = 0
+
+	f := result.Files[0]
+	if f.NewName != "a.txt" || f.Hunks[0].Lines[0].Content != "one" || *f.TrailingLines != 3 {
+		t.Errorf("expected original to be unchanged, got %+v", f)
+	}
+}
@@ -3,15 +3,97 @@ package diff
 // Result contains all file diffs parsed from a unified diff.
 type Result struct {
 	Files []FileDiff `json:"files"`
+	// TotalFiles is the number of files before PageFiles took a page of
+	// them, so clients can page through the rest. It is 0 when unpaged.
+	TotalFiles int `json:"totalFiles,omitempty"`
+	// HiddenFiles counts the files dropped by HideUnchangedFiles.
+	HiddenFiles int    `json:"hiddenFiles,omitempty"`
+	Debug       *Debug `json:"_debug,omitempty"` // set only when debugging is requested
+}
+
+// Debug describes how a Result was produced.
+type Debug struct {
+	Command    string `json:"command"` // the git command that produced the diff
+	DurationMs int64  `json:"durationMs"`
+}
+
+// Status is how a file changed. It marshals to JSON as its lowercase
+// name, e.g. "added".
+type Status string
+
+// Statuses reported for FileDiff.Status. Copies and type changes are
+// reported as modified.
+const (
+	StatusAdded    Status = "added"
+	StatusDeleted  Status = "deleted"
+	StatusModified Status = "modified"
+	StatusRenamed  Status = "renamed"
+)
+
+// Valid reports whether s is one of the defined statuses.
+func (s Status) Valid() bool {
+	switch s {
+	case StatusAdded, StatusDeleted, StatusModified, StatusRenamed:
+		return true
+	}
+	return false
 }
 
 // FileDiff represents the diff for a single file.
 type FileDiff struct {
 	OldName  string `json:"oldName"`
 	NewName  string `json:"newName"`
-	Status   string `json:"status"` // "added", "deleted", "modified", "renamed"
+	Status   Status `json:"status"`
 	IsBinary bool   `json:"isBinary"`
-	Hunks    []Hunk `json:"hunks"`
+	IsImage  bool   `json:"isImage,omitempty"` // image by extension; content via /api/file
+	// IsSymlink is set for symbolic links (mode 120000), whose hunks hold
+	// the link target rather than file content.
+	IsSymlink bool   `json:"isSymlink,omitempty"`
+	Hunks     []Hunk `json:"hunks"`
+	// TruncatedHunks counts the hunks dropped by LimitHunks, so clients
+	// can offer to load the whole file.
+	TruncatedHunks int `json:"truncatedHunks,omitempty"`
+
+	Additions int    `json:"additions"`          // number of added lines
+	Deletions int    `json:"deletions"`          // number of deleted lines
+	Language  string `json:"language,omitempty"` // language by extension, e.g. "go"
+	TabWidth  int    `json:"tabWidth,omitempty"` // columns per tab, set by SetTabWidths
+
+	// TrailingLines counts the unchanged lines after the last hunk, or is
+	// nil when the length of the file is unknown. Set by SetTrailingLines.
+	TrailingLines *int `json:"trailingLines,omitempty"`
+
+	// ContentHash is the hex SHA-256 of the file's hunks as parsed, so
+	// clients can tell whether a file's diff changed between requests.
+	// It is empty for files without hunks.
+	ContentHash string `json:"contentHash,omitempty"`
+
+	// Origin is "tracked" or "untracked" for the files of a stash entry,
+	// telling stashed edits apart from stashed untracked files.
+	Origin string `json:"origin,omitempty"`
+
+	// Side is "ours" or "theirs" for the diffs of a conflicted file from
+	// its common ancestor, and empty otherwise.
+	Side string `json:"side,omitempty"`
+
+	// RelatedTo is set by RelateCopies on an added file whose content is
+	// that of a deleted or renamed file, and on that file, to the other's
+	// path, such as a file renamed with an identical copy left behind.
+	RelatedTo string `json:"relatedTo,omitempty"`
+
+	// InvalidUTF8 is set when at least one line is not valid UTF-8.
+	InvalidUTF8 bool `json:"invalidUtf8,omitempty"`
+	// EOLOnly is set by ClassifyEOLOnly when only line endings changed.
+	EOLOnly bool `json:"eolOnly,omitempty"`
+}
+
+// Path returns the path that identifies the file: the old name for
+// deleted files and the new name otherwise.
+func (f *FileDiff) Path() string {
+	if f.Status == StatusDeleted {
+		return f.OldName
+	}
+	return f.NewName
 }
 
 // Hunk represents a contiguous block of changes within a file diff.
@@ -22,6 +104,20 @@ type Hunk struct {
 	NewLines int    `json:"newLines"`
 	Header   string `json:"header"`
 	Lines    []Line `json:"lines"`
+	// PrecedingLines counts the unchanged lines between the previous hunk,
+	// or the start of the file, and this hunk, which a client can expand
+	// without fetching the file to find out whether there are any.
+	PrecedingLines int `json:"precedingLines"`
+
+	// WhitespaceOnly is set by ClassifyWhitespaceOnly when every change
+	// only reindents a line or touches its trailing whitespace.
+	WhitespaceOnly bool `json:"whitespaceOnly,omitempty"`
+
+	// ID identifies the hunk by its file and content, set by SetHunkIDs.
+	ID string `json:"id,omitempty"`
+	// Staged is set by MarkStaged on working tree hunks whose changes are
+	// all in the index.
+	Staged bool `json:"staged,omitempty"`
 }
 
 // Line represents a single line within a hunk.
@@ -30,4 +126,59 @@ type Line struct {
 	Content string `json:"content"`
 	OldNum  int    `json:"oldNum,omitempty"`
 	NewNum  int    `json:"newNum,omitempty"`
+
+	// For lines that are not valid UTF-8, Content has the invalid bytes
+	// replaced with U+FFFD, Encoding is "base64" and Raw holds the
+	// original bytes base64-encoded.
+	Encoding string `json:"encoding,omitempty"`
+	Raw      string `json:"raw,omitempty"`
+
+	// Truncated is set by TruncateLines when Content was shortened.
+	Truncated bool `json:"truncated,omitempty"`
+
+	// Moved is set by DetectMoves on added and deleted lines whose content
+	// was deleted or added elsewhere in the diff too.
+	Moved bool `json:"moved,omitempty"`
+
+	// Segments splits Content into changed and unchanged runs when
+	// word-level information is available.
+	Segments []Segment `json:"segments,omitempty"`
+}
+
+// Segment is a run of text within a line.
+type Segment struct {
+	Type string `json:"type"` // "add", "delete", "context"
+	Text string `json:"text"`
+}
+
+// RangeDiff is the parsed output of git range-diff, comparing two versions
+// of a series of commits.
+type RangeDiff struct {
+	Pairs []CommitPair `json:"pairs"`
+}
+
+// CommitPair matches a commit in the old range with one in the new range.
+type CommitPair struct {
+	OldIndex int    `json:"oldIndex,omitempty"` // 1-based position in the old range, 0 if added
+	OldHash  string `json:"oldHash,omitempty"`
+	NewIndex int    `json:"newIndex,omitempty"` // 1-based position in the new range, 0 if dropped
+	NewHash  string `json:"newHash,omitempty"`
+	Status   string `json:"status"` // "unchanged", "modified", "dropped", "added"
+	Subject  string `json:"subject"`
+	Hunks    []Hunk `json:"hunks,omitempty"` // diff between the two patches, for "modified"
+}
+
+// Log is a sequence of commits with their diffs, as produced by
+// "git log -p".
+type Log struct {
+	Commits []CommitDiff `json:"commits"`
+}
+
+// CommitDiff is one commit of a Log and the files it changed.
+type CommitDiff struct {
+	Hash    string     `json:"hash"`
+	Subject string     `json:"subject"`
+	Author  string     `json:"author"`
+	Date    string     `json:"date"`
+	Files   []FileDiff `json:"files"`
 }
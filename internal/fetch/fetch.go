@@ -0,0 +1,129 @@
+// Package fetch downloads the diffs of pull requests from code hosts.
+package fetch
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// Providers of pull requests, as detected by ParsePullRequest.
+const (
+	GitHub = "github"
+	GitLab = "gitlab"
+)
+
+// MaxDiffSize is the largest diff Fetcher.Diff reads, in bytes.
+const MaxDiffSize = 64 << 20
+
+var (
+	// https://github.com/org/repo/pull/123, also on GitHub Enterprise hosts
+	githubPathRe = regexp.MustCompile(`^/([^/]+/[^/]+)/pull/(\d+)(?:/(?:files|commits)?)?$`)
+	// https://gitlab.com/group/subgroup/project/-/merge_requests/45
+	gitlabPathRe = regexp.MustCompile(`^/(.+?)/-/merge_requests/(\d+)(?:/(?:diffs|commits)?)?$`)
+)
+
+// PullRequest identifies a pull request, or a merge request on GitLab.
+type PullRequest struct {
+	Provider string // GitHub or GitLab
+	Scheme   string // "https", or "http" for a local host
+	Host     string
+	Repo     string // "org/repo", or "group/project" with any subgroups
+	Number   string
+}
+
+// ParsePullRequest parses the URL of a pull request page, telling the
+// provider by the shape of its path.
+func ParsePullRequest(rawURL string) (*PullRequest, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid pull request URL: %w", err)
+	}
+	if u.Scheme != "https" && u.Scheme != "http" || u.Host == "" {
+		return nil, fmt.Errorf("invalid pull request URL %q: must be an http(s) URL", rawURL)
+	}
+	pr := &PullRequest{Scheme: u.Scheme, Host: u.Host}
+	path := strings.TrimSuffix(u.Path, ".diff")
+	if m := githubPathRe.FindStringSubmatch(path); m != nil {
+		pr.Provider, pr.Repo, pr.Number = GitHub, m[1], m[2]
+	} else if m := gitlabPathRe.FindStringSubmatch(path); m != nil {
+		pr.Provider, pr.Repo, pr.Number = GitLab, m[1], m[2]
+	} else {
+		return nil, fmt.Errorf("invalid pull request URL %q: expected .../pull/N (GitHub) or .../-/merge_requests/N (GitLab)", rawURL)
+	}
+	return pr, nil
+}
+
+// DiffURL returns the URL the host serves the pull request's diff at.
+func (pr *PullRequest) DiffURL() string {
+	if pr.Provider == GitLab {
+		return fmt.Sprintf("%s://%s/%s/-/merge_requests/%s.diff", pr.Scheme, pr.Host, pr.Repo, pr.Number)
+	}
+	return fmt.Sprintf("%s://%s/%s/pull/%s.diff", pr.Scheme, pr.Host, pr.Repo, pr.Number)
+}
+
+// Fetcher downloads pull request diffs.
+type Fetcher struct {
+	Client *http.Client // http.DefaultClient if nil
+
+	// GitHubToken, if set, authenticates requests for pull requests on
+	// github.com, which then go through the REST API at GitHubAPI so that
+	// private repositories work. It is never sent to other hosts.
+	GitHubToken string
+	GitHubAPI   string // "https://api.github.com" if empty
+}
+
+// Diff downloads the unified diff of pr.
+func (f *Fetcher) Diff(ctx context.Context, pr *PullRequest) (string, error) {
+	target := pr.DiffURL()
+	var header http.Header
+	if pr.Provider == GitHub && pr.Host == "github.com" && f.GitHubToken != "" {
+		// The .diff pages only know browser sessions, not tokens.
+		api := f.GitHubAPI
+		if api == "" {
+			api = "https://api.github.com"
+		}
+		target = fmt.Sprintf("%s/repos/%s/pulls/%s", strings.TrimSuffix(api, "/"), pr.Repo, pr.Number)
+		header = http.Header{
+			"Accept":        {"application/vnd.github.diff"},
+			"Authorization": {"Bearer " + f.GitHubToken},
+		}
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		return "", err
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	client := f.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("fetching %s: %w", target, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		hint := ""
+		if resp.StatusCode == http.StatusNotFound && pr.Provider == GitHub && f.GitHubToken == "" {
+			hint = " (set GITHUB_TOKEN for private repositories)"
+		}
+		return "", fmt.Errorf("fetching %s: %s%s", target, resp.Status, hint)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, MaxDiffSize+1))
+	if err != nil {
+		return "", fmt.Errorf("fetching %s: %w", target, err)
+	}
+	if len(data) > MaxDiffSize {
+		return "", fmt.Errorf("fetching %s: diff is larger than %d MiB", target, MaxDiffSize>>20)
+	}
+	return string(data), nil
+}
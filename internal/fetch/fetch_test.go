@@ -0,0 +1,118 @@
+package fetch
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+const testDiff = `diff --git a/a.txt b/a.txt
+--- a/a.txt
++++ b/a.txt
+@@ -1 +1 @@
+-old
++new
+`
+
+func TestParsePullRequest(t *testing.T) {
+	tests := []struct {
+		url  string
+		want PullRequest
+	}{
+		{"https://github.com/org/repo/pull/123", PullRequest{GitHub, "https", "github.com", "org/repo", "123"}},
+		{"https://github.com/org/repo/pull/123/files", PullRequest{GitHub, "https", "github.com", "org/repo", "123"}},
+		{"https://github.com/org/repo/pull/123.diff", PullRequest{GitHub, "https", "github.com", "org/repo", "123"}},
+		{"https://gitlab.com/group/sub/project/-/merge_requests/45", PullRequest{GitLab, "https", "gitlab.com", "group/sub/project", "45"}},
+		{"http://localhost:8080/org/repo/pull/7", PullRequest{GitHub, "http", "localhost:8080", "org/repo", "7"}},
+	}
+	for _, tt := range tests {
+		pr, err := ParsePullRequest(tt.url)
+		if err != nil {
+			t.Errorf("ParsePullRequest(%q): %v", tt.url, err)
+			continue
+		}
+		if *pr != tt.want {
+			t.Errorf("ParsePullRequest(%q) = %+v, want %+v", tt.url, *pr, tt.want)
+		}
+	}
+
+	for _, bad := range []string{
+		"github.com/org/repo/pull/123",
+		"https://github.com/org/repo",
+		"https://github.com/org/repo/issues/123",
+		"ftp://github.com/org/repo/pull/123",
+	} {
+		if _, err := ParsePullRequest(bad); err == nil {
+			t.Errorf("ParsePullRequest(%q): expected error, got nil", bad)
+		}
+	}
+}
+
+func TestFetcherDiff(t *testing.T) {
+	var gotAuth string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotAuth = r.Header.Get("Authorization")
+		if r.URL.Path != "/org/repo/pull/123.diff" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain")
+		_, _ = w.Write([]byte(testDiff))
+	}))
+	defer ts.Close()
+
+	pr, err := ParsePullRequest(ts.URL + "/org/repo/pull/123")
+	if err != nil {
+		t.Fatalf("ParsePullRequest: %v", err)
+	}
+	// The token is for github.com only.
+	f := &Fetcher{Client: ts.Client(), GitHubToken: "secret"}
+	got, err := f.Diff(context.Background(), pr)
+	if err != nil {
+		t.Fatalf("Diff: %v", err)
+	}
+	if got != testDiff {
+		t.Errorf("expected the served diff, got %q", got)
+	}
+	if gotAuth != "" {
+		t.Errorf("expected no token to be sent to %s, got %q", ts.URL, gotAuth)
+	}
+
+	missing, err := ParsePullRequest(ts.URL + "/org/repo/pull/999")
+	if err != nil {
+		t.Fatalf("ParsePullRequest: %v", err)
+	}
+	if _, err := f.Diff(context.Background(), missing); err == nil || !strings.Contains(err.Error(), "404") {
+		t.Errorf("expected a 404 error, got %v", err)
+	}
+}
+
+func TestFetcherDiff_GitHubToken(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer secret" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		if r.URL.Path != "/repos/org/private/pulls/5" || r.Header.Get("Accept") != "application/vnd.github.diff" {
+			http.NotFound(w, r)
+			return
+		}
+		_, _ = w.Write([]byte(testDiff))
+	}))
+	defer ts.Close()
+
+	pr, err := ParsePullRequest("https://github.com/org/private/pull/5")
+	if err != nil {
+		t.Fatalf("ParsePullRequest: %v", err)
+	}
+	f := &Fetcher{Client: ts.Client(), GitHubToken: "secret", GitHubAPI: ts.URL}
+	got, err := f.Diff(context.Background(), pr)
+	if err != nil {
+		t.Fatalf("Diff: %v", err)
+	}
+	if got != testDiff {
+		t.Errorf("expected the served diff, got %q", got)
+	}
+}
@@ -2,23 +2,82 @@
 package git
 
 import (
+	"bytes"
+	"context"
+	"errors"
 	"fmt"
+	"maps"
+	"os"
 	"os/exec"
+	"path/filepath"
+	"regexp"
+	"slices"
 	"strconv"
 	"strings"
+	"sync"
+	"time"
+	"unicode"
 )
 
-// Commit represents a single git commit.
+// Commit represents a single git commit. Fields not requested through
+// LogOptions.Fields are left empty and omitted from JSON.
 type Commit struct {
-	Hash    string `json:"hash"`
-	Message string `json:"message"`
-	Author  string `json:"author"`
-	Date    string `json:"date"`
+	Hash string `json:"hash,omitempty"`
+	// ShortHash is Hash abbreviated as git would show it, by core.abbrev
+	// or LogOptions.Abbrev, and lengthened as needed to stay unique.
+	ShortHash string `json:"shortHash,omitempty"`
+	Message   string `json:"message,omitempty"` // subject line
+	Author    string `json:"author,omitempty"`
+	Date      string `json:"date,omitempty"` // author date
+	// CommitDate differs from Date when a commit was rebased, amended or
+	// cherry-picked after it was written.
+	CommitDate string   `json:"commitDate,omitempty"`
+	Body       string   `json:"body,omitempty"`    // message after the subject
+	Parents    []string `json:"parents,omitempty"` // parent hashes
+	// Signature is "good", "bad", "none", or "unknown". Verification needs
+	// the signer's GPG key or SSH allowed-signers entry to be configured
+	// locally; signed commits that can't be checked report "unknown".
+	Signature string `json:"signature,omitempty"`
+}
+
+// signatureStatus maps git's %G? codes to Commit.Signature values.
+// Codes other than G, B and N (untrusted, expired, revoked, or unverifiable)
+// are reported as "unknown".
+func signatureStatus(code string) string {
+	switch code {
+	case "G":
+		return "good"
+	case "B":
+		return "bad"
+	case "N":
+		return "none"
+	default:
+		return "unknown"
+	}
+}
+
+// Ref represents a named git ref (branch, tag, remote branch, or HEAD).
+type Ref struct {
+	Name string `json:"name"`
+	Type string `json:"type"` // "head", "branch", "tag", "remote"
+	Hash string `json:"hash"`
 }
 
 // Repo represents a git repository at a specific directory.
 type Repo struct {
 	Dir string
+
+	// Observe, if set, is called after every git command with the
+	// subcommand name (e.g. "diff") and how long the command took.
+	Observe func(subcommand string, d time.Duration)
+
+	// Config holds "key=value" settings passed to every command with -c.
+	// Check them with ValidateConfig first.
+	Config []string
+
+	rootOnce sync.Once
+	root     string // working tree root, by worktreePath
+	rootErr  error
 }
 
 // NewRepo creates a Repo pointing at the given directory.
@@ -26,17 +85,149 @@ func NewRepo(dir string) *Repo {
 	return &Repo{Dir: dir}
 }
 
+// overriddenEnv lists environment variables that can swap in a pager, an
+// external diff program or another config file for git, changing its
+// output in ways the parsers don't expect.
+var overriddenEnv = []string{"GIT_PAGER", "PAGER", "GIT_EXTERNAL_DIFF", "GIT_CONFIG"}
+
+// command returns a git command run in the repo directory, with the
+// caller's environment minus overriddenEnv and the pager forced to cat.
+func (r *Repo) command(args ...string) *exec.Cmd {
+	return r.commandContext(context.Background(), args...)
+}
+
+// commandContext is command, killed when ctx is done.
+func (r *Repo) commandContext(ctx context.Context, args ...string) *exec.Cmd {
+	if len(r.Config) > 0 {
+		var config []string
+		for _, setting := range r.Config {
+			config = append(config, "-c", setting)
+		}
+		args = append(config, args...)
+	}
+	cmd := exec.CommandContext(ctx, "git", args...)
+	cmd.Dir = r.Dir
+	// Don't wait long for output from children git left behind when it
+	// was killed.
+	cmd.WaitDelay = time.Second
+	env := os.Environ()
+	for _, name := range overriddenEnv {
+		env = slices.DeleteFunc(env, func(kv string) bool {
+			return strings.HasPrefix(kv, name+"=")
+		})
+	}
+	cmd.Env = append(env, "GIT_PAGER=cat", "PAGER=cat")
+	return cmd
+}
+
 // git runs a git command in the repo directory and returns trimmed stdout.
 func (r *Repo) git(args ...string) (string, error) {
-	cmd := exec.Command("git", args...)
-	cmd.Dir = r.Dir
+	return r.gitTimeout(0, args...)
+}
+
+// ErrTimeout is returned, wrapped, by commands that ran out of the time
+// they were given, such as a diff past DiffOptions.Timeout.
+var ErrTimeout = errors.New("timed out")
+
+// gitTimeout is git, killing the command if it runs longer than timeout.
+// A timeout of 0 waits as long as the command takes.
+func (r *Repo) gitTimeout(timeout time.Duration, args ...string) (string, error) {
+	defer r.observe(args, time.Now())
+	ctx := context.Background()
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	cmd := r.commandContext(ctx, args...)
 	out, err := cmd.CombinedOutput()
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return "", fmt.Errorf("git %s: %w after %s", strings.Join(args, " "), ErrTimeout, timeout)
+	}
 	if err != nil {
 		return "", fmt.Errorf("git %s: %w\n%s", strings.Join(args, " "), err, out)
 	}
 	return strings.TrimSpace(string(out)), nil
 }
 
+// gitBytes runs a git command in the repo directory and returns raw stdout,
+// for output that may be binary. Stdout is returned even when the command
+// fails, for commands whose exit status is not only an error signal.
+func (r *Repo) gitBytes(args ...string) ([]byte, error) {
+	defer r.observe(args, time.Now())
+	cmd := r.command(args...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return out, fmt.Errorf("git %s: %w\n%s", strings.Join(args, " "), err, stderr.Bytes())
+	}
+	return out, nil
+}
+
+// observe reports a git command that started at start to r.Observe.
+func (r *Repo) observe(args []string, start time.Time) {
+	if r.Observe != nil && len(args) > 0 {
+		r.Observe(args[0], time.Since(start))
+	}
+}
+
+// ErrNotRepo is returned by CheckRepo when the directory is not inside a
+// git repository.
+var ErrNotRepo = errors.New("not a git repository")
+
+// CheckRepo verifies that the repo directory is inside a git repository.
+// It returns an error wrapping ErrNotRepo if git reports that it is not,
+// or the underlying error if git could not be run at all.
+func (r *Repo) CheckRepo() error {
+	_, err := r.git("rev-parse", "--git-dir")
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return fmt.Errorf("%s: %w", r.Dir, ErrNotRepo)
+	}
+	return err
+}
+
+// ErrNoPatchInProgress is returned by GetCurrentPatch when no rebase or
+// git am is in progress.
+var ErrNoPatchInProgress = errors.New("no rebase or am in progress")
+
+// GetCurrentPatch returns the patch that an in-progress rebase or git am
+// stopped on, e.g. because it did not apply cleanly.
+func (r *Repo) GetCurrentPatch() (string, error) {
+	// git am and apply-based rebases keep the patch in rebase-apply/patch.
+	applyDir, err := r.gitPath("rebase-apply")
+	if err != nil {
+		return "", err
+	}
+	if data, err := os.ReadFile(filepath.Join(applyDir, "patch")); err == nil {
+		return string(data), nil
+	}
+
+	// Merge-based rebases record the commit being picked in REBASE_HEAD.
+	mergeDir, err := r.gitPath("rebase-merge")
+	if err != nil {
+		return "", err
+	}
+	if info, err := os.Stat(mergeDir); err == nil && info.IsDir() {
+		return r.git("rebase", "--show-current-patch")
+	}
+	return "", ErrNoPatchInProgress
+}
+
+// gitPath resolves a path inside the git directory, e.g. "rebase-apply",
+// taking worktrees and $GIT_DIR into account.
+func (r *Repo) gitPath(name string) (string, error) {
+	path, err := r.git("rev-parse", "--git-path", name)
+	if err != nil {
+		return "", err
+	}
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(r.Dir, path)
+	}
+	return path, nil
+}
+
 // GetMainBranch returns "main" or "master", whichever exists as a local branch.
 func (r *Repo) GetMainBranch() (string, error) {
 	// Check if "main" branch exists
@@ -50,59 +241,1144 @@ func (r *Repo) GetMainBranch() (string, error) {
 	return "", fmt.Errorf("neither 'main' nor 'master' branch found")
 }
 
+// GetUpstream returns the upstream tracking branch of the current branch
+// (e.g. "origin/feature"). It returns an error when none is configured or
+// HEAD is detached.
+func (r *Repo) GetUpstream() (string, error) {
+	return r.git("rev-parse", "--abbrev-ref", "--symbolic-full-name", "@{upstream}")
+}
+
 // GetMergeBase returns the merge-base commit hash between two refs.
 func (r *Repo) GetMergeBase(ref1, ref2 string) (string, error) {
 	return r.git("merge-base", ref1, ref2)
 }
 
+// AheadBehind counts the commits on target that base lacks (ahead) and
+// the commits on base that target lacks (behind), as in "3 commits ahead
+// of main".
+func (r *Repo) AheadBehind(base, target string) (ahead, behind int, err error) {
+	if err := ValidateRef(base); err != nil {
+		return 0, 0, err
+	}
+	if err := ValidateRef(target); err != nil {
+		return 0, 0, err
+	}
+	// The left side of base...target is base's, the right side target's.
+	out, err := r.git("rev-list", "--left-right", "--count", base+"..."+target, "--")
+	if err != nil {
+		return 0, 0, err
+	}
+	counts := strings.Fields(out)
+	if len(counts) != 2 {
+		return 0, 0, fmt.Errorf("unexpected rev-list output: %q", out)
+	}
+	if behind, err = strconv.Atoi(counts[0]); err != nil {
+		return 0, 0, fmt.Errorf("unexpected rev-list output: %q", out)
+	}
+	if ahead, err = strconv.Atoi(counts[1]); err != nil {
+		return 0, 0, fmt.Errorf("unexpected rev-list output: %q", out)
+	}
+	return ahead, behind, nil
+}
+
+// GetTags returns the repository's tags, oldest version first. Tags are
+// ordered by version number (git's v:refname sort), so v1.10.0 follows
+// v1.9.0.
+func (r *Repo) GetTags() ([]string, error) {
+	out, err := r.git("tag", "--list", "--sort=v:refname")
+	if err != nil {
+		return nil, err
+	}
+	if out == "" {
+		return nil, nil
+	}
+	return strings.Split(out, "\n"), nil
+}
+
+// ErrNoTag is returned, wrapped, by GetLatestTag when no tag is reachable.
+var ErrNoTag = errors.New("no tag reachable")
+
+// GetLatestTag returns the most recent tag reachable from ref (git describe
+// --tags --abbrev=0), such as the last release a branch builds on.
+func (r *Repo) GetLatestTag(ref string) (string, error) {
+	if err := ValidateRef(ref); err != nil {
+		return "", fmt.Errorf("invalid ref: %w", err)
+	}
+	if _, err := r.git("rev-parse", "--verify", "--quiet", ref+"^{commit}"); err != nil {
+		return "", fmt.Errorf("unknown commit %q", ref)
+	}
+	// With a valid commit, describe only fails for want of a tag.
+	tag, err := r.git("describe", "--tags", "--abbrev=0", ref)
+	if err != nil {
+		return "", fmt.Errorf("%w from %s", ErrNoTag, ref)
+	}
+	return tag, nil
+}
+
+// GetPreviousTag returns the tag that precedes tag in GetTags order. It
+// returns an error if tag doesn't exist or is the first tag.
+func (r *Repo) GetPreviousTag(tag string) (string, error) {
+	tags, err := r.GetTags()
+	if err != nil {
+		return "", err
+	}
+	i := slices.Index(tags, tag)
+	switch {
+	case i < 0:
+		return "", fmt.Errorf("tag %q not found", tag)
+	case i == 0:
+		return "", fmt.Errorf("no tag before %q", tag)
+	}
+	return tags[i-1], nil
+}
+
+// GetToplevel returns the absolute path of the repository's working tree
+// root.
+func (r *Repo) GetToplevel() (string, error) {
+	return r.git("rev-parse", "--show-toplevel")
+}
+
+// worktreePath returns the absolute path in the working tree of path,
+// which is relative to the repository root as in diffs, rather than to
+// Dir, which may be a subdirectory.
+func (r *Repo) worktreePath(path string) (string, error) {
+	r.rootOnce.Do(func() {
+		r.root, r.rootErr = r.GetToplevel()
+	})
+	if r.rootErr != nil {
+		return "", r.rootErr
+	}
+	return filepath.Join(r.root, path), nil
+}
+
+// IsShallow reports whether the repository is a shallow clone.
+func (r *Repo) IsShallow() (bool, error) {
+	out, err := r.git("rev-parse", "--is-shallow-repository")
+	if err != nil {
+		return false, err
+	}
+	return out == "true", nil
+}
+
+// DiffOptions controls how git detects changes when producing a diff.
+type DiffOptions struct {
+	FindRenames string // rename similarity threshold in percent (-M), empty for git's default
+	FindCopies  string // copy similarity threshold in percent (-C), empty to disable
+	WordDiff    bool   // emit --word-diff=porcelain instead of line diffs
+	Text        bool   // diff files git considers binary as text (--text)
+	Filter      string // --diff-filter letters selecting files by change type, empty for all
+
+	// IgnoreMatching is a regex (-I, git 2.30+): changes whose lines all
+	// match it are left out, e.g. generated timestamps.
+	IgnoreMatching string
+
+	// Trace, if set, receives the git command GetDiff ran and how long it
+	// took, for debugging a diff that looks wrong.
+	Trace *CommandTrace
+
+	// Timeout, if set, is how long GetDiff lets git run before giving up
+	// with an error wrapping ErrTimeout.
+	Timeout time.Duration
+}
+
+// CommandTrace records a git command that was run.
+type CommandTrace struct {
+	Command  string // the command line, e.g. "git diff --no-ext-diff HEAD"
+	Duration time.Duration
+}
+
+// statusFilters maps the file statuses reported by package diff to git's
+// --diff-filter letters. Copies and type changes are reported as modified.
+var statusFilters = map[string]string{
+	"added":    "A",
+	"deleted":  "D",
+	"modified": "MTC",
+	"renamed":  "R",
+}
+
+// DiffFilter returns the --diff-filter letters selecting files with the
+// given statuses, e.g. "AD" for added and deleted. An empty list selects
+// every file.
+func DiffFilter(statuses []string) (string, error) {
+	var filter strings.Builder
+	for _, status := range statuses {
+		letters, ok := statusFilters[status]
+		if !ok {
+			return "", fmt.Errorf("invalid status %q: must be added, deleted, modified, or renamed", status)
+		}
+		filter.WriteString(letters)
+	}
+	return filter.String(), nil
+}
+
+// args returns the git diff flags for the options.
+func (o DiffOptions) args() []string {
+	var args []string
+	if o.FindRenames != "" {
+		args = append(args, "-M"+o.FindRenames+"%")
+	}
+	if o.FindCopies != "" {
+		args = append(args, "-C"+o.FindCopies+"%")
+	}
+	if o.WordDiff {
+		args = append(args, "--word-diff=porcelain")
+	}
+	if o.Text {
+		args = append(args, "--text")
+	}
+	if o.Filter != "" {
+		args = append(args, "--diff-filter="+o.Filter)
+	}
+	if o.IgnoreMatching != "" {
+		args = append(args, "-I"+o.IgnoreMatching)
+	}
+	return args
+}
+
 // GetDiff returns unified diff text between two refs.
 // If target is empty, diffs base against the working tree (staged + unstaged).
-func (r *Repo) GetDiff(base, target string) (string, error) {
-	if err := validateRef(base); err != nil {
-		return "", fmt.Errorf("invalid base ref: %w", err)
+func (r *Repo) GetDiff(base, target string, opts DiffOptions) (string, error) {
+	args, err := diffArgs(base, target, opts)
+	if err != nil {
+		return "", err
+	}
+	args = append([]string{"diff", "--no-ext-diff"}, args...)
+	if opts.Trace != nil {
+		defer func(start time.Time) {
+			opts.Trace.Command = "git " + strings.Join(args, " ")
+			opts.Trace.Duration = time.Since(start)
+		}(time.Now())
+	}
+	return r.gitTimeout(opts.Timeout, args...)
+}
+
+// GetCachedDiff returns the unified diff between base and the index, the
+// changes "git commit" would add to base.
+func (r *Repo) GetCachedDiff(base string, opts DiffOptions) (string, error) {
+	args, err := diffArgs(base, "", opts)
+	if err != nil {
+		return "", err
+	}
+	return r.gitTimeout(opts.Timeout, append([]string{"diff", "--no-ext-diff", "--cached"}, args...)...)
+}
+
+// GetUnstagedDiff returns the unified diff between the index and the
+// working tree, the changes "git add" would stage.
+func (r *Repo) GetUnstagedDiff(opts DiffOptions) (string, error) {
+	return r.gitTimeout(opts.Timeout, append([]string{"diff", "--no-ext-diff"}, opts.args()...)...)
+}
+
+// DiffDirs returns the unified diff between two directory trees, which
+// need not be inside a repository (git diff --no-index). File names in
+// the output keep the directory paths as given.
+func (r *Repo) DiffDirs(oldDir, newDir string, opts DiffOptions) (string, error) {
+	args := append([]string{"diff", "--no-index", "--no-ext-diff"}, opts.args()...)
+	out, err := r.gitBytes(append(args, "--", oldDir, newDir)...)
+	// Like diff(1), --no-index exits 1 when the trees differ.
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) && exitErr.ExitCode() == 1 {
+		err = nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return string(out), nil
+}
+
+// GetNumstat returns "git diff --numstat -z" output between two refs:
+// added and deleted line counts per file. Target works as in GetDiff.
+func (r *Repo) GetNumstat(base, target string, opts DiffOptions) (string, error) {
+	args, err := diffArgs(base, target, opts)
+	if err != nil {
+		return "", err
+	}
+	out, err := r.gitBytes(append([]string{"diff", "--numstat", "-z"}, args...)...)
+	return string(out), err
+}
+
+// GetDiffStat returns "git diff --stat" output between two refs: a line
+// per file with a bar graph of its changes, and a summary line. Target
+// works as in GetDiff.
+func (r *Repo) GetDiffStat(base, target string, opts DiffOptions) (string, error) {
+	args, err := diffArgs(base, target, opts)
+	if err != nil {
+		return "", err
+	}
+	out, err := r.gitBytes(append([]string{"diff", "--no-ext-diff", "--stat"}, args...)...)
+	return string(out), err
+}
+
+// GetNameStatus returns "git diff --name-status -z" output between two
+// refs: the status and name(s) of each changed file. Target works as in
+// GetDiff.
+func (r *Repo) GetNameStatus(base, target string, opts DiffOptions) (string, error) {
+	args, err := diffArgs(base, target, opts)
+	if err != nil {
+		return "", err
+	}
+	out, err := r.gitBytes(append([]string{"diff", "--name-status", "-z"}, args...)...)
+	return string(out), err
+}
+
+// RawEntry is a file changed between two trees, as listed by
+// "git diff --raw": its modes and object IDs without any content. Files in
+// the working tree have an all-zero NewSHA, as git hasn't hashed them.
+type RawEntry struct {
+	OldMode string `json:"oldMode"` // "000000" for added files
+	NewMode string `json:"newMode"` // "000000" for deleted files
+	OldSHA  string `json:"oldSha"`
+	NewSHA  string `json:"newSha"`
+	Status  string `json:"status"` // git's status letter, with a score for renames and copies, e.g. "R100"
+	Path    string `json:"path"`
+	OldPath string `json:"oldPath,omitempty"` // the name before a rename or copy
+}
+
+// GetRawDiff returns the files changed between two refs with their modes
+// and full object IDs. Target works as in GetDiff.
+func (r *Repo) GetRawDiff(base, target string, opts DiffOptions) ([]RawEntry, error) {
+	args, err := diffArgs(base, target, opts)
+	if err != nil {
+		return nil, err
+	}
+	out, err := r.gitBytes(append([]string{"diff", "--raw", "--no-abbrev", "-z"}, args...)...)
+	if err != nil {
+		return nil, err
 	}
+	return parseRawDiff(string(out))
+}
+
+// parseRawDiff parses "git diff --raw -z" output. Entries are
+// ":<old mode> <new mode> <old sha> <new sha> <status>\0<path>\0", with a
+// second path for renames and copies: "...R<score>\0<old>\0<new>\0".
+func parseRawDiff(out string) ([]RawEntry, error) {
+	entries := []RawEntry{}
+	fields := strings.Split(out, "\x00")
+	for i := 0; i < len(fields) && fields[i] != ""; {
+		meta := strings.Fields(strings.TrimPrefix(fields[i], ":"))
+		if len(meta) != 5 || i+1 >= len(fields) {
+			return nil, fmt.Errorf("unexpected git diff --raw entry %q", fields[i])
+		}
+		e := RawEntry{
+			OldMode: meta[0],
+			NewMode: meta[1],
+			OldSHA:  meta[2],
+			NewSHA:  meta[3],
+			Status:  meta[4],
+			Path:    fields[i+1],
+		}
+		i += 2
+		if c := e.Status[0]; c == 'R' || c == 'C' {
+			if i >= len(fields) {
+				return nil, fmt.Errorf("unexpected git diff --raw entry %q: missing new path", meta)
+			}
+			e.OldPath, e.Path = e.Path, fields[i]
+			i++
+		}
+		entries = append(entries, e)
+	}
+	return entries, nil
+}
+
+// GetCommitNumstat returns the GetNumstat output for the changes a commit
+// made: against its first parent, or against the empty tree for a root
+// commit.
+func (r *Repo) GetCommitNumstat(commit string, opts DiffOptions) (string, error) {
+	return r.showCommit(commit, "--numstat", opts)
+}
+
+// GetCommitNameStatus returns the GetNameStatus output for the changes a
+// commit made, as in GetCommitNumstat.
+func (r *Repo) GetCommitNameStatus(commit string, opts DiffOptions) (string, error) {
+	return r.showCommit(commit, "--name-status", opts)
+}
+
+// showCommit returns the "git show" output for commit's changes in the
+// given diff output format, without the commit message.
+func (r *Repo) showCommit(commit, format string, opts DiffOptions) (string, error) {
+	if err := ValidateRef(commit); err != nil {
+		return "", fmt.Errorf("invalid commit ref: %w", err)
+	}
+	// ^{commit} keeps git show from listing a tree or printing a blob.
+	args := append([]string{"show", "--format=", "--first-parent", format, "-z"}, opts.args()...)
+	out, err := r.gitBytes(append(args, commit+"^{commit}", "--")...)
+	return string(out), err
+}
+
+// RenamedFrom returns the path in base of the file at path in target: its
+// old name if the diff between them renames or copies it there, and path
+// itself otherwise. Target works as in GetDiff.
+func (r *Repo) RenamedFrom(base, target, path string, opts DiffOptions) (string, error) {
+	out, err := r.GetNameStatus(base, target, opts)
+	if err != nil {
+		return "", err
+	}
+	// Entries are "<status>\0<path>\0", with a second path for renames
+	// and copies: "R<score>\0<old>\0<new>\0".
+	fields := strings.Split(out, "\x00")
+	for i := 0; i < len(fields) && fields[i] != ""; {
+		if c := fields[i][0]; c != 'R' && c != 'C' {
+			i += 2
+			continue
+		}
+		if i+2 < len(fields) && fields[i+2] == path {
+			return fields[i+1], nil
+		}
+		i += 3
+	}
+	return path, nil
+}
+
+// diffArgs validates base and target and returns the git diff arguments
+// that follow the output format flags.
+//
+// Base and target may name subtrees, as in "HEAD:src main:src", whose
+// files are diffed with paths relative to the subtree. A subtree can only
+// be compared with another subtree: against a whole tree or the working
+// tree, git would pair up unrelated paths.
+func diffArgs(base, target string, opts DiffOptions) ([]string, error) {
+	if err := ValidateRef(base); err != nil {
+		return nil, fmt.Errorf("invalid base ref: %w", err)
+	}
+	_, _, baseTree := SplitTreePath(base)
+	args := append(opts.args(), base)
 	if target == "" {
-		return r.git("diff", "--no-ext-diff", base)
+		if baseTree {
+			return nil, fmt.Errorf("base %q names a subtree: give a target subtree to compare it with", base)
+		}
+		return args, nil
+	}
+	if err := ValidateRef(target); err != nil {
+		return nil, fmt.Errorf("invalid target ref: %w", err)
+	}
+	if _, _, targetTree := SplitTreePath(target); baseTree != targetTree {
+		return nil, fmt.Errorf("cannot compare %q with %q: both or neither must name a subtree (rev:path)", base, target)
+	}
+	return append(args, target), nil
+}
+
+// Errors returned, wrapped, by ResolveCommit.
+var (
+	ErrUnknownCommit   = errors.New("unknown commit")
+	ErrAmbiguousCommit = errors.New("ambiguous commit")
+)
+
+// ResolveCommit returns the full hash of the commit named by hash, a full
+// or abbreviated commit hash. It fails with ErrUnknownCommit if no object
+// has that hash, and with ErrAmbiguousCommit if it doesn't name exactly one
+// commit, as a short prefix of several commits or of a tree alone may not.
+func (r *Repo) ResolveCommit(hash string) (string, error) {
+	if err := ValidateRef(hash); err != nil {
+		return "", fmt.Errorf("invalid commit ref: %w", err)
+	}
+	// ^{commit} prefers the commit among objects sharing the prefix.
+	if full, err := r.git("rev-parse", "--verify", "--quiet", hash+"^{commit}"); err == nil {
+		return full, nil
+	}
+	candidates, err := r.git("rev-parse", "--disambiguate="+hash)
+	if err != nil {
+		return "", err
+	}
+	if candidates == "" {
+		return "", fmt.Errorf("%w: %s", ErrUnknownCommit, hash)
+	}
+	return "", fmt.Errorf("%w: %s names %d objects, but not one commit", ErrAmbiguousCommit, hash, strings.Count(candidates, "\n")+1)
+}
+
+// GetParentCount returns the number of parents of the given commit.
+func (r *Repo) GetParentCount(commit string) (int, error) {
+	if err := ValidateRef(commit); err != nil {
+		return 0, fmt.Errorf("invalid commit ref: %w", err)
+	}
+	// Output is the commit hash followed by its parents' hashes.
+	out, err := r.git("rev-list", "--parents", "-n", "1", commit)
+	if err != nil {
+		return 0, err
+	}
+	return len(strings.Fields(out)) - 1, nil
+}
+
+// GetCommitDiff returns the diff of a commit against its nth parent
+// (1-indexed), e.g. parent 1 is the mainline of a merge commit.
+func (r *Repo) GetCommitDiff(commit string, parent int, opts DiffOptions) (string, error) {
+	n, err := r.GetParentCount(commit)
+	if err != nil {
+		return "", err
+	}
+	if parent < 1 || parent > n {
+		return "", fmt.Errorf("invalid parent %d: commit %s has %d parent(s)", parent, commit, n)
+	}
+	return r.GetDiff(commit+"^"+strconv.Itoa(parent), commit, opts)
+}
+
+// GetRangeDiff returns the output of git range-diff comparing two commit
+// ranges, e.g. two versions of a branch before and after a rebase.
+func (r *Repo) GetRangeDiff(oldRange, newRange string) (string, error) {
+	if err := ValidateRef(oldRange); err != nil {
+		return "", fmt.Errorf("invalid old range: %w", err)
 	}
-	if err := validateRef(target); err != nil {
+	if err := ValidateRef(newRange); err != nil {
+		return "", fmt.Errorf("invalid new range: %w", err)
+	}
+	return r.git("range-diff", "--no-color", oldRange, newRange)
+}
+
+// GetRangeLog returns the "git log -p" output, in the given --format, of
+// the commits in target but not base, oldest first. Each commit is diffed
+// against its first parent, merges included.
+func (r *Repo) GetRangeLog(base, target, format string, opts DiffOptions) (string, error) {
+	if err := ValidateRef(base); err != nil {
+		return "", fmt.Errorf("invalid base ref: %w", err)
+	}
+	if err := ValidateRef(target); err != nil {
 		return "", fmt.Errorf("invalid target ref: %w", err)
 	}
-	return r.git("diff", "--no-ext-diff", base, target)
+	args := append([]string{"log", "-p", "--no-ext-diff", "--reverse", "--diff-merges=first-parent", "--format=" + format}, opts.args()...)
+	return r.gitTimeout(opts.Timeout, append(args, base+".."+target, "--")...)
+}
+
+// GetFileHistory returns "git log -p" output for the commits in
+// base..target that touch path, following renames, in the given format.
+func (r *Repo) GetFileHistory(base, target, path, format string, opts DiffOptions) (string, error) {
+	if err := ValidateRef(base); err != nil {
+		return "", fmt.Errorf("invalid base ref: %w", err)
+	}
+	if err := ValidateRef(target); err != nil {
+		return "", fmt.Errorf("invalid target ref: %w", err)
+	}
+	if !filepath.IsLocal(path) {
+		return "", fmt.Errorf("invalid path %q: must be relative to the repository", path)
+	}
+	args := append([]string{"log", "-p", "--no-ext-diff", "--follow", "--format=" + format}, opts.args()...)
+	args = append(args, base+".."+target, "--", filepath.ToSlash(path))
+	out, err := r.gitBytes(args...)
+	return string(out), err
+}
+
+// StashDiff is the diff a stash entry holds, split by where it came from.
+type StashDiff struct {
+	Tracked   string // changes to tracked files, staged and unstaged
+	Untracked string // untracked files, if stashed with --include-untracked
+}
+
+// GetStashDiff returns the diff that a stash entry such as "stash@{0}"
+// holds. A stash is a merge commit whose first parent is the commit it was
+// made on; with --include-untracked it has a third parent, a root commit
+// holding only the untracked files.
+func (r *Repo) GetStashDiff(stash string, opts DiffOptions) (StashDiff, error) {
+	if err := ValidateRef(stash); err != nil {
+		return StashDiff{}, fmt.Errorf("invalid stash: %w", err)
+	}
+	n, err := r.GetParentCount(stash)
+	if err != nil {
+		return StashDiff{}, err
+	}
+	var d StashDiff
+	args := append([]string{"diff", "--no-ext-diff"}, opts.args()...)
+	d.Tracked, err = r.git(append(args, stash+"^1", stash)...)
+	if err != nil {
+		return StashDiff{}, err
+	}
+	if n >= 3 {
+		// The untracked files commit has no parent, so showing it lists
+		// every file as added.
+		args := append([]string{"show", "--no-ext-diff", "--format="}, opts.args()...)
+		d.Untracked, err = r.git(append(args, stash+"^3")...)
+		if err != nil {
+			return StashDiff{}, err
+		}
+	}
+	return d, nil
+}
+
+// Index stages of a path with a merge conflict.
+const (
+	StageBase   = 1 // the common ancestor
+	StageOurs   = 2 // the current branch
+	StageTheirs = 3 // the branch being merged
+)
+
+// GetConflictedPaths returns the paths with unresolved merge conflicts.
+func (r *Repo) GetConflictedPaths() ([]string, error) {
+	out, err := r.gitBytes("diff", "--name-only", "--diff-filter=U", "-z")
+	if err != nil {
+		return nil, err
+	}
+	var paths []string
+	for _, p := range strings.Split(string(out), "\x00") {
+		if p != "" {
+			paths = append(paths, p)
+		}
+	}
+	return paths, nil
+}
+
+// GetStage returns the contents of a conflicted path at an index stage.
+// A stage is missing if that side did not have the file, e.g. there is
+// no base stage when both sides added the same path.
+func (r *Repo) GetStage(path string, stage int) ([]byte, error) {
+	spec, err := stageSpec(path, stage)
+	if err != nil {
+		return nil, err
+	}
+	return r.gitBytes("show", spec)
+}
+
+// GetConflictDiff returns the diff of a conflicted path from the base
+// stage to the given stage, i.e. what ours or theirs changed. File names
+// in the diff are the path itself.
+func (r *Repo) GetConflictDiff(path string, stage int, opts DiffOptions) (string, error) {
+	base, err := stageSpec(path, StageBase)
+	if err != nil {
+		return "", err
+	}
+	side, err := stageSpec(path, stage)
+	if err != nil {
+		return "", err
+	}
+	args := append([]string{"diff", "--no-ext-diff"}, opts.args()...)
+	return r.git(append(args, base, side)...)
+}
+
+// stageSpec returns the :stage:path object name for a conflicted path.
+func stageSpec(path string, stage int) (string, error) {
+	if stage < StageBase || stage > StageTheirs {
+		return "", fmt.Errorf("invalid stage %d", stage)
+	}
+	if !filepath.IsLocal(path) {
+		return "", fmt.Errorf("invalid path %q: must be relative to the repository", path)
+	}
+	return fmt.Sprintf(":%d:%s", stage, filepath.ToSlash(path)), nil
+}
+
+// GetTabWidths returns the tab widths that .gitattributes sets for paths
+// through the whitespace attribute, e.g. "*.py whitespace=tabwidth=4".
+// Paths without one are left out.
+func (r *Repo) GetTabWidths(paths []string) (map[string]int, error) {
+	widths := make(map[string]int)
+	if len(paths) == 0 {
+		return widths, nil
+	}
+	args := append([]string{"check-attr", "-z", "whitespace", "--"}, paths...)
+	out, err := r.gitBytes(args...)
+	if err != nil {
+		return nil, err
+	}
+	// Each path is reported as path NUL attribute NUL value NUL.
+	fields := strings.Split(string(out), "\x00")
+	for ; len(fields) >= 3; fields = fields[3:] {
+		for _, rule := range strings.Split(fields[2], ",") {
+			if n, ok := strings.CutPrefix(rule, "tabwidth="); ok {
+				if w, err := strconv.Atoi(n); err == nil && w > 0 {
+					widths[fields[0]] = w
+				}
+			}
+		}
+	}
+	return widths, nil
+}
+
+// GetFile returns the contents of path at ref. If ref is empty, the file
+// is read from the working tree. The path must be relative to the repo
+// root and may not escape it.
+func (r *Repo) GetFile(ref, path string) ([]byte, error) {
+	if !filepath.IsLocal(path) {
+		return nil, fmt.Errorf("invalid path %q: must be relative to the repository", path)
+	}
+	if ref == "" {
+		path, err := r.worktreePath(path)
+		if err != nil {
+			return nil, err
+		}
+		return os.ReadFile(path)
+	}
+	if err := ValidateRef(ref); err != nil {
+		return nil, fmt.Errorf("invalid ref: %w", err)
+	}
+	rev, path := resolveTreePath(ref, filepath.ToSlash(path))
+	return r.gitBytes("show", rev+":"+path)
+}
+
+// GetFileVersions returns the lines of a file at base and at target, or
+// in the working tree if target is empty, reading it from oldPath at base
+// and from path at target so that renamed files can be compared. A side is
+// nil where the file doesn't exist, as at the base of an added file.
+func (r *Repo) GetFileVersions(base, target, oldPath, path string) (oldLines, newLines []string, err error) {
+	oldLines, err = r.fileLines(base, oldPath)
+	if err != nil {
+		return nil, nil, err
+	}
+	newLines, err = r.fileLines(target, path)
+	if err != nil {
+		return nil, nil, err
+	}
+	return oldLines, newLines, nil
+}
+
+// fileLines returns the lines of path at ref as GetFile reads it, without
+// their line endings, or nil if ref has no such file.
+func (r *Repo) fileLines(ref, path string) ([]string, error) {
+	if !filepath.IsLocal(path) {
+		return nil, fmt.Errorf("invalid path %q: must be relative to the repository", path)
+	}
+	if ref == "" {
+		worktreePath, err := r.worktreePath(path)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := os.Stat(worktreePath); errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+	} else {
+		if err := ValidateRef(ref); err != nil {
+			return nil, fmt.Errorf("invalid ref: %w", err)
+		}
+		rev, treePath := resolveTreePath(ref, filepath.ToSlash(path))
+		if err := r.command("cat-file", "-e", rev+":"+treePath).Run(); err != nil {
+			// Tell a missing file from a ref that doesn't exist.
+			if _, err := r.git("rev-parse", "--verify", "--quiet", rev+"^{tree}"); err != nil {
+				return nil, fmt.Errorf("unknown ref %q", ref)
+			}
+			return nil, nil
+		}
+	}
+	data, err := r.GetFile(ref, path)
+	if err != nil {
+		return nil, err
+	}
+	content := strings.TrimSuffix(string(data), "\n")
+	if content == "" {
+		return []string{}, nil
+	}
+	return strings.Split(content, "\n"), nil
+}
+
+// BlameLine attributes one line of a file to the commit that last
+// changed it.
+type BlameLine struct {
+	Line    int    `json:"line"` // 1-based line number in the file
+	Hash    string `json:"hash"` // all zeros for uncommitted lines
+	Author  string `json:"author"`
+	Date    string `json:"date"`    // author date, "2006-01-02 15:04:05 -0700"
+	Summary string `json:"summary"` // subject line
+	Content string `json:"content"`
+}
+
+// Blame returns the blame of lines start through end (1-based, inclusive)
+// of path at ref, or in the working tree if ref is empty. The range is
+// clamped to the file, so a range past its end returns no lines. Only the
+// requested lines are blamed, which is much cheaper than blaming the whole
+// file.
+func (r *Repo) Blame(ref, path string, start, end int) ([]BlameLine, error) {
+	data, err := r.GetFile(ref, path)
+	if err != nil {
+		return nil, err
+	}
+	lines := bytes.Count(data, []byte("\n"))
+	if len(data) > 0 && !bytes.HasSuffix(data, []byte("\n")) {
+		lines++
+	}
+	start = max(start, 1)
+	end = min(end, lines)
+	if start > end {
+		return []BlameLine{}, nil
+	}
+
+	args := []string{"blame", "--porcelain", "-L", fmt.Sprintf("%d,%d", start, end)}
+	path = filepath.ToSlash(path)
+	if ref != "" {
+		var rev string
+		rev, path = resolveTreePath(ref, path)
+		args = append(args, rev)
+	}
+	// git takes the path relative to the directory it runs in, which may
+	// be below the root.
+	path, err = r.worktreePath(path)
+	if err != nil {
+		return nil, err
+	}
+	out, err := r.gitBytes(append(args, "--", path)...)
+	if err != nil {
+		return nil, err
+	}
+	return parseBlame(string(out)), nil
+}
+
+// parseBlame parses "git blame --porcelain" output. Each line's header
+// names its commit; the commit's author and summary follow only the first
+// time it appears, so they are remembered by hash.
+func parseBlame(out string) []BlameLine {
+	result := []BlameLine{}
+	commits := map[string]*BlameLine{}
+	var cur *BlameLine
+	var authorTime int64
+	for _, line := range strings.Split(out, "\n") {
+		if content, ok := strings.CutPrefix(line, "\t"); ok {
+			if cur != nil {
+				cur.Content = content
+				result = append(result, *cur)
+				cur = nil
+			}
+			continue
+		}
+		key, value, _ := strings.Cut(line, " ")
+		if cur == nil {
+			// "<hash> <orig-line> <final-line> [<lines in group>]"
+			fields := strings.Fields(line)
+			if len(fields) < 3 {
+				continue
+			}
+			n, _ := strconv.Atoi(fields[2])
+			cur = &BlameLine{Line: n, Hash: fields[0]}
+			if c, ok := commits[cur.Hash]; ok {
+				cur.Author, cur.Date, cur.Summary = c.Author, c.Date, c.Summary
+			} else {
+				commits[cur.Hash] = cur
+			}
+			continue
+		}
+		switch key {
+		case "author":
+			cur.Author = value
+		case "author-time":
+			authorTime, _ = strconv.ParseInt(value, 10, 64)
+		case "author-tz":
+			cur.Date = blameDate(authorTime, value)
+		case "summary":
+			cur.Summary = value
+		}
+	}
+	return result
+}
+
+// blameDate formats a blame author-time and author-tz ("+0200") like
+// "git log --format=%ai".
+func blameDate(unix int64, tz string) string {
+	loc := time.UTC
+	if hhmm, err := strconv.Atoi(tz); err == nil {
+		offset := (hhmm/100*60 + hhmm%100) * 60
+		loc = time.FixedZone(tz, offset)
+	}
+	return time.Unix(unix, 0).In(loc).Format("2006-01-02 15:04:05 -0700")
 }
 
-// validateRef rejects refs that could be interpreted as git flags.
-func validateRef(ref string) error {
+// SplitTreePath splits a tree-ish of the form "<rev>:<path>" that names a
+// subtree, such as "HEAD:src", into the revision and the path, without
+// surrounding slashes. ok is false for a plain revision. Ref names can't
+// contain ':', so the first colon outside a "@{...}" or "^{...}" suffix,
+// which may hold a date or a message, starts the path.
+func SplitTreePath(ref string) (rev, path string, ok bool) {
+	depth := 0
+	for i, c := range ref {
+		switch c {
+		case '{':
+			depth++
+		case '}':
+			depth = max(depth-1, 0)
+		case ':':
+			if depth == 0 {
+				return ref[:i], strings.Trim(ref[i+1:], "/"), true
+			}
+		}
+	}
+	return ref, "", false
+}
+
+// resolveTreePath returns the revision and repository-relative path of
+// path inside ref, which may name a subtree as in SplitTreePath.
+func resolveTreePath(ref, path string) (string, string) {
+	rev, dir, ok := SplitTreePath(ref)
+	if !ok || dir == "" {
+		return rev, path
+	}
+	return rev, dir + "/" + path
+}
+
+// SafeConfigKeys are the git config keys Repo.Config may set: ones that
+// change which lines a diff pairs up, how much context it shows or how
+// hashes are abbreviated, not which programs git runs or the syntax of
+// the output the parsers read. (diff.suppressBlankEmpty, for one, prints
+// blank context lines as empty lines, which end a hunk.) Keys are
+// lowercase, as git matches them case-insensitively.
+var SafeConfigKeys = map[string]bool{
+	"core.abbrev":           true,
+	"diff.algorithm":        true,
+	"diff.context":          true,
+	"diff.indentheuristic":  true,
+	"diff.interhunkcontext": true,
+	"diff.renamelimit":      true,
+	"diff.renames":          true,
+}
+
+// ValidateConfig checks a "key=value" setting for Repo.Config, rejecting
+// keys not in SafeConfigKeys.
+func ValidateConfig(setting string) error {
+	key, value, ok := strings.Cut(setting, "=")
+	if !ok || key == "" {
+		return fmt.Errorf("invalid git config %q: must be key=value", setting)
+	}
+	if !SafeConfigKeys[strings.ToLower(key)] {
+		keys := slices.Sorted(maps.Keys(SafeConfigKeys))
+		return fmt.Errorf("git config %q is not allowed: must be one of %s", key, strings.Join(keys, ", "))
+	}
+	if strings.ContainsAny(value, "\n\x00") {
+		return fmt.Errorf("invalid git config %q: value must be a single line", setting)
+	}
+	return nil
+}
+
+// ValidateRef rejects refs that could be interpreted as git flags.
+func ValidateRef(ref string) error {
 	if strings.HasPrefix(ref, "-") {
 		return fmt.Errorf("ref must not start with '-': %q", ref)
 	}
 	return nil
 }
 
-// GetCommits returns the most recent n commits for the current branch.
-func (r *Repo) GetCommits(n int) ([]Commit, error) {
-	// Use a separator unlikely to appear in commit messages
-	sep := "---COMMIT_SEP---"
-	format := strings.Join([]string{"%H", "%s", "%an", "%ai"}, sep)
-	out, err := r.git("log", "--format="+format, "-n", strconv.Itoa(n))
+// LogOptions narrows the commits returned by GetCommits.
+type LogOptions struct {
+	Pickaxe      string // only commits that change the number of occurrences of this string (-S)
+	PickaxeRegex string // only commits whose diff adds or removes lines matching this regex (-G)
+
+	// Merges is "all" (or empty) to list every commit, "none" to hide merge
+	// commits (--no-merges), or "first-parent" to follow only the first
+	// parent of merges, hiding the commits they brought in (--first-parent).
+	Merges string
+
+	// Order is "" for git's default order, or "author", "commit" or "topo"
+	// to order commits by author date, by commit date, or topologically,
+	// never showing a parent before its children.
+	Order string
+
+	// Fields selects which Commit fields to fill, by name from
+	// CommitFields. Empty means DefaultCommitFields.
+	Fields []string
+
+	// Abbrev is the number of hex digits of ShortHash, or 0 for git's
+	// default (core.abbrev).
+	Abbrev int
+
+	// Base, if set, limits the log to commits reachable from Target but
+	// not from Base (git log Base..Target). An empty Target means HEAD.
+	Base   string
+	Target string
+}
+
+// ValidateMerges checks a LogOptions.Merges value.
+func ValidateMerges(merges string) error {
+	switch merges {
+	case "", "all", "none", "first-parent":
+		return nil
+	}
+	return fmt.Errorf("invalid merges %q: must be none, first-parent, or all", merges)
+}
+
+// logOrders maps LogOptions.Order values to git log flags.
+var logOrders = map[string]string{
+	"author": "--author-date-order",
+	"commit": "--date-order",
+	"topo":   "--topo-order",
+}
+
+// ValidateOrder checks a LogOptions.Order value.
+func ValidateOrder(order string) error {
+	if _, ok := logOrders[order]; ok || order == "" {
+		return nil
+	}
+	return fmt.Errorf("invalid order %q: must be author, commit, or topo", order)
+}
+
+// args returns the git log flags for the options. Each value is attached
+// to its flag in a single argument, so it can't be parsed as another flag.
+func (o LogOptions) args() []string {
+	var args []string
+	if o.Pickaxe != "" {
+		args = append(args, "-S"+o.Pickaxe)
+	}
+	if o.PickaxeRegex != "" {
+		args = append(args, "-G"+o.PickaxeRegex)
+	}
+	switch o.Merges {
+	case "none":
+		args = append(args, "--no-merges")
+	case "first-parent":
+		args = append(args, "--first-parent")
+	}
+	if flag, ok := logOrders[o.Order]; ok {
+		args = append(args, flag)
+	}
+	if o.Abbrev > 0 {
+		args = append(args, "--abbrev="+strconv.Itoa(o.Abbrev))
+	}
+	if o.Base != "" {
+		// Commits are listed for the revisions of "rev:path" subtrees.
+		base, _, _ := SplitTreePath(o.Base)
+		target, _, _ := SplitTreePath(o.Target)
+		args = append(args, base+".."+target)
+	}
+	return args
+}
+
+// commitField is a Commit field that GetCommits can fill from git log.
+type commitField struct {
+	placeholder string // git log --format placeholder
+	set         func(c *Commit, value string)
+}
+
+// CommitFields is the allowlist of field names for LogOptions.Fields.
+var CommitFields = map[string]commitField{
+	"hash":       {"%H", func(c *Commit, v string) { c.Hash = v }},
+	"shortHash":  {"%h", func(c *Commit, v string) { c.ShortHash = v }},
+	"subject":    {"%s", func(c *Commit, v string) { c.Message = v }},
+	"author":     {"%an", func(c *Commit, v string) { c.Author = v }},
+	"date":       {"%ai", func(c *Commit, v string) { c.Date = v }},
+	"commitDate": {"%ci", func(c *Commit, v string) { c.CommitDate = v }},
+	"body":       {"%b", func(c *Commit, v string) { c.Body = strings.TrimRight(v, "\n") }},
+	"parents":    {"%P", func(c *Commit, v string) { c.Parents = strings.Fields(v) }},
+	"signature":  {"%G?", func(c *Commit, v string) { c.Signature = signatureStatus(v) }},
+}
+
+// DefaultCommitFields are the fields GetCommits fills by default.
+var DefaultCommitFields = []string{"hash", "shortHash", "subject", "author", "date", "commitDate", "signature"}
+
+// ValidateCommitFields rejects field names that are not in CommitFields.
+func ValidateCommitFields(names []string) error {
+	for _, name := range names {
+		if _, ok := CommitFields[name]; !ok {
+			return fmt.Errorf("unknown commit field %q", name)
+		}
+	}
+	return nil
+}
+
+// GetCommits returns the most recent n commits for the current branch
+// that match opts.
+func (r *Repo) GetCommits(n int, opts LogOptions) ([]Commit, error) {
+	names := opts.Fields
+	if len(names) == 0 {
+		names = DefaultCommitFields
+	}
+	if err := ValidateCommitFields(names); err != nil {
+		return nil, err
+	}
+	if err := ValidateMerges(opts.Merges); err != nil {
+		return nil, err
+	}
+	if err := ValidateOrder(opts.Order); err != nil {
+		return nil, err
+	}
+	if opts.Base != "" {
+		if err := ValidateRef(opts.Base); err != nil {
+			return nil, fmt.Errorf("invalid base ref: %w", err)
+		}
+		if opts.Target != "" {
+			if err := ValidateRef(opts.Target); err != nil {
+				return nil, fmt.Errorf("invalid target ref: %w", err)
+			}
+		}
+	}
+
+	// Fields are NUL-separated and -z terminates each commit with a NUL
+	// too, so every commit is exactly len(names) NUL-terminated fields.
+	// NUL can't appear in commit metadata, so any content is safe.
+	placeholders := make([]string, len(names))
+	for i, name := range names {
+		placeholders[i] = CommitFields[name].placeholder
+	}
+	format := strings.Join(placeholders, "%x00")
+	args := append([]string{"log", "-z", "--format=" + format, "-n", strconv.Itoa(n)}, opts.args()...)
+	out, err := r.gitBytes(args...)
 	if err != nil {
 		return nil, err
 	}
+
+	fields := strings.Split(string(out), "\x00")
+	var commits []Commit
+	for len(fields) >= len(names) {
+		var c Commit
+		for i, name := range names {
+			CommitFields[name].set(&c, sanitizeControl(fields[i]))
+		}
+		commits = append(commits, c)
+		fields = fields[len(names):]
+	}
+	return commits, nil
+}
+
+// ansiEscapeRe matches an ANSI CSI escape sequence, such as a color code.
+var ansiEscapeRe = regexp.MustCompile(`\x1b\[[0-9;?]*[ -/]*[@-~]`)
+
+// sanitizeControl strips ANSI escape sequences and other control
+// characters, except newlines and tabs, from commit metadata. Git accepts
+// any bytes but NUL in a commit message, and they would otherwise reach
+// the UI.
+func sanitizeControl(s string) string {
+	if !strings.ContainsFunc(s, isStrippedControl) {
+		return s
+	}
+	s = ansiEscapeRe.ReplaceAllString(s, "")
+	return strings.Map(func(r rune) rune {
+		if isStrippedControl(r) {
+			return -1
+		}
+		return r
+	}, s)
+}
+
+// isStrippedControl reports whether sanitizeControl removes r.
+func isStrippedControl(r rune) bool {
+	return unicode.IsControl(r) && r != '\n' && r != '\t'
+}
+
+// GetRefs returns HEAD followed by all local branches, tags, and remote
+// branches. The currently checked-out branch is listed directly after HEAD.
+func (r *Repo) GetRefs() ([]Ref, error) {
+	// Tab cannot appear in ref names. %(*objectname) is the peeled commit
+	// for annotated tags and empty otherwise. Fields that may be blank are
+	// kept away from the line edges so trimming the output can't eat them.
+	format := strings.Join([]string{"%(refname)", "%(HEAD)", "%(*objectname)", "%(objectname)"}, "\t")
+	out, err := r.git("for-each-ref", "--format="+format, "refs/heads", "refs/tags", "refs/remotes")
+	if err != nil {
+		return nil, err
+	}
+
+	var refs []Ref
+	if head, err := r.git("rev-parse", "--verify", "--quiet", "HEAD"); err == nil {
+		refs = append(refs, Ref{Name: "HEAD", Type: "head", Hash: head})
+	}
 	if out == "" {
-		return nil, nil
+		return refs, nil
 	}
 
-	var commits []Commit
+	var current []Ref
+	var rest []Ref
 	for _, line := range strings.Split(out, "\n") {
-		parts := strings.SplitN(line, sep, 4)
+		parts := strings.Split(line, "\t")
 		if len(parts) != 4 {
 			continue
 		}
-		commits = append(commits, Commit{
-			Hash:    parts[0],
-			Message: parts[1],
-			Author:  parts[2],
-			Date:    parts[3],
-		})
+		ref := Ref{Hash: parts[3]}
+		if parts[2] != "" {
+			ref.Hash = parts[2]
+		}
+		switch {
+		case strings.HasPrefix(parts[0], "refs/heads/"):
+			ref.Type = "branch"
+			ref.Name = strings.TrimPrefix(parts[0], "refs/heads/")
+		case strings.HasPrefix(parts[0], "refs/tags/"):
+			ref.Type = "tag"
+			ref.Name = strings.TrimPrefix(parts[0], "refs/tags/")
+		case strings.HasPrefix(parts[0], "refs/remotes/"):
+			ref.Type = "remote"
+			ref.Name = strings.TrimPrefix(parts[0], "refs/remotes/")
+		default:
+			continue
+		}
+		if parts[1] == "*" {
+			current = append(current, ref)
+		} else {
+			rest = append(rest, ref)
+		}
 	}
-	return commits, nil
+	refs = append(refs, current...)
+	return append(refs, rest...), nil
 }
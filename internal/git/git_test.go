@@ -1,11 +1,18 @@
 package git
 
 import (
+	"errors"
+	"fmt"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"runtime"
+	"slices"
 	"strings"
 	"testing"
+	"time"
+
+	"github.com/lundberg/ghdiff/internal/diff"
 )
 
 // initTestRepo creates a temporary git repo with user config and an initial commit.
@@ -117,6 +124,221 @@ func TestGetMainBranch_Neither(t *testing.T) {
 	}
 }
 
+func TestGetCommitFiles(t *testing.T) {
+	dir := initTestRepo(t)
+	root := commitFile(t, dir, "a.txt", "one\ntwo\n", "initial commit")
+	if err := os.WriteFile(filepath.Join(dir, "a.txt"), []byte("one\n2\nthree\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	// commitFile commits b.txt along with the staged change to a.txt.
+	add := exec.Command("git", "add", "a.txt")
+	add.Dir = dir
+	if out, err := add.CombinedOutput(); err != nil {
+		t.Fatalf("git add: %v\n%s", err, out)
+	}
+	hash := commitFile(t, dir, "b.txt", "b\n", "touch two files")
+	repo := NewRepo(dir)
+
+	nameStatus, err := repo.GetCommitNameStatus(hash, DiffOptions{})
+	if err != nil {
+		t.Fatalf("GetCommitNameStatus: %v", err)
+	}
+	if want := "M\x00a.txt\x00A\x00b.txt\x00"; nameStatus != want {
+		t.Errorf("expected name-status %q, got %q", want, nameStatus)
+	}
+	numstat, err := repo.GetCommitNumstat(hash, DiffOptions{})
+	if err != nil {
+		t.Fatalf("GetCommitNumstat: %v", err)
+	}
+	if want := "2\t1\ta.txt\x001\t0\tb.txt\x00"; numstat != want {
+		t.Errorf("expected numstat %q, got %q", want, numstat)
+	}
+
+	// A root commit is compared with the empty tree.
+	numstat, err = repo.GetCommitNumstat(root, DiffOptions{})
+	if err != nil {
+		t.Fatalf("GetCommitNumstat(root): %v", err)
+	}
+	if want := "2\t0\ta.txt\x00"; numstat != want {
+		t.Errorf("expected root numstat %q, got %q", want, numstat)
+	}
+
+	tree, err := repo.GetCommitNumstat(hash+"^{tree}", DiffOptions{})
+	if err == nil {
+		t.Errorf("expected error for a tree, got %q", tree)
+	}
+}
+
+func TestGetRawDiff(t *testing.T) {
+	dir := initTestRepo(t)
+	base := commitFile(t, dir, "a.txt", "one\n", "initial commit")
+	if err := os.WriteFile(filepath.Join(dir, "a.txt"), []byte("two\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	add := exec.Command("git", "add", "a.txt")
+	add.Dir = dir
+	if out, err := add.CombinedOutput(); err != nil {
+		t.Fatalf("git add: %v\n%s", err, out)
+	}
+	target := commitFile(t, dir, "b.txt", "b\n", "modify a, add b")
+	repo := NewRepo(dir)
+
+	blob := func(rev string) string {
+		t.Helper()
+		out, err := repo.git("rev-parse", rev)
+		if err != nil {
+			t.Fatalf("rev-parse %s: %v", rev, err)
+		}
+		return strings.TrimSpace(out)
+	}
+	zero := strings.Repeat("0", len(base))
+	want := []RawEntry{
+		{OldMode: "100644", NewMode: "100644", OldSHA: blob(base + ":a.txt"), NewSHA: blob(target + ":a.txt"), Status: "M", Path: "a.txt"},
+		{OldMode: "000000", NewMode: "100644", OldSHA: zero, NewSHA: blob(target + ":b.txt"), Status: "A", Path: "b.txt"},
+	}
+
+	got, err := repo.GetRawDiff(base, target, DiffOptions{})
+	if err != nil {
+		t.Fatalf("GetRawDiff: %v", err)
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("expected %+v, got %+v", want, got)
+	}
+}
+
+func TestParseRawDiff_Rename(t *testing.T) {
+	sha := strings.Repeat("a", 40)
+	got, err := parseRawDiff(":100644 100755 " + sha + " " + sha + " R100\x00old.sh\x00new.sh\x00")
+	if err != nil {
+		t.Fatalf("parseRawDiff: %v", err)
+	}
+	want := []RawEntry{{OldMode: "100644", NewMode: "100755", OldSHA: sha, NewSHA: sha, Status: "R100", Path: "new.sh", OldPath: "old.sh"}}
+	if !slices.Equal(got, want) {
+		t.Errorf("expected %+v, got %+v", want, got)
+	}
+	if _, err := parseRawDiff("garbage\x00"); err == nil {
+		t.Error("expected error for malformed output, got nil")
+	}
+}
+
+func TestGetFileVersions(t *testing.T) {
+	dir := initTestRepo(t)
+	base := commitFile(t, dir, "a.txt", "one\ntwo\n", "initial commit")
+	commitFile(t, dir, "a.txt", "one\n2\nthree\n", "modify a")
+	repo := NewRepo(dir)
+
+	oldLines, newLines, err := repo.GetFileVersions(base, "HEAD", "a.txt", "a.txt")
+	if err != nil {
+		t.Fatalf("GetFileVersions: %v", err)
+	}
+	if want := []string{"one", "two"}; !slices.Equal(oldLines, want) {
+		t.Errorf("expected old lines %q, got %q", want, oldLines)
+	}
+	if want := []string{"one", "2", "three"}; !slices.Equal(newLines, want) {
+		t.Errorf("expected new lines %q, got %q", want, newLines)
+	}
+
+	// The working tree, and a side where the file doesn't exist.
+	if err := os.WriteFile(filepath.Join(dir, "b.txt"), []byte("b\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	oldLines, newLines, err = repo.GetFileVersions("HEAD", "", "b.txt", "b.txt")
+	if err != nil {
+		t.Fatalf("GetFileVersions(worktree): %v", err)
+	}
+	if oldLines != nil || !slices.Equal(newLines, []string{"b"}) {
+		t.Errorf("expected no old side and [b], got %q and %q", oldLines, newLines)
+	}
+
+	if _, _, err := repo.GetFileVersions("nonexistent", "HEAD", "a.txt", "a.txt"); err == nil {
+		t.Error("expected error for an unknown ref, got nil")
+	}
+	if _, _, err := repo.GetFileVersions(base, "HEAD", "../a.txt", "a.txt"); err == nil {
+		t.Error("expected error for a path outside the repository, got nil")
+	}
+}
+
+// slowGitDiff puts a git on PATH whose diffs take seconds and that runs
+// the real git for everything else.
+func slowGitDiff(t *testing.T) {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("fake git is a shell script")
+	}
+	real, err := exec.LookPath("git")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	script := "#!/bin/sh\nif [ \"$1\" = diff ]; then exec sleep 10; fi\nexec " + real + " \"$@\"\n"
+	if err := os.WriteFile(filepath.Join(dir, "git"), []byte(script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+}
+
+func TestGetDiff_Timeout(t *testing.T) {
+	dir := initTestRepo(t)
+	commitFile(t, dir, "a.txt", "one\n", "first commit")
+	commitFile(t, dir, "a.txt", "two\n", "second commit")
+	slowGitDiff(t)
+
+	start := time.Now()
+	_, err := NewRepo(dir).GetDiff("HEAD~1", "HEAD", DiffOptions{Timeout: 100 * time.Millisecond})
+	if !errors.Is(err, ErrTimeout) {
+		t.Fatalf("expected ErrTimeout, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("expected GetDiff to give up after the timeout, took %s", elapsed)
+	}
+
+	// Other commands still run.
+	if _, err := NewRepo(dir).GetCommits(10, LogOptions{}); err != nil {
+		t.Errorf("GetCommits: %v", err)
+	}
+}
+
+func TestAheadBehind(t *testing.T) {
+	dir := initTestRepo(t)
+	commitFile(t, dir, "a.txt", "a", "initial commit")
+	setup := func(args ...string) {
+		t.Helper()
+		cmd := exec.Command("git", args...)
+		cmd.Dir = dir
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %v: %v\n%s", args, err, out)
+		}
+	}
+	setup("branch", "-M", "main")
+	setup("checkout", "-b", "feature")
+	commitFile(t, dir, "b.txt", "b", "feature commit 1")
+	commitFile(t, dir, "c.txt", "c", "feature commit 2")
+	commitFile(t, dir, "d.txt", "d", "feature commit 3")
+	setup("checkout", "main")
+	commitFile(t, dir, "e.txt", "e", "main commit")
+
+	repo := NewRepo(dir)
+	ahead, behind, err := repo.AheadBehind("main", "feature")
+	if err != nil {
+		t.Fatalf("AheadBehind: %v", err)
+	}
+	if ahead != 3 || behind != 1 {
+		t.Errorf("expected 3 ahead and 1 behind, got %d and %d", ahead, behind)
+	}
+
+	ahead, behind, err = repo.AheadBehind("feature", "main")
+	if err != nil {
+		t.Fatalf("AheadBehind: %v", err)
+	}
+	if ahead != 1 || behind != 3 {
+		t.Errorf("expected 1 ahead and 3 behind, got %d and %d", ahead, behind)
+	}
+
+	if _, _, err := repo.AheadBehind("--all", "main"); err == nil {
+		t.Error("expected error for a ref starting with '-', got nil")
+	}
+}
+
 func TestGetMergeBase(t *testing.T) {
 	dir := initTestRepo(t)
 	cmd := exec.Command("git", "branch", "-M", "main")
@@ -172,7 +394,7 @@ func TestGetDiff_BetweenRefs(t *testing.T) {
 	commitFile(t, dir, "file.txt", "line1\nline2\n", "second commit")
 
 	repo := NewRepo(dir)
-	diff, err := repo.GetDiff("HEAD~1", "HEAD")
+	diff, err := repo.GetDiff("HEAD~1", "HEAD", DiffOptions{})
 	if err != nil {
 		t.Fatalf("GetDiff: %v", err)
 	}
@@ -199,7 +421,7 @@ func TestGetDiff_WorkingTree(t *testing.T) {
 	}
 
 	repo := NewRepo(dir)
-	diff, err := repo.GetDiff("HEAD", "")
+	diff, err := repo.GetDiff("HEAD", "", DiffOptions{})
 	if err != nil {
 		t.Fatalf("GetDiff working tree: %v", err)
 	}
@@ -211,6 +433,40 @@ func TestGetDiff_WorkingTree(t *testing.T) {
 	}
 }
 
+func TestGetCachedAndUnstagedDiff(t *testing.T) {
+	dir := initTestRepo(t)
+	commitFile(t, dir, "staged.txt", "original\n", "first commit")
+	commitFile(t, dir, "unstaged.txt", "original\n", "second commit")
+
+	if err := os.WriteFile(filepath.Join(dir, "staged.txt"), []byte("staged\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	add := exec.Command("git", "add", "staged.txt")
+	add.Dir = dir
+	if out, err := add.CombinedOutput(); err != nil {
+		t.Fatalf("git add: %v\n%s", err, out)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "unstaged.txt"), []byte("unstaged\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	repo := NewRepo(dir)
+	staged, err := repo.GetCachedDiff("HEAD", DiffOptions{})
+	if err != nil {
+		t.Fatalf("GetCachedDiff: %v", err)
+	}
+	if !strings.Contains(staged, "+staged") || strings.Contains(staged, "unstaged.txt") {
+		t.Errorf("expected only staged.txt in the staged diff, got:\n%s", staged)
+	}
+	unstaged, err := repo.GetUnstagedDiff(DiffOptions{})
+	if err != nil {
+		t.Fatalf("GetUnstagedDiff: %v", err)
+	}
+	if !strings.Contains(unstaged, "+unstaged") || strings.Contains(unstaged, "staged.txt b/staged.txt") {
+		t.Errorf("expected only unstaged.txt in the unstaged diff, got:\n%s", unstaged)
+	}
+}
+
 func TestGetCommits(t *testing.T) {
 	dir := initTestRepo(t)
 	cmd := exec.Command("git", "branch", "-M", "main")
@@ -222,7 +478,7 @@ func TestGetCommits(t *testing.T) {
 	commitFile(t, dir, "c.txt", "c", "third commit")
 
 	repo := NewRepo(dir)
-	commits, err := repo.GetCommits(2)
+	commits, err := repo.GetCommits(2, LogOptions{})
 	if err != nil {
 		t.Fatalf("GetCommits: %v", err)
 	}
@@ -250,6 +506,27 @@ func TestGetCommits(t *testing.T) {
 	}
 }
 
+func TestGetCommits_SanitizesControlCharacters(t *testing.T) {
+	dir := initTestRepo(t)
+	commitFile(t, dir, "a.txt", "a", "fix \x1b[31mred\x1b[0m bug\a\n\nfirst\tline\x1b\nsecond line")
+
+	repo := NewRepo(dir)
+	commits, err := repo.GetCommits(1, LogOptions{Fields: []string{"subject", "body"}})
+	if err != nil {
+		t.Fatalf("GetCommits: %v", err)
+	}
+	if len(commits) != 1 {
+		t.Fatalf("expected 1 commit, got %d", len(commits))
+	}
+	if got := commits[0].Message; got != "fix red bug" {
+		t.Errorf("expected subject %q, got %q", "fix red bug", got)
+	}
+	// Newlines and tabs are kept.
+	if got := commits[0].Body; got != "first\tline\nsecond line" {
+		t.Errorf("expected body %q, got %q", "first\tline\nsecond line", got)
+	}
+}
+
 func TestGetCommits_All(t *testing.T) {
 	dir := initTestRepo(t)
 	cmd := exec.Command("git", "branch", "-M", "main")
@@ -261,7 +538,7 @@ func TestGetCommits_All(t *testing.T) {
 
 	repo := NewRepo(dir)
 	// Request more commits than exist
-	commits, err := repo.GetCommits(10)
+	commits, err := repo.GetCommits(10, LogOptions{})
 	if err != nil {
 		t.Fatalf("GetCommits: %v", err)
 	}
@@ -270,6 +547,69 @@ func TestGetCommits_All(t *testing.T) {
 	}
 }
 
+func TestGetDiff_Subtrees(t *testing.T) {
+	dir := initTestRepo(t)
+	if err := os.Mkdir(filepath.Join(dir, "src"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	commitFile(t, dir, "README", "readme\n", "add readme")
+	commitFile(t, dir, "src/main.go", "package main\n", "add main")
+	commitFile(t, dir, "src/main.go", "package main\n\nfunc main() {}\n", "add func main")
+	commitFile(t, dir, "README", "readme v2\n", "update readme")
+	repo := NewRepo(dir)
+
+	out, err := repo.GetDiff("HEAD~2:src", "HEAD:src/", DiffOptions{})
+	if err != nil {
+		t.Fatalf("GetDiff: %v", err)
+	}
+	// Paths are relative to the subtree, and files outside it are left out.
+	if !strings.Contains(out, "diff --git a/main.go b/main.go") || !strings.Contains(out, "+func main() {}") {
+		t.Errorf("expected a diff of main.go relative to src, got:\n%s", out)
+	}
+	if strings.Contains(out, "src/") || strings.Contains(out, "README") {
+		t.Errorf("expected only src's files without the src/ prefix, got:\n%s", out)
+	}
+
+	// Files are found inside the subtree.
+	data, err := repo.GetFile("HEAD:src", "main.go")
+	if err != nil {
+		t.Fatalf("GetFile: %v", err)
+	}
+	if string(data) != "package main\n\nfunc main() {}\n" {
+		t.Errorf("GetFile(HEAD:src, main.go) = %q", data)
+	}
+
+	for _, tt := range []struct{ base, target string }{
+		{"HEAD:src", ""},
+		{"HEAD~2:src", "HEAD"},
+		{"HEAD~2", "HEAD:src"},
+	} {
+		if _, err := repo.GetDiff(tt.base, tt.target, DiffOptions{}); err == nil {
+			t.Errorf("GetDiff(%q, %q): expected error mixing a subtree with a whole tree, got nil", tt.base, tt.target)
+		}
+	}
+}
+
+func TestSplitTreePath(t *testing.T) {
+	tests := []struct {
+		ref, rev, path string
+		ok             bool
+	}{
+		{"HEAD", "HEAD", "", false},
+		{"HEAD:src", "HEAD", "src", true},
+		{"main:src/pkg/", "main", "src/pkg", true},
+		{"v1.0:", "v1.0", "", true},
+		{"main@{2024-01-01 10:00:00}", "main@{2024-01-01 10:00:00}", "", false},
+		{"HEAD^{/fix: typo}:docs", "HEAD^{/fix: typo}", "docs", true},
+	}
+	for _, tt := range tests {
+		rev, path, ok := SplitTreePath(tt.ref)
+		if rev != tt.rev || path != tt.path || ok != tt.ok {
+			t.Errorf("SplitTreePath(%q) = %q, %q, %v; want %q, %q, %v", tt.ref, rev, path, ok, tt.rev, tt.path, tt.ok)
+		}
+	}
+}
+
 func TestGetDiff_RejectsFlagLikeRef(t *testing.T) {
 	repo := NewRepo(".")
 
@@ -284,7 +624,7 @@ func TestGetDiff_RejectsFlagLikeRef(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			_, err := repo.GetDiff(tt.base, tt.target)
+			_, err := repo.GetDiff(tt.base, tt.target, DiffOptions{})
 			if err == nil {
 				t.Error("expected error for flag-like ref, got nil")
 			}
@@ -294,3 +634,1177 @@ func TestGetDiff_RejectsFlagLikeRef(t *testing.T) {
 		})
 	}
 }
+
+func TestGetRefs(t *testing.T) {
+	dir := initTestRepo(t)
+	cmd := exec.Command("git", "branch", "-M", "main")
+	cmd.Dir = dir
+	_, _ = cmd.CombinedOutput()
+
+	first := commitFile(t, dir, "a.txt", "a", "first commit")
+	for _, args := range [][]string{
+		{"git", "branch", "feature"},
+		{"git", "tag", "-a", "v1.0.0", "-m", "release"},
+	} {
+		cmd := exec.Command(args[0], args[1:]...)
+		cmd.Dir = dir
+		out, err := cmd.CombinedOutput()
+		if err != nil {
+			t.Fatalf("setup %v: %v\n%s", args, err, out)
+		}
+	}
+	second := commitFile(t, dir, "b.txt", "b", "second commit")
+
+	repo := NewRepo(dir)
+	refs, err := repo.GetRefs()
+	if err != nil {
+		t.Fatalf("GetRefs: %v", err)
+	}
+
+	want := []Ref{
+		{Name: "HEAD", Type: "head", Hash: second},
+		{Name: "main", Type: "branch", Hash: second},
+		{Name: "feature", Type: "branch", Hash: first},
+		{Name: "v1.0.0", Type: "tag", Hash: first},
+	}
+	if len(refs) != len(want) {
+		t.Fatalf("expected %d refs, got %d: %+v", len(want), len(refs), refs)
+	}
+	for i := range want {
+		if refs[i] != want[i] {
+			t.Errorf("ref %d: expected %+v, got %+v", i, want[i], refs[i])
+		}
+	}
+}
+
+func TestIsShallow(t *testing.T) {
+	dir := initTestRepo(t)
+	cmd := exec.Command("git", "branch", "-M", "main")
+	cmd.Dir = dir
+	_, _ = cmd.CombinedOutput()
+
+	commitFile(t, dir, "README.md", "hello", "initial commit")
+	cmd = exec.Command("git", "checkout", "-b", "feature")
+	cmd.Dir = dir
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("checkout feature: %v\n%s", err, out)
+	}
+	commitFile(t, dir, "feature.txt", "feature work", "feature commit")
+	cmd = exec.Command("git", "checkout", "main")
+	cmd.Dir = dir
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("checkout main: %v\n%s", err, out)
+	}
+	commitFile(t, dir, "main.txt", "main work", "main commit")
+
+	full := NewRepo(dir)
+	if shallow, err := full.IsShallow(); err != nil || shallow {
+		t.Fatalf("IsShallow on full repo = %v, %v; want false, nil", shallow, err)
+	}
+
+	// A depth-1 clone has no common history between main and feature.
+	clone := filepath.Join(t.TempDir(), "clone")
+	cmd = exec.Command("git", "clone", "--depth", "1", "--no-single-branch", "file://"+dir, clone)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("shallow clone: %v\n%s", err, out)
+	}
+	cmd = exec.Command("git", "checkout", "-b", "feature", "origin/feature")
+	cmd.Dir = clone
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("checkout feature in clone: %v\n%s", err, out)
+	}
+
+	repo := NewRepo(clone)
+	shallow, err := repo.IsShallow()
+	if err != nil {
+		t.Fatalf("IsShallow: %v", err)
+	}
+	if !shallow {
+		t.Error("expected shallow clone to report IsShallow=true")
+	}
+	if _, err := repo.GetMergeBase("HEAD", "main"); err == nil {
+		t.Error("expected merge-base to fail in shallow clone")
+	}
+}
+
+func TestGetDiff_FindRenamesThreshold(t *testing.T) {
+	dir := initTestRepo(t)
+	cmd := exec.Command("git", "branch", "-M", "main")
+	cmd.Dir = dir
+	_, _ = cmd.CombinedOutput()
+
+	commitFile(t, dir, "old.txt", "one\ntwo\nthree\nfour\nfive\nsix\nseven\neight\nnine\nten\n", "initial commit")
+
+	// Move the file and rewrite most of it so similarity drops below 50%.
+	cmd = exec.Command("git", "mv", "old.txt", "new.txt")
+	cmd.Dir = dir
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("git mv: %v\n%s", err, out)
+	}
+	commitFile(t, dir, "new.txt", "one\ntwo\nthree\nfour\nFIVE\nSIX\nSEVEN\nEIGHT\nNINE\nTEN\n", "move and rewrite")
+
+	repo := NewRepo(dir)
+	out, err := repo.GetDiff("HEAD~1", "HEAD", DiffOptions{})
+	if err != nil {
+		t.Fatalf("GetDiff: %v", err)
+	}
+	if strings.Contains(out, "rename from") {
+		t.Fatalf("expected no rename at default threshold, got:\n%s", out)
+	}
+
+	out, err = repo.GetDiff("HEAD~1", "HEAD", DiffOptions{FindRenames: "30"})
+	if err != nil {
+		t.Fatalf("GetDiff with FindRenames: %v", err)
+	}
+	if !strings.Contains(out, "rename from old.txt") || !strings.Contains(out, "rename to new.txt") {
+		t.Errorf("expected rename with lowered threshold, got:\n%s", out)
+	}
+}
+
+func TestGetCommitDiff_MergeParents(t *testing.T) {
+	dir := initTestRepo(t)
+	cmd := exec.Command("git", "branch", "-M", "main")
+	cmd.Dir = dir
+	_, _ = cmd.CombinedOutput()
+
+	commitFile(t, dir, "README.md", "hello", "initial commit")
+	for _, args := range [][]string{{"git", "checkout", "-b", "feature"}} {
+		cmd := exec.Command(args[0], args[1:]...)
+		cmd.Dir = dir
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("setup %v: %v\n%s", args, err, out)
+		}
+	}
+	commitFile(t, dir, "feature.txt", "feature work\n", "feature commit")
+	for _, args := range [][]string{{"git", "checkout", "main"}} {
+		cmd := exec.Command(args[0], args[1:]...)
+		cmd.Dir = dir
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("setup %v: %v\n%s", args, err, out)
+		}
+	}
+	commitFile(t, dir, "main.txt", "main work\n", "main commit")
+	cmd = exec.Command("git", "merge", "--no-ff", "-m", "merge feature", "feature")
+	cmd.Dir = dir
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("merge: %v\n%s", err, out)
+	}
+
+	repo := NewRepo(dir)
+	n, err := repo.GetParentCount("HEAD")
+	if err != nil {
+		t.Fatalf("GetParentCount: %v", err)
+	}
+	if n != 2 {
+		t.Fatalf("expected 2 parents, got %d", n)
+	}
+
+	// Against the mainline, the merge brings in the feature work.
+	first, err := repo.GetCommitDiff("HEAD", 1, DiffOptions{})
+	if err != nil {
+		t.Fatalf("GetCommitDiff parent 1: %v", err)
+	}
+	if !strings.Contains(first, "+feature work") || strings.Contains(first, "main work") {
+		t.Errorf("expected parent 1 diff to add only feature work, got:\n%s", first)
+	}
+
+	// Against the feature branch, the merge brings in the main work.
+	second, err := repo.GetCommitDiff("HEAD", 2, DiffOptions{})
+	if err != nil {
+		t.Fatalf("GetCommitDiff parent 2: %v", err)
+	}
+	if !strings.Contains(second, "+main work") || strings.Contains(second, "feature work") {
+		t.Errorf("expected parent 2 diff to add only main work, got:\n%s", second)
+	}
+
+	for _, parent := range []int{0, 3} {
+		if _, err := repo.GetCommitDiff("HEAD", parent, DiffOptions{}); err == nil {
+			t.Errorf("expected error for parent %d of a two-parent merge", parent)
+		}
+	}
+}
+
+func TestGetRangeDiff(t *testing.T) {
+	dir := initTestRepo(t)
+	run := func(args ...string) {
+		t.Helper()
+		cmd := exec.Command("git", args...)
+		cmd.Dir = dir
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %v: %v\n%s", args, err, out)
+		}
+	}
+	run("branch", "-M", "main")
+	commitFile(t, dir, "README.md", "hello", "initial commit")
+	run("checkout", "-b", "v1")
+	commitFile(t, dir, "a.txt", "a\n", "add a")
+	commitFile(t, dir, "d.txt", "d\n", "add d")
+	run("checkout", "-b", "v2", "main")
+	commitFile(t, dir, "a.txt", "a\n", "add a")
+	commitFile(t, dir, "e.txt", "e\n", "add e")
+
+	repo := NewRepo(dir)
+	out, err := repo.GetRangeDiff("main..v1", "main..v2")
+	if err != nil {
+		t.Fatalf("GetRangeDiff: %v", err)
+	}
+	for _, want := range []string{" = ", "add a", " < ", "add d", " > ", "add e"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("expected range-diff to contain %q, got:\n%s", want, out)
+		}
+	}
+
+	if _, err := repo.GetRangeDiff("--output=/tmp/evil", "main..v2"); err == nil {
+		t.Error("expected error for flag-like range")
+	}
+}
+
+func TestGetCommits_SignatureNone(t *testing.T) {
+	dir := initTestRepo(t) // commit.gpgsign=false
+	commitFile(t, dir, "a.txt", "a", "first commit")
+	commitFile(t, dir, "b.txt", "b", "second commit")
+
+	repo := NewRepo(dir)
+	commits, err := repo.GetCommits(10, LogOptions{})
+	if err != nil {
+		t.Fatalf("GetCommits: %v", err)
+	}
+	if len(commits) != 2 {
+		t.Fatalf("expected 2 commits, got %d", len(commits))
+	}
+	for i, c := range commits {
+		if c.Signature != "none" {
+			t.Errorf("commit %d: expected signature 'none', got %q", i, c.Signature)
+		}
+	}
+}
+
+func TestSignatureStatus(t *testing.T) {
+	tests := map[string]string{
+		"G": "good",
+		"B": "bad",
+		"N": "none",
+		"U": "unknown",
+		"E": "unknown",
+		"X": "unknown",
+	}
+	for code, want := range tests {
+		if got := signatureStatus(code); got != want {
+			t.Errorf("signatureStatus(%q) = %q, want %q", code, got, want)
+		}
+	}
+}
+
+func TestGetUpstream(t *testing.T) {
+	dir := initTestRepo(t)
+	cmd := exec.Command("git", "branch", "-M", "main")
+	cmd.Dir = dir
+	_, _ = cmd.CombinedOutput()
+
+	commitFile(t, dir, "README.md", "hello", "initial commit")
+	repo := NewRepo(dir)
+	if _, err := repo.GetUpstream(); err == nil {
+		t.Error("expected error for branch without upstream, got nil")
+	}
+
+	// feature tracks main; work on feature should be diffed against main.
+	cmd = exec.Command("git", "checkout", "--track", "-b", "feature", "main")
+	cmd.Dir = dir
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("checkout feature: %v\n%s", err, out)
+	}
+	commitFile(t, dir, "feature.txt", "feature work", "feature commit")
+
+	upstream, err := repo.GetUpstream()
+	if err != nil {
+		t.Fatalf("GetUpstream: %v", err)
+	}
+	if upstream != "main" {
+		t.Errorf("expected upstream 'main', got %q", upstream)
+	}
+
+	base, err := repo.GetMergeBase("HEAD", upstream)
+	if err != nil {
+		t.Fatalf("GetMergeBase: %v", err)
+	}
+	mainHash, err := repo.git("rev-parse", "main")
+	if err != nil {
+		t.Fatalf("rev-parse main: %v", err)
+	}
+	if base != mainHash {
+		t.Errorf("expected merge-base %s, got %s", mainHash, base)
+	}
+}
+
+func TestGetFileHistory(t *testing.T) {
+	dir := initTestRepo(t)
+	base := commitFile(t, dir, "README.md", "hello", "initial commit")
+	commitFile(t, dir, "foo.go", "v1\n", "add foo")
+	commitFile(t, dir, "other.txt", "x\n", "unrelated")
+	commitFile(t, dir, "foo.go", "v2\n", "update foo")
+	commitFile(t, dir, "foo.go", "v3\n", "update foo again")
+
+	repo := NewRepo(dir)
+	out, err := repo.GetFileHistory(base, "HEAD", "foo.go", "%x1e%s", DiffOptions{})
+	if err != nil {
+		t.Fatalf("GetFileHistory: %v", err)
+	}
+
+	var subjects []string
+	for _, record := range strings.Split(out, "\x1e")[1:] {
+		subject, body, _ := strings.Cut(record, "\n")
+		subjects = append(subjects, subject)
+		if !strings.Contains(body, "diff --git a/foo.go b/foo.go") {
+			t.Errorf("commit %q: expected a diff of foo.go, got:\n%s", subject, body)
+		}
+	}
+	want := []string{"update foo again", "update foo", "add foo"}
+	if strings.Join(subjects, ",") != strings.Join(want, ",") {
+		t.Errorf("expected commits %q, got %q", want, subjects)
+	}
+
+	if _, err := repo.GetFileHistory(base, "HEAD", "../escape.go", "%s", DiffOptions{}); err == nil {
+		t.Error("expected error for path outside the repository, got nil")
+	}
+}
+
+func TestCheckRepo(t *testing.T) {
+	dir := initTestRepo(t)
+	if err := NewRepo(dir).CheckRepo(); err != nil {
+		t.Errorf("CheckRepo on repo: %v", err)
+	}
+
+	outside := t.TempDir()
+	t.Setenv("GIT_CEILING_DIRECTORIES", filepath.Dir(outside))
+	if err := NewRepo(outside).CheckRepo(); !errors.Is(err, ErrNotRepo) {
+		t.Errorf("CheckRepo outside a repo = %v, want ErrNotRepo", err)
+	}
+}
+
+func TestGetDiff_Text(t *testing.T) {
+	dir := initTestRepo(t)
+	commitFile(t, dir, "data.bin", "header\x00one\n", "initial commit")
+	commitFile(t, dir, "data.bin", "header\x00two\n", "change data")
+
+	repo := NewRepo(dir)
+	out, err := repo.GetDiff("HEAD~1", "HEAD", DiffOptions{})
+	if err != nil {
+		t.Fatalf("GetDiff: %v", err)
+	}
+	if !strings.Contains(out, "Binary files") {
+		t.Fatalf("expected binary diff without Text, got:\n%q", out)
+	}
+
+	out, err = repo.GetDiff("HEAD~1", "HEAD", DiffOptions{Text: true})
+	if err != nil {
+		t.Fatalf("GetDiff with Text: %v", err)
+	}
+	if !strings.Contains(out, "-header\x00one") || !strings.Contains(out, "+header\x00two") {
+		t.Errorf("expected textual diff with Text, got:\n%q", out)
+	}
+}
+
+func TestGitIgnoresPagerAndExternalDiffEnv(t *testing.T) {
+	dir := initTestRepo(t)
+	commitFile(t, dir, "a.txt", "one\n", "initial commit")
+	commitFile(t, dir, "a.txt", "two\n", "change a")
+
+	script := filepath.Join(t.TempDir(), "extdiff.sh")
+	if err := os.WriteFile(script, []byte("#!/bin/sh\necho EXTERNAL\n"), 0o755); err != nil {
+		t.Fatalf("write script: %v", err)
+	}
+	t.Setenv("GIT_EXTERNAL_DIFF", script)
+	t.Setenv("GIT_PAGER", "false")
+
+	repo := NewRepo(dir)
+	// Without --no-ext-diff, only the environment keeps the script out.
+	out, err := repo.git("diff", "HEAD~1", "HEAD")
+	if err != nil {
+		t.Fatalf("git diff: %v", err)
+	}
+	if strings.Contains(out, "EXTERNAL") || !strings.Contains(out, "diff --git a/a.txt b/a.txt") || !strings.Contains(out, "-one\n+two") {
+		t.Errorf("expected a standard unified diff, got:\n%s", out)
+	}
+
+	pager, err := repo.git("var", "GIT_PAGER")
+	if err != nil {
+		t.Fatalf("git var GIT_PAGER: %v", err)
+	}
+	if pager != "cat" {
+		t.Errorf("expected pager cat, got %q", pager)
+	}
+}
+
+func TestGetCommits_Pickaxe(t *testing.T) {
+	dir := initTestRepo(t)
+	commitFile(t, dir, "a.txt", "plain\n", "initial commit")
+	commitFile(t, dir, "a.txt", "plain\nneedle42\n", "add needle")
+	commitFile(t, dir, "b.txt", "other\n", "unrelated")
+	commitFile(t, dir, "a.txt", "plain\n", "remove needle")
+
+	repo := NewRepo(dir)
+	tests := []struct {
+		name string
+		opts LogOptions
+		want []string
+	}{
+		{"string", LogOptions{Pickaxe: "needle42"}, []string{"remove needle", "add needle"}},
+		{"regex", LogOptions{PickaxeRegex: "needle[0-9]+"}, []string{"remove needle", "add needle"}},
+		{"no match", LogOptions{Pickaxe: "haystack"}, nil},
+		{"flag-like text", LogOptions{Pickaxe: "--all"}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			commits, err := repo.GetCommits(10, tt.opts)
+			if err != nil {
+				t.Fatalf("GetCommits: %v", err)
+			}
+			var got []string
+			for _, c := range commits {
+				got = append(got, c.Message)
+			}
+			if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("expected commits %q, got %q", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestGetCommits_Merges(t *testing.T) {
+	dir := initTestRepo(t)
+	commitFile(t, dir, "a.txt", "a", "initial commit")
+	setup := func(args ...string) {
+		t.Helper()
+		cmd := exec.Command("git", args...)
+		cmd.Dir = dir
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %v: %v\n%s", args, err, out)
+		}
+	}
+	setup("checkout", "-b", "feature")
+	commitFile(t, dir, "b.txt", "b", "feature commit")
+	setup("checkout", "-")
+	commitFile(t, dir, "c.txt", "c", "main commit")
+	setup("merge", "--no-ff", "-m", "merge feature", "feature")
+
+	repo := NewRepo(dir)
+	tests := []struct {
+		merges string
+		want   []string
+	}{
+		{"all", []string{"merge feature", "main commit", "feature commit", "initial commit"}},
+		{"none", []string{"main commit", "feature commit", "initial commit"}},
+		{"first-parent", []string{"merge feature", "main commit", "initial commit"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.merges, func(t *testing.T) {
+			commits, err := repo.GetCommits(10, LogOptions{Merges: tt.merges})
+			if err != nil {
+				t.Fatalf("GetCommits: %v", err)
+			}
+			var got []string
+			for _, c := range commits {
+				got = append(got, c.Message)
+			}
+			if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("expected commits %q, got %q", tt.want, got)
+			}
+		})
+	}
+
+	if _, err := repo.GetCommits(10, LogOptions{Merges: "some"}); err == nil {
+		t.Error("expected error for invalid merges, got nil")
+	}
+}
+
+func TestRepoConfig(t *testing.T) {
+	dir := initTestRepo(t)
+	repo := NewRepo(dir)
+	repo.Config = []string{"diff.algorithm=patience"}
+
+	got, err := repo.git("config", "--get", "diff.algorithm")
+	if err != nil {
+		t.Fatalf("git config: %v", err)
+	}
+	if got != "patience" {
+		t.Errorf("expected the -c setting to reach git, got %q", got)
+	}
+
+	if err := ValidateConfig("Diff.Algorithm=histogram"); err != nil {
+		t.Errorf("ValidateConfig(Diff.Algorithm): %v", err)
+	}
+	for _, bad := range []string{"core.fsmonitor=/tmp/hook", "diff.external=sh", "core.pager=less", "=x", "diff.algorithm", "diff.algorithm=a\nb"} {
+		if err := ValidateConfig(bad); err == nil {
+			t.Errorf("ValidateConfig(%q): expected error, got nil", bad)
+		}
+	}
+}
+
+func TestRepoConfig_Parses(t *testing.T) {
+	// A value for each allowed key, chosen to differ from git's default.
+	values := map[string]string{
+		"core.abbrev":           "12",
+		"diff.algorithm":        "histogram",
+		"diff.context":          "1",
+		"diff.indentheuristic":  "false",
+		"diff.interhunkcontext": "5",
+		"diff.renamelimit":      "1",
+		"diff.renames":          "copies",
+	}
+
+	dir := initTestRepo(t)
+	// The change sits right below a blank context line.
+	commitFile(t, dir, "a.txt", "one\n\ntwo\nthree\n", "first commit")
+	commitFile(t, dir, "a.txt", "one\n\n2\nthree\n", "second commit")
+
+	for key := range SafeConfigKeys {
+		value, ok := values[key]
+		if !ok {
+			t.Errorf("no test value for allowed key %s", key)
+			continue
+		}
+		repo := NewRepo(dir)
+		repo.Config = []string{key + "=" + value}
+		raw, err := repo.GetDiff("HEAD~1", "HEAD", DiffOptions{})
+		if err != nil {
+			t.Fatalf("%s: GetDiff: %v", key, err)
+		}
+		result, err := diff.Parse(raw)
+		if err != nil {
+			t.Fatalf("%s: Parse: %v", key, err)
+		}
+		if len(result.Files) != 1 || result.Files[0].Additions != 1 || result.Files[0].Deletions != 1 {
+			t.Errorf("%s=%s: expected one file with +1 -1, got %+v from:\n%s", key, value, result.Files, raw)
+		}
+	}
+}
+
+func TestGetLatestTag(t *testing.T) {
+	dir := initTestRepo(t)
+	commitFile(t, dir, "a.txt", "one\n", "first commit")
+	repo := NewRepo(dir)
+
+	if _, err := repo.GetLatestTag("HEAD"); !errors.Is(err, ErrNoTag) {
+		t.Errorf("expected ErrNoTag without tags, got %v", err)
+	}
+
+	tag := func(name string) {
+		t.Helper()
+		cmd := exec.Command("git", "tag", name)
+		cmd.Dir = dir
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git tag: %v\n%s", err, out)
+		}
+	}
+	tag("v1.0.0")
+	commitFile(t, dir, "a.txt", "two\n", "second commit")
+	tag("v1.1.0")
+	commitFile(t, dir, "a.txt", "three\n", "third commit")
+
+	got, err := repo.GetLatestTag("HEAD")
+	if err != nil {
+		t.Fatalf("GetLatestTag: %v", err)
+	}
+	if got != "v1.1.0" {
+		t.Errorf("expected v1.1.0, the tag behind HEAD, got %q", got)
+	}
+	if got, err := repo.GetLatestTag("HEAD~2"); err != nil || got != "v1.0.0" {
+		t.Errorf("GetLatestTag(HEAD~2) = %q, %v; expected v1.0.0", got, err)
+	}
+	if _, err := repo.GetLatestTag("nonexistent"); err == nil || errors.Is(err, ErrNoTag) {
+		t.Errorf("expected an unknown commit error, got %v", err)
+	}
+}
+
+func TestGetCommits_ShortHash(t *testing.T) {
+	dir := initTestRepo(t)
+	commitFile(t, dir, "a.txt", "one\n", "first commit")
+	repo := NewRepo(dir)
+
+	for _, abbrev := range []int{0, 12} {
+		commits, err := repo.GetCommits(1, LogOptions{Abbrev: abbrev})
+		if err != nil {
+			t.Fatalf("GetCommits(Abbrev: %d): %v", abbrev, err)
+		}
+		if len(commits) != 1 {
+			t.Fatalf("expected 1 commit, got %d", len(commits))
+		}
+		c := commits[0]
+		if c.ShortHash == "" || len(c.ShortHash) >= len(c.Hash) || !strings.HasPrefix(c.Hash, c.ShortHash) {
+			t.Errorf("Abbrev %d: expected ShortHash to be a shorter prefix of %q, got %q", abbrev, c.Hash, c.ShortHash)
+		}
+		if abbrev > 0 && len(c.ShortHash) != abbrev {
+			t.Errorf("expected %d digits, got %q", abbrev, c.ShortHash)
+		}
+	}
+}
+
+func TestGetCommits_Order(t *testing.T) {
+	dir := initTestRepo(t)
+	setup := func(args ...string) {
+		t.Helper()
+		cmd := exec.Command("git", args...)
+		cmd.Dir = dir
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %v: %v\n%s", args, err, out)
+		}
+	}
+	dates := func(author, committer string) {
+		t.Setenv("GIT_AUTHOR_DATE", author)
+		t.Setenv("GIT_COMMITTER_DATE", committer)
+	}
+	dates("2024-01-01T00:00:00Z", "2024-01-01T00:00:00Z")
+	commitFile(t, dir, "a.txt", "a", "initial commit")
+	setup("checkout", "-b", "feature")
+	// Written before the main commit but rebased after it.
+	dates("2024-01-02T00:00:00Z", "2024-01-04T00:00:00Z")
+	commitFile(t, dir, "b.txt", "b", "rebased commit")
+	setup("checkout", "-")
+	dates("2024-01-03T00:00:00Z", "2024-01-03T00:00:00Z")
+	commitFile(t, dir, "c.txt", "c", "main commit")
+	dates("2024-01-05T00:00:00Z", "2024-01-05T00:00:00Z")
+	setup("merge", "--no-ff", "-m", "merge feature", "feature")
+
+	repo := NewRepo(dir)
+	tests := []struct {
+		order string
+		want  []string
+	}{
+		{"commit", []string{"merge feature", "rebased commit", "main commit", "initial commit"}},
+		{"author", []string{"merge feature", "main commit", "rebased commit", "initial commit"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.order, func(t *testing.T) {
+			commits, err := repo.GetCommits(10, LogOptions{Order: tt.order})
+			if err != nil {
+				t.Fatalf("GetCommits: %v", err)
+			}
+			var got []string
+			for _, c := range commits {
+				got = append(got, c.Message)
+			}
+			if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("expected commits %q, got %q", tt.want, got)
+			}
+		})
+	}
+
+	commits, err := repo.GetCommits(10, LogOptions{})
+	if err != nil {
+		t.Fatalf("GetCommits: %v", err)
+	}
+	rebased := commits[1]
+	if !strings.HasPrefix(rebased.Date, "2024-01-02") || !strings.HasPrefix(rebased.CommitDate, "2024-01-04") {
+		t.Errorf("expected author date 2024-01-02 and commit date 2024-01-04, got %q and %q", rebased.Date, rebased.CommitDate)
+	}
+
+	if _, err := repo.GetCommits(10, LogOptions{Order: "random"}); err == nil {
+		t.Error("expected error for invalid order, got nil")
+	}
+}
+
+func TestGetCommits_SeparatorInSubject(t *testing.T) {
+	dir := initTestRepo(t)
+	commitFile(t, dir, "a.txt", "a", "first commit")
+	commitFile(t, dir, "b.txt", "b", "fix ---COMMIT_SEP--- parsing")
+
+	repo := NewRepo(dir)
+	commits, err := repo.GetCommits(10, LogOptions{})
+	if err != nil {
+		t.Fatalf("GetCommits: %v", err)
+	}
+	if len(commits) != 2 {
+		t.Fatalf("expected 2 commits, got %d: %+v", len(commits), commits)
+	}
+	if commits[0].Message != "fix ---COMMIT_SEP--- parsing" {
+		t.Errorf("expected subject with separator intact, got %q", commits[0].Message)
+	}
+	if commits[0].Author != "Test User" || commits[0].Signature != "none" {
+		t.Errorf("expected fields after the subject to parse, got %+v", commits[0])
+	}
+	if commits[1].Message != "first commit" {
+		t.Errorf("expected second commit 'first commit', got %q", commits[1].Message)
+	}
+}
+
+func TestGetCurrentPatch(t *testing.T) {
+	dir := initTestRepo(t)
+	commitFile(t, dir, "a.txt", "a\n", "initial commit")
+
+	repo := NewRepo(dir)
+	if _, err := repo.GetCurrentPatch(); !errors.Is(err, ErrNoPatchInProgress) {
+		t.Fatalf("expected ErrNoPatchInProgress, got %v", err)
+	}
+
+	// Simulate git am stopping on a patch.
+	patch := "diff --git a/a.txt b/a.txt\n--- a/a.txt\n+++ b/a.txt\n@@ -1 +1 @@\n-a\n+b\n"
+	applyDir := filepath.Join(dir, ".git", "rebase-apply")
+	if err := os.MkdirAll(applyDir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(applyDir, "patch"), []byte(patch), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := repo.GetCurrentPatch()
+	if err != nil {
+		t.Fatalf("GetCurrentPatch: %v", err)
+	}
+	if got != patch {
+		t.Errorf("expected patch %q, got %q", patch, got)
+	}
+}
+
+func TestGetCurrentPatch_RebaseMerge(t *testing.T) {
+	dir := initTestRepo(t)
+	run := func(args ...string) {
+		t.Helper()
+		cmd := exec.Command("git", args...)
+		cmd.Dir = dir
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %v: %v\n%s", args, err, out)
+		}
+	}
+	run("branch", "-M", "main")
+	commitFile(t, dir, "a.txt", "base\n", "initial commit")
+	run("checkout", "-b", "feature")
+	commitFile(t, dir, "a.txt", "feature\n", "feature change")
+	run("checkout", "main")
+	commitFile(t, dir, "a.txt", "main\n", "main change")
+	run("checkout", "feature")
+
+	// The rebase stops on the conflicting feature commit.
+	cmd := exec.Command("git", "rebase", "--merge", "main")
+	cmd.Dir = dir
+	if out, err := cmd.CombinedOutput(); err == nil {
+		t.Fatalf("expected rebase to stop on a conflict, got:\n%s", out)
+	}
+	t.Cleanup(func() {
+		cmd := exec.Command("git", "rebase", "--abort")
+		cmd.Dir = dir
+		_ = cmd.Run()
+	})
+
+	got, err := NewRepo(dir).GetCurrentPatch()
+	if err != nil {
+		t.Fatalf("GetCurrentPatch: %v", err)
+	}
+	if !strings.Contains(got, "feature change") || !strings.Contains(got, "+feature") {
+		t.Errorf("expected the feature commit's patch, got:\n%s", got)
+	}
+}
+
+func TestGetTabWidths(t *testing.T) {
+	dir := initTestRepo(t)
+	attrs := "*.py whitespace=tabwidth=4\n*.c whitespace=indent-with-non-tab,tabwidth=2\n*.txt whitespace=trailing-space\n"
+	if err := os.WriteFile(filepath.Join(dir, ".gitattributes"), []byte(attrs), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	repo := NewRepo(dir)
+	widths, err := repo.GetTabWidths([]string{"a.py", "src/b.c", "c.txt", "d.go"})
+	if err != nil {
+		t.Fatalf("GetTabWidths: %v", err)
+	}
+	want := map[string]int{"a.py": 4, "src/b.c": 2}
+	if len(widths) != len(want) {
+		t.Fatalf("expected %v, got %v", want, widths)
+	}
+	for path, w := range want {
+		if widths[path] != w {
+			t.Errorf("%s: expected tab width %d, got %d", path, w, widths[path])
+		}
+	}
+}
+
+func TestGetDiff_ThreeDot(t *testing.T) {
+	dir := initTestRepo(t)
+	commitFile(t, dir, "base.txt", "base\n", "initial commit")
+	setup := func(args ...string) {
+		t.Helper()
+		cmd := exec.Command("git", args...)
+		cmd.Dir = dir
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %v: %v\n%s", args, err, out)
+		}
+	}
+	setup("branch", "-M", "main")
+	setup("checkout", "-b", "feature")
+	commitFile(t, dir, "feature.txt", "feature\n", "feature commit")
+	setup("checkout", "main")
+	commitFile(t, dir, "main.txt", "main\n", "landed on main later")
+
+	repo := NewRepo(dir)
+
+	// Two-dot: main's later change shows up as a deletion.
+	twoDot, err := repo.GetDiff("main", "feature", DiffOptions{})
+	if err != nil {
+		t.Fatalf("GetDiff: %v", err)
+	}
+	if !strings.Contains(twoDot, "main.txt") {
+		t.Errorf("expected two-dot diff to include main.txt, got:\n%s", twoDot)
+	}
+
+	// Three-dot: only what feature changed since it diverged.
+	base, err := repo.GetMergeBase("main", "feature")
+	if err != nil {
+		t.Fatalf("GetMergeBase: %v", err)
+	}
+	threeDot, err := repo.GetDiff(base, "feature", DiffOptions{})
+	if err != nil {
+		t.Fatalf("GetDiff: %v", err)
+	}
+	if strings.Contains(threeDot, "main.txt") {
+		t.Errorf("expected three-dot diff to exclude main.txt, got:\n%s", threeDot)
+	}
+	if !strings.Contains(threeDot, "feature.txt") {
+		t.Errorf("expected three-dot diff to include feature.txt, got:\n%s", threeDot)
+	}
+}
+
+func TestConflictStages(t *testing.T) {
+	dir := initTestRepo(t)
+	commitFile(t, dir, "a.txt", "1\n2\n3\n", "base")
+	setup := func(args ...string) error {
+		t.Helper()
+		cmd := exec.Command("git", args...)
+		cmd.Dir = dir
+		out, err := cmd.CombinedOutput()
+		if err != nil {
+			return fmt.Errorf("git %v: %w\n%s", args, err, out)
+		}
+		return nil
+	}
+	for _, args := range [][]string{{"branch", "-M", "main"}, {"checkout", "-b", "other"}} {
+		if err := setup(args...); err != nil {
+			t.Fatal(err)
+		}
+	}
+	commitFile(t, dir, "a.txt", "1\ntheirs\n3\n", "theirs")
+	if err := setup("checkout", "main"); err != nil {
+		t.Fatal(err)
+	}
+	commitFile(t, dir, "a.txt", "1\nours\n3\n", "ours")
+	if err := setup("merge", "other"); err == nil {
+		t.Fatal("expected the merge to conflict")
+	}
+
+	repo := NewRepo(dir)
+	paths, err := repo.GetConflictedPaths()
+	if err != nil {
+		t.Fatalf("GetConflictedPaths: %v", err)
+	}
+	if len(paths) != 1 || paths[0] != "a.txt" {
+		t.Fatalf("expected [a.txt], got %q", paths)
+	}
+
+	for stage, want := range map[int]string{StageBase: "2", StageOurs: "ours", StageTheirs: "theirs"} {
+		data, err := repo.GetStage("a.txt", stage)
+		if err != nil {
+			t.Fatalf("GetStage(%d): %v", stage, err)
+		}
+		if got := strings.Split(string(data), "\n")[1]; got != want {
+			t.Errorf("stage %d: expected line 2 %q, got %q", stage, want, got)
+		}
+	}
+
+	for stage, want := range map[int]string{StageOurs: "+ours", StageTheirs: "+theirs"} {
+		out, err := repo.GetConflictDiff("a.txt", stage, DiffOptions{})
+		if err != nil {
+			t.Fatalf("GetConflictDiff(%d): %v", stage, err)
+		}
+		if !strings.Contains(out, "diff --git a/a.txt b/a.txt") || !strings.Contains(out, "-2\n"+want) {
+			t.Errorf("stage %d: unexpected diff:\n%s", stage, out)
+		}
+	}
+
+	if _, err := repo.GetStage("a.txt", 4); err == nil {
+		t.Error("expected error for invalid stage, got nil")
+	}
+}
+
+func TestGetStashDiff(t *testing.T) {
+	dir := initTestRepo(t)
+	commitFile(t, dir, "tracked.txt", "before\n", "initial commit")
+	if err := os.WriteFile(filepath.Join(dir, "tracked.txt"), []byte("after\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "new.txt"), []byte("untracked\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	cmd := exec.Command("git", "stash", "push", "--include-untracked")
+	cmd.Dir = dir
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("git stash: %v\n%s", err, out)
+	}
+
+	repo := NewRepo(dir)
+	d, err := repo.GetStashDiff("stash@{0}", DiffOptions{})
+	if err != nil {
+		t.Fatalf("GetStashDiff: %v", err)
+	}
+	if !strings.Contains(d.Tracked, "+after") || strings.Contains(d.Tracked, "new.txt") {
+		t.Errorf("expected only the tracked edit in Tracked, got:\n%s", d.Tracked)
+	}
+	if !strings.Contains(d.Untracked, "new file mode") || !strings.Contains(d.Untracked, "+untracked") ||
+		strings.Contains(d.Untracked, "tracked.txt b/tracked.txt") {
+		t.Errorf("expected only new.txt in Untracked, got:\n%s", d.Untracked)
+	}
+
+	// Without --include-untracked there is no untracked part.
+	if err := os.WriteFile(filepath.Join(dir, "tracked.txt"), []byte("again\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	cmd = exec.Command("git", "stash", "push")
+	cmd.Dir = dir
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("git stash: %v\n%s", err, out)
+	}
+	d, err = repo.GetStashDiff("stash@{0}", DiffOptions{})
+	if err != nil {
+		t.Fatalf("GetStashDiff: %v", err)
+	}
+	if d.Untracked != "" {
+		t.Errorf("expected no untracked part, got:\n%s", d.Untracked)
+	}
+}
+
+func TestGetPreviousTag(t *testing.T) {
+	dir := initTestRepo(t)
+	repo := NewRepo(dir)
+
+	// Created out of version order, and v1.10.0 sorts before v1.9.0 by name.
+	for _, tag := range []string{"v1.9.0", "v2.0.0", "v1.10.0"} {
+		commitFile(t, dir, "VERSION", tag, "release "+tag)
+		cmd := exec.Command("git", "tag", tag)
+		cmd.Dir = dir
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git tag %s: %v\n%s", tag, err, out)
+		}
+	}
+
+	tags, err := repo.GetTags()
+	if err != nil {
+		t.Fatalf("GetTags: %v", err)
+	}
+	if want := []string{"v1.9.0", "v1.10.0", "v2.0.0"}; !slices.Equal(tags, want) {
+		t.Errorf("GetTags = %v, want %v", tags, want)
+	}
+
+	for _, tc := range []struct {
+		tag, want string
+	}{
+		{"v1.10.0", "v1.9.0"},
+		{"v2.0.0", "v1.10.0"},
+	} {
+		prev, err := repo.GetPreviousTag(tc.tag)
+		if err != nil {
+			t.Errorf("GetPreviousTag(%s): %v", tc.tag, err)
+		} else if prev != tc.want {
+			t.Errorf("GetPreviousTag(%s) = %s, want %s", tc.tag, prev, tc.want)
+		}
+	}
+
+	if _, err := repo.GetPreviousTag("v1.9.0"); err == nil {
+		t.Error("expected error for the first tag, got nil")
+	}
+	if _, err := repo.GetPreviousTag("v3.0.0"); err == nil {
+		t.Error("expected error for a missing tag, got nil")
+	}
+}
+
+func TestRepo_Subdirectory(t *testing.T) {
+	dir := initTestRepo(t)
+	if err := os.Mkdir(filepath.Join(dir, "sub"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	commitFile(t, dir, "sub/a.txt", "a\n", "add a")
+	commitFile(t, dir, "top.txt", "one\n", "add top")
+	if err := os.WriteFile(filepath.Join(dir, "top.txt"), []byte("two\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	// Paths are relative to the root, as in diffs, wherever ghdiff runs.
+	repo := NewRepo(filepath.Join(dir, "sub"))
+	data, err := repo.GetFile("", "top.txt")
+	if err != nil || string(data) != "two\n" {
+		t.Errorf("GetFile(top.txt) = %q, %v; want the working tree file", data, err)
+	}
+	_, newLines, err := repo.GetFileVersions("HEAD", "", "top.txt", "top.txt")
+	if err != nil || !slices.Equal(newLines, []string{"two"}) {
+		t.Errorf("GetFileVersions(top.txt) = %q, %v; want the working tree lines", newLines, err)
+	}
+	for _, ref := range []string{"", "HEAD"} {
+		lines, err := repo.Blame(ref, "sub/a.txt", 1, 1)
+		if err != nil || len(lines) != 1 || lines[0].Content != "a" {
+			t.Errorf("Blame(%q, sub/a.txt) = %+v, %v", ref, lines, err)
+		}
+	}
+}
+
+// ambiguousCommits writes two commit objects to the repo in dir whose
+// hashes both start with 29a5, returning the hashes.
+func ambiguousCommits(t *testing.T, dir string) []string {
+	t.Helper()
+	var hashes []string
+	// The messages were found by search to give hashes sharing a prefix.
+	for _, n := range []int{393, 501} {
+		cmd := exec.Command("git", "hash-object", "-t", "commit", "-w", "--stdin")
+		cmd.Dir = dir
+		cmd.Stdin = strings.NewReader(fmt.Sprintf("tree 4b825dc642cb6eb9a060e54bf8d69288fbee4904\nauthor A <a@example.com> 0 +0000\ncommitter A <a@example.com> 0 +0000\n\ncommit %d\n", n))
+		out, err := cmd.Output()
+		if err != nil {
+			t.Fatalf("git hash-object: %v", err)
+		}
+		hashes = append(hashes, strings.TrimSpace(string(out)))
+	}
+	return hashes
+}
+
+func TestResolveCommit(t *testing.T) {
+	dir := initTestRepo(t)
+	head := commitFile(t, dir, "a.txt", "a\n", "first commit")
+	hashes := ambiguousCommits(t, dir)
+	repo := NewRepo(dir)
+
+	for _, hash := range []string{head, head[:7], hashes[0][:5]} {
+		if _, err := repo.ResolveCommit(hash); err != nil {
+			t.Errorf("ResolveCommit(%s): %v", hash, err)
+		}
+	}
+	if got, _ := repo.ResolveCommit(head[:7]); got != head {
+		t.Errorf("expected the full hash %s, got %s", head, got)
+	}
+	if _, err := repo.ResolveCommit("29a5"); !errors.Is(err, ErrAmbiguousCommit) {
+		t.Errorf("expected ErrAmbiguousCommit for a prefix of two commits, got %v", err)
+	}
+	if _, err := repo.ResolveCommit("deadbeef"); !errors.Is(err, ErrUnknownCommit) {
+		t.Errorf("expected ErrUnknownCommit, got %v", err)
+	}
+}
+
+func TestBlameRange(t *testing.T) {
+	dir := initTestRepo(t)
+	first := commitFile(t, dir, "file.txt", "one\ntwo\nthree\nfour\n", "add file")
+	second := commitFile(t, dir, "file.txt", "one\ntwo\nTHREE\nfour\n", "shout three")
+	repo := NewRepo(dir)
+
+	lines, err := repo.Blame("HEAD", "file.txt", 2, 3)
+	if err != nil {
+		t.Fatalf("Blame: %v", err)
+	}
+	want := []BlameLine{
+		{Line: 2, Hash: first, Author: "Test User", Summary: "add file", Content: "two"},
+		{Line: 3, Hash: second, Author: "Test User", Summary: "shout three", Content: "THREE"},
+	}
+	if len(lines) != len(want) {
+		t.Fatalf("expected %d lines, got %d: %+v", len(want), len(lines), lines)
+	}
+	for i, got := range lines {
+		if got.Date == "" {
+			t.Errorf("line %d: expected a date", got.Line)
+		}
+		got.Date = ""
+		if got != want[i] {
+			t.Errorf("line %d: got %+v, want %+v", want[i].Line, got, want[i])
+		}
+	}
+
+	// The range is clamped to the file.
+	lines, err = repo.Blame("HEAD", "file.txt", 0, 100)
+	if err != nil {
+		t.Fatalf("Blame: %v", err)
+	}
+	if len(lines) != 4 || lines[0].Line != 1 || lines[3].Line != 4 {
+		t.Errorf("expected lines 1-4, got %+v", lines)
+	}
+	lines, err = repo.Blame("HEAD", "file.txt", 10, 12)
+	if err != nil {
+		t.Fatalf("Blame: %v", err)
+	}
+	if len(lines) != 0 {
+		t.Errorf("expected no lines past the end, got %+v", lines)
+	}
+}
+
+func TestGetDiffStat(t *testing.T) {
+	dir := initTestRepo(t)
+	commitFile(t, dir, "file.txt", "one\ntwo\n", "first commit")
+	commitFile(t, dir, "file.txt", "one\nTWO\nthree\n", "second commit")
+
+	repo := NewRepo(dir)
+	stat, err := repo.GetDiffStat("HEAD~1", "HEAD", DiffOptions{})
+	if err != nil {
+		t.Fatalf("GetDiffStat: %v", err)
+	}
+	if !strings.Contains(stat, "file.txt | 3 ++-") {
+		t.Errorf("expected a stat line with a bar graph for file.txt, got:\n%s", stat)
+	}
+	if !strings.Contains(stat, "1 file changed, 2 insertions(+), 1 deletion(-)") {
+		t.Errorf("expected a summary line, got:\n%s", stat)
+	}
+}
+
+func TestGetDiff_IgnoreMatching(t *testing.T) {
+	dir := initTestRepo(t)
+	commitFile(t, dir, "gen.go", "// Generated at 2024-01-01T10:00:00Z\npackage gen\n", "generate")
+	commitFile(t, dir, "gen.go", "// Generated at 2024-06-30T12:34:56Z\npackage gen\n", "regenerate")
+	repo := NewRepo(dir)
+
+	out, err := repo.GetDiff("HEAD~1", "HEAD", DiffOptions{})
+	if err != nil {
+		t.Fatalf("GetDiff: %v", err)
+	}
+	if !strings.Contains(out, "+// Generated at 2024-06-30T12:34:56Z") {
+		t.Fatalf("expected the timestamp change without a regex, got:\n%s", out)
+	}
+
+	out, err = repo.GetDiff("HEAD~1", "HEAD", DiffOptions{IgnoreMatching: "^// Generated at "})
+	if err != nil {
+		t.Fatalf("GetDiff: %v", err)
+	}
+	if strings.Contains(out, "@@") {
+		t.Errorf("expected the timestamp-only change to disappear, got:\n%s", out)
+	}
+}
+
+func TestRenamedFrom(t *testing.T) {
+	dir := initTestRepo(t)
+	oldContent := "line 1\nline 2\nline 3\nline 4\nline 5\nline 6\n"
+	newContent := "line 1\nline 2\nline 3\nline 4\nline 5\nline six\n"
+	commitFile(t, dir, "old.txt", oldContent, "add old.txt")
+	commitFile(t, dir, "other.txt", "other\n", "add other.txt")
+	cmd := exec.Command("git", "mv", "old.txt", "new.txt")
+	cmd.Dir = dir
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("git mv: %v\n%s", err, out)
+	}
+	commitFile(t, dir, "new.txt", newContent, "rename and edit")
+	repo := NewRepo(dir)
+
+	oldPath, err := repo.RenamedFrom("HEAD~1", "HEAD", "new.txt", DiffOptions{})
+	if err != nil {
+		t.Fatalf("RenamedFrom: %v", err)
+	}
+	if oldPath != "old.txt" {
+		t.Fatalf("RenamedFrom(new.txt) = %q, want old.txt", oldPath)
+	}
+
+	// Context on each side of the rename comes from that side's path.
+	before, err := repo.GetFile("HEAD~1", oldPath)
+	if err != nil {
+		t.Fatalf("GetFile old side: %v", err)
+	}
+	after, err := repo.GetFile("HEAD", "new.txt")
+	if err != nil {
+		t.Fatalf("GetFile new side: %v", err)
+	}
+	if string(before) != oldContent || string(after) != newContent {
+		t.Errorf("expected the pre- and post-image, got %q and %q", before, after)
+	}
+
+	// Files that weren't renamed keep their path.
+	if p, err := repo.RenamedFrom("HEAD~2", "HEAD", "other.txt", DiffOptions{}); err != nil || p != "other.txt" {
+		t.Errorf("RenamedFrom(other.txt) = %q, %v; want other.txt", p, err)
+	}
+}
@@ -0,0 +1,103 @@
+// Package graph lays out commit history for drawing as a graph, assigning
+// each commit a lane (column) and the lines between its row and the next.
+package graph
+
+import "github.com/lundberg/ghdiff/internal/git"
+
+// Node is a commit placed in the graph. Rows are the commits in the order
+// given to Layout.
+type Node struct {
+	git.Commit
+	Lane  int    `json:"lane"`  // column of the commit's dot, from 0 at the left
+	Edges []Edge `json:"edges"` // lines from this row down to the next
+}
+
+// Edge is a line from lane From in a commit's row to lane To in the row
+// below it. Lines passing a commit by have From == To.
+type Edge struct {
+	From int `json:"from"`
+	To   int `json:"to"`
+}
+
+// Layout assigns lanes to commits, which must be in topological order,
+// children before their parents, as "git log --topo-order" lists them.
+//
+// Each lane holds the commit expected next in it: a commit takes the lane
+// its children left for it, or the leftmost free lane if it has no child
+// above it. Its first parent continues in the same lane, and other parents
+// take the leftmost free lanes. A parent that a lane already expects is
+// joined to that lane instead, or for a first parent expected further
+// right, that lane to this one, so lines merge as soon as they meet and
+// every commit is expected by at most one lane. Parents missing from
+// commits keep their lanes to the bottom of the graph.
+func Layout(commits []git.Commit) []Node {
+	nodes := make([]Node, 0, len(commits))
+	var lanes []string // expected commit hash per lane, "" if free
+	for _, c := range commits {
+		lane := index(lanes, c.Hash)
+		if lane < 0 {
+			lane = take(&lanes, "")
+		}
+
+		// Lines passing by this row keep their lanes.
+		edges := []Edge{}
+		for i, hash := range lanes {
+			if hash != "" && i != lane {
+				edges = append(edges, Edge{From: i, To: i})
+			}
+		}
+
+		lanes[lane] = ""
+		for i, parent := range c.Parents {
+			to := index(lanes, parent)
+			switch {
+			case i == 0 && to > lane:
+				// Pull the line expecting the first parent over into
+				// this lane, keeping the graph narrow on the left.
+				for j := range edges {
+					if edges[j].From == to {
+						edges[j].To = lane
+					}
+				}
+				lanes[to], lanes[lane] = "", parent
+				to = lane
+			case to >= 0:
+			case i == 0:
+				lanes[lane] = parent
+				to = lane
+			default:
+				to = take(&lanes, parent)
+			}
+			edges = append(edges, Edge{From: lane, To: to})
+		}
+		for len(lanes) > 0 && lanes[len(lanes)-1] == "" {
+			lanes = lanes[:len(lanes)-1]
+		}
+
+		nodes = append(nodes, Node{Commit: c, Lane: lane, Edges: edges})
+	}
+	return nodes
+}
+
+// index returns the lane expecting hash, or -1 if none does.
+func index(lanes []string, hash string) int {
+	for i, h := range lanes {
+		if h == hash {
+			return i
+		}
+	}
+	return -1
+}
+
+// take puts hash in the leftmost free lane, adding one if all are taken,
+// and returns its index.
+func take(lanes *[]string, hash string) int {
+	for i, h := range *lanes {
+		if h == "" {
+			(*lanes)[i] = hash
+			return i
+		}
+	}
+	*lanes = append(*lanes, hash)
+	return len(*lanes) - 1
+}
@@ -0,0 +1,87 @@
+package graph
+
+import (
+	"testing"
+
+	"github.com/lundberg/ghdiff/internal/git"
+)
+
+// checkEdges fails t unless every line leaving a row arrives at the next
+// row's commit or continues from there, and lines only leave occupied
+// lanes: the commit's own or one passing by.
+func checkEdges(t *testing.T, nodes []Node) {
+	t.Helper()
+	arriving := map[int]bool{}
+	for i, n := range nodes {
+		leaving := map[int]bool{}
+		for _, e := range n.Edges {
+			if e.From != n.Lane && !arriving[e.From] {
+				t.Errorf("row %d (%s): edge %+v leaves lane %d, which no line reached", i, n.Hash, e, e.From)
+			}
+			leaving[e.From] = true
+		}
+		for lane := range arriving {
+			if lane != n.Lane && !leaving[lane] {
+				t.Errorf("row %d (%s): the line in lane %d ends without reaching a commit", i, n.Hash, lane)
+			}
+		}
+		arriving = map[int]bool{}
+		for _, e := range n.Edges {
+			arriving[e.To] = true
+		}
+	}
+}
+
+func TestLayout_Merge(t *testing.T) {
+	// A - B - D - M
+	//      \     /
+	//       C --'
+	commits := []git.Commit{
+		{Hash: "M", Parents: []string{"D", "C"}},
+		{Hash: "C", Parents: []string{"B"}},
+		{Hash: "D", Parents: []string{"B"}},
+		{Hash: "B", Parents: []string{"A"}},
+		{Hash: "A"},
+	}
+	nodes := Layout(commits)
+	checkEdges(t, nodes)
+
+	want := map[string]int{"M": 0, "C": 1, "D": 0, "B": 0, "A": 0}
+	for _, n := range nodes {
+		if n.Lane != want[n.Hash] {
+			t.Errorf("%s: expected lane %d, got %d", n.Hash, want[n.Hash], n.Lane)
+		}
+	}
+	// The merge forks into both lanes, which join again above B.
+	if got := nodes[0].Edges; len(got) != 2 || got[0] != (Edge{0, 0}) || got[1] != (Edge{0, 1}) {
+		t.Errorf("M: expected edges to lanes 0 and 1, got %+v", got)
+	}
+	if got := nodes[2].Edges; len(got) != 2 || got[0] != (Edge{1, 0}) || got[1] != (Edge{0, 0}) {
+		t.Errorf("D: expected C's line to join lane 0, got %+v", got)
+	}
+	if got := nodes[4].Edges; len(got) != 0 {
+		t.Errorf("A: expected no edges below the root, got %+v", got)
+	}
+}
+
+func TestLayout_Branches(t *testing.T) {
+	// Two branch tips over a common base, and a parent past the last row.
+	commits := []git.Commit{
+		{Hash: "F2", Parents: []string{"F1"}},
+		{Hash: "M1", Parents: []string{"B"}},
+		{Hash: "F1", Parents: []string{"B"}},
+		{Hash: "B", Parents: []string{"X"}},
+	}
+	nodes := Layout(commits)
+	checkEdges(t, nodes)
+
+	want := map[string]int{"F2": 0, "M1": 1, "F1": 0, "B": 0}
+	for _, n := range nodes {
+		if n.Lane != want[n.Hash] {
+			t.Errorf("%s: expected lane %d, got %d", n.Hash, want[n.Hash], n.Lane)
+		}
+	}
+	if got := nodes[3].Edges; len(got) != 1 || got[0] != (Edge{0, 0}) {
+		t.Errorf("B: expected a line down to its missing parent, got %+v", got)
+	}
+}
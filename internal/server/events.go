@@ -0,0 +1,76 @@
+package server
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/lundberg/ghdiff/internal/cli"
+)
+
+// handleEvents streams server-sent events, sending a "change" event
+// whenever the diff between ?base= and ?target= (by default the current
+// range; WorktreeTarget for the working tree) changes. The diff is polled
+// every --watch-interval, so large repositories where diffing is expensive
+// can poll less often.
+func (s *Server) handleEvents(w http.ResponseWriter, r *http.Request) {
+	if s.stdin() != nil {
+		http.Error(w, "watching is not available in stdin mode", http.StatusConflict)
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming not supported", http.StatusInternalServerError)
+		return
+	}
+
+	var rng compareRange
+	rng.Base, rng.Target = s.currentRange().override(r.URL.Query())
+	last, err := s.fingerprint(rng)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	interval := s.config.WatchInterval
+	if interval <= 0 {
+		interval = cli.DefaultWatchInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-s.closing:
+			return
+		case <-ticker.C:
+			fp, err := s.fingerprint(rng)
+			if err != nil || fp == last {
+				// A failing git command is usually transient, e.g. a
+				// locked index mid-commit; try again on the next tick.
+				continue
+			}
+			last = fp
+			if _, err := fmt.Fprint(w, "event: change\ndata: {}\n\n"); err != nil {
+				return
+			}
+			flusher.Flush()
+		}
+	}
+}
+
+// fingerprint returns a hash of the raw diff for rng.
+func (s *Server) fingerprint(rng compareRange) ([sha256.Size]byte, error) {
+	raw, err := s.repo.GetDiff(rng.Base, rng.Target, s.diffOptions())
+	if err != nil {
+		return [sha256.Size]byte{}, err
+	}
+	return sha256.Sum256([]byte(raw)), nil
+}
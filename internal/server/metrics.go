@@ -0,0 +1,142 @@
+package server
+
+import (
+	"bytes"
+	"fmt"
+	"maps"
+	"net/http"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// durationBuckets are the histogram upper bounds in seconds, covering
+// everything from a trivial rev-parse to a diff of a huge repository.
+var durationBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// histogram counts observations into durationBuckets.
+type histogram struct {
+	counts []uint64 // per bucket, not cumulative
+	sum    float64
+	count  uint64
+}
+
+func (h *histogram) observe(seconds float64) {
+	if h.counts == nil {
+		h.counts = make([]uint64, len(durationBuckets))
+	}
+	for i, le := range durationBuckets {
+		if seconds <= le {
+			h.counts[i]++
+			break
+		}
+	}
+	h.sum += seconds
+	h.count++
+}
+
+// metrics holds the counters exposed on /metrics in the Prometheus text
+// format.
+type metrics struct {
+	mu       sync.Mutex
+	requests map[string]uint64     // by route pattern
+	parse    histogram             // diff parse durations
+	git      map[string]*histogram // git command durations by subcommand
+}
+
+func newMetrics() *metrics {
+	return &metrics{
+		requests: make(map[string]uint64),
+		git:      make(map[string]*histogram),
+	}
+}
+
+// countRequests returns middleware that counts requests by the mux route
+// they matched.
+func (m *metrics) countRequests(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		next.ServeHTTP(w, r)
+		// ServeMux sets Pattern on the request while routing it.
+		route := r.Pattern
+		if route == "" {
+			route = "unmatched"
+		}
+		m.mu.Lock()
+		m.requests[route]++
+		m.mu.Unlock()
+	})
+}
+
+func (m *metrics) observeParse(d time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.parse.observe(d.Seconds())
+}
+
+func (m *metrics) observeGit(subcommand string, d time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	h := m.git[subcommand]
+	if h == nil {
+		h = &histogram{}
+		m.git[subcommand] = h
+	}
+	h.observe(d.Seconds())
+}
+
+// handleMetrics writes all metrics in the Prometheus text format. It is
+// not token-protected since it exposes only counts and timings.
+func (m *metrics) handleMetrics(w http.ResponseWriter, _ *http.Request) {
+	// Rendered before writing, so that a slow client doesn't hold up the
+	// requests being counted.
+	var buf bytes.Buffer
+	m.render(&buf)
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	_, _ = w.Write(buf.Bytes())
+}
+
+// render writes all metrics to buf in the Prometheus text format.
+func (m *metrics) render(buf *bytes.Buffer) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	fmt.Fprintln(buf, "# HELP ghdiff_http_requests_total HTTP requests by route.")
+	fmt.Fprintln(buf, "# TYPE ghdiff_http_requests_total counter")
+	for _, route := range slices.Sorted(maps.Keys(m.requests)) {
+		fmt.Fprintf(buf, "ghdiff_http_requests_total{route=%s} %d\n", strconv.Quote(route), m.requests[route])
+	}
+
+	fmt.Fprintln(buf, "# HELP ghdiff_diff_parse_seconds Time spent parsing diffs.")
+	fmt.Fprintln(buf, "# TYPE ghdiff_diff_parse_seconds histogram")
+	writeHistogram(buf, "ghdiff_diff_parse_seconds", "", &m.parse)
+
+	fmt.Fprintln(buf, "# HELP ghdiff_git_command_seconds Time spent running git commands.")
+	fmt.Fprintln(buf, "# TYPE ghdiff_git_command_seconds histogram")
+	for _, sub := range slices.Sorted(maps.Keys(m.git)) {
+		writeHistogram(buf, "ghdiff_git_command_seconds", "command="+strconv.Quote(sub), m.git[sub])
+	}
+}
+
+// writeHistogram writes the bucket, sum and count series of h. labels is
+// a comma-separated label list without braces, or "". Writes to a
+// bytes.Buffer don't fail.
+func writeHistogram(buf *bytes.Buffer, name, labels string, h *histogram) {
+	sep := ""
+	if labels != "" {
+		sep = ","
+	}
+	var cumulative uint64
+	for i, le := range durationBuckets {
+		if h.counts != nil {
+			cumulative += h.counts[i]
+		}
+		fmt.Fprintf(buf, "%s_bucket{%s%sle=\"%s\"} %d\n", name, labels, sep, strconv.FormatFloat(le, 'g', -1, 64), cumulative)
+	}
+	fmt.Fprintf(buf, "%s_bucket{%s%sle=\"+Inf\"} %d\n", name, labels, sep, h.count)
+	if labels != "" {
+		labels = "{" + labels + "}"
+	}
+	fmt.Fprintf(buf, "%s_sum%s %g\n", name, labels, h.sum)
+	fmt.Fprintf(buf, "%s_count%s %d\n", name, labels, h.count)
+}
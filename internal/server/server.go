@@ -2,35 +2,103 @@
 package server
 
 import (
+	"bytes"
 	"crypto/rand"
+	"crypto/sha256"
 	"crypto/subtle"
 	"encoding/hex"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"io/fs"
+	"mime"
+	"net"
 	"net/http"
+	"net/url"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/lundberg/ghdiff/internal/cli"
 	"github.com/lundberg/ghdiff/internal/diff"
 	"github.com/lundberg/ghdiff/internal/git"
+	"github.com/lundberg/ghdiff/internal/graph"
 )
 
 // Server is the HTTP server that serves the frontend and API endpoints.
 type Server struct {
-	config    *cli.Config
-	repo      *git.Repo
-	mux       *http.ServeMux
+	config  *cli.Config
+	repo    *git.Repo
+	mux     *http.ServeMux
+	assets  fs.FS
+	token   string
+	metrics *metrics
+
+	// mu guards the fields below so they can be swapped while requests
+	// are being served.
+	mu        sync.RWMutex
 	stdinDiff *diff.Result
-	assets    fs.FS
-	token     string
+	series    *diff.Log // patches served by /api/history in mbox mode
+	indexTmpl []byte    // index.html as read from the assets, by indexTemplate()
+	rng       compareRange
+
+	rootOnce sync.Once
+	editor   string // --editor scheme of "open in editor" links, if offered
+	repoRoot string // repository root the links are built from
+
+	postProcessors []func(*diff.Result) // run in order on each diff served
+
+	sessionMu sync.Mutex // serializes access to the --session file
+
+	closing   chan struct{} // closed by Close to end event streams
+	closeOnce sync.Once
+}
+
+// Option configures a Server created by New.
+type Option func(*Server)
+
+// WithPostProcessor registers a hook that transforms each diff served,
+// whether by /api/diff in any of its forms, /api/diff/markdown,
+// /api/history or /api/commit/{hash}/files, before it is written, e.g. to
+// redact secrets or add annotations. Hooks run in the order they were
+// registered, on a copy of the diff that they may modify freely. The
+// diffs of a commit list are passed to them one commit at a time.
+func WithPostProcessor(hook func(*diff.Result)) Option {
+	return func(s *Server) {
+		s.postProcessors = append(s.postProcessors, hook)
+	}
+}
+
+// compareRange is the default base/target pair used by /api/diff.
+type compareRange struct {
+	Base   string `json:"base"`
+	Target string `json:"target"` // empty for the working tree
+}
 
-	indexOnce sync.Once
-	indexHTML []byte
+// override returns the base and target of rng, overridden by the request's
+// ?base= and ?target= parameters. WorktreeTarget selects the working tree,
+// which the git package diffs against when target is empty.
+func (rng compareRange) override(q url.Values) (base, target string) {
+	base, target = rng.Base, rng.Target
+	if b := q.Get("base"); b != "" {
+		base = b
+	}
+	switch t := q.Get("target"); t {
+	case "":
+	case WorktreeTarget:
+		target = ""
+	default:
+		target = t
+	}
+	return base, target
 }
 
 // New creates a new server. If stdinDiff is non-nil, the server is in stdin mode.
-func New(config *cli.Config, repo *git.Repo, stdinDiff *diff.Result, assets fs.FS) *Server {
+func New(config *cli.Config, repo *git.Repo, stdinDiff *diff.Result, assets fs.FS, opts ...Option) *Server {
 	b := make([]byte, 16)
 	if _, err := rand.Read(b); err != nil {
 		panic("crypto/rand failed: " + err.Error())
@@ -43,116 +111,1446 @@ func New(config *cli.Config, repo *git.Repo, stdinDiff *diff.Result, assets fs.F
 		stdinDiff: stdinDiff,
 		assets:    assets,
 		token:     hex.EncodeToString(b),
+		rng:       compareRange{Base: config.Base, Target: config.Target},
+		metrics:   newMetrics(),
+		closing:   make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	if repo != nil {
+		repo.Observe = s.metrics.observeGit
+	}
+	if stdinDiff != nil {
+		s.process(stdinDiff)
 	}
 	s.routes()
 	return s
 }
 
+// Close ends the streams of /api/events, which would otherwise keep a
+// graceful shutdown of the HTTP server waiting until its deadline.
+func (s *Server) Close() {
+	s.closeOnce.Do(func() { close(s.closing) })
+}
+
 // Handler returns the http.Handler (useful for testing).
 func (s *Server) Handler() http.Handler {
-	return s.mux
+	return s.checkHost(s.metrics.countRequests(s.mux))
+}
+
+// checkHost returns middleware that rejects requests whose Host header does
+// not name this server, defeating DNS-rebinding attacks where a hostile
+// page resolves its own domain to 127.0.0.1.
+func (s *Server) checkHost(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !s.allowedHost(r.Host) {
+			http.Error(w, "Misdirected Request", http.StatusMisdirectedRequest)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// allowedHost reports whether a Host header value refers to this server.
+func (s *Server) allowedHost(hostport string) bool {
+	host, port, err := net.SplitHostPort(hostport)
+	if err != nil {
+		// No port in the header
+		host, port = hostport, ""
+	}
+	host = strings.Trim(host, "[]")
+	if s.config.Port != 0 && port != strconv.Itoa(s.config.Port) {
+		return false
+	}
+
+	switch host {
+	case "localhost", "127.0.0.1", "::1", s.config.Host:
+		return true
+	}
+	// When bound to all interfaces, any IP address may legitimately reach
+	// us. Rebinding needs a DNS name, so IP literals are still safe.
+	if ip := net.ParseIP(s.config.Host); ip != nil && ip.IsUnspecified() {
+		return net.ParseIP(host) != nil
+	}
+	return false
 }
 
 func (s *Server) routes() {
+	// GET patterns also match HEAD; the response body is then discarded
+	// but headers such as Content-Length and ETag are still sent.
 	s.mux.HandleFunc("GET /api/diff", s.requireToken(s.handleDiff))
+	s.mux.HandleFunc("GET /api/diff/markdown", s.requireToken(s.handleDiffMarkdown))
+	s.mux.HandleFunc("GET /api/diff/stat", s.requireToken(s.handleDiffStat))
+	s.mux.HandleFunc("GET /api/diff/raw", s.requireToken(s.handleDiffRaw))
 	s.mux.HandleFunc("GET /api/commits", s.requireToken(s.handleCommits))
+	s.mux.HandleFunc("GET /api/commit/{hash}/files", s.requireToken(s.handleCommitFiles))
+	s.mux.HandleFunc("GET /api/graph", s.requireToken(s.handleGraph))
+	s.mux.HandleFunc("GET /api/refs", s.requireToken(s.handleRefs))
+	s.mux.HandleFunc("GET /api/range-diff", s.requireToken(s.handleRangeDiff))
+	s.mux.HandleFunc("GET /api/history", s.requireToken(s.handleHistory))
+	s.mux.HandleFunc("GET /api/batch", s.requireToken(s.handleBatch))
+	s.mux.HandleFunc("GET /api/events", s.requireToken(s.handleEvents))
+	s.mux.HandleFunc("GET /api/file", s.requireToken(s.handleFile))
+	s.mux.HandleFunc("GET /api/sidebyside", s.requireToken(s.handleSideBySide))
+	s.mux.HandleFunc("GET /api/blame", s.requireToken(s.handleBlame))
+	s.mux.HandleFunc("GET /api/range", s.requireToken(s.handleGetRange))
+	s.mux.HandleFunc("GET /api/status", s.requireToken(s.handleStatus))
+	s.mux.HandleFunc("GET /api/session", s.requireToken(s.handleGetSession))
+	s.mux.HandleFunc("POST /api/session", s.requireToken(s.handlePostSession))
+	s.mux.HandleFunc("PUT /api/range", s.requireToken(s.handlePutRange))
+	s.mux.HandleFunc("GET /healthz", handleHealthz)
+	s.mux.HandleFunc("GET /metrics", s.metrics.handleMetrics)
 	s.mux.HandleFunc("GET /{$}", s.handleIndex)
 	s.mux.Handle("GET /", http.FileServerFS(s.assets))
 }
 
-// requireToken returns middleware that checks the X-Auth-Token header on API routes.
+// requireToken returns middleware that checks the X-Auth-Token header on API
+// routes and rejects cross-site requests.
 func (s *Server) requireToken(next http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		if subtle.ConstantTimeCompare([]byte(r.Header.Get("X-Auth-Token")), []byte(s.token)) != 1 {
 			http.Error(w, "Forbidden", http.StatusForbidden)
 			return
 		}
+		if !sameOrigin(r) {
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
 		next(w, r)
 	}
 }
 
-// handleIndex serves index.html with the auth token injected.
-func (s *Server) handleIndex(w http.ResponseWriter, _ *http.Request) {
-	s.indexOnce.Do(func() {
+// sameOrigin reports whether a request comes from our own page (or from a
+// non-browser client that sends no origin information at all).
+func sameOrigin(r *http.Request) bool {
+	switch r.Header.Get("Sec-Fetch-Site") {
+	case "", "same-origin", "none":
+	default:
+		return false
+	}
+	if origin := r.Header.Get("Origin"); origin != "" {
+		u, err := url.Parse(origin)
+		if err != nil || u.Host != r.Host {
+			return false
+		}
+	}
+	return true
+}
+
+// stdin returns the pre-parsed diff in stdin mode, or nil in git mode.
+func (s *Server) stdin() *diff.Result {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.stdinDiff
+}
+
+// SetStdinDiff replaces the diff served in stdin mode. Requests in flight
+// keep the snapshot they already read.
+func (s *Server) SetStdinDiff(d *diff.Result) {
+	s.process(d)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.stdinDiff = d
+}
+
+// SetSeries sets the patch series served by /api/history in mbox mode.
+func (s *Server) SetSeries(log *diff.Log) {
+	s.processLog(log)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.series = log
+}
+
+// ReloadIndex discards the cached index.html so that the next request
+// reads it again from the assets.
+func (s *Server) ReloadIndex() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.indexTmpl = nil
+}
+
+// indexTemplate returns index.html with its placeholders, reading it on
+// first use. It returns nil if index.html is missing. The placeholders are
+// filled in per request by handleIndex, as some come from the query.
+func (s *Server) indexTemplate() []byte {
+	s.mu.RLock()
+	tmpl := s.indexTmpl
+	s.mu.RUnlock()
+	if tmpl != nil {
+		return tmpl
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.indexTmpl == nil {
 		raw, err := fs.ReadFile(s.assets, "index.html")
 		if err != nil {
-			// Will serve an error on every request; acceptable since this is fatal.
+			return nil
+		}
+		s.indexTmpl = raw
+	}
+	return s.indexTmpl
+}
+
+// editorRoot returns the --editor scheme and the repository root that
+// "open in editor" links are built from, or empty strings when the links
+// are off. They are only offered on localhost, where the browser runs on
+// the machine that has the files, and never reveal the root's path to
+// other hosts. The root is looked up once.
+func (s *Server) editorRoot() (editor, root string) {
+	s.rootOnce.Do(func() {
+		if s.config.Editor == "" || s.config.Editor == "none" || s.repo == nil || !isLoopback(s.config.Host) {
+			return
+		}
+		root, err := s.repo.GetToplevel()
+		if err != nil {
 			return
 		}
-		s.indexHTML = []byte(strings.Replace(
-			string(raw),
-			"{{TOKEN}}",
-			s.token,
-			1,
-		))
+		s.editor, s.repoRoot = s.config.Editor, root
 	})
-	if s.indexHTML == nil {
+	return s.editor, s.repoRoot
+}
+
+// isLoopback reports whether host names the loopback interface.
+func isLoopback(host string) bool {
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// handleIndex serves index.html with the auth token and UI state injected.
+// The query parameters base, target and mode (split or unified) make a
+// permalink: the UI starts on that comparison instead of the command
+// line's. All placeholders are filled in one pass, so no injected value
+// is itself scanned for placeholders.
+func (s *Server) handleIndex(w http.ResponseWriter, r *http.Request) {
+	tmpl := s.indexTemplate()
+	if tmpl == nil {
 		http.Error(w, "index.html not found", http.StatusInternalServerError)
 		return
 	}
+
+	q := r.URL.Query()
+	viewMode := s.config.ViewMode
+	if mode := q.Get("mode"); mode != "" {
+		if mode != "split" && mode != "unified" {
+			http.Error(w, "invalid mode: "+mode, http.StatusBadRequest)
+			return
+		}
+		viewMode = mode
+	}
+	base, target := q.Get("base"), q.Get("target")
+	for _, ref := range []string{base, target} {
+		if err := git.ValidateRef(ref); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	editor, root := s.editorRoot()
+	theme := s.config.SyntaxTheme
+	if theme == "" {
+		theme = cli.DefaultSyntaxTheme
+	}
+	page := strings.NewReplacer(
+		"{{TOKEN}}", s.token,
+		"{{MODE}}", s.config.Mode,
+		"{{VIEW_MODE}}", viewMode,
+		"{{BASE}}", jsString(base),
+		"{{TARGET}}", jsString(target),
+		"{{EDITOR}}", editor,
+		"{{REPO_ROOT}}", jsString(root),
+		// Checked against the shipped themes by cli.ParseArgs.
+		"{{SYNTAX_THEME}}", theme,
+	)
 	w.Header().Set("Content-Type", "text/html; charset=utf-8")
 	w.Header().Set("Cache-Control", "no-store")
-	_, _ = w.Write(s.indexHTML)
+	_, _ = page.WriteString(w, string(tmpl))
+}
+
+// jsString escapes s for a double-quoted JavaScript string in an inline
+// script. JSON encoding escapes quotes and backslashes, and <, > and & so
+// that s can't close the script element.
+func jsString(s string) string {
+	b, _ := json.Marshal(s)
+	return string(b[1 : len(b)-1])
+}
+
+// handleHealthz reports that the server is accepting requests. It is not
+// token-protected since it exposes nothing about the repository.
+func handleHealthz(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	_, _ = w.Write([]byte("ok\n"))
 }
 
+// WorktreeTarget is the ?target= value of /api/diff that diffs the base
+// against the working tree, whatever the target of the current range.
+const WorktreeTarget = "WORKTREE"
+
+// resultWriter writes a parsed diff in an endpoint's response format.
+type resultWriter func(w http.ResponseWriter, result *diff.Result)
+
 func (s *Server) handleDiff(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Query().Get("byCommit") == "1" {
+		s.handleDiffByCommit(w, r)
+		return
+	}
+	s.serveDiff(w, r, func(w http.ResponseWriter, result *diff.Result) {
+		writeJSON(w, result)
+	})
+}
+
+// maxByCommit is the most commits /api/diff?byCommit=1 diffs one by one.
+const maxByCommit = 100
+
+// handleDiffByCommit serves the diff of the compared range split by commit:
+// each commit between base and target, oldest first, with its diff against
+// its parent, as for /api/history.
+func (s *Server) handleDiffByCommit(w http.ResponseWriter, r *http.Request) {
+	if s.config.Mode != "compare" {
+		http.Error(w, "byCommit is only available in compare mode", http.StatusConflict)
+		return
+	}
+	base, target := s.currentRange().override(r.URL.Query())
+	if target == "" {
+		http.Error(w, "byCommit needs a target commit, not the working tree", http.StatusBadRequest)
+		return
+	}
+
+	// Diffing every commit of a long range would take as long as it is
+	// useless to review.
+	n, _, err := s.repo.AheadBehind(base, target)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if n > maxByCommit {
+		http.Error(w, fmt.Sprintf("%d commits between %s and %s: byCommit handles at most %d", n, base, target, maxByCommit), http.StatusBadRequest)
+		return
+	}
+
+	_, filter, err := s.statusFilter(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	opts := s.diffOptions()
+	opts.WordDiff = false
+	opts.Filter = filter
+	opts.Timeout = s.config.DiffSoftTimeout
+	raw, err := s.repo.GetRangeLog(base, target, diff.LogFormat, opts)
+	if err != nil {
+		writeDiffError(w, err)
+		return
+	}
+	result, err := diff.ParseLog(raw)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if result.Commits == nil {
+		result.Commits = []diff.CommitDiff{}
+	}
+	s.processLog(result)
+	writeJSON(w, s.postProcessLog(result))
+}
+
+// statusFilter returns the statuses ?status=added,deleted keeps files
+// with, overriding --status, and the git --diff-filter selecting them.
+func (s *Server) statusFilter(q url.Values) (statuses []string, filter string, err error) {
+	statuses = s.config.Status
+	if status := q.Get("status"); status != "" {
+		statuses = strings.Split(status, ",")
+	}
+	filter, err = git.DiffFilter(statuses)
+	if err != nil {
+		return nil, "", err
+	}
+	return statuses, filter, nil
+}
+
+// handleDiffMarkdown serves the same diff as /api/diff, with the same
+// parameters, as GitHub-flavored markdown for pasting into issues.
+func (s *Server) handleDiffMarkdown(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Query().Get("split") == "stage" {
+		http.Error(w, "split=stage is only available from /api/diff", http.StatusBadRequest)
+		return
+	}
+	s.serveDiff(w, r, writeMarkdown)
+}
+
+// serveDiff resolves the diff selected by the request's parameters and
+// writes it with write.
+func (s *Server) serveDiff(w http.ResponseWriter, r *http.Request, write resultWriter) {
+	// ?summary=1 returns files with names, statuses and counts but no
+	// hunks, for rendering the file list of very large diffs quickly
+	summary := r.URL.Query().Get("summary") == "1"
+
+	statuses, filter, err := s.statusFilter(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// ?maxHunks=N returns at most N hunks per file, for rendering files
+	// with very many hunks quickly
+	var maxHunks int
+	if m := r.URL.Query().Get("maxHunks"); m != "" {
+		n, err := strconv.Atoi(m)
+		if err != nil || n < 1 {
+			http.Error(w, "invalid maxHunks: "+m, http.StatusBadRequest)
+			return
+		}
+		maxHunks = n
+	}
+
+	// ?fileOffset=N&fileLimit=M returns M files starting at the Nth, for
+	// paging through diffs with very many files. The response's
+	// totalFiles counts the files in all pages.
+	paged := false
+	fileOffset, fileLimit := 0, 0
+	if o := r.URL.Query().Get("fileOffset"); o != "" {
+		n, err := strconv.Atoi(o)
+		if err != nil || n < 0 {
+			http.Error(w, "invalid fileOffset: "+o, http.StatusBadRequest)
+			return
+		}
+		fileOffset, paged = n, true
+	}
+	if l := r.URL.Query().Get("fileLimit"); l != "" {
+		n, err := strconv.Atoi(l)
+		if err != nil || n < 1 {
+			http.Error(w, "invalid fileLimit: "+l, http.StatusBadRequest)
+			return
+		}
+		fileLimit, paged = n, true
+	}
+
+	// ?split=hunks gives each hunk of a working tree diff an ID and marks
+	// those already staged, previewing what "git add -p" would offer.
+	// ?split=stage returns the staged and unstaged changes separately.
+	split := r.URL.Query().Get("split")
+	if split != "" && split != "hunks" && split != "stage" {
+		http.Error(w, "invalid split: "+split+": must be hunks or stage", http.StatusBadRequest)
+		return
+	}
+	if split == "stage" && summary {
+		http.Error(w, "split=stage can't be combined with summary", http.StatusBadRequest)
+		return
+	}
+
+	// steps run in order on each parsed diff. Then the parameters above
+	// choose which hunks and files are sent, and the hooks see the result
+	// last.
+	var steps []func(*diff.Result)
+	apply := func(result *diff.Result) *diff.Result {
+		for _, step := range steps {
+			step(result)
+		}
+		diff.LimitHunks(result, maxHunks)
+		if paged {
+			diff.PageFiles(result, fileOffset, fileLimit)
+		}
+		return s.postProcess(result)
+	}
+	emit := func(w http.ResponseWriter, result *diff.Result) {
+		write(w, apply(result))
+	}
+
 	// In stdin mode, always return the pre-parsed diff
-	if s.stdinDiff != nil {
-		writeJSON(w, s.stdinDiff)
+	if stdinDiff := s.stdin(); stdinDiff != nil {
+		if r.URL.Query().Get("target") == WorktreeTarget || split != "" {
+			http.Error(w, "the working tree is not available in stdin mode", http.StatusConflict)
+			return
+		}
+		// Filtering works on a copy, leaving the shared diff intact.
+		if summary || len(statuses) > 0 || maxHunks > 0 || paged {
+			result := &diff.Result{Files: slices.Clone(stdinDiff.Files), HiddenFiles: stdinDiff.HiddenFiles}
+			diff.FilterByStatus(result, statuses)
+			if summary {
+				diff.Summarize(result)
+			}
+			emit(w, result)
+			return
+		}
+		emit(w, stdinDiff)
+		return
+	}
+
+	opts := s.diffOptions()
+	opts.Filter = filter
+	opts.Timeout = s.config.DiffSoftTimeout
+
+	// ?debug=1 adds the git command behind the diff and how long it took.
+	// It reveals paths and options, so it is only honored on localhost.
+	if r.URL.Query().Get("debug") == "1" && isLoopback(s.config.Host) {
+		trace := &git.CommandTrace{}
+		opts.Trace = trace
+		steps = append(steps, func(result *diff.Result) {
+			if trace.Command != "" {
+				result.Debug = &diff.Debug{Command: trace.Command, DurationMs: trace.Duration.Milliseconds()}
+			}
+		})
+	}
+
+	// ?commit=<hash>[&parent=N] shows a single commit against one parent
+	if commit := r.URL.Query().Get("commit"); commit != "" {
+		s.handleCommitDiff(w, r, commit, opts, emit)
+		return
+	}
+
+	rng := s.currentRange()
+
+	// ?id=N selects entry N of the --commits-file list
+	if id := r.URL.Query().Get("id"); id != "" {
+		n, err := strconv.Atoi(id)
+		if err != nil || n < 0 || n >= len(s.config.Batch) {
+			http.Error(w, "invalid id: "+id, http.StatusBadRequest)
+			return
+		}
+		rng = compareRange{Base: s.config.Batch[n].Base, Target: s.config.Batch[n].Target}
+	}
+
+	base, target := rng.override(r.URL.Query())
+
+	if split != "" && target != "" {
+		http.Error(w, "split="+split+" needs a diff against the working tree", http.StatusBadRequest)
+		return
+	}
+
+	if summary {
+		s.writeSummary(w, base, target, opts, emit)
+		return
+	}
+
+	if split == "stage" {
+		staged, unstaged, err := s.stageDiffs(base, opts)
+		if err != nil {
+			writeDiffError(w, err)
+			return
+		}
+		writeJSON(w, stageSplit{Staged: apply(staged), Unstaged: apply(unstaged)})
 		return
 	}
 
-	// Determine which base ref to use
-	base := r.URL.Query().Get("base")
-	if base == "" {
-		base = s.config.Base
+	if split == "hunks" {
+		rawStaged, err := s.repo.GetCachedDiff(base, opts)
+		if err != nil {
+			writeDiffError(w, err)
+			return
+		}
+		staged, err := s.parse(rawStaged)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		// Processed like the diff itself, so that the hunks compare.
+		s.process(staged)
+		steps = append(steps, func(result *diff.Result) {
+			diff.MarkStaged(result, staged)
+			diff.SetHunkIDs(result)
+		})
 	}
 
-	// Determine which target ref to use
-	target := r.URL.Query().Get("target")
+	// Added files identical to a renamed one are compared with the
+	// renamed file as it is in target.
+	steps = append(steps, func(result *diff.Result) {
+		diff.RelateCopies(result, func(path string) ([]byte, bool) {
+			data, err := s.repo.GetFile(target, path)
+			return data, err == nil
+		})
+	})
+
+	// Files in the working tree are cheap to read, so diffs against it
+	// report how many lines follow each file's last hunk.
 	if target == "" {
-		target = s.config.Target
+		steps = append(steps, func(result *diff.Result) {
+			diff.SetTrailingLines(result, s.worktreeLineCount)
+		})
 	}
 
 	// Get the diff from git
-	rawDiff, err := s.repo.GetDiff(base, target)
+	rawDiff, err := s.repo.GetDiff(base, target, opts)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeDiffError(w, err)
 		return
 	}
 
-	result, err := diff.Parse(rawDiff)
+	s.writeDiff(w, rawDiff, emit)
+}
+
+// worktreeLineCount returns the number of lines in path in the working
+// tree.
+func (s *Server) worktreeLineCount(path string) (int, bool) {
+	data, err := s.repo.GetFile("", path)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return 0, false
+	}
+	n := bytes.Count(data, []byte("\n"))
+	if len(data) > 0 && data[len(data)-1] != '\n' {
+		n++
+	}
+	return n, true
+}
+
+// handleDiffStat serves "git diff --stat" output for the same base and
+// target parameters as /api/diff.
+func (s *Server) handleDiffStat(w http.ResponseWriter, r *http.Request) {
+	if s.stdin() != nil {
+		http.Error(w, "diff stat is not available in stdin mode", http.StatusConflict)
 		return
 	}
 
-	writeJSON(w, result)
+	base, target := s.currentRange().override(r.URL.Query())
+	opts := s.diffOptions()
+	opts.WordDiff = false
+	stat, err := s.repo.GetDiffStat(base, target, opts)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	_, _ = w.Write([]byte(stat))
 }
 
-func (s *Server) handleCommits(w http.ResponseWriter, _ *http.Request) {
-	// In stdin mode, return empty array
-	if s.stdinDiff != nil {
-		writeJSON(w, []git.Commit{})
+// handleDiffRaw serves the "git diff --raw" entries for the same base and
+// target parameters as /api/diff: each file's modes and object IDs,
+// without content.
+func (s *Server) handleDiffRaw(w http.ResponseWriter, r *http.Request) {
+	if s.stdin() != nil {
+		http.Error(w, "raw diff is not available in stdin mode", http.StatusConflict)
 		return
 	}
 
-	commits, err := s.repo.GetCommits(50)
+	base, target := s.currentRange().override(r.URL.Query())
+	opts := s.diffOptions()
+	opts.WordDiff = false
+	entries, err := s.repo.GetRawDiff(base, target, opts)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
+	writeJSON(w, entries)
+}
 
-	if commits == nil {
-		commits = []git.Commit{}
+// handleCommitDiff serves the diff of commit against its parent given by
+// the 1-indexed ?parent= parameter (default 1, the mainline for merges).
+func (s *Server) handleCommitDiff(w http.ResponseWriter, r *http.Request, commit string, opts git.DiffOptions, write resultWriter) {
+	parent := 1
+	if p := r.URL.Query().Get("parent"); p != "" {
+		n, err := strconv.Atoi(p)
+		if err != nil {
+			http.Error(w, "invalid parent: "+p, http.StatusBadRequest)
+			return
+		}
+		parent = n
 	}
 
-	writeJSON(w, commits)
+	count, err := s.repo.GetParentCount(commit)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if parent < 1 || parent > count {
+		http.Error(w, fmt.Sprintf("invalid parent %d: commit has %d parent(s)", parent, count), http.StatusBadRequest)
+		return
+	}
+
+	if r.URL.Query().Get("summary") == "1" {
+		s.writeSummary(w, commit+"^"+strconv.Itoa(parent), commit, opts, write)
+		return
+	}
+
+	rawDiff, err := s.repo.GetCommitDiff(commit, parent, opts)
+	if err != nil {
+		writeDiffError(w, err)
+		return
+	}
+
+	s.writeDiff(w, rawDiff, write)
 }
 
-func writeJSON(w http.ResponseWriter, v any) {
+// stageSplit is the response of /api/diff?split=stage.
+type stageSplit struct {
+	Staged   *diff.Result `json:"staged"`
+	Unstaged *diff.Result `json:"unstaged"`
+}
+
+// stageDiffs returns the changes between base and the index and those
+// between the index and the working tree, like "git diff --cached" and
+// "git diff", parsed and processed.
+func (s *Server) stageDiffs(base string, opts git.DiffOptions) (staged, unstaged *diff.Result, err error) {
+	rawStaged, err := s.repo.GetCachedDiff(base, opts)
+	if err != nil {
+		return nil, nil, err
+	}
+	rawUnstaged, err := s.repo.GetUnstagedDiff(opts)
+	if err != nil {
+		return nil, nil, err
+	}
+	if staged, err = s.parse(rawStaged); err != nil {
+		return nil, nil, err
+	}
+	if unstaged, err = s.parse(rawUnstaged); err != nil {
+		return nil, nil, err
+	}
+	s.process(staged)
+	s.process(unstaged)
+	return staged, unstaged, nil
+}
+
+// parse parses raw git diff output, as word diffs with --word-diff.
+func (s *Server) parse(rawDiff string) (*diff.Result, error) {
+	parse := diff.Parse
+	if s.config.WordDiff {
+		parse = diff.ParseWordDiff
+	}
+	start := time.Now()
+	result, err := parse(rawDiff)
+	s.metrics.observeParse(time.Since(start))
+	return result, err
+}
+
+// writeDiff parses raw git diff output and writes it with write.
+func (s *Server) writeDiff(w http.ResponseWriter, rawDiff string, write resultWriter) {
+	result, err := s.parse(rawDiff)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	s.process(result)
+
+	write(w, result)
+}
+
+// diffTimeout is the response of /api/diff when git took longer than
+// --diff-soft-timeout.
+type diffTimeout struct {
+	Error      string `json:"error"`
+	Timeout    bool   `json:"timeout"`
+	Suggestion string `json:"suggestion"`
+}
+
+// writeDiffError reports a failed git diff: with a 503 and advice on
+// getting a smaller diff when it ran out of time, and a 500 otherwise.
+func writeDiffError(w http.ResponseWriter, err error) {
+	if !errors.Is(err, git.ErrTimeout) {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
 	w.Header().Set("Content-Type", "application/json")
-	if err := json.NewEncoder(w).Encode(v); err != nil {
+	w.WriteHeader(http.StatusServiceUnavailable)
+	_ = json.NewEncoder(w).Encode(diffTimeout{
+		Error:      err.Error(),
+		Timeout:    true,
+		Suggestion: "The diff took too long. Compare a narrower range of commits, limit the files with --only or ?status=, or request ?summary=1 for just the file list.",
+	})
+}
+
+// writeSummary writes the files changed between base and target, with
+// line counts but without hunks, built from git's numstat and name-status
+// output rather than the full diff.
+func (s *Server) writeSummary(w http.ResponseWriter, base, target string, opts git.DiffOptions, write resultWriter) {
+	opts.WordDiff = false
+	numstat, err := s.repo.GetNumstat(base, target, opts)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	nameStatus, err := s.repo.GetNameStatus(base, target, opts)
+	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	result, err := diff.ParseSummary(numstat, nameStatus)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
 	}
+	s.processSummary(result)
+
+	write(w, result)
+}
+
+// processSummary applies the command line's file filters and order to a
+// Result built by diff.ParseSummary.
+func (s *Server) processSummary(result *diff.Result) {
+	diff.FilterByExtensions(result, s.config.Only)
+	if s.config.ChangesOnlyFiles {
+		diff.HideUnchangedFiles(result)
+	}
+	diff.SortFiles(result, s.config.SortBy)
+}
+
+// commitHashRe matches a full or abbreviated commit hash.
+var commitHashRe = regexp.MustCompile(`^[0-9a-f]{4,64}$`)
+
+// changedFile is an entry of /api/commit/{hash}/files.
+type changedFile struct {
+	Status    diff.Status `json:"status"`
+	Path      string      `json:"path"`
+	OldPath   string      `json:"oldPath,omitempty"` // the name before a rename
+	Additions int         `json:"additions"`
+	Deletions int         `json:"deletions"`
+	IsBinary  bool        `json:"isBinary,omitempty"`
+}
+
+// handleCommitFiles lists the files a commit changed, with line counts,
+// for showing a commit's file list before its diff has loaded. Merge
+// commits are compared with their first parent.
+func (s *Server) handleCommitFiles(w http.ResponseWriter, r *http.Request) {
+	if s.stdin() != nil {
+		http.Error(w, "commits are not available in stdin mode", http.StatusConflict)
+		return
+	}
+	hash := r.PathValue("hash")
+	if !commitHashRe.MatchString(hash) {
+		http.Error(w, "invalid commit hash: "+hash, http.StatusBadRequest)
+		return
+	}
+
+	hash, err := s.repo.ResolveCommit(hash)
+	switch {
+	case errors.Is(err, git.ErrUnknownCommit):
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	opts := s.diffOptions()
+	opts.WordDiff = false
+	numstat, err := s.repo.GetCommitNumstat(hash, opts)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	nameStatus, err := s.repo.GetCommitNameStatus(hash, opts)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	result, err := diff.ParseSummary(numstat, nameStatus)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	s.processSummary(result)
+	result = s.postProcess(result)
+
+	files := make([]changedFile, 0, len(result.Files))
+	for _, f := range result.Files {
+		cf := changedFile{
+			Status:    f.Status,
+			Path:      f.Path(),
+			Additions: f.Additions,
+			Deletions: f.Deletions,
+			IsBinary:  f.IsBinary,
+		}
+		if f.Status == diff.StatusRenamed {
+			cf.OldPath = f.OldName
+		}
+		files = append(files, cf)
+	}
+	writeJSON(w, files)
+}
+
+// currentRange returns the default range for /api/diff.
+func (s *Server) currentRange() compareRange {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.rng
+}
+
+func (s *Server) handleGetRange(w http.ResponseWriter, _ *http.Request) {
+	if s.stdin() != nil {
+		http.Error(w, "range is not available in stdin mode", http.StatusConflict)
+		return
+	}
+	writeJSON(w, s.currentRange())
+}
+
+// branchStatus is the response of /api/status.
+type branchStatus struct {
+	Base   string `json:"base"`
+	Target string `json:"target"`
+	Ahead  int    `json:"ahead"`  // commits on target that base lacks
+	Behind int    `json:"behind"` // commits on base that target lacks
+}
+
+// handleStatus reports how many commits the range's target is ahead of and
+// behind its base, for headers like "12 commits ahead of main". In
+// merge-base mode, the base is the main branch rather than the merge-base,
+// which is never ahead. ?base= and ?target= override the range as for
+// /api/diff; the working tree counts as HEAD.
+func (s *Server) handleStatus(w http.ResponseWriter, r *http.Request) {
+	if s.stdin() != nil {
+		http.Error(w, "status is not available in stdin mode", http.StatusConflict)
+		return
+	}
+	rng := s.currentRange()
+	base, target := rng.override(r.URL.Query())
+	if s.config.BaseBranch != "" && base == s.config.Base {
+		base = s.config.BaseBranch
+	}
+	if target == "" {
+		target = "HEAD"
+	}
+	ahead, behind, err := s.repo.AheadBehind(base, target)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	writeJSON(w, branchStatus{Base: base, Target: target, Ahead: ahead, Behind: behind})
+}
+
+// handlePutRange replaces the default range so that later /api/diff
+// requests without explicit refs use it.
+func (s *Server) handlePutRange(w http.ResponseWriter, r *http.Request) {
+	if s.stdin() != nil {
+		http.Error(w, "range is not available in stdin mode", http.StatusConflict)
+		return
+	}
+
+	var rng compareRange
+	if err := json.NewDecoder(r.Body).Decode(&rng); err != nil {
+		http.Error(w, "invalid JSON: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if rng.Base == "" {
+		http.Error(w, "base is required", http.StatusBadRequest)
+		return
+	}
+	if err := git.ValidateRef(rng.Base); err != nil {
+		http.Error(w, "invalid base ref: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if rng.Target != "" {
+		if err := git.ValidateRef(rng.Target); err != nil {
+			http.Error(w, "invalid target ref: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	if err := s.saveRange(rng); err != nil {
+		http.Error(w, "saving session: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	s.mu.Lock()
+	s.rng = rng
+	s.mu.Unlock()
+
+	writeJSON(w, rng)
+}
+
+// process applies the post-parse steps selected on the command line.
+func (s *Server) process(result *diff.Result) {
+	if s.config.HideMoves {
+		// Before other filters, which could hide the other end of a move.
+		diff.DetectMoves(result)
+		diff.HideMoves(result)
+	}
+	diff.FilterByExtensions(result, s.config.Only)
+	if s.config.ChangesOnlyFiles {
+		diff.HideUnchangedFiles(result)
+	}
+	s.setTabWidths(result)
+	diff.ClassifyEOLOnly(result)
+	diff.ClassifyWhitespaceOnly(result)
+	if s.config.ChangesOnly {
+		diff.StripContext(result)
+	}
+	if s.config.Renumber > 0 {
+		diff.RenumberFrom(result, s.config.Renumber)
+	}
+	diff.TruncateLines(result, s.config.MaxLineLength)
+	diff.SortFiles(result, s.config.SortBy)
+}
+
+// postProcess returns result after the WithPostProcessor hooks. They run
+// on a copy, since result may be the stdin diff shared between requests.
+func (s *Server) postProcess(result *diff.Result) *diff.Result {
+	if len(s.postProcessors) == 0 {
+		return result
+	}
+	result = diff.Clone(result)
+	for _, hook := range s.postProcessors {
+		hook(result)
+	}
+	return result
+}
+
+// postProcessLog returns log after the WithPostProcessor hooks, run on
+// each commit's files. log itself, which may be the --mbox series shared
+// between requests, is left unchanged.
+func (s *Server) postProcessLog(log *diff.Log) *diff.Log {
+	if len(s.postProcessors) == 0 {
+		return log
+	}
+	out := &diff.Log{Commits: slices.Clone(log.Commits)}
+	for i := range out.Commits {
+		out.Commits[i].Files = s.postProcess(&diff.Result{Files: out.Commits[i].Files}).Files
+	}
+	return out
+}
+
+// processLog applies process to the files of each commit of log.
+func (s *Server) processLog(log *diff.Log) {
+	for i := range log.Commits {
+		// The filters replace the slice rather than compacting it in place.
+		result := &diff.Result{Files: log.Commits[i].Files}
+		s.process(result)
+		log.Commits[i].Files = result.Files
+	}
+}
+
+// setTabWidths sets each file's tab width from .editorconfig, then
+// .gitattributes, then --tab-width. Either file may be missing, e.g. in
+// stdin mode outside a repository.
+func (s *Server) setTabWidths(result *diff.Result) {
+	var sources []func(path string) int
+	if s.repo != nil {
+		if data, err := s.repo.GetFile("", ".editorconfig"); err == nil {
+			sources = append(sources, diff.ParseEditorConfig(string(data)).TabWidth)
+		}
+		paths := make([]string, len(result.Files))
+		for i := range result.Files {
+			paths[i] = result.Files[i].Path()
+		}
+		if widths, err := s.repo.GetTabWidths(paths); err == nil {
+			sources = append(sources, func(path string) int { return widths[path] })
+		}
+	}
+	diff.SetTabWidths(result, s.config.TabWidth, sources...)
+}
+
+// diffOptions returns the git diff options selected on the command line.
+func (s *Server) diffOptions() git.DiffOptions {
+	// --status was validated when parsing the command line.
+	filter, _ := git.DiffFilter(s.config.Status)
+	return git.DiffOptions{
+		FindRenames: s.config.FindRenames,
+		FindCopies:  s.config.FindCopies,
+		WordDiff:    s.config.WordDiff,
+		Text:        s.config.Text,
+		Filter:      filter,
+
+		IgnoreMatching: s.config.IgnoreMatching,
+	}
+}
+
+// handleCommits lists the commits between the base and target of the diff
+// being shown in merge-base and compare modes, and recent commits
+// otherwise. ?pickaxe=<text> limits them to commits that change the number
+// of occurrences of text (git log -S), and ?pickaxeRegex=<regex> to commits
+// whose diff has lines matching the regex (git log -G).
+// ?fields=hash,subject,... selects the commit fields to return from
+// git.CommitFields, and ?merges=none|first-parent|all overrides --merges.
+func (s *Server) handleCommits(w http.ResponseWriter, r *http.Request) {
+	// In stdin mode, return empty array
+	if s.stdin() != nil {
+		writeJSON(w, []git.Commit{})
+		return
+	}
+
+	opts := git.LogOptions{
+		Pickaxe:      r.URL.Query().Get("pickaxe"),
+		PickaxeRegex: r.URL.Query().Get("pickaxeRegex"),
+		Merges:       s.config.Merges,
+		Abbrev:       s.config.Abbrev,
+	}
+	if s.config.Mode == "merge-base" || s.config.Mode == "compare" {
+		rng := s.currentRange()
+		opts.Base, opts.Target = rng.Base, rng.Target
+	}
+	if merges := r.URL.Query().Get("merges"); merges != "" {
+		if err := git.ValidateMerges(merges); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		opts.Merges = merges
+	}
+	if order := r.URL.Query().Get("order"); order != "" {
+		if err := git.ValidateOrder(order); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		opts.Order = order
+	}
+	if opts.Pickaxe != "" && opts.PickaxeRegex != "" {
+		http.Error(w, "pickaxe and pickaxeRegex cannot be combined", http.StatusBadRequest)
+		return
+	}
+	if fields := r.URL.Query().Get("fields"); fields != "" {
+		opts.Fields = strings.Split(fields, ",")
+		if err := git.ValidateCommitFields(opts.Fields); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	commits, err := s.repo.GetCommits(50, opts)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if commits == nil {
+		commits = []git.Commit{}
+	}
+
+	writeJSON(w, commits)
+}
+
+// maxGraphCommits is the most commits /api/graph lays out.
+const maxGraphCommits = 1000
+
+// handleGraph serves the last ?n= commits (default 100) of the current
+// branch in topological order, with their parents and the lanes to draw
+// them in as a graph.
+func (s *Server) handleGraph(w http.ResponseWriter, r *http.Request) {
+	if s.stdin() != nil {
+		writeJSON(w, []graph.Node{})
+		return
+	}
+
+	n := 100
+	if v := r.URL.Query().Get("n"); v != "" {
+		var err error
+		n, err = strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxGraphCommits {
+			http.Error(w, fmt.Sprintf("invalid n %q: must be between 1 and %d", v, maxGraphCommits), http.StatusBadRequest)
+			return
+		}
+	}
+
+	commits, err := s.repo.GetCommits(n, git.LogOptions{
+		Order:  "topo",
+		Fields: []string{"hash", "shortHash", "subject", "author", "date", "parents"},
+		Abbrev: s.config.Abbrev,
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, graph.Layout(commits))
+}
+
+// handleRangeDiff compares two commit ranges with git range-diff. The
+// ranges come from ?old= and ?new=, defaulting to the command line ranges
+// in range-diff mode.
+func (s *Server) handleRangeDiff(w http.ResponseWriter, r *http.Request) {
+	if s.stdin() != nil {
+		http.Error(w, "range-diff is not available in stdin mode", http.StatusConflict)
+		return
+	}
+
+	oldRange := r.URL.Query().Get("old")
+	newRange := r.URL.Query().Get("new")
+	if s.config.Mode == "range-diff" {
+		if oldRange == "" {
+			oldRange = s.config.Base
+		}
+		if newRange == "" {
+			newRange = s.config.Target
+		}
+	}
+	if oldRange == "" || newRange == "" {
+		http.Error(w, "old and new ranges are required", http.StatusBadRequest)
+		return
+	}
+
+	raw, err := s.repo.GetRangeDiff(oldRange, newRange)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	result, err := diff.ParseRangeDiff(raw)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if result.Pairs == nil {
+		result.Pairs = []diff.CommitPair{}
+	}
+
+	writeJSON(w, result)
+}
+
+// batchEntry is an entry of /api/batch; ID selects it in /api/diff?id=.
+type batchEntry struct {
+	ID int `json:"id"`
+	cli.BatchEntry
+}
+
+// handleBatch lists the diffs given with --commits-file.
+func (s *Server) handleBatch(w http.ResponseWriter, _ *http.Request) {
+	entries := make([]batchEntry, len(s.config.Batch))
+	for i, e := range s.config.Batch {
+		entries[i] = batchEntry{ID: i, BatchEntry: e}
+	}
+	writeJSON(w, entries)
+}
+
+// handleHistory serves the commits in ?base=..?target= that touch ?path=,
+// each with its diff of that file. Parameters default to the command line
+// in history mode. In mbox mode it serves the patch series instead.
+func (s *Server) handleHistory(w http.ResponseWriter, r *http.Request) {
+	s.mu.RLock()
+	series := s.series
+	s.mu.RUnlock()
+	if series != nil {
+		writeJSON(w, s.postProcessLog(series))
+		return
+	}
+	if s.stdin() != nil {
+		http.Error(w, "history is not available in stdin mode", http.StatusConflict)
+		return
+	}
+
+	q := r.URL.Query()
+	base, target, path := q.Get("base"), q.Get("target"), q.Get("path")
+	if s.config.Mode == "history" {
+		if base == "" {
+			base = s.config.Base
+		}
+		if target == "" {
+			target = s.config.Target
+		}
+		if path == "" {
+			path = s.config.Path
+		}
+	}
+	if base == "" || target == "" || path == "" {
+		http.Error(w, "base, target and path are required", http.StatusBadRequest)
+		return
+	}
+
+	opts := s.diffOptions()
+	opts.WordDiff = false
+	raw, err := s.repo.GetFileHistory(base, target, path, diff.LogFormat, opts)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	result, err := diff.ParseLog(raw)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if result.Commits == nil {
+		result.Commits = []diff.CommitDiff{}
+	}
+	s.processLog(result)
+
+	writeJSON(w, s.postProcessLog(result))
+}
+
+// fileAt resolves the path and ref query parameters of /api/file and
+// /api/blame. ref is "new" (the default) or "old" for the target or base
+// of the diff being viewed, which base and target override, or any other
+// ref as is. side=new or side=old instead picks a side of the diff for the
+// file at path in the target: for a renamed file, the old side is read
+// from its old path.
+func (s *Server) fileAt(q url.Values) (ref, path string, err error) {
+	path = q.Get("path")
+	if path == "" {
+		return "", "", errors.New("path is required")
+	}
+	base, target := s.currentRange().override(q)
+
+	ref = q.Get("ref")
+	switch side := q.Get("side"); {
+	case side != "" && ref != "":
+		return "", "", errors.New("ref and side can't be combined")
+	case side == "new":
+		return target, path, nil
+	case side == "old":
+		opts := s.diffOptions()
+		opts.WordDiff = false
+		opts.Filter = "" // --status must not hide the rename
+		oldPath, err := s.repo.RenamedFrom(base, target, path, opts)
+		if err != nil {
+			return "", "", err
+		}
+		return base, oldPath, nil
+	case side != "":
+		return "", "", fmt.Errorf("invalid side %q: must be old or new", side)
+	}
+
+	switch ref {
+	case "", "new":
+		ref = target
+	case "old":
+		ref = base
+	}
+	return ref, path, nil
+}
+
+// handleFile serves the raw contents of ?path= at ?ref=. The ref may be
+// "old" or "new" for the base and target of the current comparison (which
+// ?base= and ?target= override, as for /api/diff), or any other git ref.
+// A "new" side without a target is read from the working tree.
+func (s *Server) handleFile(w http.ResponseWriter, r *http.Request) {
+	if s.stdin() != nil {
+		http.Error(w, "file contents are not available in stdin mode", http.StatusConflict)
+		return
+	}
+
+	ref, path, err := s.fileAt(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	data, err := s.repo.GetFile(ref, path)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	ctype := mime.TypeByExtension(filepath.Ext(path))
+	if ctype == "" {
+		ctype = http.DetectContentType(data)
+	}
+	w.Header().Set("Content-Type", ctype)
+	// Repository content is untrusted: never sniff it into something
+	// executable, and sandbox it (e.g. scripts in SVGs) if opened directly.
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("Content-Security-Policy", "default-src 'none'; style-src 'unsafe-inline'; sandbox")
+	_, _ = w.Write(data)
+}
+
+// sideBySide is the response of /api/sidebyside. A side is null where the
+// file doesn't exist.
+type sideBySide struct {
+	OldPath string   `json:"oldPath,omitempty"` // the name at base, if renamed
+	Old     []string `json:"old"`
+	New     []string `json:"new"`
+}
+
+// handleSideBySide serves the lines of ?path= at the base and the target of
+// the diff being viewed, which ?base= and ?target= override as for
+// /api/diff, for showing both versions whole rather than as hunks. A
+// renamed file is read from its old path at the base.
+func (s *Server) handleSideBySide(w http.ResponseWriter, r *http.Request) {
+	if s.stdin() != nil {
+		http.Error(w, "file contents are not available in stdin mode", http.StatusConflict)
+		return
+	}
+
+	q := r.URL.Query()
+	path := q.Get("path")
+	if path == "" {
+		http.Error(w, "path is required", http.StatusBadRequest)
+		return
+	}
+	base, target := s.currentRange().override(q)
+	opts := s.diffOptions()
+	opts.WordDiff = false
+	opts.Filter = "" // --status must not hide the rename
+	oldPath, err := s.repo.RenamedFrom(base, target, path, opts)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	oldLines, newLines, err := s.repo.GetFileVersions(base, target, oldPath, path)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if oldLines == nil && newLines == nil {
+		http.Error(w, "no file "+path+" on either side", http.StatusNotFound)
+		return
+	}
+	resp := sideBySide{Old: oldLines, New: newLines}
+	if oldPath != path {
+		resp.OldPath = oldPath
+	}
+	writeJSON(w, resp)
+}
+
+// handleBlame serves the blame of lines start through end of a file, e.g.
+// for the lines of one hunk, taking the same path and ref parameters as
+// /api/file. The range is clamped to the file.
+func (s *Server) handleBlame(w http.ResponseWriter, r *http.Request) {
+	if s.stdin() != nil {
+		http.Error(w, "blame is not available in stdin mode", http.StatusConflict)
+		return
+	}
+
+	q := r.URL.Query()
+	start, err := strconv.Atoi(q.Get("start"))
+	if err != nil {
+		http.Error(w, "invalid start: "+q.Get("start"), http.StatusBadRequest)
+		return
+	}
+	end, err := strconv.Atoi(q.Get("end"))
+	if err != nil || end < start {
+		http.Error(w, "invalid end: "+q.Get("end"), http.StatusBadRequest)
+		return
+	}
+
+	ref, path, err := s.fileAt(q)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	lines, err := s.repo.Blame(ref, path, start, end)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	writeJSON(w, lines)
+}
+
+func (s *Server) handleRefs(w http.ResponseWriter, _ *http.Request) {
+	// In stdin mode, return empty array
+	if s.stdin() != nil {
+		writeJSON(w, []git.Ref{})
+		return
+	}
+
+	refs, err := s.repo.GetRefs()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if refs == nil {
+		refs = []git.Ref{}
+	}
+
+	writeJSON(w, refs)
+}
+
+// writeJSON encodes v as the response body. The body is buffered so that
+// Content-Length and an ETag can be set, which lets clients check the size
+// of a response with a HEAD request before fetching it.
+func writeJSON(w http.ResponseWriter, v any) {
+	var buf bytes.Buffer
+	if err := json.NewEncoder(&buf).Encode(v); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	sum := sha256.Sum256(buf.Bytes())
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Length", strconv.Itoa(buf.Len()))
+	w.Header().Set("ETag", `"`+hex.EncodeToString(sum[:16])+`"`)
+	_, _ = w.Write(buf.Bytes())
+}
+
+// writeMarkdown writes result as GitHub-flavored markdown.
+func writeMarkdown(w http.ResponseWriter, result *diff.Result) {
+	w.Header().Set("Content-Type", "text/markdown; charset=utf-8")
+	_, _ = w.Write([]byte(diff.Markdown(result)))
 }
@@ -1,20 +1,30 @@
 package server
 
 import (
+	"bufio"
 	"encoding/json"
+	"fmt"
 	"io"
+	"io/fs"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"runtime"
+	"slices"
 	"strings"
+	"sync"
 	"testing"
 	"testing/fstest"
+	"time"
 
 	"github.com/lundberg/ghdiff/internal/cli"
 	"github.com/lundberg/ghdiff/internal/diff"
 	"github.com/lundberg/ghdiff/internal/git"
+	"github.com/lundberg/ghdiff/internal/graph"
+	"github.com/lundberg/ghdiff/web"
 )
 
 // initTestRepo creates a temporary git repo with user config and an initial commit.
@@ -69,7 +79,7 @@ func commitFile(t *testing.T, dir, name, content, message string) string {
 func testAssets() fstest.MapFS {
 	return fstest.MapFS{
 		"index.html": &fstest.MapFile{
-			Data: []byte(`<html><body><script>window.__TOKEN__="{{TOKEN}}";</script>Hello ghdiff</body></html>`),
+			Data: []byte(`<html><head><link rel="stylesheet" href="css/themes/{{SYNTAX_THEME}}.css"></head><body><script>window.__TOKEN__="{{TOKEN}}";window.__VIEW_MODE__="{{VIEW_MODE}}";window.__BASE__="{{BASE}}";window.__TARGET__="{{TARGET}}";window.__EDITOR__="{{EDITOR}}";window.__REPO_ROOT__="{{REPO_ROOT}}";</script>Hello ghdiff</body></html>`),
 		},
 	}
 }
@@ -373,6 +383,90 @@ func TestAPIDiffStdinMode(t *testing.T) {
 	}
 }
 
+func TestAPIDiffPostProcessor(t *testing.T) {
+	stdinDiff := &diff.Result{
+		Files: []diff.FileDiff{
+			{
+				NewName: "config.env",
+				Status:  "modified",
+				Hunks: []diff.Hunk{
+					{
+						OldStart: 1, OldLines: 1, NewStart: 1, NewLines: 1,
+						Lines: []diff.Line{
+							{Type: "delete", Content: "TOKEN=old", OldNum: 1},
+							{Type: "add", Content: "TOKEN=secret", NewNum: 1},
+						},
+					},
+				},
+			},
+		},
+	}
+
+	cfg := &cli.Config{
+		Mode: "stdin",
+		Host: "localhost",
+		Port: 0,
+	}
+	redact := func(result *diff.Result) {
+		for i := range result.Files {
+			for j := range result.Files[i].Hunks {
+				lines := result.Files[i].Hunks[j].Lines
+				for k := range lines {
+					if strings.HasPrefix(lines[k].Content, "TOKEN=") {
+						lines[k].Content = "TOKEN=[redacted]"
+					}
+				}
+			}
+		}
+	}
+	var order []string
+	srv := New(cfg, nil, stdinDiff, testAssets(),
+		WithPostProcessor(func(*diff.Result) { order = append(order, "first") }),
+		WithPostProcessor(redact),
+		WithPostProcessor(func(*diff.Result) { order = append(order, "second") }),
+	)
+
+	ts := httptest.NewServer(srv.Handler())
+	defer ts.Close()
+
+	resp, err := authGet(ts.URL+"/api/diff", srv.token)
+	if err != nil {
+		t.Fatalf("GET /api/diff: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", resp.StatusCode)
+	}
+	var result diff.Result
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		t.Fatalf("decode JSON: %v", err)
+	}
+	for _, l := range result.Files[0].Hunks[0].Lines {
+		if l.Content != "TOKEN=[redacted]" {
+			t.Errorf("expected line to be redacted, got %q", l.Content)
+		}
+	}
+	if strings.Join(order, ",") != "first,second" {
+		t.Errorf("expected hooks to run in order, got %q", order)
+	}
+	// The hooks work on a copy, leaving the shared stdin diff intact.
+	if got := stdinDiff.Files[0].Hunks[0].Lines[1].Content; got != "TOKEN=secret" {
+		t.Errorf("expected stdin diff to be unchanged, got %q", got)
+	}
+
+	// Other endpoints serving the diff run the hooks too.
+	resp, err = authGet(ts.URL+"/api/diff/markdown", srv.token)
+	if err != nil {
+		t.Fatalf("GET /api/diff/markdown: %v", err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	if strings.Contains(string(body), "TOKEN=secret") || !strings.Contains(string(body), "TOKEN=[redacted]") {
+		t.Errorf("expected the markdown to be redacted, got:\n%s", body)
+	}
+}
+
 func TestAPIDiffStdinModeIgnoresBase(t *testing.T) {
 	stdinDiff := &diff.Result{
 		Files: []diff.FileDiff{
@@ -469,6 +563,42 @@ func TestAPICommits(t *testing.T) {
 	}
 }
 
+func TestAPICommitsInRange(t *testing.T) {
+	dir := initTestRepo(t)
+	commitFile(t, dir, "a.txt", "a", "before base")
+	base := commitFile(t, dir, "b.txt", "b", "base commit")
+	commitFile(t, dir, "c.txt", "c", "in range one")
+	target := commitFile(t, dir, "d.txt", "d", "in range two")
+	commitFile(t, dir, "e.txt", "e", "after target")
+
+	cfg := &cli.Config{Mode: "compare", Base: base, Target: target, Host: "localhost"}
+	srv := New(cfg, git.NewRepo(dir), nil, testAssets())
+
+	ts := httptest.NewServer(srv.Handler())
+	defer ts.Close()
+
+	resp, err := authGet(ts.URL+"/api/commits", srv.token)
+	if err != nil {
+		t.Fatalf("GET /api/commits: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", resp.StatusCode)
+	}
+
+	var commits []git.Commit
+	if err := json.NewDecoder(resp.Body).Decode(&commits); err != nil {
+		t.Fatalf("decode JSON: %v", err)
+	}
+	var got []string
+	for _, c := range commits {
+		got = append(got, c.Message)
+	}
+	if want := []string{"in range two", "in range one"}; !slices.Equal(got, want) {
+		t.Errorf("expected commits %q, got %q", want, got)
+	}
+}
+
 func TestAPICommitsStdinMode(t *testing.T) {
 	stdinDiff := &diff.Result{
 		Files: []diff.FileDiff{},
@@ -549,6 +679,218 @@ func TestStaticServing(t *testing.T) {
 	}
 }
 
+func TestIndexViewMode(t *testing.T) {
+	cfg := &cli.Config{
+		Mode:     "stdin",
+		Host:     "localhost",
+		Port:     0,
+		ViewMode: "unified",
+	}
+	srv := New(cfg, nil, &diff.Result{}, testAssets())
+
+	ts := httptest.NewServer(srv.Handler())
+	defer ts.Close()
+
+	resp, err := http.Get(ts.URL + "/")
+	if err != nil {
+		t.Fatalf("GET /: %v", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("read body: %v", err)
+	}
+
+	if !strings.Contains(string(body), `window.__VIEW_MODE__="unified"`) {
+		t.Errorf("expected body to contain injected view mode, got:\n%s", body)
+	}
+	if strings.Contains(string(body), "{{VIEW_MODE}}") {
+		t.Error("expected {{VIEW_MODE}} placeholder to be replaced")
+	}
+}
+
+func TestIndexPermalink(t *testing.T) {
+	cfg := &cli.Config{
+		Mode:     "merge-base",
+		Host:     "localhost",
+		Port:     0,
+		ViewMode: "split",
+	}
+	srv := New(cfg, nil, &diff.Result{}, testAssets())
+
+	ts := httptest.NewServer(srv.Handler())
+	defer ts.Close()
+
+	get := func(query string) (int, string) {
+		t.Helper()
+		resp, err := http.Get(ts.URL + "/?" + query)
+		if err != nil {
+			t.Fatalf("GET /?%s: %v", query, err)
+		}
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatalf("read body: %v", err)
+		}
+		return resp.StatusCode, string(body)
+	}
+
+	status, body := get("base=main&target=feature%2Fx&mode=unified")
+	if status != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", status)
+	}
+	for _, want := range []string{
+		`window.__BASE__="main"`,
+		`window.__TARGET__="feature/x"`,
+		`window.__VIEW_MODE__="unified"`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("expected body to contain %s, got:\n%s", want, body)
+		}
+	}
+
+	// Without parameters the command line's state is served.
+	_, body = get("")
+	if !strings.Contains(body, `window.__BASE__="";window.__TARGET__=""`) ||
+		!strings.Contains(body, `window.__VIEW_MODE__="split"`) {
+		t.Errorf("expected empty refs and split view, got:\n%s", body)
+	}
+
+	// A ref can't break out of the script.
+	_, body = get("base=" + url.QueryEscape(`"</script><script>alert(1)//`))
+	if strings.Contains(body, "</script><script>") {
+		t.Errorf("expected ref to be escaped, got:\n%s", body)
+	}
+
+	for _, query := range []string{"mode=sideways", "base=--output=x", "target=-p"} {
+		if status, _ := get(query); status != http.StatusBadRequest {
+			t.Errorf("GET /?%s: expected status 400, got %d", query, status)
+		}
+	}
+}
+
+func TestIndexRendersPerRequest(t *testing.T) {
+	cfg := &cli.Config{Mode: "stdin", Host: "localhost", ViewMode: "split"}
+	srv := New(cfg, nil, &diff.Result{}, testAssets())
+
+	ts := httptest.NewServer(srv.Handler())
+	defer ts.Close()
+
+	// Each request gets its own view mode, not the first request's.
+	for _, mode := range []string{"unified", "split", "unified"} {
+		resp, err := http.Get(ts.URL + "/?mode=" + mode)
+		if err != nil {
+			t.Fatalf("GET /?mode=%s: %v", mode, err)
+		}
+		body, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			t.Fatalf("read body: %v", err)
+		}
+		if want := `window.__VIEW_MODE__="` + mode + `"`; !strings.Contains(string(body), want) {
+			t.Errorf("mode=%s: expected body to contain %s, got:\n%s", mode, want, body)
+		}
+		if !strings.Contains(string(body), srv.token) {
+			t.Errorf("mode=%s: expected body to contain the token", mode)
+		}
+	}
+}
+
+func TestIndexEditorRoot(t *testing.T) {
+	dir := initTestRepo(t)
+	commitFile(t, dir, "a.txt", "a", "first commit")
+	root, err := filepath.EvalSymlinks(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		host, editor string
+		want         string
+	}{
+		{"localhost", "vscode", `window.__EDITOR__="vscode";window.__REPO_ROOT__="` + root + `"`},
+		{"127.0.0.1", "idea", `window.__EDITOR__="idea";window.__REPO_ROOT__="` + root + `"`},
+		{"localhost", "none", `window.__EDITOR__="";window.__REPO_ROOT__=""`},
+		// Never reveal the path to other hosts.
+		{"0.0.0.0", "vscode", `window.__EDITOR__="";window.__REPO_ROOT__=""`},
+	}
+	for _, tt := range tests {
+		cfg := &cli.Config{Mode: "commit", Base: "HEAD", Host: tt.host, Editor: tt.editor}
+		srv := New(cfg, git.NewRepo(dir), nil, testAssets())
+		ts := httptest.NewServer(srv.Handler())
+
+		resp, err := http.Get(ts.URL + "/")
+		if err != nil {
+			t.Fatalf("GET /: %v", err)
+		}
+		body, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		ts.Close()
+		if err != nil {
+			t.Fatalf("read body: %v", err)
+		}
+		if !strings.Contains(string(body), tt.want) {
+			t.Errorf("host %s, editor %s: expected body to contain %s, got:\n%s", tt.host, tt.editor, tt.want, body)
+		}
+	}
+}
+
+func TestIndexSyntaxTheme(t *testing.T) {
+	cfg, err := cli.ParseArgs([]string{"--syntax-theme", "github", "-"})
+	if err != nil {
+		t.Fatalf("ParseArgs: %v", err)
+	}
+	srv := New(cfg, nil, &diff.Result{}, testAssets())
+	ts := httptest.NewServer(srv.Handler())
+	defer ts.Close()
+
+	resp, err := http.Get(ts.URL + "/")
+	if err != nil {
+		t.Fatalf("GET /: %v", err)
+	}
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		t.Fatalf("read body: %v", err)
+	}
+	const path = "css/themes/github.css"
+	if !strings.Contains(string(body), `href="`+path+`"`) {
+		t.Errorf("expected body to link %s, got:\n%s", path, body)
+	}
+	// The linked stylesheet ships with the real assets.
+	if _, err := fs.Stat(web.Assets, path); err != nil {
+		t.Errorf("expected %s in the embedded assets: %v", path, err)
+	}
+
+	if _, err := cli.ParseArgs([]string{"--syntax-theme", "solarized"}); err == nil {
+		t.Error("expected error for unknown syntax theme, got nil")
+	}
+}
+
+func TestHealthz(t *testing.T) {
+	cfg := &cli.Config{
+		Mode: "stdin",
+		Host: "localhost",
+		Port: 0,
+	}
+	srv := New(cfg, nil, &diff.Result{}, testAssets())
+
+	ts := httptest.NewServer(srv.Handler())
+	defer ts.Close()
+
+	// No token required
+	resp, err := http.Get(ts.URL + "/healthz")
+	if err != nil {
+		t.Fatalf("GET /healthz: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", resp.StatusCode)
+	}
+}
+
 func TestAPIForbiddenWithoutToken(t *testing.T) {
 	cfg := &cli.Config{
 		Mode: "stdin",
@@ -561,7 +903,7 @@ func TestAPIForbiddenWithoutToken(t *testing.T) {
 	ts := httptest.NewServer(srv.Handler())
 	defer ts.Close()
 
-	for _, path := range []string{"/api/diff", "/api/commits"} {
+	for _, path := range []string{"/api/diff", "/api/commits", "/api/refs"} {
 		resp, err := http.Get(ts.URL + path)
 		if err != nil {
 			t.Fatalf("GET %s: %v", path, err)
@@ -585,7 +927,7 @@ func TestAPIForbiddenWithWrongToken(t *testing.T) {
 	ts := httptest.NewServer(srv.Handler())
 	defer ts.Close()
 
-	for _, path := range []string{"/api/diff", "/api/commits"} {
+	for _, path := range []string{"/api/diff", "/api/commits", "/api/refs"} {
 		resp, err := authGet(ts.URL+path, "wrong-token-value")
 		if err != nil {
 			t.Fatalf("GET %s: %v", path, err)
@@ -596,3 +938,2132 @@ func TestAPIForbiddenWithWrongToken(t *testing.T) {
 		}
 	}
 }
+
+func TestAPIRefs(t *testing.T) {
+	dir := initTestRepo(t)
+	cmd := exec.Command("git", "branch", "-M", "main")
+	cmd.Dir = dir
+	_, _ = cmd.CombinedOutput()
+
+	hash := commitFile(t, dir, "a.txt", "a", "first commit")
+	cmd = exec.Command("git", "tag", "v1.0.0")
+	cmd.Dir = dir
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("tag: %v\n%s", err, out)
+	}
+
+	cfg := &cli.Config{
+		Mode: "merge-base",
+		Host: "localhost",
+		Port: 0,
+	}
+	srv := New(cfg, git.NewRepo(dir), nil, testAssets())
+
+	ts := httptest.NewServer(srv.Handler())
+	defer ts.Close()
+
+	resp, err := authGet(ts.URL+"/api/refs", srv.token)
+	if err != nil {
+		t.Fatalf("GET /api/refs: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", resp.StatusCode)
+	}
+
+	var refs []git.Ref
+	if err := json.NewDecoder(resp.Body).Decode(&refs); err != nil {
+		t.Fatalf("decode JSON: %v", err)
+	}
+	want := []git.Ref{
+		{Name: "HEAD", Type: "head", Hash: hash},
+		{Name: "main", Type: "branch", Hash: hash},
+		{Name: "v1.0.0", Type: "tag", Hash: hash},
+	}
+	if len(refs) != len(want) {
+		t.Fatalf("expected %d refs, got %d: %+v", len(want), len(refs), refs)
+	}
+	for i := range want {
+		if refs[i] != want[i] {
+			t.Errorf("ref %d: expected %+v, got %+v", i, want[i], refs[i])
+		}
+	}
+}
+
+func TestAPIRefsStdinMode(t *testing.T) {
+	cfg := &cli.Config{
+		Mode: "stdin",
+		Host: "localhost",
+		Port: 0,
+	}
+	srv := New(cfg, nil, &diff.Result{}, testAssets())
+
+	ts := httptest.NewServer(srv.Handler())
+	defer ts.Close()
+
+	resp, err := authGet(ts.URL+"/api/refs", srv.token)
+	if err != nil {
+		t.Fatalf("GET /api/refs: %v", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("read body: %v", err)
+	}
+	if strings.TrimSpace(string(body)) != "[]" {
+		t.Errorf("expected empty JSON array in stdin mode, got %s", body)
+	}
+}
+
+func TestConcurrentReadsAndSwap(t *testing.T) {
+	cfg := &cli.Config{
+		Mode: "stdin",
+		Host: "localhost",
+		Port: 0,
+	}
+	first := &diff.Result{Files: []diff.FileDiff{{NewName: "first.txt", Status: "modified"}}}
+	second := &diff.Result{Files: []diff.FileDiff{{NewName: "second.txt", Status: "modified"}}}
+	srv := New(cfg, nil, first, testAssets())
+	handler := srv.Handler()
+
+	var wg sync.WaitGroup
+	for range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range 50 {
+				req := httptest.NewRequest("GET", "http://localhost/api/diff", http.NoBody)
+				req.Header.Set("X-Auth-Token", srv.token)
+				rec := httptest.NewRecorder()
+				handler.ServeHTTP(rec, req)
+
+				var result diff.Result
+				if err := json.Unmarshal(rec.Body.Bytes(), &result); err != nil {
+					t.Errorf("decode JSON: %v", err)
+					return
+				}
+				if len(result.Files) != 1 {
+					t.Errorf("expected 1 file, got %d", len(result.Files))
+					return
+				}
+				if name := result.Files[0].NewName; name != "first.txt" && name != "second.txt" {
+					t.Errorf("unexpected file %q", name)
+				}
+
+				rec = httptest.NewRecorder()
+				handler.ServeHTTP(rec, httptest.NewRequest("GET", "http://localhost/", http.NoBody))
+				if !strings.Contains(rec.Body.String(), srv.token) {
+					t.Errorf("expected index to contain token, got:\n%s", rec.Body.String())
+				}
+			}
+		}()
+	}
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := range 50 {
+			if i%2 == 0 {
+				srv.SetStdinDiff(second)
+			} else {
+				srv.SetStdinDiff(first)
+			}
+			srv.ReloadIndex()
+		}
+	}()
+	wg.Wait()
+
+	srv.SetStdinDiff(second)
+	if got := srv.stdin(); got != second {
+		t.Errorf("expected swapped diff to be served, got %+v", got)
+	}
+}
+
+// authPut performs an HTTP PUT with a JSON body and the X-Auth-Token header set.
+func authPut(url, token, body string) (*http.Response, error) {
+	req, err := http.NewRequest("PUT", url, strings.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("X-Auth-Token", token)
+	req.Header.Set("Content-Type", "application/json")
+	return http.DefaultClient.Do(req)
+}
+
+func authPost(url, token, body string) (*http.Response, error) {
+	req, err := http.NewRequest("POST", url, strings.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("X-Auth-Token", token)
+	req.Header.Set("Content-Type", "application/json")
+	return http.DefaultClient.Do(req)
+}
+
+func TestAPISession(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "session.json")
+	cfg := &cli.Config{Mode: "compare", Base: "HEAD~1", Target: "HEAD", Host: "localhost", Session: path}
+	srv := New(cfg, git.NewRepo(initTestRepo(t)), nil, testAssets())
+
+	ts := httptest.NewServer(srv.Handler())
+	defer ts.Close()
+
+	// Nothing saved yet.
+	resp, err := authGet(ts.URL+"/api/session", srv.token)
+	if err != nil {
+		t.Fatalf("GET /api/session: %v", err)
+	}
+	var got Session
+	err = json.NewDecoder(resp.Body).Decode(&got)
+	resp.Body.Close()
+	if err != nil || got != (Session{}) {
+		t.Errorf("expected an empty session, got %+v (%v)", got, err)
+	}
+
+	resp, err = authPost(ts.URL+"/api/session", srv.token, `{"base":"main","target":"feature","mode":"unified","file":"src/a.go"}`)
+	if err != nil {
+		t.Fatalf("POST /api/session: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", resp.StatusCode)
+	}
+
+	want := Session{Base: "main", Target: "feature", ViewMode: "unified", File: "src/a.go"}
+	saved, err := LoadSession(path)
+	if err != nil {
+		t.Fatalf("LoadSession: %v", err)
+	}
+	if saved == nil || *saved != want {
+		t.Errorf("expected %+v in %s, got %+v", want, path, saved)
+	}
+
+	resp, err = authGet(ts.URL+"/api/session", srv.token)
+	if err != nil {
+		t.Fatalf("GET /api/session: %v", err)
+	}
+	err = json.NewDecoder(resp.Body).Decode(&got)
+	resp.Body.Close()
+	if err != nil || got != want {
+		t.Errorf("expected %+v, got %+v (%v)", want, got, err)
+	}
+
+	for _, body := range []string{`{"base":"--all"}`, `{"base":"main","mode":"wide"}`, `not json`} {
+		resp, err := authPost(ts.URL+"/api/session", srv.token, body)
+		if err != nil {
+			t.Fatalf("POST /api/session: %v", err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusBadRequest {
+			t.Errorf("POST %s: expected status 400, got %d", body, resp.StatusCode)
+		}
+	}
+	// Rejected state leaves the file alone.
+	if saved, _ := LoadSession(path); saved == nil || *saved != want {
+		t.Errorf("expected %+v to be kept, got %+v", want, saved)
+	}
+
+	// Changing the range through the API saves it too, keeping the view.
+	resp, err = authPut(ts.URL+"/api/range", srv.token, `{"base":"v1.0"}`)
+	if err != nil {
+		t.Fatalf("PUT /api/range: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("PUT /api/range: expected status 200, got %d", resp.StatusCode)
+	}
+	want = Session{Base: "v1.0", ViewMode: "unified", File: "src/a.go"}
+	if saved, _ := LoadSession(path); saved == nil || *saved != want {
+		t.Errorf("expected %+v after PUT /api/range, got %+v", want, saved)
+	}
+}
+
+func TestAPISessionDisabled(t *testing.T) {
+	cfg := &cli.Config{Mode: "compare", Base: "HEAD~1", Target: "HEAD", Host: "localhost"}
+	srv := New(cfg, git.NewRepo(initTestRepo(t)), nil, testAssets())
+
+	ts := httptest.NewServer(srv.Handler())
+	defer ts.Close()
+
+	resp, err := authPost(ts.URL+"/api/session", srv.token, `{"base":"main"}`)
+	if err != nil {
+		t.Fatalf("POST /api/session: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("expected status 404 without --session, got %d", resp.StatusCode)
+	}
+}
+
+func TestAPIStatus(t *testing.T) {
+	dir := initTestRepo(t)
+	setup := func(args ...string) {
+		t.Helper()
+		cmd := exec.Command("git", args...)
+		cmd.Dir = dir
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %v: %v\n%s", args, err, out)
+		}
+	}
+	mergeBase := commitFile(t, dir, "file.txt", "line1\n", "first commit")
+	setup("branch", "-M", "main")
+	setup("checkout", "-b", "feature")
+	commitFile(t, dir, "a.txt", "a\n", "feature commit 1")
+	commitFile(t, dir, "b.txt", "b\n", "feature commit 2")
+	setup("checkout", "main")
+	commitFile(t, dir, "c.txt", "c\n", "main commit")
+	setup("checkout", "feature")
+
+	cfg := &cli.Config{
+		Mode:       "merge-base",
+		Base:       mergeBase,
+		BaseBranch: "main",
+		Host:       "localhost",
+		Port:       0,
+	}
+	srv := New(cfg, git.NewRepo(dir), nil, testAssets())
+
+	ts := httptest.NewServer(srv.Handler())
+	defer ts.Close()
+
+	resp, err := authGet(ts.URL+"/api/status", srv.token)
+	if err != nil {
+		t.Fatalf("GET /api/status: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", resp.StatusCode)
+	}
+	var status branchStatus
+	if err := json.NewDecoder(resp.Body).Decode(&status); err != nil {
+		t.Fatalf("decode JSON: %v", err)
+	}
+	want := branchStatus{Base: "main", Target: "HEAD", Ahead: 2, Behind: 1}
+	if status != want {
+		t.Errorf("expected %+v, got %+v", want, status)
+	}
+
+	resp, err = authGet(ts.URL+"/api/status?base=-x", srv.token)
+	if err != nil {
+		t.Fatalf("GET /api/status: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("expected status 400 for an invalid base, got %d", resp.StatusCode)
+	}
+}
+
+func TestAPIPutRange(t *testing.T) {
+	dir := initTestRepo(t)
+	cmd := exec.Command("git", "branch", "-M", "main")
+	cmd.Dir = dir
+	_, _ = cmd.CombinedOutput()
+
+	firstHash := commitFile(t, dir, "file.txt", "line1\n", "first commit")
+	secondHash := commitFile(t, dir, "file.txt", "line1\nline2\n", "second commit")
+	commitFile(t, dir, "file.txt", "line1\nline2\nline3\n", "third commit")
+
+	cfg := &cli.Config{
+		Mode:   "compare",
+		Base:   "HEAD~1",
+		Target: "HEAD",
+		Host:   "localhost",
+		Port:   0,
+	}
+	srv := New(cfg, git.NewRepo(dir), nil, testAssets())
+
+	ts := httptest.NewServer(srv.Handler())
+	defer ts.Close()
+
+	resp, err := authPut(ts.URL+"/api/range", srv.token, `{"base":"`+firstHash+`","target":"`+secondHash+`"}`)
+	if err != nil {
+		t.Fatalf("PUT /api/range: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", resp.StatusCode)
+	}
+
+	resp, err = authGet(ts.URL+"/api/range", srv.token)
+	if err != nil {
+		t.Fatalf("GET /api/range: %v", err)
+	}
+	var rng compareRange
+	err = json.NewDecoder(resp.Body).Decode(&rng)
+	resp.Body.Close()
+	if err != nil {
+		t.Fatalf("decode JSON: %v", err)
+	}
+	if rng.Base != firstHash || rng.Target != secondHash {
+		t.Errorf("expected range %s..%s, got %+v", firstHash, secondHash, rng)
+	}
+
+	// /api/diff without query params now uses first..second
+	resp, err = authGet(ts.URL+"/api/diff", srv.token)
+	if err != nil {
+		t.Fatalf("GET /api/diff: %v", err)
+	}
+	defer resp.Body.Close()
+
+	var result diff.Result
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		t.Fatalf("decode JSON: %v", err)
+	}
+	foundLine2 := false
+	foundLine3 := false
+	for _, f := range result.Files {
+		for _, h := range f.Hunks {
+			for _, l := range h.Lines {
+				if l.Type == "add" && l.Content == "line2" {
+					foundLine2 = true
+				}
+				if l.Type == "add" && l.Content == "line3" {
+					foundLine3 = true
+				}
+			}
+		}
+	}
+	if !foundLine2 {
+		t.Error("expected diff first..second to contain added line 'line2'")
+	}
+	if foundLine3 {
+		t.Error("expected diff first..second to NOT contain added line 'line3'")
+	}
+}
+
+func TestAPIPutRange_Rejects(t *testing.T) {
+	gitCfg := &cli.Config{Mode: "commit", Base: "HEAD", Host: "localhost"}
+	gitSrv := New(gitCfg, git.NewRepo(t.TempDir()), nil, testAssets())
+	stdinCfg := &cli.Config{Mode: "stdin", Host: "localhost"}
+	stdinSrv := New(stdinCfg, nil, &diff.Result{}, testAssets())
+
+	tests := []struct {
+		name string
+		srv  *Server
+		body string
+		want int
+	}{
+		{"flag-like base", gitSrv, `{"base":"--output=/tmp/evil"}`, http.StatusBadRequest},
+		{"flag-like target", gitSrv, `{"base":"HEAD","target":"-n"}`, http.StatusBadRequest},
+		{"missing base", gitSrv, `{"target":"HEAD"}`, http.StatusBadRequest},
+		{"invalid JSON", gitSrv, `{`, http.StatusBadRequest},
+		{"stdin mode", stdinSrv, `{"base":"HEAD"}`, http.StatusConflict},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ts := httptest.NewServer(tt.srv.Handler())
+			defer ts.Close()
+
+			resp, err := authPut(ts.URL+"/api/range", tt.srv.token, tt.body)
+			if err != nil {
+				t.Fatalf("PUT /api/range: %v", err)
+			}
+			resp.Body.Close()
+			if resp.StatusCode != tt.want {
+				t.Errorf("expected status %d, got %d", tt.want, resp.StatusCode)
+			}
+		})
+	}
+
+	// Without a token
+	ts := httptest.NewServer(gitSrv.Handler())
+	defer ts.Close()
+	resp, err := authPut(ts.URL+"/api/range", "wrong-token-value", `{"base":"HEAD"}`)
+	if err != nil {
+		t.Fatalf("PUT /api/range: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusForbidden {
+		t.Errorf("expected 403 with wrong token, got %d", resp.StatusCode)
+	}
+}
+
+func TestAPIDiffCommitParent(t *testing.T) {
+	dir := initTestRepo(t)
+	run := func(args ...string) {
+		t.Helper()
+		cmd := exec.Command("git", args...)
+		cmd.Dir = dir
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %v: %v\n%s", args, err, out)
+		}
+	}
+	run("branch", "-M", "main")
+	commitFile(t, dir, "README.md", "hello", "initial commit")
+	run("checkout", "-b", "feature")
+	commitFile(t, dir, "feature.txt", "feature work\n", "feature commit")
+	run("checkout", "main")
+	commitFile(t, dir, "main.txt", "main work\n", "main commit")
+	run("merge", "--no-ff", "-m", "merge feature", "feature")
+
+	cfg := &cli.Config{Mode: "merge-base", Host: "localhost"}
+	srv := New(cfg, git.NewRepo(dir), nil, testAssets())
+
+	ts := httptest.NewServer(srv.Handler())
+	defer ts.Close()
+
+	resp, err := authGet(ts.URL+"/api/diff?commit=HEAD&parent=2", srv.token)
+	if err != nil {
+		t.Fatalf("GET /api/diff?commit=HEAD&parent=2: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", resp.StatusCode)
+	}
+	var result diff.Result
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		t.Fatalf("decode JSON: %v", err)
+	}
+	if len(result.Files) != 1 || result.Files[0].NewName != "main.txt" {
+		t.Errorf("expected only main.txt against parent 2, got %+v", result.Files)
+	}
+
+	resp, err = authGet(ts.URL+"/api/diff?commit=HEAD&parent=3", srv.token)
+	if err != nil {
+		t.Fatalf("GET /api/diff?commit=HEAD&parent=3: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("expected 400 for out-of-range parent, got %d", resp.StatusCode)
+	}
+}
+
+func TestAPICommitFiles(t *testing.T) {
+	dir := initTestRepo(t)
+	commitFile(t, dir, "a.txt", "one\n", "initial commit")
+	if err := os.WriteFile(filepath.Join(dir, "a.txt"), []byte("one\ntwo\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	// commitFile commits b.txt along with the staged change to a.txt.
+	add := exec.Command("git", "add", "a.txt")
+	add.Dir = dir
+	if out, err := add.CombinedOutput(); err != nil {
+		t.Fatalf("git add: %v\n%s", err, out)
+	}
+	hash := commitFile(t, dir, "b.txt", "b\n", "second commit")
+
+	cfg := &cli.Config{Mode: "merge-base", Host: "localhost"}
+	srv := New(cfg, git.NewRepo(dir), nil, testAssets())
+
+	ts := httptest.NewServer(srv.Handler())
+	defer ts.Close()
+
+	resp, err := authGet(ts.URL+"/api/commit/"+hash+"/files", srv.token)
+	if err != nil {
+		t.Fatalf("GET /api/commit/{hash}/files: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", resp.StatusCode)
+	}
+	var files []changedFile
+	if err := json.NewDecoder(resp.Body).Decode(&files); err != nil {
+		t.Fatalf("decode JSON: %v", err)
+	}
+	// Two commits whose hashes share the prefix 29a5, which therefore
+	// doesn't name one of them.
+	for _, n := range []int{393, 501} {
+		cmd := exec.Command("git", "hash-object", "-t", "commit", "-w", "--stdin")
+		cmd.Dir = dir
+		cmd.Stdin = strings.NewReader(fmt.Sprintf("tree 4b825dc642cb6eb9a060e54bf8d69288fbee4904\nauthor A <a@example.com> 0 +0000\ncommitter A <a@example.com> 0 +0000\n\ncommit %d\n", n))
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git hash-object: %v\n%s", err, out)
+		}
+	}
+	want := []changedFile{
+		{Status: diff.StatusModified, Path: "a.txt", Additions: 1},
+		{Status: diff.StatusAdded, Path: "b.txt", Additions: 1},
+	}
+	if !slices.Equal(files, want) {
+		t.Errorf("expected %+v, got %+v", want, files)
+	}
+
+	for path, code := range map[string]int{
+		"/api/commit/HEAD/files":             http.StatusBadRequest,
+		"/api/commit/--all/files":            http.StatusBadRequest,
+		"/api/commit/" + hash[:7] + "/files": http.StatusOK,
+		"/api/commit/deadbeef/files":         http.StatusNotFound,
+		"/api/commit/29a5/files":             http.StatusBadRequest,
+	} {
+		resp, err := authGet(ts.URL+path, srv.token)
+		if err != nil {
+			t.Fatalf("GET %s: %v", path, err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != code {
+			t.Errorf("GET %s: expected status %d, got %d", path, code, resp.StatusCode)
+		}
+	}
+}
+
+func TestAPIDiffSoftTimeout(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("fake git is a shell script")
+	}
+	dir := initTestRepo(t)
+	commitFile(t, dir, "a.txt", "one\n", "first commit")
+	commitFile(t, dir, "a.txt", "two\n", "second commit")
+
+	// A git whose diffs and logs take seconds, running the real git
+	// otherwise.
+	real, err := exec.LookPath("git")
+	if err != nil {
+		t.Fatal(err)
+	}
+	bin := t.TempDir()
+	script := "#!/bin/sh\nif [ \"$1\" = diff ] || [ \"$1\" = log ]; then exec sleep 10; fi\nexec " + real + " \"$@\"\n"
+	if err := os.WriteFile(filepath.Join(bin, "git"), []byte(script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	cfg := &cli.Config{Mode: "compare", Base: "HEAD~1", Target: "HEAD", Host: "localhost", DiffSoftTimeout: 100 * time.Millisecond}
+	srv := New(cfg, git.NewRepo(dir), nil, testAssets())
+
+	ts := httptest.NewServer(srv.Handler())
+	defer ts.Close()
+
+	for _, path := range []string{"/api/diff", "/api/diff?commit=HEAD", "/api/diff?byCommit=1"} {
+		resp, err := authGet(ts.URL+path, srv.token)
+		if err != nil {
+			t.Fatalf("GET %s: %v", path, err)
+		}
+		var body diffTimeout
+		err = json.NewDecoder(resp.Body).Decode(&body)
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusServiceUnavailable {
+			t.Fatalf("GET %s: expected status 503, got %d", path, resp.StatusCode)
+		}
+		if err != nil {
+			t.Fatalf("GET %s: decode JSON: %v", path, err)
+		}
+		if !body.Timeout || !strings.Contains(body.Suggestion, "narrower range") {
+			t.Errorf("GET %s: expected a timeout with a suggestion, got %+v", path, body)
+		}
+	}
+}
+
+func TestAPIDiffWorktreeTarget(t *testing.T) {
+	dir := initTestRepo(t)
+	commitFile(t, dir, "file.txt", "one\n", "first commit")
+	commitFile(t, dir, "file.txt", "one\ntwo\n", "second commit")
+	if err := os.WriteFile(filepath.Join(dir, "file.txt"), []byte("one\ntwo\nthree\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	// The command line's range ends at HEAD, not the working tree.
+	cfg := &cli.Config{Mode: "compare", Base: "HEAD~1", Target: "HEAD", Host: "localhost"}
+	srv := New(cfg, git.NewRepo(dir), nil, testAssets())
+
+	ts := httptest.NewServer(srv.Handler())
+	defer ts.Close()
+
+	resp, err := authGet(ts.URL+"/api/diff?base=HEAD&target=WORKTREE", srv.token)
+	if err != nil {
+		t.Fatalf("GET /api/diff: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", resp.StatusCode)
+	}
+	var result diff.Result
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if len(result.Files) != 1 || result.Files[0].Additions != 1 {
+		t.Fatalf("expected one file with one addition, got %+v", result.Files)
+	}
+	var added []string
+	for _, line := range result.Files[0].Hunks[0].Lines {
+		if line.Type == "add" {
+			added = append(added, line.Content)
+		}
+	}
+	if !slices.Equal(added, []string{"three"}) {
+		t.Errorf("expected the working tree's added line, got %q", added)
+	}
+
+	// There is no working tree behind a diff read from stdin.
+	stdinSrv := New(&cli.Config{Mode: "stdin", Host: "localhost"}, nil, &diff.Result{}, testAssets())
+	ts2 := httptest.NewServer(stdinSrv.Handler())
+	defer ts2.Close()
+	resp2, err := authGet(ts2.URL+"/api/diff?target=WORKTREE", stdinSrv.token)
+	if err != nil {
+		t.Fatalf("GET /api/diff: %v", err)
+	}
+	resp2.Body.Close()
+	if resp2.StatusCode != http.StatusConflict {
+		t.Errorf("expected status 409 in stdin mode, got %d", resp2.StatusCode)
+	}
+}
+
+func TestAPIDiffDebug(t *testing.T) {
+	dir := initTestRepo(t)
+	commitFile(t, dir, "file.txt", "one\n", "first commit")
+	commitFile(t, dir, "file.txt", "one\ntwo\n", "second commit")
+
+	tests := []struct {
+		host, query string
+		debug       bool
+	}{
+		{"localhost", "?debug=1", true},
+		{"localhost", "", false},
+		{"0.0.0.0", "?debug=1", false},
+	}
+	for _, tt := range tests {
+		cfg := &cli.Config{Mode: "compare", Base: "HEAD~1", Target: "HEAD", Host: tt.host}
+		srv := New(cfg, git.NewRepo(dir), nil, testAssets())
+		ts := httptest.NewServer(srv.Handler())
+
+		resp, err := authGet(ts.URL+"/api/diff"+tt.query, srv.token)
+		if err != nil {
+			t.Fatalf("GET /api/diff%s: %v", tt.query, err)
+		}
+		var body map[string]json.RawMessage
+		err = json.NewDecoder(resp.Body).Decode(&body)
+		resp.Body.Close()
+		ts.Close()
+		if err != nil {
+			t.Fatalf("decode: %v", err)
+		}
+
+		raw, ok := body["_debug"]
+		if ok != tt.debug {
+			t.Errorf("host %s, query %q: expected _debug present=%v, got %s", tt.host, tt.query, tt.debug, raw)
+			continue
+		}
+		if !ok {
+			continue
+		}
+		var debug diff.Debug
+		if err := json.Unmarshal(raw, &debug); err != nil {
+			t.Fatalf("decode _debug: %v", err)
+		}
+		if !strings.HasPrefix(debug.Command, "git diff ") || !strings.Contains(debug.Command, "HEAD~1 HEAD") {
+			t.Errorf("expected the git diff command, got %q", debug.Command)
+		}
+	}
+}
+
+func TestAPIDiffStatus(t *testing.T) {
+	dir := initTestRepo(t)
+	run := func(args ...string) {
+		t.Helper()
+		cmd := exec.Command("git", args...)
+		cmd.Dir = dir
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %v: %v\n%s", args, err, out)
+		}
+	}
+	commitFile(t, dir, "kept.txt", "one\n", "first commit")
+	base := commitFile(t, dir, "gone.txt", "bye\n", "second commit")
+	commitFile(t, dir, "kept.txt", "two\n", "modify kept.txt")
+	commitFile(t, dir, "new.txt", "hello\n", "add new.txt")
+	run("rm", "-q", "gone.txt")
+	run("commit", "-q", "-m", "delete gone.txt")
+
+	cfg := &cli.Config{Mode: "compare", Base: base, Target: "HEAD", Host: "localhost"}
+	srv := New(cfg, git.NewRepo(dir), nil, testAssets())
+
+	ts := httptest.NewServer(srv.Handler())
+	defer ts.Close()
+
+	resp, err := authGet(ts.URL+"/api/diff?status=added", srv.token)
+	if err != nil {
+		t.Fatalf("GET /api/diff?status=added: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", resp.StatusCode)
+	}
+	var result diff.Result
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		t.Fatalf("decode JSON: %v", err)
+	}
+	if len(result.Files) != 1 || result.Files[0].NewName != "new.txt" || result.Files[0].Status != "added" {
+		t.Errorf("expected only the added new.txt, got %+v", result.Files)
+	}
+
+	// Stdin mode filters the pre-parsed diff instead of asking git.
+	raw, err := git.NewRepo(dir).GetDiff(base, "HEAD", git.DiffOptions{})
+	if err != nil {
+		t.Fatalf("GetDiff: %v", err)
+	}
+	parsed, err := diff.Parse(raw)
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	srv.SetStdinDiff(parsed)
+	resp, err = authGet(ts.URL+"/api/diff?status=added", srv.token)
+	if err != nil {
+		t.Fatalf("GET /api/diff?status=added in stdin mode: %v", err)
+	}
+	defer resp.Body.Close()
+	result = diff.Result{}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		t.Fatalf("decode JSON: %v", err)
+	}
+	if len(result.Files) != 1 || result.Files[0].NewName != "new.txt" {
+		t.Errorf("expected only new.txt in stdin mode, got %+v", result.Files)
+	}
+
+	resp, err = authGet(ts.URL+"/api/diff?status=copied", srv.token)
+	if err != nil {
+		t.Fatalf("GET /api/diff?status=copied: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("expected 400 for unknown status, got %d", resp.StatusCode)
+	}
+}
+
+func TestAPIDiffMarkdown(t *testing.T) {
+	dir := initTestRepo(t)
+	base := commitFile(t, dir, "file.txt", "line1\nline2\n", "first commit")
+	commitFile(t, dir, "file.txt", "line1\nchanged\n", "second commit")
+	commitFile(t, dir, "main.go", "package main\n", "third commit")
+
+	cfg := &cli.Config{Mode: "compare", Base: base, Target: "HEAD", Host: "localhost"}
+	srv := New(cfg, git.NewRepo(dir), nil, testAssets())
+
+	ts := httptest.NewServer(srv.Handler())
+	defer ts.Close()
+
+	resp, err := http.Get(ts.URL + "/api/diff/markdown")
+	if err != nil {
+		t.Fatalf("GET /api/diff/markdown without token: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusForbidden {
+		t.Errorf("expected 403 without token, got %d", resp.StatusCode)
+	}
+
+	resp, err = authGet(ts.URL+"/api/diff/markdown", srv.token)
+	if err != nil {
+		t.Fatalf("GET /api/diff/markdown: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", resp.StatusCode)
+	}
+	if ct := resp.Header.Get("Content-Type"); !strings.HasPrefix(ct, "text/markdown") {
+		t.Errorf("expected markdown content type, got %q", ct)
+	}
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("read body: %v", err)
+	}
+	md := string(body)
+	if n := strings.Count(md, "```diff\n"); n != 2 {
+		t.Errorf("expected 2 fenced diff blocks, got %d:\n%s", n, md)
+	}
+	for _, want := range []string{"**`file.txt`**", "**`main.go`**", "-line2\n+changed\n", "+package main\n"} {
+		if !strings.Contains(md, want) {
+			t.Errorf("expected markdown to contain %q:\n%s", want, md)
+		}
+	}
+}
+
+func TestAPIDiffFilePages(t *testing.T) {
+	dir := initTestRepo(t)
+	base := commitFile(t, dir, "README", "readme\n", "first commit")
+	for _, name := range []string{"a.txt", "b.txt", "c.txt", "d.txt"} {
+		commitFile(t, dir, name, name+"\n", "add "+name)
+	}
+
+	cfg := &cli.Config{Mode: "compare", Base: base, Target: "HEAD", Host: "localhost", SortBy: "path"}
+	srv := New(cfg, git.NewRepo(dir), nil, testAssets())
+
+	ts := httptest.NewServer(srv.Handler())
+	defer ts.Close()
+
+	// The summary pages the same way as the full diff.
+	for _, query := range []string{"fileOffset=1&fileLimit=2", "fileOffset=1&fileLimit=2&summary=1"} {
+		resp, err := authGet(ts.URL+"/api/diff?"+query, srv.token)
+		if err != nil {
+			t.Fatalf("GET /api/diff?%s: %v", query, err)
+		}
+		var result diff.Result
+		err = json.NewDecoder(resp.Body).Decode(&result)
+		resp.Body.Close()
+		if err != nil {
+			t.Fatalf("decode JSON: %v", err)
+		}
+		var names []string
+		for _, f := range result.Files {
+			names = append(names, f.NewName)
+		}
+		if !slices.Equal(names, []string{"b.txt", "c.txt"}) || result.TotalFiles != 4 {
+			t.Errorf("%s: expected b.txt and c.txt of 4 files, got %v of %d", query, names, result.TotalFiles)
+		}
+	}
+
+	for _, query := range []string{"fileOffset=-1", "fileLimit=0", "fileLimit=x"} {
+		resp, err := authGet(ts.URL+"/api/diff?"+query, srv.token)
+		if err != nil {
+			t.Fatalf("GET /api/diff?%s: %v", query, err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusBadRequest {
+			t.Errorf("%s: expected status 400, got %d", query, resp.StatusCode)
+		}
+	}
+}
+
+func TestAPIDiffStat(t *testing.T) {
+	dir := initTestRepo(t)
+	commitFile(t, dir, "file.txt", "one\n", "first commit")
+	commitFile(t, dir, "file.txt", "one\ntwo\n", "second commit")
+
+	cfg := &cli.Config{Mode: "compare", Base: "HEAD~1", Target: "HEAD", Host: "localhost"}
+	srv := New(cfg, git.NewRepo(dir), nil, testAssets())
+
+	ts := httptest.NewServer(srv.Handler())
+	defer ts.Close()
+
+	resp, err := http.Get(ts.URL + "/api/diff/stat")
+	if err != nil {
+		t.Fatalf("GET /api/diff/stat: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusForbidden {
+		t.Errorf("expected status 403 without token, got %d", resp.StatusCode)
+	}
+
+	resp, err = authGet(ts.URL+"/api/diff/stat", srv.token)
+	if err != nil {
+		t.Fatalf("GET /api/diff/stat: %v", err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("read body: %v", err)
+	}
+	if ct := resp.Header.Get("Content-Type"); !strings.HasPrefix(ct, "text/plain") {
+		t.Errorf("expected Content-Type text/plain, got %q", ct)
+	}
+	if !strings.Contains(string(body), "file.txt | 1 +") {
+		t.Errorf("expected a stat line for file.txt, got:\n%s", body)
+	}
+}
+
+func TestAPIDiffRaw(t *testing.T) {
+	dir := initTestRepo(t)
+	commitFile(t, dir, "file.txt", "one\n", "first commit")
+	commitFile(t, dir, "file.txt", "one\ntwo\n", "second commit")
+
+	cfg := &cli.Config{Mode: "compare", Base: "HEAD~1", Target: "HEAD", Host: "localhost"}
+	srv := New(cfg, git.NewRepo(dir), nil, testAssets())
+
+	ts := httptest.NewServer(srv.Handler())
+	defer ts.Close()
+
+	resp, err := http.Get(ts.URL + "/api/diff/raw")
+	if err != nil {
+		t.Fatalf("GET /api/diff/raw: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusForbidden {
+		t.Errorf("expected status 403 without token, got %d", resp.StatusCode)
+	}
+
+	resp, err = authGet(ts.URL+"/api/diff/raw", srv.token)
+	if err != nil {
+		t.Fatalf("GET /api/diff/raw: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", resp.StatusCode)
+	}
+	var entries []git.RawEntry
+	if err := json.NewDecoder(resp.Body).Decode(&entries); err != nil {
+		t.Fatalf("decode JSON: %v", err)
+	}
+	if len(entries) != 1 || entries[0].Path != "file.txt" || entries[0].Status != "M" || len(entries[0].NewSHA) != 40 {
+		t.Errorf("expected one modified file.txt with a full object ID, got %+v", entries)
+	}
+}
+
+func TestAPIDiffMaxHunks(t *testing.T) {
+	dir := initTestRepo(t)
+	var before, after strings.Builder
+	for i := 1; i <= 50; i++ {
+		fmt.Fprintf(&before, "line %d\n", i)
+		// Changes 10 lines apart land in separate hunks.
+		if i%10 == 5 {
+			fmt.Fprintf(&after, "changed %d\n", i)
+		} else {
+			fmt.Fprintf(&after, "line %d\n", i)
+		}
+	}
+	base := commitFile(t, dir, "many.txt", before.String(), "first commit")
+	commitFile(t, dir, "many.txt", after.String(), "second commit")
+
+	cfg := &cli.Config{Mode: "compare", Base: base, Target: "HEAD", Host: "localhost"}
+	srv := New(cfg, git.NewRepo(dir), nil, testAssets())
+
+	ts := httptest.NewServer(srv.Handler())
+	defer ts.Close()
+
+	resp, err := authGet(ts.URL+"/api/diff?maxHunks=2", srv.token)
+	if err != nil {
+		t.Fatalf("GET /api/diff?maxHunks=2: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", resp.StatusCode)
+	}
+	var result diff.Result
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		t.Fatalf("decode JSON: %v", err)
+	}
+	if len(result.Files) != 1 {
+		t.Fatalf("expected 1 file, got %d", len(result.Files))
+	}
+	f := result.Files[0]
+	if len(f.Hunks) != 2 || f.TruncatedHunks != 3 {
+		t.Errorf("expected 2 hunks with 3 truncated, got %d with %d truncated", len(f.Hunks), f.TruncatedHunks)
+	}
+	if f.Additions != 5 || f.Deletions != 5 {
+		t.Errorf("expected counts for the whole file, got +%d -%d", f.Additions, f.Deletions)
+	}
+
+	// Against the working tree, a truncated file doesn't count the lines
+	// after its last hunk, which is not the one sent.
+	for _, tt := range []struct {
+		query    string
+		trailing bool
+	}{{"", true}, {"&maxHunks=2", false}} {
+		resp, err := authGet(ts.URL+"/api/diff?target=WORKTREE"+tt.query, srv.token)
+		if err != nil {
+			t.Fatalf("GET /api/diff?target=WORKTREE%s: %v", tt.query, err)
+		}
+		var result diff.Result
+		err = json.NewDecoder(resp.Body).Decode(&result)
+		resp.Body.Close()
+		if err != nil {
+			t.Fatalf("decode JSON: %v", err)
+		}
+		if len(result.Files) != 1 || (result.Files[0].TrailingLines != nil) != tt.trailing {
+			t.Errorf("target=WORKTREE%s: expected trailing lines %v, got %+v", tt.query, tt.trailing, result.Files)
+		}
+	}
+
+	resp, err = authGet(ts.URL+"/api/diff?maxHunks=0", srv.token)
+	if err != nil {
+		t.Fatalf("GET /api/diff?maxHunks=0: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("expected 400 for maxHunks=0, got %d", resp.StatusCode)
+	}
+}
+
+func TestHostHeaderCheck(t *testing.T) {
+	cfg := &cli.Config{
+		Mode: "stdin",
+		Host: "localhost",
+		Port: 8123,
+	}
+	srv := New(cfg, nil, &diff.Result{}, testAssets())
+	handler := srv.Handler()
+
+	tests := []struct {
+		host string
+		want int
+	}{
+		{"localhost:8123", http.StatusOK},
+		{"127.0.0.1:8123", http.StatusOK},
+		{"[::1]:8123", http.StatusOK},
+		{"evil.example.com:8123", http.StatusMisdirectedRequest},
+		{"localhost.evil.example.com:8123", http.StatusMisdirectedRequest},
+		{"localhost:9999", http.StatusMisdirectedRequest},
+		{"evil.example.com", http.StatusMisdirectedRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.host, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/api/diff", http.NoBody)
+			req.Host = tt.host
+			req.Header.Set("X-Auth-Token", srv.token)
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+			if rec.Code != tt.want {
+				t.Errorf("Host %q: expected %d, got %d", tt.host, tt.want, rec.Code)
+			}
+		})
+	}
+}
+
+func TestHostHeaderCheck_Unspecified(t *testing.T) {
+	cfg := &cli.Config{
+		Mode: "stdin",
+		Host: "0.0.0.0",
+		Port: 8123,
+	}
+	srv := New(cfg, nil, &diff.Result{}, testAssets())
+	handler := srv.Handler()
+
+	for host, want := range map[string]int{
+		"192.168.1.10:8123":     http.StatusOK,
+		"evil.example.com:8123": http.StatusMisdirectedRequest,
+	} {
+		req := httptest.NewRequest("GET", "/", http.NoBody)
+		req.Host = host
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		if rec.Code != want {
+			t.Errorf("Host %q: expected %d, got %d", host, want, rec.Code)
+		}
+	}
+}
+
+func TestAPIRejectsCrossSite(t *testing.T) {
+	cfg := &cli.Config{
+		Mode: "stdin",
+		Host: "localhost",
+		Port: 8123,
+	}
+	srv := New(cfg, nil, &diff.Result{}, testAssets())
+	handler := srv.Handler()
+
+	tests := []struct {
+		name    string
+		headers map[string]string
+		want    int
+	}{
+		{"no origin headers", nil, http.StatusOK},
+		{"same origin", map[string]string{"Origin": "http://localhost:8123", "Sec-Fetch-Site": "same-origin"}, http.StatusOK},
+		{"foreign origin", map[string]string{"Origin": "http://evil.example.com"}, http.StatusForbidden},
+		{"cross-site fetch", map[string]string{"Sec-Fetch-Site": "cross-site"}, http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/api/diff", http.NoBody)
+			req.Host = "localhost:8123"
+			req.Header.Set("X-Auth-Token", srv.token)
+			for k, v := range tt.headers {
+				req.Header.Set(k, v)
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+			if rec.Code != tt.want {
+				t.Errorf("expected %d, got %d", tt.want, rec.Code)
+			}
+		})
+	}
+}
+
+func TestAPIRangeDiff(t *testing.T) {
+	dir := initTestRepo(t)
+	run := func(args ...string) {
+		t.Helper()
+		cmd := exec.Command("git", args...)
+		cmd.Dir = dir
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %v: %v\n%s", args, err, out)
+		}
+	}
+	run("branch", "-M", "main")
+	commitFile(t, dir, "README.md", "hello", "initial commit")
+	run("checkout", "-b", "v1")
+	commitFile(t, dir, "a.txt", "a\n", "add a")
+	run("checkout", "-b", "v2", "main")
+	commitFile(t, dir, "a.txt", "a\n", "add a")
+	commitFile(t, dir, "b.txt", "b\n", "add b")
+
+	cfg := &cli.Config{
+		Mode:   "range-diff",
+		Base:   "main..v1",
+		Target: "main..v2",
+		Host:   "localhost",
+	}
+	srv := New(cfg, git.NewRepo(dir), nil, testAssets())
+
+	ts := httptest.NewServer(srv.Handler())
+	defer ts.Close()
+
+	resp, err := authGet(ts.URL+"/api/range-diff", srv.token)
+	if err != nil {
+		t.Fatalf("GET /api/range-diff: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		t.Fatalf("expected status 200, got %d: %s", resp.StatusCode, body)
+	}
+
+	var result diff.RangeDiff
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		t.Fatalf("decode JSON: %v", err)
+	}
+	if len(result.Pairs) != 2 {
+		t.Fatalf("expected 2 commit pairs, got %+v", result.Pairs)
+	}
+	if result.Pairs[0].Status != "unchanged" || result.Pairs[1].Status != "added" {
+		t.Errorf("expected unchanged then added, got %q and %q", result.Pairs[0].Status, result.Pairs[1].Status)
+	}
+}
+
+func TestAPIFileImage(t *testing.T) {
+	dir := initTestRepo(t)
+	cmd := exec.Command("git", "branch", "-M", "main")
+	cmd.Dir = dir
+	_, _ = cmd.CombinedOutput()
+
+	// Minimal PNG signature plus a few bytes, including a NUL
+	oldPNG := "\x89PNG\r\n\x1a\n\x00old"
+	newPNG := "\x89PNG\r\n\x1a\n\x00new"
+	commitFile(t, dir, "logo.png", oldPNG, "add logo")
+	commitFile(t, dir, "logo.png", newPNG, "update logo")
+
+	cfg := &cli.Config{
+		Mode:   "compare",
+		Base:   "HEAD~1",
+		Target: "HEAD",
+		Host:   "localhost",
+	}
+	srv := New(cfg, git.NewRepo(dir), nil, testAssets())
+
+	ts := httptest.NewServer(srv.Handler())
+	defer ts.Close()
+
+	for ref, want := range map[string]string{"old": oldPNG, "new": newPNG} {
+		resp, err := authGet(ts.URL+"/api/file?path=logo.png&ref="+ref, srv.token)
+		if err != nil {
+			t.Fatalf("GET /api/file ref=%s: %v", ref, err)
+		}
+		body, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			t.Fatalf("read body: %v", err)
+		}
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("ref=%s: expected status 200, got %d: %s", ref, resp.StatusCode, body)
+		}
+		if ct := resp.Header.Get("Content-Type"); ct != "image/png" {
+			t.Errorf("ref=%s: expected Content-Type image/png, got %q", ref, ct)
+		}
+		if string(body) != want {
+			t.Errorf("ref=%s: got bytes %q, want %q", ref, body, want)
+		}
+	}
+}
+
+func TestAPIBlame(t *testing.T) {
+	dir := initTestRepo(t)
+	first := commitFile(t, dir, "file.txt", "one\ntwo\nthree\n", "add file")
+	second := commitFile(t, dir, "file.txt", "one\nTWO\nthree\n", "shout two")
+
+	cfg := &cli.Config{Mode: "compare", Base: "HEAD~1", Target: "HEAD", Host: "localhost"}
+	srv := New(cfg, git.NewRepo(dir), nil, testAssets())
+
+	ts := httptest.NewServer(srv.Handler())
+	defer ts.Close()
+
+	resp, err := authGet(ts.URL+"/api/blame?path=file.txt&start=1&end=2", srv.token)
+	if err != nil {
+		t.Fatalf("GET /api/blame: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", resp.StatusCode)
+	}
+	var lines []git.BlameLine
+	if err := json.NewDecoder(resp.Body).Decode(&lines); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if len(lines) != 2 || lines[0].Hash != first || lines[1].Hash != second {
+		t.Errorf("expected lines 1-2 from %s and %s, got %+v", first, second, lines)
+	}
+
+	for _, query := range []string{"start=1&end=2", "path=file.txt&start=x&end=2", "path=file.txt&start=3&end=2"} {
+		resp, err := authGet(ts.URL+"/api/blame?"+query, srv.token)
+		if err != nil {
+			t.Fatalf("GET /api/blame?%s: %v", query, err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusBadRequest {
+			t.Errorf("GET /api/blame?%s: expected status 400, got %d", query, resp.StatusCode)
+		}
+	}
+}
+
+func TestAPIFileSide(t *testing.T) {
+	dir := initTestRepo(t)
+	commitFile(t, dir, "old.txt", "a\nb\nc\nd\ne\n", "add old.txt")
+	cmd := exec.Command("git", "mv", "old.txt", "new.txt")
+	cmd.Dir = dir
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("git mv: %v\n%s", err, out)
+	}
+	commitFile(t, dir, "new.txt", "a\nb\nc\nd\nE\n", "rename and edit")
+
+	cfg := &cli.Config{Mode: "compare", Base: "HEAD~1", Target: "HEAD", Host: "localhost"}
+	srv := New(cfg, git.NewRepo(dir), nil, testAssets())
+
+	ts := httptest.NewServer(srv.Handler())
+	defer ts.Close()
+
+	for side, want := range map[string]string{"old": "a\nb\nc\nd\ne\n", "new": "a\nb\nc\nd\nE\n"} {
+		resp, err := authGet(ts.URL+"/api/file?path=new.txt&side="+side, srv.token)
+		if err != nil {
+			t.Fatalf("GET /api/file side=%s: %v", side, err)
+		}
+		body, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			t.Fatalf("read body: %v", err)
+		}
+		if resp.StatusCode != http.StatusOK || string(body) != want {
+			t.Errorf("side=%s: got %d %q, want %q", side, resp.StatusCode, body, want)
+		}
+	}
+
+	for _, query := range []string{"path=new.txt&side=both", "path=new.txt&side=old&ref=old"} {
+		resp, err := authGet(ts.URL+"/api/file?"+query, srv.token)
+		if err != nil {
+			t.Fatalf("GET /api/file?%s: %v", query, err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusBadRequest {
+			t.Errorf("%s: expected status 400, got %d", query, resp.StatusCode)
+		}
+	}
+}
+
+func TestAPIFileRejectsEscapingPath(t *testing.T) {
+	dir := initTestRepo(t)
+	commitFile(t, dir, "a.txt", "a", "first commit")
+
+	cfg := &cli.Config{Mode: "commit", Base: "HEAD", Host: "localhost"}
+	srv := New(cfg, git.NewRepo(dir), nil, testAssets())
+
+	ts := httptest.NewServer(srv.Handler())
+	defer ts.Close()
+
+	for _, path := range []string{"../secret", "/etc/passwd"} {
+		resp, err := authGet(ts.URL+"/api/file?path="+path, srv.token)
+		if err != nil {
+			t.Fatalf("GET /api/file: %v", err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode == http.StatusOK {
+			t.Errorf("path %q: expected rejection, got 200", path)
+		}
+	}
+}
+
+func TestAPIDiffSummary(t *testing.T) {
+	dir := initTestRepo(t)
+	cmd := exec.Command("git", "branch", "-M", "main")
+	cmd.Dir = dir
+	_, _ = cmd.CombinedOutput()
+
+	firstHash := commitFile(t, dir, "file.txt", "line1\nline2\n", "first commit")
+	commitFile(t, dir, "file.txt", "line1\nchanged\nline3\n", "second commit")
+	commitFile(t, dir, "main.go", "package main\n", "third commit")
+
+	cfg := &cli.Config{
+		Mode:   "compare",
+		Base:   firstHash,
+		Target: "HEAD",
+		Host:   "localhost",
+	}
+	srv := New(cfg, git.NewRepo(dir), nil, testAssets())
+
+	ts := httptest.NewServer(srv.Handler())
+	defer ts.Close()
+
+	resp, err := authGet(ts.URL+"/api/diff?summary=1", srv.token)
+	if err != nil {
+		t.Fatalf("GET /api/diff?summary=1: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		t.Fatalf("expected status 200, got %d: %s", resp.StatusCode, body)
+	}
+
+	var result diff.Result
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		t.Fatalf("decode JSON: %v", err)
+	}
+	if len(result.Files) != 2 {
+		t.Fatalf("expected 2 files, got %+v", result.Files)
+	}
+	for _, f := range result.Files {
+		if len(f.Hunks) != 0 {
+			t.Errorf("%s: expected no hunks in summary, got %d", f.Path(), len(f.Hunks))
+		}
+	}
+
+	file, goFile := result.Files[0], result.Files[1]
+	if file.NewName != "file.txt" || file.Status != "modified" || file.Additions != 2 || file.Deletions != 1 {
+		t.Errorf("unexpected summary for file.txt: %+v", file)
+	}
+	if goFile.NewName != "main.go" || goFile.Status != "added" || goFile.Additions != 1 || goFile.Language != "go" {
+		t.Errorf("unexpected summary for main.go: %+v", goFile)
+	}
+}
+
+func TestAPIHistory(t *testing.T) {
+	dir := initTestRepo(t)
+	base := commitFile(t, dir, "README.md", "hello", "initial commit")
+	commitFile(t, dir, "foo.go", "v1\n", "add foo")
+	commitFile(t, dir, "other.txt", "x\n", "unrelated")
+	commitFile(t, dir, "foo.go", "v2\n", "update foo")
+
+	cfg := &cli.Config{
+		Mode:   "history",
+		Base:   base,
+		Target: "HEAD",
+		Path:   "foo.go",
+		Host:   "localhost",
+	}
+	srv := New(cfg, git.NewRepo(dir), nil, testAssets())
+
+	ts := httptest.NewServer(srv.Handler())
+	defer ts.Close()
+
+	resp, err := authGet(ts.URL+"/api/history", srv.token)
+	if err != nil {
+		t.Fatalf("GET /api/history: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		t.Fatalf("expected status 200, got %d: %s", resp.StatusCode, body)
+	}
+
+	var result diff.Log
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		t.Fatalf("decode JSON: %v", err)
+	}
+	if len(result.Commits) != 2 {
+		t.Fatalf("expected 2 commits touching foo.go, got %+v", result.Commits)
+	}
+	if result.Commits[0].Subject != "update foo" || result.Commits[1].Subject != "add foo" {
+		t.Errorf("expected update foo then add foo, got %q and %q", result.Commits[0].Subject, result.Commits[1].Subject)
+	}
+	for _, c := range result.Commits {
+		if len(c.Files) != 1 || c.Files[0].NewName != "foo.go" {
+			t.Errorf("commit %q: expected only foo.go, got %+v", c.Subject, c.Files)
+		}
+	}
+}
+
+func TestSetSeries_Only(t *testing.T) {
+	cfg := &cli.Config{Mode: "mbox", Only: []string{"go"}, Host: "localhost"}
+	srv := New(cfg, nil, &diff.Result{}, testAssets())
+	srv.SetSeries(&diff.Log{Commits: []diff.CommitDiff{{
+		Subject: "change both",
+		Files: []diff.FileDiff{
+			{OldName: "a.txt", NewName: "a.txt", Status: diff.StatusModified},
+			{OldName: "b.go", NewName: "b.go", Status: diff.StatusModified},
+		},
+	}}})
+
+	ts := httptest.NewServer(srv.Handler())
+	defer ts.Close()
+
+	resp, err := authGet(ts.URL+"/api/history", srv.token)
+	if err != nil {
+		t.Fatalf("GET /api/history: %v", err)
+	}
+	defer resp.Body.Close()
+	var result diff.Log
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		t.Fatalf("decode JSON: %v", err)
+	}
+	if len(result.Commits) != 1 {
+		t.Fatalf("expected 1 commit, got %+v", result.Commits)
+	}
+	if files := result.Commits[0].Files; len(files) != 1 || files[0].NewName != "b.go" {
+		t.Errorf("expected only b.go, got %+v", files)
+	}
+}
+
+func TestAPIDiffByCommit(t *testing.T) {
+	dir := initTestRepo(t)
+	base := commitFile(t, dir, "a.txt", "one\n", "initial commit")
+	commitFile(t, dir, "a.txt", "two\n", "change a")
+	commitFile(t, dir, "b.txt", "b\n", "add b")
+
+	cfg := &cli.Config{Mode: "compare", Base: base, Target: "HEAD", Host: "localhost"}
+	srv := New(cfg, git.NewRepo(dir), nil, testAssets())
+
+	ts := httptest.NewServer(srv.Handler())
+	defer ts.Close()
+
+	resp, err := authGet(ts.URL+"/api/diff?byCommit=1", srv.token)
+	if err != nil {
+		t.Fatalf("GET /api/diff?byCommit=1: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		t.Fatalf("expected status 200, got %d: %s", resp.StatusCode, body)
+	}
+	var result diff.Log
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		t.Fatalf("decode JSON: %v", err)
+	}
+	if len(result.Commits) != 2 {
+		t.Fatalf("expected 2 commits, got %+v", result.Commits)
+	}
+	for i, want := range []struct{ subject, file string }{{"change a", "a.txt"}, {"add b", "b.txt"}} {
+		c := result.Commits[i]
+		if c.Subject != want.subject || len(c.Files) != 1 || c.Files[0].NewName != want.file {
+			t.Errorf("commit %d: expected %q changing only %s, got %q with %+v", i, want.subject, want.file, c.Subject, c.Files)
+		}
+	}
+
+	// ?status= keeps only the commits and files with those statuses.
+	resp, err = authGet(ts.URL+"/api/diff?byCommit=1&status=added", srv.token)
+	if err != nil {
+		t.Fatalf("GET /api/diff?byCommit=1&status=added: %v", err)
+	}
+	result = diff.Log{}
+	err = json.NewDecoder(resp.Body).Decode(&result)
+	resp.Body.Close()
+	if err != nil {
+		t.Fatalf("decode JSON: %v", err)
+	}
+	if len(result.Commits) != 1 || result.Commits[0].Subject != "add b" {
+		t.Errorf("expected only the commit adding b.txt, got %+v", result.Commits)
+	}
+	resp, err = authGet(ts.URL+"/api/diff?byCommit=1&status=bogus", srv.token)
+	if err != nil {
+		t.Fatalf("GET /api/diff?byCommit=1&status=bogus: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("expected status 400 for an invalid status, got %d", resp.StatusCode)
+	}
+
+	// Only compare mode compares a range of commits.
+	cfg.Mode = "working"
+	resp, err = authGet(ts.URL+"/api/diff?byCommit=1", srv.token)
+	if err != nil {
+		t.Fatalf("GET /api/diff?byCommit=1: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusConflict {
+		t.Errorf("expected status 409 outside compare mode, got %d", resp.StatusCode)
+	}
+}
+
+func TestAPIGraph(t *testing.T) {
+	dir := initTestRepo(t)
+	run := func(args ...string) {
+		t.Helper()
+		cmd := exec.Command("git", args...)
+		cmd.Dir = dir
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %v: %v\n%s", args, err, out)
+		}
+	}
+	commitFile(t, dir, "a.txt", "a\n", "first commit")
+	run("checkout", "-q", "-b", "feature")
+	commitFile(t, dir, "f.txt", "f\n", "feature commit")
+	run("checkout", "-q", "-")
+	commitFile(t, dir, "m.txt", "m\n", "main commit")
+	run("merge", "-q", "--no-ff", "-m", "merge feature", "feature")
+
+	cfg := &cli.Config{Mode: "working", Base: "HEAD", Host: "localhost"}
+	srv := New(cfg, git.NewRepo(dir), nil, testAssets())
+
+	ts := httptest.NewServer(srv.Handler())
+	defer ts.Close()
+
+	resp, err := authGet(ts.URL+"/api/graph", srv.token)
+	if err != nil {
+		t.Fatalf("GET /api/graph: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		t.Fatalf("expected status 200, got %d: %s", resp.StatusCode, body)
+	}
+	var nodes []graph.Node
+	if err := json.NewDecoder(resp.Body).Decode(&nodes); err != nil {
+		t.Fatalf("decode JSON: %v", err)
+	}
+	if len(nodes) != 4 {
+		t.Fatalf("expected 4 commits, got %+v", nodes)
+	}
+	lanes := map[string]int{}
+	for _, n := range nodes {
+		lanes[n.Message] = n.Lane
+	}
+	if lanes["merge feature"] != 0 || lanes["first commit"] != 0 || lanes["feature commit"] == lanes["main commit"] {
+		t.Errorf("expected the merged branches in two lanes over lane 0, got %v", lanes)
+	}
+	if len(nodes[0].Parents) != 2 {
+		t.Errorf("expected the merge first with two parents, got %+v", nodes[0])
+	}
+
+	resp, err = authGet(ts.URL+"/api/graph?n=0", srv.token)
+	if err != nil {
+		t.Fatalf("GET /api/graph?n=0: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("expected status 400 for n=0, got %d", resp.StatusCode)
+	}
+}
+
+func TestAPIDiffSplitHunks(t *testing.T) {
+	dir := initTestRepo(t)
+	var before strings.Builder
+	for i := 1; i <= 30; i++ {
+		fmt.Fprintf(&before, "line %d\n", i)
+	}
+	commitFile(t, dir, "file.txt", before.String(), "first commit")
+	write := func(first, last string) {
+		t.Helper()
+		content := strings.Replace(before.String(), "line 2\n", first, 1)
+		content = strings.Replace(content, "line 29\n", last, 1)
+		if err := os.WriteFile(filepath.Join(dir, "file.txt"), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Stage the change at the top, then make the one at the bottom too.
+	write("changed 2\n", "line 29\n")
+	add := exec.Command("git", "add", "file.txt")
+	add.Dir = dir
+	if out, err := add.CombinedOutput(); err != nil {
+		t.Fatalf("git add: %v\n%s", err, out)
+	}
+	write("changed 2\n", "changed 29\n")
+
+	cfg := &cli.Config{Mode: "working", Base: "HEAD", Host: "localhost"}
+	srv := New(cfg, git.NewRepo(dir), nil, testAssets())
+
+	ts := httptest.NewServer(srv.Handler())
+	defer ts.Close()
+
+	resp, err := authGet(ts.URL+"/api/diff?split=hunks", srv.token)
+	if err != nil {
+		t.Fatalf("GET /api/diff?split=hunks: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		t.Fatalf("expected status 200, got %d: %s", resp.StatusCode, body)
+	}
+	var result diff.Result
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		t.Fatalf("decode JSON: %v", err)
+	}
+	if len(result.Files) != 1 || len(result.Files[0].Hunks) != 2 {
+		t.Fatalf("expected one file with two hunks, got %+v", result.Files)
+	}
+	hunks := result.Files[0].Hunks
+	if !hunks[0].Staged || hunks[1].Staged {
+		t.Errorf("expected only the first hunk staged, got staged=%v,%v", hunks[0].Staged, hunks[1].Staged)
+	}
+	if hunks[0].ID == "" || hunks[0].ID == hunks[1].ID {
+		t.Errorf("expected distinct hunk IDs, got %q and %q", hunks[0].ID, hunks[1].ID)
+	}
+
+	for _, query := range []string{"split=hunks&target=HEAD", "split=hunks&target=HEAD&summary=1"} {
+		resp, err = authGet(ts.URL+"/api/diff?"+query, srv.token)
+		if err != nil {
+			t.Fatalf("GET /api/diff?%s: %v", query, err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusBadRequest {
+			t.Errorf("%s: expected status 400 for a diff between commits, got %d", query, resp.StatusCode)
+		}
+	}
+}
+
+func TestAPIDiffSplitStage(t *testing.T) {
+	dir := initTestRepo(t)
+	commitFile(t, dir, "a.txt", "a\n", "first commit")
+	commitFile(t, dir, "b.txt", "b\n", "second commit")
+	if err := os.WriteFile(filepath.Join(dir, "a.txt"), []byte("a2\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	add := exec.Command("git", "add", "a.txt")
+	add.Dir = dir
+	if out, err := add.CombinedOutput(); err != nil {
+		t.Fatalf("git add: %v\n%s", err, out)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "b.txt"), []byte("b2\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := &cli.Config{Mode: "working", Base: "HEAD", Host: "localhost"}
+	hooked := 0
+	srv := New(cfg, git.NewRepo(dir), nil, testAssets(), WithPostProcessor(func(*diff.Result) { hooked++ }))
+
+	ts := httptest.NewServer(srv.Handler())
+	defer ts.Close()
+
+	resp, err := authGet(ts.URL+"/api/diff?split=stage", srv.token)
+	if err != nil {
+		t.Fatalf("GET /api/diff?split=stage: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		t.Fatalf("expected status 200, got %d: %s", resp.StatusCode, body)
+	}
+	var split struct {
+		Staged   diff.Result `json:"staged"`
+		Unstaged diff.Result `json:"unstaged"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&split); err != nil {
+		t.Fatalf("decode JSON: %v", err)
+	}
+	if len(split.Staged.Files) != 1 || split.Staged.Files[0].NewName != "a.txt" {
+		t.Errorf("expected a.txt staged, got %+v", split.Staged.Files)
+	}
+	if len(split.Unstaged.Files) != 1 || split.Unstaged.Files[0].NewName != "b.txt" {
+		t.Errorf("expected b.txt unstaged, got %+v", split.Unstaged.Files)
+	}
+	if hooked != 2 {
+		t.Errorf("expected the hooks to run on both diffs, ran %d times", hooked)
+	}
+
+	// Paging applies to each diff, as to any other.
+	resp, err = authGet(ts.URL+"/api/diff?split=stage&fileOffset=1", srv.token)
+	if err != nil {
+		t.Fatalf("GET /api/diff?split=stage&fileOffset=1: %v", err)
+	}
+	defer resp.Body.Close()
+	split.Staged, split.Unstaged = diff.Result{}, diff.Result{}
+	if err := json.NewDecoder(resp.Body).Decode(&split); err != nil {
+		t.Fatalf("decode JSON: %v", err)
+	}
+	if len(split.Staged.Files) != 0 || split.Staged.TotalFiles != 1 || len(split.Unstaged.Files) != 0 || split.Unstaged.TotalFiles != 1 {
+		t.Errorf("expected empty second pages of one file each, got %+v", split)
+	}
+
+	resp, err = authGet(ts.URL+"/api/diff?split=stage&summary=1", srv.token)
+	if err != nil {
+		t.Fatalf("GET /api/diff?split=stage&summary=1: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("expected status 400 for split=stage with summary, got %d", resp.StatusCode)
+	}
+}
+
+func TestAPIDiffByCommit_OnlyAndHooks(t *testing.T) {
+	dir := initTestRepo(t)
+	base := commitFile(t, dir, "README.md", "hello", "initial commit")
+	for _, name := range []string{"a.txt", "b.go"} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte("TOKEN=secret\n"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, args := range [][]string{{"add", "."}, {"commit", "-q", "-m", "add both"}} {
+		cmd := exec.Command("git", args...)
+		cmd.Dir = dir
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %v: %v\n%s", args, err, out)
+		}
+	}
+
+	cfg := &cli.Config{Mode: "compare", Base: base, Target: "HEAD", Only: []string{"go"}, Host: "localhost"}
+	redact := func(result *diff.Result) {
+		for i := range result.Files {
+			for j := range result.Files[i].Hunks {
+				for k := range result.Files[i].Hunks[j].Lines {
+					result.Files[i].Hunks[j].Lines[k].Content = "[redacted]"
+				}
+			}
+		}
+	}
+	srv := New(cfg, git.NewRepo(dir), nil, testAssets(), WithPostProcessor(redact))
+
+	ts := httptest.NewServer(srv.Handler())
+	defer ts.Close()
+
+	resp, err := authGet(ts.URL+"/api/diff?byCommit=1", srv.token)
+	if err != nil {
+		t.Fatalf("GET /api/diff?byCommit=1: %v", err)
+	}
+	defer resp.Body.Close()
+	var result diff.Log
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		t.Fatalf("decode JSON: %v", err)
+	}
+	if len(result.Commits) != 1 {
+		t.Fatalf("expected 1 commit, got %+v", result.Commits)
+	}
+	files := result.Commits[0].Files
+	if len(files) != 1 || files[0].NewName != "b.go" {
+		t.Fatalf("expected only b.go, got %+v", files)
+	}
+	if content := files[0].Hunks[0].Lines[0].Content; content != "[redacted]" {
+		t.Errorf("expected the hooks to redact the line, got %q", content)
+	}
+}
+
+func TestAPISideBySide(t *testing.T) {
+	dir := initTestRepo(t)
+	base := commitFile(t, dir, "file.txt", "one\ntwo\n", "first commit")
+	commitFile(t, dir, "file.txt", "one\n2\n", "second commit")
+
+	cfg := &cli.Config{Mode: "compare", Base: base, Target: "HEAD", Host: "localhost"}
+	srv := New(cfg, git.NewRepo(dir), nil, testAssets())
+
+	ts := httptest.NewServer(srv.Handler())
+	defer ts.Close()
+
+	resp, err := authGet(ts.URL+"/api/sidebyside?path=file.txt", srv.token)
+	if err != nil {
+		t.Fatalf("GET /api/sidebyside: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		t.Fatalf("expected status 200, got %d: %s", resp.StatusCode, body)
+	}
+	var got sideBySide
+	if err := json.NewDecoder(resp.Body).Decode(&got); err != nil {
+		t.Fatalf("decode JSON: %v", err)
+	}
+	if strings.Join(got.Old, ",") != "one,two" || strings.Join(got.New, ",") != "one,2" {
+		t.Errorf("expected both versions of file.txt, got %+v", got)
+	}
+
+	for _, query := range []string{"", "?path=missing.txt", "?path=../file.txt"} {
+		resp, err := authGet(ts.URL+"/api/sidebyside"+query, srv.token)
+		if err != nil {
+			t.Fatalf("GET /api/sidebyside%s: %v", query, err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode == http.StatusOK {
+			t.Errorf("GET /api/sidebyside%s: expected an error status, got 200", query)
+		}
+	}
+}
+
+func TestAPIDiffHead(t *testing.T) {
+	dir := initTestRepo(t)
+	commitFile(t, dir, "file.txt", "line1\n", "first commit")
+	commitFile(t, dir, "file.txt", "line1\nline2\n", "second commit")
+
+	cfg := &cli.Config{
+		Mode: "commit",
+		Base: "HEAD~1",
+		Host: "localhost",
+	}
+	srv := New(cfg, git.NewRepo(dir), nil, testAssets())
+
+	ts := httptest.NewServer(srv.Handler())
+	defer ts.Close()
+
+	req, err := http.NewRequest(http.MethodHead, ts.URL+"/api/diff", nil)
+	if err != nil {
+		t.Fatalf("new request: %v", err)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("HEAD /api/diff: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusForbidden {
+		t.Errorf("expected 403 for HEAD without token, got %d", resp.StatusCode)
+	}
+
+	req.Header.Set("X-Auth-Token", srv.token)
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("HEAD /api/diff: %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", resp.StatusCode)
+	}
+	if len(body) != 0 {
+		t.Errorf("expected no body for HEAD, got %q", body)
+	}
+	etag := resp.Header.Get("ETag")
+	if etag == "" {
+		t.Error("expected an ETag header")
+	}
+	if resp.ContentLength <= 0 {
+		t.Errorf("expected a positive Content-Length, got %d", resp.ContentLength)
+	}
+
+	getResp, err := authGet(ts.URL+"/api/diff", srv.token)
+	if err != nil {
+		t.Fatalf("GET /api/diff: %v", err)
+	}
+	getBody, _ := io.ReadAll(getResp.Body)
+	getResp.Body.Close()
+	if got := getResp.Header.Get("ETag"); got != etag {
+		t.Errorf("expected GET ETag %s to match HEAD, got %s", etag, got)
+	}
+	if int64(len(getBody)) != resp.ContentLength {
+		t.Errorf("expected GET body of %d bytes, got %d", resp.ContentLength, len(getBody))
+	}
+}
+
+func TestAPICommitsPickaxe(t *testing.T) {
+	dir := initTestRepo(t)
+	commitFile(t, dir, "a.txt", "plain\n", "initial commit")
+	commitFile(t, dir, "a.txt", "plain\nneedle42\n", "add needle")
+	commitFile(t, dir, "b.txt", "other\n", "unrelated")
+
+	cfg := &cli.Config{Mode: "merge-base", Host: "localhost"}
+	srv := New(cfg, git.NewRepo(dir), nil, testAssets())
+
+	ts := httptest.NewServer(srv.Handler())
+	defer ts.Close()
+
+	resp, err := authGet(ts.URL+"/api/commits?pickaxe=needle42", srv.token)
+	if err != nil {
+		t.Fatalf("GET /api/commits?pickaxe=: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", resp.StatusCode)
+	}
+	var commits []git.Commit
+	if err := json.NewDecoder(resp.Body).Decode(&commits); err != nil {
+		t.Fatalf("decode JSON: %v", err)
+	}
+	if len(commits) != 1 || commits[0].Message != "add needle" {
+		t.Errorf("expected only 'add needle', got %+v", commits)
+	}
+
+	resp, err = authGet(ts.URL+"/api/commits?pickaxe=a&pickaxeRegex=b", srv.token)
+	if err != nil {
+		t.Fatalf("GET /api/commits: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("expected 400 for both pickaxe params, got %d", resp.StatusCode)
+	}
+}
+
+func TestMetrics(t *testing.T) {
+	dir := initTestRepo(t)
+	commitFile(t, dir, "file.txt", "line1\n", "first commit")
+	commitFile(t, dir, "file.txt", "line1\nline2\n", "second commit")
+
+	cfg := &cli.Config{Mode: "commit", Base: "HEAD~1", Host: "localhost"}
+	srv := New(cfg, git.NewRepo(dir), nil, testAssets())
+
+	ts := httptest.NewServer(srv.Handler())
+	defer ts.Close()
+
+	for _, path := range []string{"/api/diff", "/api/diff", "/api/commits"} {
+		resp, err := authGet(ts.URL+path, srv.token)
+		if err != nil {
+			t.Fatalf("GET %s: %v", path, err)
+		}
+		resp.Body.Close()
+	}
+
+	// Unauthenticated, like /healthz
+	resp, err := http.Get(ts.URL + "/metrics")
+	if err != nil {
+		t.Fatalf("GET /metrics: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", resp.StatusCode)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	out := string(body)
+
+	for _, want := range []string{
+		`ghdiff_http_requests_total{route="GET /api/diff"} 2`,
+		`ghdiff_http_requests_total{route="GET /api/commits"} 1`,
+		`ghdiff_diff_parse_seconds_count 2`,
+		`ghdiff_git_command_seconds_bucket{command="diff",le="+Inf"} 2`,
+		`ghdiff_git_command_seconds_count{command="log"} 1`,
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("expected /metrics to contain %q, got:\n%s", want, out)
+		}
+	}
+}
+
+func TestAPICommitsFields(t *testing.T) {
+	dir := initTestRepo(t)
+	first := commitFile(t, dir, "a.txt", "a", "first commit")
+	cmd := exec.Command("git", "commit", "--allow-empty", "-m", "second commit", "-m", "line one\nline two")
+	cmd.Dir = dir
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("git commit: %v\n%s", err, out)
+	}
+
+	cfg := &cli.Config{Mode: "merge-base", Host: "localhost"}
+	srv := New(cfg, git.NewRepo(dir), nil, testAssets())
+
+	ts := httptest.NewServer(srv.Handler())
+	defer ts.Close()
+
+	resp, err := authGet(ts.URL+"/api/commits?fields=hash,body,parents", srv.token)
+	if err != nil {
+		t.Fatalf("GET /api/commits?fields=: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		t.Fatalf("expected status 200, got %d: %s", resp.StatusCode, body)
+	}
+	var commits []git.Commit
+	if err := json.NewDecoder(resp.Body).Decode(&commits); err != nil {
+		t.Fatalf("decode JSON: %v", err)
+	}
+	if len(commits) != 2 {
+		t.Fatalf("expected 2 commits, got %d", len(commits))
+	}
+
+	latest := commits[0]
+	if latest.Hash == "" || latest.Body != "line one\nline two" {
+		t.Errorf("expected hash and multi-line body, got %+v", latest)
+	}
+	if len(latest.Parents) != 1 || latest.Parents[0] != first {
+		t.Errorf("expected parent %s, got %q", first, latest.Parents)
+	}
+	if latest.Message != "" || latest.Author != "" || latest.Date != "" || latest.Signature != "" {
+		t.Errorf("expected unrequested fields to be empty, got %+v", latest)
+	}
+
+	resp, err = authGet(ts.URL+"/api/commits?fields=hash,email", srv.token)
+	if err != nil {
+		t.Fatalf("GET /api/commits?fields=: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("expected 400 for unknown field, got %d", resp.StatusCode)
+	}
+}
+
+func TestAPIDiffTabWidth(t *testing.T) {
+	dir := initTestRepo(t)
+	first := commitFile(t, dir, ".editorconfig", "[*.go]\ntab_width = 4\n", "add editorconfig")
+	commitFile(t, dir, "main.go", "package main\n", "add go file")
+	commitFile(t, dir, "notes.txt", "notes\n", "add notes")
+
+	cfg := &cli.Config{
+		Mode:     "compare",
+		Base:     first,
+		Target:   "HEAD",
+		Host:     "localhost",
+		TabWidth: 8,
+	}
+	srv := New(cfg, git.NewRepo(dir), nil, testAssets())
+
+	ts := httptest.NewServer(srv.Handler())
+	defer ts.Close()
+
+	resp, err := authGet(ts.URL+"/api/diff", srv.token)
+	if err != nil {
+		t.Fatalf("GET /api/diff: %v", err)
+	}
+	defer resp.Body.Close()
+
+	var result diff.Result
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		t.Fatalf("decode JSON: %v", err)
+	}
+	want := map[string]int{"main.go": 4, "notes.txt": 8}
+	if len(result.Files) != len(want) {
+		t.Fatalf("expected %d files, got %+v", len(want), result.Files)
+	}
+	for _, f := range result.Files {
+		if f.TabWidth != want[f.Path()] {
+			t.Errorf("%s: expected tab width %d, got %d", f.Path(), want[f.Path()], f.TabWidth)
+		}
+	}
+}
+
+// timeToChangeEvent opens /api/events on a server polling every interval,
+// edits the working tree, and returns how long the change event took.
+func timeToChangeEvent(t *testing.T, interval time.Duration) time.Duration {
+	t.Helper()
+	dir := initTestRepo(t)
+	commitFile(t, dir, "a.txt", "one\n", "initial commit")
+
+	cfg := &cli.Config{Mode: "working", Base: "HEAD", Host: "localhost", WatchInterval: interval}
+	srv := New(cfg, git.NewRepo(dir), nil, testAssets())
+	ts := httptest.NewServer(srv.Handler())
+	defer ts.Close()
+
+	resp, err := authGet(ts.URL+"/api/events", srv.token)
+	if err != nil {
+		t.Fatalf("GET /api/events: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", resp.StatusCode)
+	}
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Fatalf("expected Content-Type text/event-stream, got %q", ct)
+	}
+
+	start := time.Now()
+	if err := os.WriteFile(filepath.Join(dir, "a.txt"), []byte("two\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	lines := make(chan string)
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		defer close(lines)
+		scanner := bufio.NewScanner(resp.Body)
+		for scanner.Scan() {
+			select {
+			case lines <- scanner.Text():
+			case <-done:
+				return
+			}
+		}
+	}()
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case line, ok := <-lines:
+			if !ok {
+				t.Fatal("event stream ended without a change event")
+			}
+			if line == "event: change" {
+				return time.Since(start)
+			}
+		case <-timeout:
+			t.Fatal("timed out waiting for a change event")
+		}
+	}
+}
+
+func TestAPIEventsInterval(t *testing.T) {
+	fast := timeToChangeEvent(t, 20*time.Millisecond)
+	slow := timeToChangeEvent(t, 500*time.Millisecond)
+	if fast >= slow {
+		t.Errorf("expected a 20ms interval to report the change before a 500ms one, got %s and %s", fast, slow)
+	}
+	if fast > 400*time.Millisecond {
+		t.Errorf("expected a change event within 400ms at a 20ms interval, took %s", fast)
+	}
+}
+
+func TestAPIEventsStdinMode(t *testing.T) {
+	cfg := &cli.Config{Mode: "stdin", Host: "localhost"}
+	srv := New(cfg, nil, &diff.Result{}, testAssets())
+	ts := httptest.NewServer(srv.Handler())
+	defer ts.Close()
+
+	resp, err := authGet(ts.URL+"/api/events", srv.token)
+	if err != nil {
+		t.Fatalf("GET /api/events: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusConflict {
+		t.Errorf("expected 409 in stdin mode, got %d", resp.StatusCode)
+	}
+}
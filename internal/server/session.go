@@ -0,0 +1,143 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+
+	"github.com/lundberg/ghdiff/internal/git"
+)
+
+// Session is the review state kept in the --session file, so that the
+// next ghdiff started with the same file resumes where the last one was.
+type Session struct {
+	Base     string `json:"base"`
+	Target   string `json:"target"`         // empty for the working tree
+	ViewMode string `json:"mode,omitempty"` // "split" or "unified"
+	File     string `json:"file,omitempty"` // path of the file last viewed
+}
+
+// validate checks a session's fields as the endpoints they came from would.
+func (sess *Session) validate() error {
+	for _, ref := range []string{sess.Base, sess.Target} {
+		if err := git.ValidateRef(ref); err != nil {
+			return err
+		}
+	}
+	switch sess.ViewMode {
+	case "", "split", "unified":
+	default:
+		return fmt.Errorf("invalid mode %q: must be split or unified", sess.ViewMode)
+	}
+	return nil
+}
+
+// LoadSession reads the session saved in path. It returns nil without an
+// error if path doesn't exist yet.
+func LoadSession(path string) (*Session, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var sess Session
+	if err := json.Unmarshal(data, &sess); err != nil {
+		return nil, fmt.Errorf("reading session %s: %w", path, err)
+	}
+	if err := sess.validate(); err != nil {
+		return nil, fmt.Errorf("reading session %s: %w", path, err)
+	}
+	return &sess, nil
+}
+
+// saveSession writes sess to path, replacing the file in one step so that
+// a crash never leaves half a session behind.
+func saveSession(path string, sess *Session) error {
+	data, err := json.MarshalIndent(sess, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".ghdiff-session-*")
+	if err != nil {
+		return err
+	}
+	defer func() { _ = os.Remove(tmp.Name()) }() // fails harmlessly after the rename
+	if _, err := tmp.Write(append(data, '\n')); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// saveRange records rng as the compared refs in the --session file, if
+// any, keeping the view state the UI saved there.
+func (s *Server) saveRange(rng compareRange) error {
+	if s.config.Session == "" {
+		return nil
+	}
+	s.sessionMu.Lock()
+	defer s.sessionMu.Unlock()
+	sess, err := LoadSession(s.config.Session)
+	if err != nil {
+		return err
+	}
+	if sess == nil {
+		sess = &Session{}
+	}
+	sess.Base, sess.Target = rng.Base, rng.Target
+	return saveSession(s.config.Session, sess)
+}
+
+// handleGetSession returns the state last saved to the --session file, so
+// the UI can return to the file that was being viewed.
+func (s *Server) handleGetSession(w http.ResponseWriter, _ *http.Request) {
+	if s.config.Session == "" {
+		http.Error(w, "no --session file", http.StatusNotFound)
+		return
+	}
+	s.sessionMu.Lock()
+	defer s.sessionMu.Unlock()
+	sess, err := LoadSession(s.config.Session)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if sess == nil {
+		sess = &Session{}
+	}
+	writeJSON(w, sess)
+}
+
+// handlePostSession saves the UI's view state to the --session file.
+func (s *Server) handlePostSession(w http.ResponseWriter, r *http.Request) {
+	if s.config.Session == "" {
+		http.Error(w, "no --session file", http.StatusNotFound)
+		return
+	}
+	var sess Session
+	if err := json.NewDecoder(io.LimitReader(r.Body, 1<<16)).Decode(&sess); err != nil {
+		http.Error(w, "invalid JSON: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := sess.validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	s.sessionMu.Lock()
+	defer s.sessionMu.Unlock()
+	if err := saveSession(s.config.Session, &sess); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, sess)
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strconv"
+	"syscall"
+	"time"
+)
+
+// bindRetryDelay is how long to wait between attempts to bind a port that
+// is in use, e.g. right after a previous ghdiff exited.
+const bindRetryDelay = 250 * time.Millisecond
+
+// listen binds a TCP listener on addr with SO_REUSEADDR set where
+// supported, retrying for up to timeout while the address is in use.
+func listen(addr string, timeout time.Duration) (net.Listener, error) {
+	lc := net.ListenConfig{Control: reuseAddrControl}
+	deadline := time.Now().Add(timeout)
+	for {
+		ln, err := lc.Listen(context.Background(), "tcp", addr)
+		if err == nil {
+			return ln, nil
+		}
+		remaining := time.Until(deadline)
+		if remaining <= 0 || !errors.Is(err, syscall.EADDRINUSE) {
+			return nil, err
+		}
+		time.Sleep(min(bindRetryDelay, remaining))
+	}
+}
+
+// listenPorts binds the first free port of the count ports starting at
+// port on host. The first port is retried for up to timeout, as it may be
+// about to be released; the others are tried once. A count below 1 is
+// treated as 1.
+func listenPorts(host string, port, count int, timeout time.Duration) (net.Listener, error) {
+	var err error
+	for i := range max(count, 1) {
+		var ln net.Listener
+		ln, err = listen(net.JoinHostPort(host, strconv.Itoa(port+i)), timeout)
+		if err == nil || !errors.Is(err, syscall.EADDRINUSE) {
+			return ln, err
+		}
+		timeout = 0
+	}
+	return nil, err
+}
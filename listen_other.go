@@ -0,0 +1,11 @@
+//go:build !unix
+
+package main
+
+import "syscall"
+
+// reuseAddrControl is a no-op: on Windows SO_REUSEADDR would let another
+// process bind the same port, and TIME_WAIT doesn't block rebinding.
+func reuseAddrControl(_, _ string, _ syscall.RawConn) error {
+	return nil
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"errors"
+	"net"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestListenRebindFixedPort(t *testing.T) {
+	ln, err := listen("127.0.0.1:0", 0)
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	addr := ln.Addr().String()
+
+	// Close an accepted connection from the server side first so that it
+	// lingers in TIME_WAIT, as after a restart with a fixed --port.
+	client, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	conn, err := ln.Accept()
+	if err != nil {
+		t.Fatalf("accept: %v", err)
+	}
+	_ = conn.Close()
+	_ = client.Close()
+	_ = ln.Close()
+
+	ln, err = listen(addr, time.Second)
+	if err != nil {
+		t.Fatalf("second listen on %s: %v", addr, err)
+	}
+	_ = ln.Close()
+}
+
+func TestListenPortsTriesNextPort(t *testing.T) {
+	busy, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	defer busy.Close()
+	port := busy.Addr().(*net.TCPAddr).Port
+
+	if _, err := listenPorts("127.0.0.1", port, 1, 0); !errors.Is(err, syscall.EADDRINUSE) {
+		t.Fatalf("expected EADDRINUSE for a busy port, got %v", err)
+	}
+
+	ln, err := listenPorts("127.0.0.1", port, 2, 0)
+	if errors.Is(err, syscall.EADDRINUSE) {
+		t.Skipf("port %d after the busy one is also in use", port+1)
+	}
+	if err != nil {
+		t.Fatalf("listenPorts: %v", err)
+	}
+	defer ln.Close()
+	if got := ln.Addr().(*net.TCPAddr).Port; got != port+1 {
+		t.Errorf("expected port %d, got %d", port+1, got)
+	}
+}
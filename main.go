@@ -3,6 +3,7 @@ package main
 
 import (
 	"context"
+	"crypto/tls"
 	"errors"
 	"fmt"
 	"io"
@@ -10,12 +11,16 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
+	"path/filepath"
 	"strconv"
+	"strings"
 	"syscall"
+	"time"
 
 	"github.com/lundberg/ghdiff/internal/browser"
 	"github.com/lundberg/ghdiff/internal/cli"
 	"github.com/lundberg/ghdiff/internal/diff"
+	"github.com/lundberg/ghdiff/internal/fetch"
 	"github.com/lundberg/ghdiff/internal/git"
 	"github.com/lundberg/ghdiff/internal/server"
 	"github.com/lundberg/ghdiff/web"
@@ -24,10 +29,36 @@ import (
 // version is set via -ldflags at build time.
 var version = "dev"
 
+// Exit codes, for scripts that need to tell failures apart.
+const (
+	exitGeneric = 1 // any other error
+	exitUsage   = 2 // invalid flags or arguments
+	exitNotRepo = 3 // not inside a git repository
+	exitGit     = 4 // a git command failed
+)
+
+// exitError attaches an exit code to an error returned by run.
+type exitError struct {
+	code int
+	err  error
+}
+
+func (e *exitError) Error() string { return e.err.Error() }
+func (e *exitError) Unwrap() error { return e.err }
+
+func withExitCode(code int, err error) error {
+	return &exitError{code: code, err: err}
+}
+
 func main() {
 	if err := run(); err != nil {
 		fmt.Fprintf(os.Stderr, "error: %v\n", err)
-		os.Exit(1)
+		code := exitGeneric
+		var ee *exitError
+		if errors.As(err, &ee) {
+			code = ee.code
+		}
+		os.Exit(code)
 	}
 }
 
@@ -42,11 +73,21 @@ func run() error {
 			fmt.Println(version)
 			return nil
 		}
-		return err
+		return withExitCode(exitUsage, err)
 	}
 
 	repo := git.NewRepo(".")
+	repo.Config = cfg.GitConfig
+	if cfg.Mode != "stdin" && cfg.Mode != "dirs" && cfg.Mode != "mbox" && cfg.Mode != "pr" {
+		if err := repo.CheckRepo(); err != nil {
+			if errors.Is(err, git.ErrNotRepo) {
+				return withExitCode(exitNotRepo, err)
+			}
+			return withExitCode(exitGit, err)
+		}
+	}
 	var stdinDiff *diff.Result
+	var series *diff.Log
 
 	switch cfg.Mode {
 	case "stdin":
@@ -54,35 +95,205 @@ func run() error {
 		if err != nil {
 			return fmt.Errorf("reading stdin: %w", err)
 		}
-		result, err := diff.Parse(string(data))
+		input := string(data)
+		if cfg.StripCR {
+			input = diff.StripCR(input)
+		}
+		parse := diff.Parse
+		if cfg.WordDiff {
+			parse = diff.ParseWordDiff
+		}
+		result, err := parse(input)
 		if err != nil {
 			return fmt.Errorf("parsing diff from stdin: %w", err)
 		}
 		stdinDiff = result
 
-	case "merge-base":
-		mainBranch, err := repo.GetMainBranch()
+	case "pr":
+		pr, err := fetch.ParsePullRequest(cfg.PR)
+		if err != nil {
+			return withExitCode(exitUsage, err)
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+		f := &fetch.Fetcher{GitHubToken: os.Getenv("GITHUB_TOKEN")}
+		patch, err := f.Diff(ctx, pr)
+		cancel()
+		if err != nil {
+			return err
+		}
+		// Served like stdin input: the pull request is fetched once.
+		result, err := diff.Parse(patch)
+		if err != nil {
+			return fmt.Errorf("parsing pull request diff: %w", err)
+		}
+		stdinDiff = result
+
+	case "rebase":
+		patch, err := repo.GetCurrentPatch()
+		if err != nil {
+			return withExitCode(exitGit, fmt.Errorf("reading current patch: %w", err))
+		}
+		// Served like stdin input: the patch doesn't change while we run.
+		result, err := diff.Parse(patch)
+		if err != nil {
+			return fmt.Errorf("parsing current patch: %w", err)
+		}
+		stdinDiff = result
+
+	case "dirs":
+		for _, dir := range []string{cfg.Base, cfg.Target} {
+			info, err := os.Stat(dir)
+			if err != nil {
+				return withExitCode(exitUsage, err)
+			}
+			if !info.IsDir() {
+				return withExitCode(exitUsage, fmt.Errorf("%s is not a directory", dir))
+			}
+		}
+		patch, err := repo.DiffDirs(cfg.Base, cfg.Target, git.DiffOptions{
+			FindRenames: cfg.FindRenames,
+			FindCopies:  cfg.FindCopies,
+			Text:        cfg.Text,
+
+			IgnoreMatching: cfg.IgnoreMatching,
+		})
+		if err != nil {
+			return withExitCode(exitGit, fmt.Errorf("diffing directories: %w", err))
+		}
+		// Served like stdin input: the trees are compared once at startup.
+		result, err := diff.Parse(patch)
+		if err != nil {
+			return fmt.Errorf("parsing directory diff: %w", err)
+		}
+		diff.TrimDirs(result, cfg.Base, cfg.Target)
+		stdinDiff = result
+
+	case "mbox":
+		log, err := readSeries(cfg.Mbox)
+		if err != nil {
+			return withExitCode(exitUsage, err)
+		}
+		// Served like stdin input, with every patch's files in /api/diff.
+		result := &diff.Result{}
+		for _, c := range log.Commits {
+			result.Files = append(result.Files, c.Files...)
+		}
+		stdinDiff = result
+		series = log
+
+	case "stash":
+		result, err := stashDiff(repo, cfg.Base, git.DiffOptions{
+			FindRenames: cfg.FindRenames,
+			FindCopies:  cfg.FindCopies,
+			Text:        cfg.Text,
+
+			IgnoreMatching: cfg.IgnoreMatching,
+		})
+		if err != nil {
+			return withExitCode(exitGit, err)
+		}
+		// Served like stdin input: a stash entry doesn't change.
+		stdinDiff = result
+
+	case "conflict":
+		result, err := conflictDiff(repo, git.DiffOptions{
+			FindRenames: cfg.FindRenames,
+			FindCopies:  cfg.FindCopies,
+			Text:        cfg.Text,
+
+			IgnoreMatching: cfg.IgnoreMatching,
+		})
 		if err != nil {
-			return fmt.Errorf("detecting main branch: %w", err)
+			return withExitCode(exitGit, err)
+		}
+		// Served like stdin input: the index doesn't change while we run.
+		stdinDiff = result
+
+	case "merge-base":
+		var mainBranch string
+		if cfg.Upstream {
+			upstream, err := repo.GetUpstream()
+			if err != nil {
+				fmt.Fprintln(os.Stderr, "warning: no upstream branch configured, falling back to main/master")
+			}
+			mainBranch = upstream
+		}
+		if mainBranch == "" {
+			mainBranch, err = repo.GetMainBranch()
+			if err != nil {
+				return withExitCode(exitGit, fmt.Errorf("detecting main branch: %w", err))
+			}
 		}
 		base, err := repo.GetMergeBase("HEAD", mainBranch)
 		if err != nil {
-			return fmt.Errorf("computing merge-base: %w", err)
+			// Truncated history in shallow clones can hide the merge-base;
+			// diffing against the main branch tip is the best we can do.
+			shallow, shallowErr := repo.IsShallow()
+			if shallowErr != nil || !shallow {
+				return withExitCode(exitGit, fmt.Errorf("computing merge-base: %w", err))
+			}
+			fmt.Fprintf(os.Stderr, "warning: no merge-base with %s in shallow clone, diffing against %s directly\n", mainBranch, mainBranch)
+			base = mainBranch
 		}
 		cfg.Base = base
+		cfg.BaseBranch = mainBranch
 
 	case "working":
 		cfg.Base = "HEAD"
 
-	case "commit", "compare":
-		// Base (and Target for compare) already set by CLI parser
+	case "compare":
+		if cfg.SinceTag {
+			prev, err := repo.GetPreviousTag(cfg.Target)
+			if err != nil {
+				return withExitCode(exitUsage, fmt.Errorf("--since-tag: %w", err))
+			}
+			cfg.Base = prev
+		}
+		if cfg.ThreeDot {
+			// Like GitHub's base...head: only the changes made on Target
+			// since it diverged from Base.
+			base, err := repo.GetMergeBase(cfg.Base, cfg.Target)
+			if err != nil {
+				return withExitCode(exitGit, fmt.Errorf("computing merge-base: %w", err))
+			}
+			cfg.Base = base
+		}
+
+	case "commit":
+		// Base already set by CLI parser, except for --since-release
+		if cfg.SinceRelease {
+			tag, err := repo.GetLatestTag("HEAD")
+			if errors.Is(err, git.ErrNoTag) {
+				return withExitCode(exitUsage, fmt.Errorf("--since-release: no tag reachable from HEAD; tag a release or name the base commit instead"))
+			}
+			if err != nil {
+				return withExitCode(exitGit, fmt.Errorf("--since-release: %w", err))
+			}
+			cfg.Base = tag
+		}
+	}
+
+	if cfg.Session != "" {
+		sess, err := server.LoadSession(cfg.Session)
+		if err != nil {
+			return withExitCode(exitUsage, err)
+		}
+		if sess != nil {
+			resumeSession(cfg, sess)
+		}
 	}
 
 	// Listen on a port to get the actual address (handles port=0 auto-select)
-	addr := net.JoinHostPort(cfg.Host, strconv.Itoa(cfg.Port))
-	ln, err := net.Listen("tcp", addr)
+	ln, err := listenPorts(cfg.Host, cfg.Port, cfg.PortRange, cfg.BindTimeout)
+	if errors.Is(err, syscall.EADDRINUSE) {
+		ports := fmt.Sprintf("port %d is", cfg.Port)
+		if cfg.PortRange > 1 {
+			ports = fmt.Sprintf("ports %d-%d are all", cfg.Port, cfg.Port+cfg.PortRange-1)
+		}
+		return fmt.Errorf("%s already in use on %s; use --port 0 to pick a free port, or --port-range to try the ports after it: %w", ports, cfg.Host, err)
+	}
 	if err != nil {
-		return fmt.Errorf("listen %s: %w", addr, err)
+		return fmt.Errorf("listen %s: %w", net.JoinHostPort(cfg.Host, strconv.Itoa(cfg.Port)), err)
 	}
 
 	// Extract the actual port (important when port=0).
@@ -93,36 +304,228 @@ func run() error {
 	}
 	actualPort := tcpAddr.Port
 	cfg.Port = actualPort
-	url := fmt.Sprintf("http://%s", net.JoinHostPort(cfg.Host, strconv.Itoa(actualPort)))
+	scheme := "http"
+	if cfg.TLS {
+		scheme = "https"
+	}
+	url := fmt.Sprintf("%s://%s", scheme, net.JoinHostPort(cfg.Host, strconv.Itoa(actualPort)))
+
+	srv := server.New(cfg, repo, stdinDiff, web.Assets)
+	if series != nil {
+		srv.SetSeries(series)
+	}
+	httpServer := &http.Server{Handler: srv.Handler()}
+
+	serveErr := make(chan error, 1)
+	if cfg.TLS {
+		httpServer.TLSConfig, err = tlsConfig(cfg)
+		if err != nil {
+			_ = ln.Close()
+			return err
+		}
+		// The certificate is already in TLSConfig.
+		go func() { serveErr <- httpServer.ServeTLS(ln, "", "") }()
+	} else {
+		go func() { serveErr <- httpServer.Serve(ln) }()
+	}
+
+	// Don't announce the URL (or open a browser on it) until the server
+	// actually answers, so the first page load never hits a dead socket.
+	if err := waitReady(url, 5*time.Second); err != nil {
+		_ = httpServer.Close()
+		return err
+	}
 
-	fmt.Printf("Listening on %s\n", url)
+	if cfg.PrintURL {
+		fmt.Println(url)
+	} else {
+		fmt.Printf("Listening on %s\n", url)
+	}
 	if cfg.Host != "localhost" && cfg.Host != "127.0.0.1" {
 		fmt.Fprintln(os.Stderr, "WARNING: ghdiff is not designed for public access. It exposes repository contents without authentication.")
 	}
-	fmt.Println("Press Ctrl+C to stop")
+	if !cfg.Quiet {
+		fmt.Println("Press Ctrl+C to stop")
+	}
 
-	if !cfg.NoOpen {
+	// On headless machines there is nothing to open; the URL printed
+	// above is all the user needs, so skip without a warning.
+	if !cfg.NoOpen && browser.Available() {
+		time.Sleep(cfg.OpenDelay)
 		if err := browser.Open(url); err != nil {
 			fmt.Fprintf(os.Stderr, "warning: could not open browser: %v\n", err)
 		}
 	}
 
-	srv := server.New(cfg, repo, stdinDiff, web.Assets)
-	httpServer := &http.Server{Handler: srv.Handler()}
-
 	// Graceful shutdown on Ctrl+C
 	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
 	defer stop()
 
+	httpServer.RegisterOnShutdown(srv.Close)
+	shutdown := make(chan struct{})
 	go func() {
+		defer close(shutdown)
 		<-ctx.Done()
-		fmt.Println("\nShutting down...")
-		_ = httpServer.Close()
+		stop() // a second Ctrl+C exits at once
+		if !cfg.Quiet {
+			fmt.Println("\nShutting down...")
+		}
+		// Let responses being written finish, such as a large diff still
+		// downloading, but not forever.
+		graceCtx, cancel := context.WithTimeout(context.Background(), shutdownGrace)
+		defer cancel()
+		if err := httpServer.Shutdown(graceCtx); err != nil {
+			_ = httpServer.Close()
+		}
 	}()
 
-	if err := httpServer.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+	if err := <-serveErr; err != nil && !errors.Is(err, http.ErrServerClosed) {
 		return err
 	}
+	<-shutdown
 
 	return nil
 }
+
+// shutdownGrace is how long in-flight requests get to finish after Ctrl+C.
+const shutdownGrace = 5 * time.Second
+
+// stashDiff returns the files of a stash entry, with Origin telling
+// stashed edits to tracked files from stashed untracked files.
+func stashDiff(repo *git.Repo, stash string, opts git.DiffOptions) (*diff.Result, error) {
+	d, err := repo.GetStashDiff(stash, opts)
+	if err != nil {
+		return nil, fmt.Errorf("reading %s: %w", stash, err)
+	}
+	result := &diff.Result{}
+	for _, part := range []struct{ origin, patch string }{
+		{"tracked", d.Tracked},
+		{"untracked", d.Untracked},
+	} {
+		parsed, err := diff.Parse(part.patch)
+		if err != nil {
+			return nil, fmt.Errorf("parsing %s files of %s: %w", part.origin, stash, err)
+		}
+		for _, f := range parsed.Files {
+			f.Origin = part.origin
+			result.Files = append(result.Files, f)
+		}
+	}
+	return result, nil
+}
+
+// resumeSession restores the view mode saved in a --session file unless
+// --mode was given and, when ghdiff was started without refs, the compared
+// refs. Refs given on the command line, or chosen with flags such as
+// --upstream, are kept.
+func resumeSession(cfg *cli.Config, sess *server.Session) {
+	if sess.ViewMode != "" && !cfg.ViewModeSet {
+		cfg.ViewMode = sess.ViewMode
+	}
+	if cfg.Mode != "merge-base" || cfg.Upstream {
+		return
+	}
+	if sess.Base != "" && (sess.Base != cfg.Base || sess.Target != cfg.Target) {
+		cfg.Base, cfg.Target = sess.Base, sess.Target
+		cfg.BaseBranch = "" // no longer the merge-base with it
+	}
+}
+
+// readSeries parses the patch series in path, an mbox file or a directory
+// whose .patch files are read in name order, as git format-patch numbers
+// them.
+func readSeries(path string) (*diff.Log, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	var mbox strings.Builder
+	if info.IsDir() {
+		patches, err := filepath.Glob(filepath.Join(path, "*.patch"))
+		if err != nil {
+			return nil, err
+		}
+		for _, name := range patches {
+			data, err := os.ReadFile(name)
+			if err != nil {
+				return nil, err
+			}
+			mbox.Write(data)
+			mbox.WriteString("\n")
+		}
+	} else {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		mbox.Write(data)
+	}
+	log, err := diff.ParseMbox(mbox.String())
+	if err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", path, err)
+	}
+	if len(log.Commits) == 0 {
+		return nil, fmt.Errorf("no patches found in %s", path)
+	}
+	return log, nil
+}
+
+// conflictDiff returns, for each conflicted path, the diffs of ours and
+// theirs from the common ancestor. Sides whose stage is missing, such as
+// both sides of an add/add conflict, are left out.
+func conflictDiff(repo *git.Repo, opts git.DiffOptions) (*diff.Result, error) {
+	paths, err := repo.GetConflictedPaths()
+	if err != nil {
+		return nil, fmt.Errorf("listing conflicted paths: %w", err)
+	}
+	if len(paths) == 0 {
+		return nil, errors.New("no merge conflicts in the index")
+	}
+	result := &diff.Result{}
+	for _, path := range paths {
+		for _, side := range []struct {
+			name  string
+			stage int
+		}{{"ours", git.StageOurs}, {"theirs", git.StageTheirs}} {
+			patch, err := repo.GetConflictDiff(path, side.stage, opts)
+			if err != nil {
+				continue
+			}
+			parsed, err := diff.Parse(patch)
+			if err != nil {
+				return nil, fmt.Errorf("parsing %s diff of %s: %w", side.name, path, err)
+			}
+			for _, f := range parsed.Files {
+				f.Side = side.name
+				result.Files = append(result.Files, f)
+			}
+		}
+	}
+	return result, nil
+}
+
+// waitReady polls the server's health endpoint until it responds with 200
+// or the timeout expires.
+func waitReady(url string, timeout time.Duration) error {
+	client := &http.Client{
+		Timeout: time.Second,
+		// Only our own listener is probed, whose certificate may be
+		// self-signed or not name the host we connect to.
+		Transport: &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}},
+	}
+	deadline := time.Now().Add(timeout)
+	for {
+		resp, err := client.Get(url + "/healthz")
+		if err == nil {
+			_ = resp.Body.Close()
+			if resp.StatusCode == http.StatusOK {
+				return nil
+			}
+			err = fmt.Errorf("unexpected status %s", resp.Status)
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("server not ready after %s: %w", timeout, err)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
@@ -0,0 +1,30 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/lundberg/ghdiff/internal/cli"
+	"github.com/lundberg/ghdiff/internal/server"
+)
+
+func TestResumeSession(t *testing.T) {
+	sess := &server.Session{Base: "main", Target: "feature", ViewMode: "unified"}
+	tests := []struct {
+		args               []string
+		wantMode, wantBase string
+	}{
+		{nil, "unified", "main"},
+		{[]string{"--mode", "split"}, "split", "main"},
+		{[]string{"HEAD~1", "HEAD"}, "unified", "HEAD~1"},
+	}
+	for _, tt := range tests {
+		cfg, err := cli.ParseArgs(tt.args)
+		if err != nil {
+			t.Fatalf("ParseArgs(%v): %v", tt.args, err)
+		}
+		resumeSession(cfg, sess)
+		if cfg.ViewMode != tt.wantMode || cfg.Base != tt.wantBase {
+			t.Errorf("%v: expected mode %s and base %s, got %s and %s", tt.args, tt.wantMode, tt.wantBase, cfg.ViewMode, cfg.Base)
+		}
+	}
+}
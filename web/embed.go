@@ -1,9 +1,33 @@
 // Package web contains embedded static assets for the frontend.
 package web
 
-import "embed"
+import (
+	"embed"
+	"io/fs"
+	"strings"
+)
 
 //go:embed index.html css/* js/* vendor/*
 
 // Assets contains the embedded frontend files.
 var Assets embed.FS
+
+// SyntaxThemeDir holds the syntax highlighting themes, one NAME.css per
+// theme.
+const SyntaxThemeDir = "css/themes"
+
+// SyntaxThemes returns the names of the syntax highlighting themes in
+// Assets, sorted.
+func SyntaxThemes() []string {
+	entries, err := fs.ReadDir(Assets, SyntaxThemeDir)
+	if err != nil {
+		return nil
+	}
+	var names []string
+	for _, e := range entries {
+		if name, ok := strings.CutSuffix(e.Name(), ".css"); ok && !e.IsDir() {
+			names = append(names, name)
+		}
+	}
+	return names
+}
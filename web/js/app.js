@@ -6,8 +6,10 @@
 
   // --- State ---
   let currentFiles = [];
-  let viewMode = "split"; // "split" or "unified"
+  let viewMode = window.__VIEW_MODE__ === "unified" ? "unified" : "split";
   let activeFile = null;
+  let sessionEnabled = false; // set when started with --session
+  let currentHistory = null;
 
   // --- DOM References ---
   const basePicker = document.getElementById("base-picker");
@@ -22,13 +24,19 @@
 
   // --- API Calls ---
 
-  async function fetchDiff(base, target) {
+  async function fetchDiff(base, target, id) {
     const params = new URLSearchParams();
     if (base) params.set("base", base);
     if (target) params.set("target", target);
+    if (id !== undefined) params.set("id", id);
     const qs = params.toString();
     const url = qs ? `/api/diff?${qs}` : "/api/diff";
     const resp = await fetch(url, { headers: authHeaders });
+    if (resp.status === 503) {
+      // Past --diff-soft-timeout, with advice on asking for less
+      const body = await resp.json().catch(() => ({}));
+      if (body.timeout) throw new Error(body.suggestion);
+    }
     if (!resp.ok) {
       throw new Error(`Failed to fetch diff: ${resp.status} ${resp.statusText}`);
     }
@@ -45,6 +53,63 @@
     return resp.json();
   }
 
+  async function fetchStatus() {
+    const resp = await fetch("/api/status", { headers: authHeaders });
+    if (!resp.ok) {
+      throw new Error(`Failed to fetch status: ${resp.status} ${resp.statusText}`);
+    }
+    return resp.json();
+  }
+
+  // showAheadBehind shows how far the branch has diverged from the one it
+  // is reviewed against, e.g. "12 commits ahead of main".
+  async function showAheadBehind() {
+    const el = document.getElementById("ahead-behind");
+    let status;
+    try {
+      status = await fetchStatus();
+    } catch {
+      return; // not worth an error in the diff view
+    }
+    const commits = (n) => `${n} commit${n === 1 ? "" : "s"}`;
+    let text = `${commits(status.ahead)} ahead of ${status.base}`;
+    if (status.behind > 0) {
+      text += `, ${status.behind} behind`;
+    }
+    el.textContent = text;
+    el.hidden = false;
+  }
+
+  async function fetchRangeDiff() {
+    const resp = await fetch("/api/range-diff", { headers: authHeaders });
+    if (!resp.ok) {
+      throw new Error(
+        `Failed to fetch range-diff: ${resp.status} ${resp.statusText}`
+      );
+    }
+    return resp.json();
+  }
+
+  async function fetchBatch() {
+    const resp = await fetch("/api/batch", { headers: authHeaders });
+    if (!resp.ok) {
+      throw new Error(
+        `Failed to fetch commit list: ${resp.status} ${resp.statusText}`
+      );
+    }
+    return resp.json();
+  }
+
+  async function fetchHistory() {
+    const resp = await fetch("/api/history", { headers: authHeaders });
+    if (!resp.ok) {
+      throw new Error(
+        `Failed to fetch history: ${resp.status} ${resp.statusText}`
+      );
+    }
+    return resp.json();
+  }
+
   // --- File Tree ---
 
   function buildFileTree(files) {
@@ -155,6 +220,7 @@
 
   function setActiveTreeFile(path) {
     activeFile = path;
+    saveSession();
     const allFiles = fileTreeContent.querySelectorAll(".tree-file");
     for (const f of allFiles) {
       f.classList.toggle("active", f.dataset.path === path);
@@ -182,6 +248,8 @@
     const path =
       file.status === "deleted" ? file.oldName : file.newName || file.oldName;
     section.id = `file-${cssId(path)}`;
+    // A conflicted file appears twice; links go to the "ours" diff.
+    if (file.side === "theirs") section.id += "-theirs";
 
     // Count additions and deletions
     let additions = 0;
@@ -214,13 +282,34 @@
       }
     }
 
+    const notes = [];
+    if (file.origin === "untracked") notes.push("untracked");
+    if (file.side) notes.push(`${file.side} vs base`);
+    if (file.eolOnly) notes.push("line endings only");
+    if (file.relatedTo) notes.push(`same content as ${file.relatedTo}`);
+    if (file.invalidUtf8) notes.push("non-UTF-8 content");
+    const notesHtml = notes
+      .map((n) => `<span class="file-note">${escapeHtml(n)}</span>`)
+      .join("");
+
     header.innerHTML = `
       <span class="collapse-arrow">&#9660;</span>
       <span class="status-badge ${file.status}">${file.status}</span>
       <span class="file-path">${escapeHtml(displayPath)}</span>
+      ${notesHtml}
       ${statsHtml}
     `;
 
+    const editorUrl = file.status === "deleted" ? "" : editorLink(path, file);
+    if (editorUrl) {
+      const link = document.createElement("a");
+      link.className = "editor-link";
+      link.href = editorUrl;
+      link.textContent = "Open in editor";
+      link.addEventListener("click", (e) => e.stopPropagation());
+      header.appendChild(link);
+    }
+
     header.addEventListener("click", () => {
       section.classList.toggle("collapsed");
     });
@@ -231,11 +320,18 @@
     const body = document.createElement("div");
     body.className = "file-body";
 
-    if (file.isBinary) {
+    if (file.isBinary && file.isImage) {
+      body.appendChild(renderImagePreview(file));
+    } else if (file.isSymlink) {
+      body.appendChild(renderSymlink(file));
+    } else if (file.isBinary) {
       body.innerHTML = '<div class="binary-notice">Binary file not shown</div>';
     } else if (file.hunks && file.hunks.length > 0) {
       const table = document.createElement("table");
       table.className = `diff-table ${viewMode}`;
+      if (file.tabWidth) {
+        table.style.tabSize = file.tabWidth;
+      }
 
       if (viewMode === "split") {
         const colgroup = document.createElement("colgroup");
@@ -265,6 +361,92 @@
     return section;
   }
 
+  // --- Editor links ---
+
+  // editorLink returns a URL that opens path in the --editor at the
+  // file's first hunk, or "" when the server doesn't offer editor links.
+  function editorLink(path, file) {
+    const root = window.__REPO_ROOT__;
+    if (!root) return "";
+    const abs = `${root}/${path}`;
+    const line = Math.max(file.hunks?.[0]?.newStart || 1, 1);
+    switch (window.__EDITOR__) {
+      case "vscode":
+        // Windows roots ("C:/repo") need a slash after the authority
+        return `vscode://file${abs.startsWith("/") ? "" : "/"}${encodeURI(abs)}:${line}`;
+      case "idea":
+        return `idea://open?file=${encodeURIComponent(abs)}&line=${line}`;
+      default:
+        return "";
+    }
+  }
+
+  // --- Symlinks ---
+
+  // renderSymlink shows a symlink's old and new target instead of a diff
+  // of the target path as if it were file content.
+  function renderSymlink(file) {
+    let oldTarget = "";
+    let newTarget = "";
+    for (const hunk of file.hunks || []) {
+      for (const line of hunk.lines) {
+        if (line.type === "delete") oldTarget = line.content;
+        if (line.type === "add") newTarget = line.content;
+      }
+    }
+    const el = document.createElement("div");
+    el.className = "symlink-notice";
+    const parts = [];
+    if (oldTarget) parts.push(`<span class="symlink-old">${escapeHtml(oldTarget)}</span>`);
+    if (newTarget) parts.push(`<span class="symlink-new">${escapeHtml(newTarget)}</span>`);
+    el.innerHTML = `symlink &rarr; ${parts.join(" &rarr; ")}`;
+    return el;
+  }
+
+  // --- Image Preview ---
+
+  function renderImagePreview(file) {
+    const preview = document.createElement("div");
+    preview.className = "image-preview";
+    const sides = [];
+    if (file.status !== "added") sides.push(["old", file.oldName, "Before"]);
+    if (file.status !== "deleted") sides.push(["new", file.newName, "After"]);
+
+    for (const [ref, path, label] of sides) {
+      const figure = document.createElement("figure");
+      figure.className = `image-side ${ref}`;
+      const img = document.createElement("img");
+      img.alt = `${label}: ${path}`;
+      const caption = document.createElement("figcaption");
+      caption.textContent = label;
+      figure.appendChild(img);
+      figure.appendChild(caption);
+      preview.appendChild(figure);
+      loadImage(img, path, ref);
+    }
+    return preview;
+  }
+
+  // The API requires the auth header, so images are fetched as blobs
+  // rather than pointed at with a plain src URL.
+  async function loadImage(img, path, ref) {
+    const params = new URLSearchParams({ path, ref });
+    if (basePicker.value) params.set("base", basePicker.value);
+    if (targetPicker.value) params.set("target", targetPicker.value);
+    try {
+      const resp = await fetch(`/api/file?${params}`, { headers: authHeaders });
+      if (!resp.ok) throw new Error(`${resp.status} ${resp.statusText}`);
+      img.src = URL.createObjectURL(await resp.blob());
+    } catch (err) {
+      img.replaceWith(
+        Object.assign(document.createElement("div"), {
+          className: "binary-notice",
+          textContent: `Could not load image: ${err.message}`,
+        })
+      );
+    }
+  }
+
   // --- Hunk Rendering: Split View ---
 
   function renderHunkSplit(hunk, tbody) {
@@ -290,10 +472,10 @@
         tr.className = "line-context";
         tr.innerHTML = `
           <td class="line-num old-num">${line.oldNum || ""}</td>
-          <td class="line-content old-content">${escapeHtml(line.content)}</td>
+          <td class="line-content old-content">${renderContent(line)}</td>
           <td class="split-divider"></td>
           <td class="line-num new-num">${line.newNum || ""}</td>
-          <td class="line-content new-content">${escapeHtml(line.content)}</td>
+          <td class="line-content new-content">${renderContent(line)}</td>
         `;
         tbody.appendChild(tr);
         i++;
@@ -321,16 +503,16 @@
             // Modification: delete on left, add on right
             tr.innerHTML = `
               <td class="line-num old-num old-del">${del.oldNum || ""}</td>
-              <td class="line-content old-content old-del">${escapeHtml(del.content)}</td>
+              <td class="line-content old-content old-del">${renderContent(del)}</td>
               <td class="split-divider"></td>
               <td class="line-num new-num new-add">${add.newNum || ""}</td>
-              <td class="line-content new-content new-add">${escapeHtml(add.content)}</td>
+              <td class="line-content new-content new-add">${renderContent(add)}</td>
             `;
           } else if (del) {
             // Delete only
             tr.innerHTML = `
               <td class="line-num old-num old-del">${del.oldNum || ""}</td>
-              <td class="line-content old-content old-del">${escapeHtml(del.content)}</td>
+              <td class="line-content old-content old-del">${renderContent(del)}</td>
               <td class="split-divider"></td>
               <td class="line-num new-num empty-cell"></td>
               <td class="line-content new-content empty-cell"></td>
@@ -342,7 +524,7 @@
               <td class="line-content old-content empty-cell"></td>
               <td class="split-divider"></td>
               <td class="line-num new-num new-add">${add.newNum || ""}</td>
-              <td class="line-content new-content new-add">${escapeHtml(add.content)}</td>
+              <td class="line-content new-content new-add">${renderContent(add)}</td>
             `;
           }
           tbody.appendChild(tr);
@@ -355,7 +537,7 @@
           <td class="line-content old-content empty-cell"></td>
           <td class="split-divider"></td>
           <td class="line-num new-num new-add">${line.newNum || ""}</td>
-          <td class="line-content new-content new-add">${escapeHtml(line.content)}</td>
+          <td class="line-content new-content new-add">${renderContent(line)}</td>
         `;
         tbody.appendChild(tr);
         i++;
@@ -385,21 +567,21 @@
         tr.innerHTML = `
           <td class="line-num">${line.oldNum || ""}</td>
           <td class="line-num">${line.newNum || ""}</td>
-          <td class="line-content">${escapeHtml(line.content)}</td>
+          <td class="line-content">${renderContent(line)}</td>
         `;
       } else if (line.type === "add") {
         tr.className = "line-add";
         tr.innerHTML = `
           <td class="line-num"></td>
           <td class="line-num">${line.newNum || ""}</td>
-          <td class="line-content">${escapeHtml(line.content)}</td>
+          <td class="line-content">${renderContent(line)}</td>
         `;
       } else if (line.type === "delete") {
         tr.className = "line-delete";
         tr.innerHTML = `
           <td class="line-num">${line.oldNum || ""}</td>
           <td class="line-num"></td>
-          <td class="line-content">${escapeHtml(line.content)}</td>
+          <td class="line-content">${renderContent(line)}</td>
         `;
       }
 
@@ -407,6 +589,108 @@
     }
   }
 
+  // --- Range Diff ---
+
+  function renderRangeDiff(data) {
+    fileTreeContent.innerHTML = "";
+    diffContent.innerHTML = "";
+    const pairs = data.pairs || [];
+    if (pairs.length === 0) {
+      fileTreeContent.innerHTML = '<div class="loading">No commits</div>';
+      return;
+    }
+
+    // Badge classes reuse the file status colors
+    const badgeClass = {
+      added: "added",
+      dropped: "deleted",
+      modified: "modified",
+      unchanged: "unchanged",
+    };
+
+    const fragment = document.createDocumentFragment();
+    for (const pair of pairs) {
+      const section = document.createElement("div");
+      section.className = "file-section";
+
+      const oldSide = pair.oldIndex ? `${pair.oldIndex}: ${pair.oldHash}` : "-";
+      const newSide = pair.newIndex ? `${pair.newIndex}: ${pair.newHash}` : "-";
+
+      const header = document.createElement("div");
+      header.className = "file-header";
+      header.innerHTML = `
+        <span class="collapse-arrow">&#9660;</span>
+        <span class="status-badge ${badgeClass[pair.status] || ""}">${escapeHtml(pair.status)}</span>
+        <span class="file-path">${escapeHtml(`${oldSide} \u2192 ${newSide}  ${pair.subject}`)}</span>
+      `;
+      header.addEventListener("click", () => {
+        section.classList.toggle("collapsed");
+      });
+      section.appendChild(header);
+
+      if (pair.hunks && pair.hunks.length > 0) {
+        const body = document.createElement("div");
+        body.className = "file-body";
+        const table = document.createElement("table");
+        table.className = "diff-table unified";
+        const tbody = document.createElement("tbody");
+        for (const hunk of pair.hunks) {
+          renderHunkUnified(hunk, tbody);
+        }
+        table.appendChild(tbody);
+        body.appendChild(table);
+        section.appendChild(body);
+      }
+
+      fragment.appendChild(section);
+    }
+    diffContent.appendChild(fragment);
+  }
+
+  // --- File History ---
+
+  function renderHistory(data) {
+    fileTreeContent.innerHTML = "";
+    diffContent.innerHTML = "";
+    const commits = data.commits || [];
+    if (commits.length === 0) {
+      fileTreeContent.innerHTML = '<div class="loading">No commits</div>';
+      return;
+    }
+
+    const fragment = document.createDocumentFragment();
+    for (const [i, commit] of commits.entries()) {
+      // Patches from an mbox may lack a hash
+      const id = `commit-${i}`;
+
+      // The sidebar lists commits instead of files
+      const item = document.createElement("div");
+      item.className = "tree-file";
+      item.textContent = `${commit.hash.slice(0, 7)} ${commit.subject}`;
+      item.title = `${commit.author}, ${commit.date}`;
+      item.addEventListener("click", () => {
+        document.getElementById(id)?.scrollIntoView({ behavior: "smooth" });
+      });
+      fileTreeContent.appendChild(item);
+
+      const heading = document.createElement("div");
+      heading.className = "commit-heading";
+      heading.id = id;
+      heading.innerHTML = `
+        <span class="commit-hash">${escapeHtml(commit.hash.slice(0, 7))}</span>
+        <span class="commit-subject">${escapeHtml(commit.subject)}</span>
+        <span class="commit-meta">${escapeHtml(`${commit.author}, ${commit.date}`)}</span>
+      `;
+      fragment.appendChild(heading);
+
+      for (const file of commit.files || []) {
+        fragment.appendChild(renderFileSection(file));
+      }
+    }
+    diffContent.appendChild(fragment);
+    adjustSplitTableWidths();
+  }
+
   // --- Interactions ---
 
   function toggleViewMode(mode) {
@@ -415,17 +699,65 @@
 
     btnSplit.classList.toggle("active", mode === "split");
     btnUnified.classList.toggle("active", mode === "unified");
+    updatePermalink();
 
     // Re-render diffs only (keep file tree as-is)
-    renderDiffContent(currentFiles);
+    if (currentHistory) {
+      renderHistory(currentHistory);
+    } else {
+      renderDiffContent(currentFiles);
+    }
+  }
+
+  // --- Watch ---
+
+  // Reloads the diff whenever /api/events reports a change. The stream is
+  // read with fetch because EventSource can't send the auth header.
+  let watchController = null;
+
+  async function watchDiff(base, target) {
+    if (watchController) watchController.abort();
+    watchController = new AbortController();
+    const params = new URLSearchParams();
+    if (base) params.set("base", base);
+    if (target) params.set("target", target);
+    try {
+      const res = await fetch(`/api/events?${params}`, {
+        headers: authHeaders,
+        signal: watchController.signal,
+      });
+      if (!res.ok) return; // e.g. 409 in stdin mode
+      const reader = res.body.pipeThrough(new TextDecoderStream()).getReader();
+      let buffer = "";
+      for (;;) {
+        const { value, done } = await reader.read();
+        if (done) return;
+        buffer += value;
+        let end;
+        while ((end = buffer.indexOf("\n\n")) >= 0) {
+          const event = buffer.slice(0, end);
+          buffer = buffer.slice(end + 2);
+          if (event.startsWith("event: change")) loadDiff();
+        }
+      }
+    } catch {
+      // Aborted for a new range, or the server went away
+    }
   }
 
   async function loadDiff() {
     showLoading();
     try {
-      const base = basePicker.value || undefined;
-      const target = targetPicker.value || undefined;
-      const data = await fetchDiff(base, target);
+      let data;
+      if (window.__MODE__ === "batch") {
+        // The base picker lists the --commits-file entries
+        data = await fetchDiff(undefined, undefined, basePicker.value);
+      } else {
+        const base = basePicker.value || undefined;
+        const target = targetPicker.value || undefined;
+        data = await fetchDiff(base, target);
+        watchDiff(base, target);
+      }
       currentFiles = data.files || [];
       renderFileTree(currentFiles);
       renderDiffContent(currentFiles);
@@ -481,6 +813,23 @@
     }
   }
 
+  // renderContent returns the escaped line content, with word-level
+  // segments highlighted and a marker for lines the server truncated.
+  function renderContent(line) {
+    const marker = line.truncated
+      ? '<span class="truncated-marker">\u2026 line truncated</span>'
+      : "";
+    if (!line.segments) return escapeHtml(line.content) + marker;
+    return line.segments
+      .map((seg) => {
+        const text = escapeHtml(seg.text);
+        if (seg.type === "add") return `<span class="word-add">${text}</span>`;
+        if (seg.type === "delete") return `<span class="word-del">${text}</span>`;
+        return text;
+      })
+      .join("") + marker;
+  }
+
   function escapeHtml(str) {
     if (!str) return "";
     return str
@@ -525,7 +874,7 @@
 
       if (commits && commits.length > 0) {
         for (const c of commits) {
-          const shortHash = c.hash.substring(0, 7);
+          const shortHash = c.shortHash || c.hash.substring(0, 7);
           const msg =
             c.message.length > 60
               ? c.message.substring(0, 57) + "..."
@@ -558,30 +907,152 @@
     }
   }
 
+  // selectRef selects ref in picker, adding it as an option if it isn't
+  // one of the listed commits (e.g. a branch name from a permalink).
+  function selectRef(picker, ref) {
+    if (!ref) return;
+    if (![...picker.options].some((opt) => opt.value === ref)) {
+      const opt = document.createElement("option");
+      opt.value = ref;
+      opt.textContent = ref;
+      picker.appendChild(opt);
+    }
+    picker.value = ref;
+  }
+
+  // updatePermalink puts the current refs and view mode in the address bar,
+  // so that the URL can be shared to open the same comparison.
+  function updatePermalink() {
+    const params = new URLSearchParams();
+    if (window.__MODE__ !== "batch") {
+      if (basePicker.value) params.set("base", basePicker.value);
+      if (targetPicker.value) params.set("target", targetPicker.value);
+    }
+    params.set("mode", viewMode);
+    history.replaceState(null, "", `${location.pathname}?${params}`);
+    saveSession();
+  }
+
+  // saveSession records the view in the --session file, if any, so that
+  // the next ghdiff started with it resumes here.
+  function saveSession() {
+    if (!sessionEnabled) return;
+    fetch("/api/session", {
+      method: "POST",
+      headers: { ...authHeaders, "Content-Type": "application/json" },
+      body: JSON.stringify({
+        base: basePicker.value,
+        target: targetPicker.value,
+        mode: viewMode,
+        file: activeFile || "",
+      }),
+    }).catch(() => {}); // losing a save only loses the resume point
+  }
+
+  // restoreSession returns to the file viewed when the --session file was
+  // last saved. The server already resumed the refs.
+  async function restoreSession() {
+    const resp = await fetch("/api/session", { headers: authHeaders });
+    if (!resp.ok) return; // no --session
+    const session = await resp.json();
+    sessionEnabled = true;
+    if (session.file && document.getElementById(`file-${cssId(session.file)}`)) {
+      setActiveTreeFile(session.file);
+      scrollToFile(session.file);
+    }
+  }
+
+  // populateBatch fills the base picker with the --commits-file entries
+  // and hides the target picker, which doesn't apply.
+  async function populateBatch() {
+    const entries = await fetchBatch();
+    basePicker.innerHTML = "";
+    for (const entry of entries) {
+      const opt = document.createElement("option");
+      opt.value = entry.id;
+      opt.textContent = `${entry.id + 1}/${entries.length}  ${entry.label}`;
+      basePicker.appendChild(opt);
+    }
+    basePicker.setAttribute("aria-label", "Select commit to review");
+    document.querySelector(".ref-separator").style.display = "none";
+    targetPicker.style.display = "none";
+  }
+
   // --- Event Listeners ---
 
   btnSplit.addEventListener("click", () => toggleViewMode("split"));
   btnUnified.addEventListener("click", () => toggleViewMode("unified"));
 
   for (const picker of [basePicker, targetPicker]) {
-    picker.addEventListener("change", loadDiff);
+    picker.addEventListener("change", () => {
+      updatePermalink();
+      loadDiff();
+    });
   }
 
   // --- Init ---
 
   async function init() {
+    btnSplit.classList.toggle("active", viewMode === "split");
+    btnUnified.classList.toggle("active", viewMode === "unified");
     showLoading();
 
-    // Fetch commits and diff in parallel
+    if (window.__MODE__ === "range-diff") {
+      // Ref pickers and view toggle don't apply to commit pairs
+      for (const el of document.querySelectorAll(".top-bar > div")) {
+        el.style.visibility = "hidden";
+      }
+      try {
+        renderRangeDiff(await fetchRangeDiff());
+      } catch (err) {
+        showError(`Failed to load range-diff: ${err.message}`);
+      }
+      return;
+    }
+
+    if (window.__MODE__ === "history" || window.__MODE__ === "mbox") {
+      // The range and path, or the patch series, are fixed on the command line
+      document.querySelector(".top-bar-left").style.visibility = "hidden";
+      try {
+        currentHistory = await fetchHistory();
+        renderHistory(currentHistory);
+      } catch (err) {
+        showError(`Failed to load history: ${err.message}`);
+      }
+      return;
+    }
+
+    if (window.__MODE__ === "batch") {
+      try {
+        await populateBatch();
+      } catch (err) {
+        showError(err.message);
+        return;
+      }
+      await loadDiff();
+      return;
+    }
+
+    if (window.__MODE__ === "merge-base") {
+      showAheadBehind();
+    }
+
+    // Fetch commits and diff in parallel, starting on a permalink's refs
+    const base = window.__BASE__ || undefined;
+    const target = window.__TARGET__ || undefined;
     const [, diffResult] = await Promise.allSettled([
-      populateCommits(),
-      fetchDiff(),
+      populateCommits().then(() => {
+        selectRef(basePicker, base);
+        selectRef(targetPicker, target);
+      }),
+      fetchDiff(base, target),
     ]);
 
     if (diffResult.status === "fulfilled") {
       currentFiles = diffResult.value.files || [];
       renderFileTree(currentFiles);
       renderDiffContent(currentFiles);
+      restoreSession().catch(() => {});
     } else {
       showError(`Failed to load diff: ${diffResult.reason?.message || "Unknown error"}`);
     }